@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/job"
+	"github.com/MuxiKeStack/bff/pkg/diag"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
+	"github.com/MuxiKeStack/bff/webhook"
+)
+
+type App struct {
+	server *ginx.Server
+	// 诊断用的管理端口
+	admin *diag.Server
+	// 下面三个是后台循环，在 main 里启动，进程退出时取消
+	// 邮件摘要的定时任务
+	digest *job.Digest
+	// webhook 的投递和重试
+	webhooks *webhook.Dispatcher
+	// feed 实时推送的跨实例广播
+	feedHub *pubsub.Hub
+	// 在后台消费 kafka，standalone 模式没有
+	consumers []events.Consumer
+}
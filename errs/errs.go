@@ -3,6 +3,12 @@ package errs
 const (
 	// InternalServerError 一个非常含糊的错误码。代表系统内部错误
 	InternalServerError = 500001
+	// Timeout 请求的时间预算用完了，可能是某个下游太慢，前端可以提示稍后重试
+	Timeout = 500002
+	// Maintenance 系统维护中，只读模式下的写接口和全站维护时的所有接口都会返回这个
+	Maintenance = 500003
+	// RequestInProgress 带着同一个 Idempotency-Key 的请求还在处理中
+	RequestInProgress = 500004
 )
 
 // User 部分，模块代码使用 01
@@ -61,3 +67,29 @@ const (
 )
 
 const FeedInvalidInput = 411001
+
+// Admin 管理接口，功能开关、维护模式等
+const (
+	AdminInvalidInput     = 412001
+	AdminPermissionDenied = 412002
+	// AdminNotFound webhook 或者投递记录不存在
+	AdminNotFound = 412003
+	// AdminQueueFull webhook 投递队列满了
+	AdminQueueFull = 412004
+)
+
+const BatchInvalidInput = 413001
+
+// GraphQLInvalidQuery 查询本身有问题：语法错误、字段不存在、超出深度或者复杂度限制
+const GraphQLInvalidQuery = 414001
+
+// Email 邮件通知：绑定邮箱和邮件摘要
+const (
+	EmailInvalidInput = 415001
+	// EmailTooFrequent 验证码发得太频繁
+	EmailTooFrequent = 415002
+	// EmailCodeInvalid 验证码不对、过期了，或者错的次数太多
+	EmailCodeInvalid = 415003
+	// EmailNotBound 开邮件摘要之前要先绑定邮箱
+	EmailNotBound = 415004
+)
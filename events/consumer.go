@@ -0,0 +1,253 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/IBM/sarama"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Consumer 启动后在后台消费，Start 只返回启动时的错误
+type Consumer interface {
+	Start() error
+}
+
+// Handler 处理一个事件。返回错误时这条消息不会提交，隔一段时间重新处理，直到成功、分区被分给别的实例，
+// 或者重试超过 ConsumerConfig.MaxRetryTime 转到死信 topic；
+// 解不出来的事件（ErrUnknownEventType、ErrUnsupportedVersion）重试也没用，打日志之后跳过
+type Handler func(ctx context.Context, env Envelope) error
+
+// Subscription BFF 自己订阅的事件。Name 决定消费组，多个实例时每个事件只会被其中一个实例处理
+type Subscription struct {
+	Name    string
+	Types   []string
+	Handler Handler
+}
+
+// Matches 订阅了 env 的类型
+func (s Subscription) Matches(env Envelope) bool {
+	return slices.Contains(s.Types, env.Type)
+}
+
+type ConsumerConfig struct {
+	// MaxRetryTime 一条消息最多重试多久，超过之后转到死信 topic 再提交，这个分区后面的消息才能接着处理
+	MaxRetryTime time.Duration `yaml:"maxRetryTime"`
+}
+
+// 死信消息的请求头，原来的请求头原样保留
+const (
+	HeaderDeadLetterTopic     = "x-dead-letter-topic"
+	HeaderDeadLetterPartition = "x-dead-letter-partition"
+	HeaderDeadLetterOffset    = "x-dead-letter-offset"
+	HeaderDeadLetterError     = "x-dead-letter-error"
+)
+
+const (
+	retryMinBackoff = time.Second
+	retryMaxBackoff = time.Minute
+)
+
+var (
+	lagGauge        *prometheus.GaugeVec
+	stuckGauge      *prometheus.GaugeVec
+	deadLetterCount *prometheus.CounterVec
+)
+
+// InitMetrics 每个分区的 lag、当前消息已经重试了多少秒（0 是没在重试），以及转到死信的消息数
+func InitMetrics(namespace, subsystem string) {
+	labels := []string{"subscription", "topic", "partition"}
+	lagGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "consumer_lag",
+		Help:      "分区里还没处理的消息数",
+	}, labels)
+	stuckGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "consumer_stuck_seconds",
+		Help:      "分区当前的消息已经重试了多少秒，一直涨说明分区卡住了",
+	}, labels)
+	deadLetterCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "consumer_dead_letter",
+		Help:      "重试超时放弃的消息数，配置了死信时转到死信 topic",
+	}, labels)
+	prometheus.MustRegister(lagGauge, stuckGauge, deadLetterCount)
+}
+
+// DeadLetterTopic 订阅 name 处理不了的消息转到这个 topic，原样保留 key、value 和请求头
+func DeadLetterTopic(name string) string {
+	return "kstack_bff_" + name + "_dead_letter"
+}
+
+// SaramaConsumer 在消费组 kstack_bff_{name} 里消费订阅的事件类型对应的 topic
+type SaramaConsumer struct {
+	client sarama.Client
+	// deadLetter 为 nil 时重试超时的消息打日志之后跳过
+	deadLetter sarama.SyncProducer
+	sub        Subscription
+	cfg        ConsumerConfig
+	l          logger.Logger
+	// 处理失败之后第一次重试的间隔，之后每次翻倍，最多 retryMaxBackoff
+	backoff time.Duration
+}
+
+func NewSaramaConsumer(client sarama.Client, deadLetter sarama.SyncProducer, sub Subscription,
+	cfg ConsumerConfig, l logger.Logger) *SaramaConsumer {
+	return &SaramaConsumer{client: client, deadLetter: deadLetter, sub: sub, cfg: cfg, l: l, backoff: retryMinBackoff}
+}
+
+func (c *SaramaConsumer) Start() error {
+	topics := make([]string, 0, len(c.sub.Types))
+	for _, name := range c.sub.Types {
+		t, ok := Lookup(name)
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownEventType, name)
+		}
+		if t.Raw {
+			return fmt.Errorf("%s 没有信封，不能订阅", name)
+		}
+		topics = append(topics, t.Topic)
+	}
+	cg, err := sarama.NewConsumerGroupFromClient("kstack_bff_"+c.sub.Name, c.client)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			// 每次 rebalance 之后 Consume 都会返回，要重新调用
+			er := cg.Consume(context.Background(), topics, c)
+			if errors.Is(er, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			if er != nil {
+				c.l.Error("消费事件出错", logger.String("subscription", c.sub.Name), logger.Error(er))
+				time.Sleep(time.Second)
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *SaramaConsumer) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (c *SaramaConsumer) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 一条处理成功（或者确定处理不了）之后才提交，再处理下一条。
+// offset 是按分区顺序提交的，失败的消息不能跳过，不然提交后面的消息时会把它一起提交掉
+func (c *SaramaConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for msg := range claim.Messages() {
+		if lagGauge != nil {
+			lagGauge.WithLabelValues(c.labels(msg)...).Set(float64(claim.HighWaterMarkOffset() - msg.Offset - 1))
+		}
+		if !c.handle(session.Context(), msg) {
+			// 分区被收回了，不提交，由接手的实例重新处理
+			return nil
+		}
+		session.MarkMessage(msg, "")
+	}
+	return nil
+}
+
+// handle 失败时重试到 cfg.MaxRetryTime 再转死信，ctx 结束时返回 false
+func (c *SaramaConsumer) handle(ctx context.Context, msg *sarama.ConsumerMessage) bool {
+	var env Envelope
+	if err := json.Unmarshal(msg.Value, &env); err != nil {
+		c.logSkip(msg, err)
+		return true
+	}
+	backoff := c.backoff
+	start := time.Now()
+	defer c.setStuck(msg, 0)
+	for {
+		err := c.sub.Handler(ctx, env)
+		switch {
+		case err == nil:
+			return true
+		case errors.Is(err, ErrUnknownEventType) || errors.Is(err, ErrUnsupportedVersion):
+			c.logSkip(msg, err)
+			return true
+		}
+		retried := time.Since(start)
+		c.setStuck(msg, retried)
+		if c.cfg.MaxRetryTime > 0 && retried >= c.cfg.MaxRetryTime {
+			er := c.sendDeadLetter(msg, err)
+			if er == nil {
+				return true
+			}
+			// 死信也发不出去，只能接着重试，下次失败再发
+			c.l.Error("转死信失败", logger.String("subscription", c.sub.Name), logger.Error(er),
+				logger.String("topic", msg.Topic), logger.Int64("offset", msg.Offset))
+		}
+		c.l.Error("处理事件失败，稍后重试", logger.String("subscription", c.sub.Name), logger.Error(err),
+			logger.String("topic", msg.Topic), logger.Int64("offset", msg.Offset), logger.String("backoff", backoff.String()))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, retryMaxBackoff)
+	}
+}
+
+// sendDeadLetter 没配死信时打日志跳过
+func (c *SaramaConsumer) sendDeadLetter(msg *sarama.ConsumerMessage, cause error) error {
+	if c.deadLetter != nil {
+		headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+4)
+		for _, h := range msg.Headers {
+			headers = append(headers, *h)
+		}
+		headers = append(headers,
+			sarama.RecordHeader{Key: []byte(HeaderDeadLetterTopic), Value: []byte(msg.Topic)},
+			sarama.RecordHeader{Key: []byte(HeaderDeadLetterPartition), Value: []byte(strconv.FormatInt(int64(msg.Partition), 10))},
+			sarama.RecordHeader{Key: []byte(HeaderDeadLetterOffset), Value: []byte(strconv.FormatInt(msg.Offset, 10))},
+			sarama.RecordHeader{Key: []byte(HeaderDeadLetterError), Value: []byte(cause.Error())},
+		)
+		_, _, err := c.deadLetter.SendMessage(&sarama.ProducerMessage{
+			Topic:   DeadLetterTopic(c.sub.Name),
+			Key:     sarama.ByteEncoder(msg.Key),
+			Value:   sarama.ByteEncoder(msg.Value),
+			Headers: headers,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if deadLetterCount != nil {
+		deadLetterCount.WithLabelValues(c.labels(msg)...).Inc()
+	}
+	msgText := "事件重试超时，转到死信"
+	if c.deadLetter == nil {
+		msgText = "事件重试超时，没有配置死信，跳过"
+	}
+	c.l.Error(msgText, logger.String("subscription", c.sub.Name), logger.Error(cause),
+		logger.String("topic", msg.Topic), logger.Int64("offset", msg.Offset))
+	return nil
+}
+
+func (c *SaramaConsumer) setStuck(msg *sarama.ConsumerMessage, d time.Duration) {
+	if stuckGauge != nil {
+		stuckGauge.WithLabelValues(c.labels(msg)...).Set(d.Seconds())
+	}
+}
+
+func (c *SaramaConsumer) labels(msg *sarama.ConsumerMessage) []string {
+	return []string{c.sub.Name, msg.Topic, strconv.FormatInt(int64(msg.Partition), 10)}
+}
+
+func (c *SaramaConsumer) logSkip(msg *sarama.ConsumerMessage, err error) {
+	c.l.Error("事件处理不了，跳过", logger.String("subscription", c.sub.Name), logger.Error(err),
+		logger.String("topic", msg.Topic), logger.Int64("offset", msg.Offset))
+}
@@ -0,0 +1,251 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testSession 只实现 ConsumeClaim 用到的方法，记下提交的 offset
+type testSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *testSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	msgs chan *sarama.ConsumerMessage
+}
+
+func (c testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.msgs
+}
+
+func (c testClaim) HighWaterMarkOffset() int64 {
+	return int64(cap(c.msgs))
+}
+
+func newTestClaim(t *testing.T, values ...[]byte) testClaim {
+	t.Helper()
+	msgs := make(chan *sarama.ConsumerMessage, len(values))
+	for i, v := range values {
+		msgs <- &sarama.ConsumerMessage{Topic: "question_published_event", Offset: int64(i), Value: v}
+	}
+	close(msgs)
+	return testClaim{msgs: msgs}
+}
+
+func newTestMessage(t *testing.T, content string) []byte {
+	t.Helper()
+	env, err := NewEnvelope(1, QuestionPublished{Content: content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestConsumeClaimRetry(t *testing.T) {
+	// 第一条失败两次之后成功
+	var calls []string
+	handler := func(ctx context.Context, env Envelope) error {
+		evt, err := Decode[QuestionPublished](env)
+		if err != nil {
+			return err
+		}
+		calls = append(calls, evt.Content)
+		if evt.Content == "a" && len(calls) < 3 {
+			return errors.New("redis 挂了")
+		}
+		return nil
+	}
+	c := NewSaramaConsumer(nil, nil, Subscription{Name: "test", Handler: handler}, ConsumerConfig{}, logger.NewNopLogger())
+	c.backoff = time.Millisecond
+	session := &testSession{ctx: context.Background()}
+	claim := newTestClaim(t, newTestMessage(t, "a"), newTestMessage(t, "b"))
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(calls, []string{"a", "a", "a", "b"}) {
+		t.Fatalf("处理顺序 = %v，失败的消息应该重试成功之后才处理下一条", calls)
+	}
+	if !slices.Equal(session.marked, []int64{0, 1}) {
+		t.Fatalf("提交的 offset = %v，期望 [0 1]", session.marked)
+	}
+}
+
+func TestConsumeClaimStopWithoutMark(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := func(ctx context.Context, env Envelope) error {
+		// 分区在重试的时候被收回
+		cancel()
+		return errors.New("redis 挂了")
+	}
+	c := NewSaramaConsumer(nil, nil, Subscription{Name: "test", Handler: handler}, ConsumerConfig{}, logger.NewNopLogger())
+	session := &testSession{ctx: ctx}
+	if err := c.ConsumeClaim(session, newTestClaim(t, newTestMessage(t, "a"), newTestMessage(t, "b"))); err != nil {
+		t.Fatal(err)
+	}
+	if len(session.marked) != 0 {
+		t.Fatalf("处理失败的消息不应该提交，实际提交了 %v", session.marked)
+	}
+}
+
+func TestConsumeClaimSkip(t *testing.T) {
+	handler := func(ctx context.Context, env Envelope) error {
+		_, err := Decode[QuestionPublished](env)
+		return err
+	}
+	c := NewSaramaConsumer(nil, nil, Subscription{Name: "test", Handler: handler}, ConsumerConfig{}, logger.NewNopLogger())
+	session := &testSession{ctx: context.Background()}
+	newer := newTestMessage(t, "a")
+	var env Envelope
+	_ = json.Unmarshal(newer, &env)
+	env.Version = 99
+	newer, _ = json.Marshal(env)
+	claim := newTestClaim(t, []byte("不是 json"), newer, newTestMessage(t, "b"))
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	// 解不出来的事件重试也没用，直接跳过
+	if !slices.Equal(session.marked, []int64{0, 1, 2}) {
+		t.Fatalf("提交的 offset = %v，期望 [0 1 2]", session.marked)
+	}
+}
+
+// testSyncProducer 前 fails 次发送失败，记下发出去的死信
+type testSyncProducer struct {
+	sarama.SyncProducer
+	fails int
+	sent  []*sarama.ProducerMessage
+}
+
+func (p *testSyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if p.fails > 0 {
+		p.fails--
+		return 0, 0, errors.New("kafka 挂了")
+	}
+	p.sent = append(p.sent, msg)
+	return 0, int64(len(p.sent) - 1), nil
+}
+
+func TestConsumeClaimDeadLetter(t *testing.T) {
+	testCases := []struct {
+		name       string
+		deadLetter *testSyncProducer
+		// 第一条消息处理了几次
+		wantCalls int
+		wantSent  int
+	}{
+		{name: "超时转死信", deadLetter: &testSyncProducer{}, wantCalls: 2, wantSent: 1},
+		{name: "死信发送失败接着重试", deadLetter: &testSyncProducer{fails: 1}, wantCalls: 3, wantSent: 1},
+		{name: "没有配置死信直接跳过", wantCalls: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := 0
+			handler := func(ctx context.Context, env Envelope) error {
+				evt, err := Decode[QuestionPublished](env)
+				if err != nil {
+					return err
+				}
+				if evt.Content == "a" {
+					calls++
+					return errors.New("redis 挂了")
+				}
+				return nil
+			}
+			var deadLetter sarama.SyncProducer
+			if tc.deadLetter != nil {
+				deadLetter = tc.deadLetter
+			}
+			c := NewSaramaConsumer(nil, deadLetter, Subscription{Name: "test", Handler: handler},
+				ConsumerConfig{MaxRetryTime: 5 * time.Millisecond}, logger.NewNopLogger())
+			c.backoff = 5 * time.Millisecond
+			session := &testSession{ctx: context.Background()}
+			claim := newTestClaim(t, newTestMessage(t, "a"), newTestMessage(t, "b"))
+			if err := c.ConsumeClaim(session, claim); err != nil {
+				t.Fatal(err)
+			}
+			if calls != tc.wantCalls {
+				t.Fatalf("第一条处理了 %d 次，期望 %d 次", calls, tc.wantCalls)
+			}
+			// 放弃之后后面的消息要接着处理
+			if !slices.Equal(session.marked, []int64{0, 1}) {
+				t.Fatalf("提交的 offset = %v，期望 [0 1]", session.marked)
+			}
+			if tc.deadLetter == nil {
+				return
+			}
+			if len(tc.deadLetter.sent) != tc.wantSent {
+				t.Fatalf("发了 %d 条死信，期望 %d 条", len(tc.deadLetter.sent), tc.wantSent)
+			}
+			msg := tc.deadLetter.sent[0]
+			if msg.Topic != "kstack_bff_test_dead_letter" {
+				t.Fatalf("死信 topic = %s", msg.Topic)
+			}
+			headers := map[string]string{}
+			for _, h := range msg.Headers {
+				headers[string(h.Key)] = string(h.Value)
+			}
+			if headers[HeaderDeadLetterTopic] != "question_published_event" || headers[HeaderDeadLetterOffset] != "0" ||
+				headers[HeaderDeadLetterError] != "redis 挂了" {
+				t.Fatalf("死信请求头 = %v", headers)
+			}
+		})
+	}
+}
+
+func TestConsumeClaimMetrics(t *testing.T) {
+	InitMetrics("test", "events")
+	handler := func(ctx context.Context, env Envelope) error {
+		evt, err := Decode[QuestionPublished](env)
+		if err != nil {
+			return err
+		}
+		if evt.Content == "a" {
+			// 第一条处理的时候后面还有 2 条没处理
+			if lag := testutil.ToFloat64(lagGauge.WithLabelValues("test", "question_published_event", "0")); lag != 2 {
+				t.Errorf("lag = %v，期望 2", lag)
+			}
+			return errors.New("redis 挂了")
+		}
+		return nil
+	}
+	c := NewSaramaConsumer(nil, nil, Subscription{Name: "test", Handler: handler},
+		ConsumerConfig{MaxRetryTime: 5 * time.Millisecond}, logger.NewNopLogger())
+	c.backoff = 5 * time.Millisecond
+	session := &testSession{ctx: context.Background()}
+	claim := newTestClaim(t, newTestMessage(t, "a"), newTestMessage(t, "b"), newTestMessage(t, "c"))
+	if err := c.ConsumeClaim(session, claim); err != nil {
+		t.Fatal(err)
+	}
+	labels := []string{"test", "question_published_event", "0"}
+	if lag := testutil.ToFloat64(lagGauge.WithLabelValues(labels...)); lag != 0 {
+		t.Fatalf("处理完之后 lag = %v，期望 0", lag)
+	}
+	if stuck := testutil.ToFloat64(stuckGauge.WithLabelValues(labels...)); stuck != 0 {
+		t.Fatalf("处理完之后 stuck = %v，期望 0", stuck)
+	}
+	if n := testutil.ToFloat64(deadLetterCount.WithLabelValues(labels...)); n != 1 {
+		t.Fatalf("放弃了 %v 条，期望 1 条", n)
+	}
+}
@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	ErrUnknownEventType   = errors.New("没有注册的事件类型")
+	ErrUnsupportedVersion = errors.New("不支持的事件版本")
+)
+
+// Envelope 所有事件统一的信封，payload 的结构由 type 和 version 决定
+type Envelope struct {
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	Id      string `json:"id"`
+	// OccurredAt 毫秒时间戳
+	OccurredAt int64 `json:"occurred_at"`
+	// Actor 触发事件的用户，系统触发的是 0。匿名发布时也是真实的 uid，只在内部流转，webhook 里没有这个字段
+	Actor   int64           `json:"actor"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewEnvelope T 要先注册
+func NewEnvelope[T any](actor int64, payload T) (Envelope, error) {
+	t, ok := TypeOf[T]()
+	if !ok {
+		return Envelope{}, fmt.Errorf("%w: %s", ErrUnknownEventType, reflect.TypeFor[T]())
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		Type:       t.Name,
+		Version:    t.Version,
+		Id:         hex.EncodeToString(id),
+		OccurredAt: time.Now().UnixMilli(),
+		Actor:      actor,
+		Payload:    data,
+	}, nil
+}
+
+// Produce 装进信封然后发到注册时的 topic
+func Produce[T any](ctx context.Context, p Producer, actor int64, payload T) error {
+	env, err := NewEnvelope(actor, payload)
+	if err != nil {
+		return err
+	}
+	return p.Produce(ctx, env)
+}
+
+// Decode 取出 payload。比注册的版本新的事件解不了，旧版本按现在的结构解，缺的字段是零值
+func Decode[T any](env Envelope) (T, error) {
+	var payload T
+	t, ok := TypeOf[T]()
+	if !ok {
+		return payload, fmt.Errorf("%w: %s", ErrUnknownEventType, reflect.TypeFor[T]())
+	}
+	if env.Type != t.Name {
+		return payload, fmt.Errorf("事件类型是 %s，不是 %s", env.Type, t.Name)
+	}
+	if env.Version > t.Version {
+		return payload, fmt.Errorf("%w: %s 的版本 %d，只认识到 %d", ErrUnsupportedVersion, env.Type, env.Version, t.Version)
+	}
+	err := json.Unmarshal(env.Payload, &payload)
+	return payload, err
+}
@@ -3,37 +3,62 @@ package events
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/IBM/sarama"
+	"github.com/MuxiKeStack/bff/pkg/logger"
 )
 
-const topicShareGradeEvent = "share_grade_event"
-
-type ShareGradeEvent struct {
-	Uid       int64
-	StudentId string
-	Password  string
-}
+var ErrProducerBusy = errors.New("事件发送队列满了")
 
+// Producer 一般不直接调用，用 Produce[T]
 type Producer interface {
-	ProduceShareGradeEvent(ctx context.Context, evt ShareGradeEvent) error
+	Produce(ctx context.Context, env Envelope) error
 }
 
+// SaramaProducer 只把消息放进 sarama 的发送队列就返回，不等 kafka 确认。
+// 请求里发事件都是尽力而为，kafka 出问题时不能拖住请求，队列满了直接返回 ErrProducerBusy，发送失败只打日志
 type SaramaProducer struct {
-	producer sarama.SyncProducer
+	producer sarama.AsyncProducer
+	l        logger.Logger
 }
 
-func NewSaramaProducer(producer sarama.SyncProducer) *SaramaProducer {
-	return &SaramaProducer{producer: producer}
+func NewSaramaProducer(producer sarama.AsyncProducer, l logger.Logger) *SaramaProducer {
+	s := &SaramaProducer{producer: producer, l: l}
+	// Errors 不读的话发送会卡住，producer 关闭时这个循环跟着结束
+	go s.logErrors()
+	return s
 }
 
-func (s *SaramaProducer) ProduceShareGradeEvent(ctx context.Context, evt ShareGradeEvent) error {
-	data, err := json.Marshal(evt)
-	if err != nil {
+func (s *SaramaProducer) Produce(ctx context.Context, env Envelope) error {
+	t, ok := Lookup(env.Type)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownEventType, env.Type)
+	}
+	data := []byte(env.Payload)
+	if !t.Raw {
+		var err error
+		if data, err = json.Marshal(env); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-	_, _, err = s.producer.SendMessage(&sarama.ProducerMessage{
-		Topic: topicShareGradeEvent,
+	select {
+	case s.producer.Input() <- &sarama.ProducerMessage{
+		Topic: t.Topic,
+		Key:   sarama.StringEncoder(env.Id),
 		Value: sarama.ByteEncoder(data),
-	})
-	return err
+	}:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", ErrProducerBusy, env.Type)
+	}
+}
+
+func (s *SaramaProducer) logErrors() {
+	for err := range s.producer.Errors() {
+		s.l.Error("发送事件失败", logger.String("topic", err.Msg.Topic), logger.Error(err.Err))
+	}
 }
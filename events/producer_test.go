@@ -0,0 +1,52 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"github.com/IBM/sarama"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"testing"
+)
+
+// testAsyncProducer 发送队列只有一个位置，没有人取
+type testAsyncProducer struct {
+	sarama.AsyncProducer
+	input  chan *sarama.ProducerMessage
+	errors chan *sarama.ProducerError
+}
+
+func (p *testAsyncProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func (p *testAsyncProducer) Errors() <-chan *sarama.ProducerError {
+	return p.errors
+}
+
+func TestSaramaProducerProduce(t *testing.T) {
+	p := &testAsyncProducer{input: make(chan *sarama.ProducerMessage, 1), errors: make(chan *sarama.ProducerError)}
+	defer close(p.errors)
+	producer := NewSaramaProducer(p, logger.NewNopLogger())
+	env, err := NewEnvelope(1, QuestionPublished{Id: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = producer.Produce(ctx, env); !errors.Is(err, context.Canceled) {
+		t.Fatalf("ctx 已经取消应该返回 context.Canceled，实际是 %v", err)
+	}
+	if err = producer.Produce(context.Background(), env); err != nil {
+		t.Fatal(err)
+	}
+	msg := <-p.input
+	if msg.Topic != "question_published_event" {
+		t.Fatalf("topic = %s", msg.Topic)
+	}
+	p.input <- msg
+	// 队列满了不等，直接返回
+	if err = producer.Produce(context.Background(), env); !errors.Is(err, ErrProducerBusy) {
+		t.Fatalf("队列满了应该返回 ErrProducerBusy，实际是 %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// EventType 事件类型的元信息，每种 payload 在 types.go 里注册一次
+type EventType struct {
+	// Name 形如 evaluation.published，就是信封里的 type
+	Name string
+	// Version payload 的版本。只加字段不用升版本，删字段、改字段的类型或者含义才升
+	Version int
+	Topic   string
+	// Webhook 管理员能不能在 webhook 里订阅
+	Webhook bool
+	// Raw 只发 payload 不带信封，兼容还在按旧格式消费的服务，这种事件不能在 BFF 里订阅
+	Raw bool
+}
+
+var registry = struct {
+	sync.RWMutex
+	byName map[string]EventType
+	byType map[reflect.Type]EventType
+}{
+	byName: make(map[string]EventType),
+	byType: make(map[reflect.Type]EventType),
+}
+
+// Register 把 T 注册成一种事件，名字或者 T 重复注册会 panic
+func Register[T any](t EventType) {
+	typ := reflect.TypeFor[T]()
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.byName[t.Name]; ok {
+		panic(fmt.Sprintf("events: 重复注册的事件类型 %s", t.Name))
+	}
+	if _, ok := registry.byType[typ]; ok {
+		panic(fmt.Sprintf("events: %s 重复注册", typ))
+	}
+	registry.byName[t.Name] = t
+	registry.byType[typ] = t
+}
+
+// TypeOf T 注册成了哪种事件
+func TypeOf[T any]() (EventType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.byType[reflect.TypeFor[T]()]
+	return t, ok
+}
+
+func Lookup(name string) (EventType, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.byName[name]
+	return t, ok
+}
+
+// Types 所有注册过的事件类型，按名字排序
+func Types() []EventType {
+	registry.RLock()
+	res := make([]EventType, 0, len(registry.byName))
+	for _, t := range registry.byName {
+		res = append(res, t)
+	}
+	registry.RUnlock()
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// WebhookTypes webhook 能订阅的事件类型的名字，按名字排序
+func WebhookTypes() []string {
+	var res []string
+	for _, t := range Types() {
+		if t.Webhook {
+			res = append(res, t.Name)
+		}
+	}
+	return res
+}
@@ -0,0 +1,80 @@
+package events
+
+// 事件类型的名字，也是信封里的 type
+const (
+	TypeShareGrade          = "grade.share"
+	TypeEvaluationPublished = "evaluation.published"
+	TypeQuestionPublished   = "question.published"
+	// TypeAnswerPublished 问题有了新回答
+	TypeAnswerPublished = "answer.published"
+	TypeCommentCreated  = "comment.created"
+	TypeUserLogin       = "user.login"
+	// TypeFeedCreated feed 服务给用户产生了一条 feed 事件，BFF 消费之后推给在线的客户端
+	TypeFeedCreated = "feed.created"
+)
+
+func init() {
+	// grade 服务还在按没有信封的旧格式消费
+	Register[ShareGradeEvent](EventType{Name: TypeShareGrade, Version: 1, Topic: "share_grade_event", Raw: true})
+	Register[EvaluationPublished](EventType{Name: TypeEvaluationPublished, Version: 1, Topic: "evaluation_published_event", Webhook: true})
+	Register[QuestionPublished](EventType{Name: TypeQuestionPublished, Version: 1, Topic: "question_published_event", Webhook: true})
+	Register[AnswerPublished](EventType{Name: TypeAnswerPublished, Version: 1, Topic: "answer_published_event", Webhook: true})
+	Register[CommentCreated](EventType{Name: TypeCommentCreated, Version: 1, Topic: "comment_created_event"})
+	Register[UserLogin](EventType{Name: TypeUserLogin, Version: 1, Topic: "user_login_event"})
+	Register[FeedCreated](EventType{Name: TypeFeedCreated, Version: 1, Topic: "feed_created_event"})
+}
+
+type ShareGradeEvent struct {
+	Uid       int64
+	StudentId string
+	Password  string
+}
+
+// EvaluationPublished 匿名课评不带 publisher_id
+type EvaluationPublished struct {
+	Id          int64  `json:"id"`
+	CourseId    int64  `json:"course_id"`
+	PublisherId int64  `json:"publisher_id,omitempty"`
+	StarRating  int    `json:"star_rating"`
+	Content     string `json:"content"`
+}
+
+type QuestionPublished struct {
+	Id           int64  `json:"id"`
+	Biz          string `json:"biz"`
+	BizId        int64  `json:"biz_id"`
+	QuestionerId int64  `json:"questioner_id"`
+	Content      string `json:"content"`
+}
+
+type AnswerPublished struct {
+	Id          int64  `json:"id"`
+	QuestionId  int64  `json:"question_id"`
+	PublisherId int64  `json:"publisher_id"`
+	Content     string `json:"content"`
+}
+
+// CommentCreated 评论服务创建时不返回 id，root_id 和 parent_id 为 0 是一级评论
+type CommentCreated struct {
+	Biz           string `json:"biz"`
+	BizId         int64  `json:"biz_id"`
+	CommentatorId int64  `json:"commentator_id"`
+	RootId        int64  `json:"root_id"`
+	ParentId      int64  `json:"parent_id"`
+	Content       string `json:"content"`
+}
+
+// UserLogin 一站式登录成功，New 是第一次登录
+type UserLogin struct {
+	Uid int64 `json:"uid"`
+	New bool  `json:"new"`
+}
+
+// FeedCreated 由 feed 服务产生，带信封。Uid 是收到这条 feed 的用户，其余字段和 feedv1.FeedEvent 一样
+type FeedCreated struct {
+	Uid     int64             `json:"uid"`
+	Id      int64             `json:"id"`
+	Type    string            `json:"type"`
+	Content map[string]string `json:"content"`
+	Ctime   int64             `json:"ctime"`
+}
@@ -0,0 +1,96 @@
+package fakes
+
+import (
+	"context"
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	"google.golang.org/grpc"
+	"slices"
+	"sync"
+)
+
+type AnswerService struct {
+	answerv1.AnswerServiceClient
+	ids     idGen
+	mu      sync.RWMutex
+	answers []*answerv1.Answer
+}
+
+func NewAnswerService() *AnswerService {
+	return &AnswerService{}
+}
+
+func (s *AnswerService) Publish(ctx context.Context, in *answerv1.PublishRequest, opts ...grpc.CallOption) (*answerv1.PublishResponse, error) {
+	a := in.GetAnswer()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	na := &answerv1.Answer{
+		Id:          s.ids.next(),
+		PublisherId: a.GetPublisherId(),
+		QuestionId:  a.GetQuestionId(),
+		Content:     a.GetContent(),
+		Utime:       t,
+		Ctime:       t,
+	}
+	s.answers = append(s.answers, na)
+	return &answerv1.PublishResponse{AnswerId: na.Id}, nil
+}
+
+func (s *AnswerService) Detail(ctx context.Context, in *answerv1.DetailRequest, opts ...grpc.CallOption) (*answerv1.DetailResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.indexOf(in.GetAnswerId())
+	if idx < 0 {
+		return nil, answerv1.ErrorAnswerNotFound("回答不存在")
+	}
+	return &answerv1.DetailResponse{Answer: s.answers[idx]}, nil
+}
+
+func (s *AnswerService) ListForQuestion(ctx context.Context, in *answerv1.ListForQuestionRequest, opts ...grpc.CallOption) (*answerv1.ListForQuestionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	answers := filter(s.answers, func(a *answerv1.Answer) bool {
+		return a.QuestionId == in.GetQuestionId()
+	})
+	return &answerv1.ListForQuestionResponse{
+		Answers: pageDesc(answers, (*answerv1.Answer).GetId, in.GetCurAnswerId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *AnswerService) ListForUser(ctx context.Context, in *answerv1.ListForUserRequest, opts ...grpc.CallOption) (*answerv1.ListForUserResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	answers := filter(s.answers, func(a *answerv1.Answer) bool {
+		return a.PublisherId == in.GetUid()
+	})
+	return &answerv1.ListForUserResponse{
+		Answers: pageDesc(answers, (*answerv1.Answer).GetId, in.GetCurAnswerId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *AnswerService) CountForQuestion(ctx context.Context, in *answerv1.CountForQuestionRequest, opts ...grpc.CallOption) (*answerv1.CountForQuestionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	answers := filter(s.answers, func(a *answerv1.Answer) bool {
+		return a.QuestionId == in.GetQuestionId()
+	})
+	return &answerv1.CountForQuestionResponse{Cnt: int64(len(answers))}, nil
+}
+
+func (s *AnswerService) DelAnswerById(ctx context.Context, in *answerv1.DelAnswerByIdRequest, opts ...grpc.CallOption) (*answerv1.DelAnswerByIdResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.indexOf(in.GetAnswerId())
+	if idx < 0 || s.answers[idx].PublisherId != in.GetUid() {
+		return nil, answerv1.ErrorAnswerNotFound("回答不存在")
+	}
+	s.answers = slices.Delete(s.answers, idx, idx+1)
+	return &answerv1.DelAnswerByIdResponse{}, nil
+}
+
+// indexOf 调用方要持有锁
+func (s *AnswerService) indexOf(aid int64) int {
+	return slices.IndexFunc(s.answers, func(a *answerv1.Answer) bool {
+		return a.Id == aid
+	})
+}
@@ -0,0 +1,54 @@
+package fakes
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
+	"path"
+	"sync"
+)
+
+// Broker 进程内的 pubsub.Broker，standalone 只有一个实例，广播就是直接转给本进程的订阅者
+type Broker struct {
+	mu   sync.RWMutex
+	subs map[*brokerSub]struct{}
+}
+
+type brokerSub struct {
+	pattern string
+	ch      chan pubsub.Message
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*brokerSub]struct{})}
+}
+
+func (b *Broker) Publish(ctx context.Context, channel string, payload []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		if ok, _ := path.Match(sub.pattern, channel); !ok {
+			continue
+		}
+		select {
+		case sub.ch <- pubsub.Message{Channel: channel, Payload: payload}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (b *Broker) Subscribe(ctx context.Context, pattern string) (<-chan pubsub.Message, error) {
+	sub := &brokerSub{pattern: pattern, ch: make(chan pubsub.Message, 64)}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		b.mu.Lock()
+		delete(b.subs, sub)
+		b.mu.Unlock()
+		close(sub.ch)
+	}()
+	return sub.ch, nil
+}
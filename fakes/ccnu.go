@@ -0,0 +1,44 @@
+package fakes
+
+import (
+	"context"
+	ccnuv1 "github.com/MuxiKeStack/be-api/gen/proto/ccnu/v1"
+	"google.golang.org/grpc"
+)
+
+// CCNUService 不去教务系统，任何学号和非空密码都能登录
+type CCNUService struct {
+	ccnuv1.CCNUServiceClient
+}
+
+func NewCCNUService() *CCNUService {
+	return &CCNUService{}
+}
+
+func (s *CCNUService) Login(ctx context.Context, in *ccnuv1.LoginRequest, opts ...grpc.CallOption) (*ccnuv1.LoginResponse, error) {
+	if in.GetStudentId() == "" || in.GetPassword() == "" {
+		return nil, ccnuv1.ErrorInvalidSidOrPwd("学号或密码错误")
+	}
+	return &ccnuv1.LoginResponse{Success: true}, nil
+}
+
+func (s *CCNUService) GetGrades(ctx context.Context, in *ccnuv1.GetGradesRequest, opts ...grpc.CallOption) (*ccnuv1.GetGradesResponse, error) {
+	if in.GetStudentId() == "" || in.GetPassword() == "" {
+		return nil, ccnuv1.ErrorInvalidSidOrPwd("学号或密码错误")
+	}
+	res := &ccnuv1.GetGradesResponse{}
+	if (in.GetYear() != "" && in.GetYear() != seedYear) || (in.GetTerm() != "" && in.GetTerm() != seedTerm) {
+		return res, nil
+	}
+	for _, c := range seedCourses {
+		res.Grades = append(res.Grades, &ccnuv1.Grade{
+			Year:    seedYear,
+			Term:    seedTerm,
+			Title:   c.Name,
+			Regular: 90,
+			Final:   80,
+			Total:   84,
+		})
+	}
+	return res, nil
+}
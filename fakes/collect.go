@@ -0,0 +1,77 @@
+package fakes
+
+import (
+	"context"
+	collectv1 "github.com/MuxiKeStack/be-api/gen/proto/collect/v1"
+	"google.golang.org/grpc"
+	"slices"
+	"sync"
+)
+
+type CollectService struct {
+	collectv1.CollectServiceClient
+	ids         idGen
+	mu          sync.RWMutex
+	collections []*collectv1.Collection
+}
+
+func NewCollectService() *CollectService {
+	return &CollectService{}
+}
+
+func (s *CollectService) AddCollection(ctx context.Context, in *collectv1.AddCollectionRequest, opts ...grpc.CallOption) (*collectv1.AddCollectionResponse, error) {
+	c := in.GetCollection()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 重复收藏不报错
+	if s.indexOf(c.GetUid(), c.GetBiz(), c.GetBizId()) < 0 {
+		s.collections = append(s.collections, &collectv1.Collection{
+			Id:    s.ids.next(),
+			Uid:   c.GetUid(),
+			Biz:   c.GetBiz(),
+			BizId: c.GetBizId(),
+		})
+	}
+	return &collectv1.AddCollectionResponse{}, nil
+}
+
+func (s *CollectService) RemoveCollection(ctx context.Context, in *collectv1.RemoveCollectionRequest, opts ...grpc.CallOption) (*collectv1.RemoveCollectionResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if idx := s.indexOf(in.GetUid(), in.GetBiz(), in.GetBizId()); idx >= 0 {
+		s.collections = slices.Delete(s.collections, idx, idx+1)
+	}
+	return &collectv1.RemoveCollectionResponse{}, nil
+}
+
+func (s *CollectService) CheckCollection(ctx context.Context, in *collectv1.CheckCollectionRequest, opts ...grpc.CallOption) (*collectv1.CheckCollectionResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &collectv1.CheckCollectionResponse{IsCollected: s.indexOf(in.GetUid(), in.GetBiz(), in.GetBizId()) >= 0}, nil
+}
+
+func (s *CollectService) ListCollections(ctx context.Context, in *collectv1.ListCollectionsRequest, opts ...grpc.CallOption) (*collectv1.ListCollectionsResponse, error) {
+	return &collectv1.ListCollectionsResponse{
+		Collections: pageDesc(s.mine(in.GetUid(), in.GetBiz()), (*collectv1.Collection).GetId, in.GetCurCollectionId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *CollectService) CountCollections(ctx context.Context, in *collectv1.CountCollectionsRequest, opts ...grpc.CallOption) (*collectv1.CountCollectionsResponse, error) {
+	return &collectv1.CountCollectionsResponse{TotalCount: int64(len(s.mine(in.GetUid(), in.GetBiz())))}, nil
+}
+
+// mine 用户某类资源的所有收藏，按 id 升序，搜索收藏也要用
+func (s *CollectService) mine(uid int64, biz collectv1.Biz) []*collectv1.Collection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return filter(s.collections, func(c *collectv1.Collection) bool {
+		return c.Uid == uid && c.Biz == biz
+	})
+}
+
+// indexOf 调用方要持有锁
+func (s *CollectService) indexOf(uid int64, biz collectv1.Biz, bizId int64) int {
+	return slices.IndexFunc(s.collections, func(c *collectv1.Collection) bool {
+		return c.Uid == uid && c.Biz == biz && c.BizId == bizId
+	})
+}
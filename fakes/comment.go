@@ -0,0 +1,121 @@
+package fakes
+
+import (
+	"context"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	"google.golang.org/grpc"
+	"slices"
+	"sync"
+)
+
+type CommentService struct {
+	commentv1.CommentServiceClient
+	ids      idGen
+	mu       sync.RWMutex
+	comments []*commentv1.Comment
+}
+
+func NewCommentService() *CommentService {
+	return &CommentService{}
+}
+
+func (s *CommentService) CreateComment(ctx context.Context, in *commentv1.CreateCommentRequest, opts ...grpc.CallOption) (*commentv1.CreateCommentResponse, error) {
+	c := in.GetComment()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	nc := &commentv1.Comment{
+		Id:            s.ids.next(),
+		CommentatorId: c.GetCommentatorId(),
+		Biz:           c.GetBiz(),
+		BizId:         c.GetBizId(),
+		Content:       c.GetContent(),
+		Utime:         t,
+		Ctime:         t,
+	}
+	// 和评论服务一样，根据 rid、pid 来决定回复的是谁，0 表示没有
+	if rid := c.GetRootComment().GetId(); rid > 0 {
+		root, ok := s.find(rid)
+		if !ok {
+			return nil, commentv1.ErrorCommentNotFound("根评论不存在")
+		}
+		nc.RootComment = &commentv1.Comment{Id: rid}
+		nc.ReplyToUid = root.CommentatorId
+	}
+	if pid := c.GetParentComment().GetId(); pid > 0 {
+		parent, ok := s.find(pid)
+		if !ok {
+			return nil, commentv1.ErrorCommentNotFound("父评论不存在")
+		}
+		nc.ParentComment = &commentv1.Comment{Id: pid}
+		nc.ReplyToUid = parent.CommentatorId
+	}
+	s.comments = append(s.comments, nc)
+	return &commentv1.CreateCommentResponse{}, nil
+}
+
+func (s *CommentService) GetCommentList(ctx context.Context, in *commentv1.CommentListRequest, opts ...grpc.CallOption) (*commentv1.CommentListResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	comments := filter(s.comments, func(c *commentv1.Comment) bool {
+		return c.Biz == in.GetBiz() && c.BizId == in.GetBizId() && c.RootComment == nil
+	})
+	return &commentv1.CommentListResponse{
+		Comments: pageDesc(comments, (*commentv1.Comment).GetId, in.GetCurCommentId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *CommentService) GetMoreReplies(ctx context.Context, in *commentv1.GetMoreRepliesRequest, opts ...grpc.CallOption) (*commentv1.GetMoreRepliesResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	replies := filter(s.comments, func(c *commentv1.Comment) bool {
+		return c.GetRootComment().GetId() == in.GetRid()
+	})
+	return &commentv1.GetMoreRepliesResponse{
+		Replies: pageDesc(replies, (*commentv1.Comment).GetId, in.GetCurCommentId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *CommentService) CountComment(ctx context.Context, in *commentv1.CountCommentRequest, opts ...grpc.CallOption) (*commentv1.CountCommentResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	comments := filter(s.comments, func(c *commentv1.Comment) bool {
+		return c.Biz == in.GetBiz() && c.BizId == in.GetBizId()
+	})
+	return &commentv1.CountCommentResponse{Count: int64(len(comments))}, nil
+}
+
+func (s *CommentService) DeleteComment(ctx context.Context, in *commentv1.DeleteCommentRequest, opts ...grpc.CallOption) (*commentv1.DeleteCommentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.find(in.GetCommentId())
+	if !ok || c.CommentatorId != in.GetUid() {
+		return nil, commentv1.ErrorCommentNotFound("评论不存在")
+	}
+	// 删根评论会把它下面的回复一起删掉
+	s.comments = slices.DeleteFunc(s.comments, func(e *commentv1.Comment) bool {
+		return e.Id == c.Id || e.GetRootComment().GetId() == c.Id
+	})
+	return &commentv1.DeleteCommentResponse{}, nil
+}
+
+func (s *CommentService) GetComment(ctx context.Context, in *commentv1.GetCommentRequest, opts ...grpc.CallOption) (*commentv1.GetCommentResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c, ok := s.find(in.GetCommentId())
+	if !ok {
+		return nil, commentv1.ErrorCommentNotFound("评论不存在")
+	}
+	return &commentv1.GetCommentResponse{Comment: c}, nil
+}
+
+// find 调用方要持有锁
+func (s *CommentService) find(id int64) (*commentv1.Comment, bool) {
+	idx := slices.IndexFunc(s.comments, func(c *commentv1.Comment) bool {
+		return c.Id == id
+	})
+	if idx < 0 {
+		return nil, false
+	}
+	return s.comments[idx], true
+}
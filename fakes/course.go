@@ -0,0 +1,69 @@
+package fakes
+
+import (
+	"context"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	"google.golang.org/grpc"
+)
+
+// seedCourses standalone 模式下的课程数据，课程服务的数据来自教务系统，这里没法凭空造，只能写死几门。
+// 课程性质直接用枚举值，名字以 be-api 为准
+var seedCourses = []*coursev1.Course{
+	{Id: 1, Name: "高等数学A", Teacher: "张三", School: "数学与统计学学院", Property: coursev1.CourseProperty(1), Credit: 5},
+	{Id: 2, Name: "大学英语", Teacher: "李四", School: "外国语学院", Property: coursev1.CourseProperty(1), Credit: 2},
+	{Id: 3, Name: "数据结构", Teacher: "王五", School: "计算机学院", Property: coursev1.CourseProperty(2), Credit: 3.5},
+	{Id: 4, Name: "心理学与生活", Teacher: "赵六", School: "心理学院", Property: coursev1.CourseProperty(3), Credit: 2},
+}
+
+const (
+	seedYear = "2023"
+	seedTerm = "1"
+)
+
+// CourseService 课程是只读的，所有用户都当作上过所有课
+type CourseService struct {
+	coursev1.CourseServiceClient
+	courses map[int64]*coursev1.Course
+}
+
+func NewCourseService() *CourseService {
+	courses := make(map[int64]*coursev1.Course, len(seedCourses))
+	for _, c := range seedCourses {
+		courses[c.Id] = c
+	}
+	return &CourseService{courses: courses}
+}
+
+func (s *CourseService) SubscriptionList(ctx context.Context, in *coursev1.SubscriptionListRequest, opts ...grpc.CallOption) (*coursev1.SubscriptionListResponse, error) {
+	res := &coursev1.SubscriptionListResponse{}
+	if (in.GetYear() != "" && in.GetYear() != seedYear) || (in.GetTerm() != "" && in.GetTerm() != seedTerm) {
+		return res, nil
+	}
+	for _, c := range seedCourses {
+		res.CourseSubscriptions = append(res.CourseSubscriptions, &coursev1.CourseSubscription{
+			Course: c,
+			Year:   seedYear,
+			Term:   seedTerm,
+		})
+	}
+	return res, nil
+}
+
+func (s *CourseService) GetDetailById(ctx context.Context, in *coursev1.GetDetailByIdRequest, opts ...grpc.CallOption) (*coursev1.GetDetailByIdResponse, error) {
+	// 和课程服务一样，不存在的课程返回空对象
+	return &coursev1.GetDetailByIdResponse{Course: s.courses[in.GetCourseId()]}, nil
+}
+
+func (s *CourseService) Subscribed(ctx context.Context, in *coursev1.SubscribedRequest, opts ...grpc.CallOption) (*coursev1.SubscribedResponse, error) {
+	_, ok := s.courses[in.GetCourseId()]
+	return &coursev1.SubscribedResponse{Subscribed: ok}, nil
+}
+
+func (s *CourseService) get(cid int64) (*coursev1.Course, bool) {
+	c, ok := s.courses[cid]
+	return c, ok
+}
+
+func (s *CourseService) list() []*coursev1.Course {
+	return seedCourses
+}
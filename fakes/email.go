@@ -0,0 +1,30 @@
+package fakes
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"strings"
+	"sync"
+)
+
+// EmailSender 不连 SMTP，只把邮件记下来并打日志，验证码在标题里，看日志就能拿到
+type EmailSender struct {
+	l    logger.Logger
+	mu   sync.Mutex
+	sent []email.Message
+}
+
+func NewEmailSender(l logger.Logger) *EmailSender {
+	return &EmailSender{l: l}
+}
+
+func (s *EmailSender) Send(ctx context.Context, msg email.Message) error {
+	s.mu.Lock()
+	s.sent = append(s.sent, msg)
+	s.mu.Unlock()
+	s.l.Info("standalone 模式，不发邮件",
+		logger.String("to", strings.Join(msg.To, ",")),
+		logger.String("subject", msg.Subject))
+	return nil
+}
@@ -0,0 +1,215 @@
+package fakes
+
+import (
+	"context"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// EvaluationService 更新时整个换掉存下去的对象，所以可以直接把指针返回出去
+type EvaluationService struct {
+	evaluationv1.EvaluationServiceClient
+	course      *CourseService
+	ids         idGen
+	mu          sync.RWMutex
+	evaluations []*evaluationv1.Evaluation
+}
+
+func NewEvaluationService(course *CourseService) *EvaluationService {
+	return &EvaluationService{course: course}
+}
+
+func (s *EvaluationService) Save(ctx context.Context, in *evaluationv1.SaveRequest, opts ...grpc.CallOption) (*evaluationv1.SaveResponse, error) {
+	e := in.GetEvaluation()
+	if _, ok := s.course.get(e.GetCourseId()); !ok {
+		return nil, evaluationv1.ErrorCanNotEvaluateUnattendedCourse("没有上过这门课")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	ne := &evaluationv1.Evaluation{
+		Id:          e.GetId(),
+		PublisherId: e.GetPublisherId(),
+		CourseId:    e.GetCourseId(),
+		StarRating:  e.GetStarRating(),
+		Content:     e.GetContent(),
+		Status:      e.GetStatus(),
+		IsAnonymous: e.GetIsAnonymous(),
+		Utime:       t,
+		Ctime:       t,
+	}
+	// 一个人一门课只有一条课评，没带 id 也按已有的那条更新
+	idx := s.indexOf(func(old *evaluationv1.Evaluation) bool {
+		if ne.Id != 0 {
+			return old.Id == ne.Id
+		}
+		return old.PublisherId == ne.PublisherId && old.CourseId == ne.CourseId
+	})
+	if idx < 0 {
+		if ne.Id != 0 {
+			return nil, evaluationv1.ErrorEvaluationNotFound("课评不存在")
+		}
+		ne.Id = s.ids.next()
+		s.evaluations = append(s.evaluations, ne)
+		return &evaluationv1.SaveResponse{EvaluationId: ne.Id}, nil
+	}
+	old := s.evaluations[idx]
+	if old.PublisherId != ne.PublisherId {
+		return nil, evaluationv1.ErrorEvaluationNotFound("课评不存在")
+	}
+	ne.Id, ne.Ctime = old.Id, old.Ctime
+	s.evaluations[idx] = ne
+	return &evaluationv1.SaveResponse{EvaluationId: ne.Id}, nil
+}
+
+func (s *EvaluationService) UpdateStatus(ctx context.Context, in *evaluationv1.UpdateStatusRequest, opts ...grpc.CallOption) (*evaluationv1.UpdateStatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.indexOf(func(e *evaluationv1.Evaluation) bool {
+		return e.Id == in.GetEvaluationId() && e.PublisherId == in.GetUid()
+	})
+	if idx < 0 {
+		return nil, evaluationv1.ErrorEvaluationNotFound("课评不存在")
+	}
+	old := s.evaluations[idx]
+	s.evaluations[idx] = &evaluationv1.Evaluation{
+		Id:          old.Id,
+		PublisherId: old.PublisherId,
+		CourseId:    old.CourseId,
+		StarRating:  old.StarRating,
+		Content:     old.Content,
+		Status:      in.GetStatus(),
+		IsAnonymous: old.IsAnonymous,
+		Utime:       now(),
+		Ctime:       old.Ctime,
+	}
+	return &evaluationv1.UpdateStatusResponse{}, nil
+}
+
+func (s *EvaluationService) Detail(ctx context.Context, in *evaluationv1.DetailRequest, opts ...grpc.CallOption) (*evaluationv1.DetailResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.indexOf(func(e *evaluationv1.Evaluation) bool {
+		return e.Id == in.GetEvaluationId()
+	})
+	if idx < 0 {
+		return nil, evaluationv1.ErrorEvaluationNotFound("课评不存在")
+	}
+	return &evaluationv1.DetailResponse{Evaluation: s.evaluations[idx]}, nil
+}
+
+func (s *EvaluationService) ListRecent(ctx context.Context, in *evaluationv1.ListRecentRequest, opts ...grpc.CallOption) (*evaluationv1.ListRecentResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	evaluations := filter(s.evaluations, func(e *evaluationv1.Evaluation) bool {
+		if e.Status != evaluationv1.EvaluationStatus_Public {
+			return false
+		}
+		if in.GetProperty() == coursev1.CourseProperty_CoursePropertyAny {
+			return true
+		}
+		c, _ := s.course.get(e.CourseId)
+		return c.GetProperty() == in.GetProperty()
+	})
+	return &evaluationv1.ListRecentResponse{
+		Evaluations: pageDesc(evaluations, (*evaluationv1.Evaluation).GetId, in.GetCurEvaluationId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *EvaluationService) ListCourse(ctx context.Context, in *evaluationv1.ListCourseRequest, opts ...grpc.CallOption) (*evaluationv1.ListCourseResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	evaluations := filter(s.evaluations, func(e *evaluationv1.Evaluation) bool {
+		return e.CourseId == in.GetCourseId() && e.Status == evaluationv1.EvaluationStatus_Public
+	})
+	return &evaluationv1.ListCourseResponse{
+		Evaluations: pageDesc(evaluations, (*evaluationv1.Evaluation).GetId, in.GetCurEvaluationId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *EvaluationService) ListMine(ctx context.Context, in *evaluationv1.ListMineRequest, opts ...grpc.CallOption) (*evaluationv1.ListMineResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	evaluations := filter(s.evaluations, func(e *evaluationv1.Evaluation) bool {
+		return e.PublisherId == in.GetUid() && e.Status == in.GetStatus()
+	})
+	return &evaluationv1.ListMineResponse{
+		Evaluations: pageDesc(evaluations, (*evaluationv1.Evaluation).GetId, in.GetCurEvaluationId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *EvaluationService) CountCourseInvisible(ctx context.Context, in *evaluationv1.CountCourseInvisibleRequest, opts ...grpc.CallOption) (*evaluationv1.CountCourseInvisibleResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	evaluations := filter(s.evaluations, func(e *evaluationv1.Evaluation) bool {
+		return e.CourseId == in.GetCourseId() && e.Status != evaluationv1.EvaluationStatus_Public
+	})
+	return &evaluationv1.CountCourseInvisibleResponse{Count: int64(len(evaluations))}, nil
+}
+
+func (s *EvaluationService) CountMine(ctx context.Context, in *evaluationv1.CountMineRequest, opts ...grpc.CallOption) (*evaluationv1.CountMineResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	evaluations := filter(s.evaluations, func(e *evaluationv1.Evaluation) bool {
+		return e.PublisherId == in.GetUid() && e.Status == in.GetStatus()
+	})
+	return &evaluationv1.CountMineResponse{Count: int64(len(evaluations))}, nil
+}
+
+func (s *EvaluationService) Evaluated(ctx context.Context, in *evaluationv1.EvaluatedRequest, opts ...grpc.CallOption) (*evaluationv1.EvaluatedResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := s.indexOf(func(e *evaluationv1.Evaluation) bool {
+		return e.CourseId == in.GetCourseId() && e.PublisherId == in.GetPublisherId()
+	})
+	return &evaluationv1.EvaluatedResponse{Evaluated: idx >= 0}, nil
+}
+
+func (s *EvaluationService) CompositeScoreCourse(ctx context.Context, in *evaluationv1.CompositeScoreCourseRequest, opts ...grpc.CallOption) (*evaluationv1.CompositeScoreCourseResponse, error) {
+	score, cnt := s.compositeScore(in.GetCourseId())
+	return &evaluationv1.CompositeScoreCourseResponse{Score: score, RaterCount: cnt}, nil
+}
+
+func (s *EvaluationService) VisiblePublishersCourse(ctx context.Context, in *evaluationv1.VisiblePublishersCourseRequest, opts ...grpc.CallOption) (*evaluationv1.VisiblePublishersCourseResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := &evaluationv1.VisiblePublishersCourseResponse{}
+	for _, e := range s.evaluations {
+		if e.CourseId == in.GetCourseId() && e.Status == evaluationv1.EvaluationStatus_Public {
+			res.Publishers = append(res.Publishers, e.PublisherId)
+		}
+	}
+	return res, nil
+}
+
+// compositeScore 公开课评的平均星级，搜索也要用
+func (s *EvaluationService) compositeScore(cid int64) (float64, int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var (
+		sum uint32
+		cnt int64
+	)
+	for _, e := range s.evaluations {
+		if e.CourseId == cid && e.Status == evaluationv1.EvaluationStatus_Public {
+			sum += e.StarRating
+			cnt++
+		}
+	}
+	if cnt == 0 {
+		return 0, 0
+	}
+	return float64(sum) / float64(cnt), cnt
+}
+
+// indexOf 调用方要持有锁
+func (s *EvaluationService) indexOf(fn func(e *evaluationv1.Evaluation) bool) int {
+	for i, e := range s.evaluations {
+		if fn(e) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,44 @@
+// Package fakes 是 be-api 各个服务客户端的内存实现，带状态，进程退出就没了。
+// standalone 模式下用它们替换掉 etcd、kafka、redis 和所有下游服务，方便本地起 BFF 调前端。
+// 每个 fake 都内嵌了对应的 ServiceClient 接口，只实现了 BFF 用到的方法，调用没实现的方法会直接 panic
+package fakes
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+type idGen struct {
+	id atomic.Int64
+}
+
+func (g *idGen) next() int64 {
+	return g.id.Add(1)
+}
+
+func now() int64 {
+	return time.Now().UnixMilli()
+}
+
+// pageDesc 按 id 倒序的游标分页，items 要按 id 升序存放，cur 为 0 时从最新的开始
+func pageDesc[T any](items []T, id func(T) int64, cur, limit int64) []T {
+	res := make([]T, 0, min(int64(len(items)), max(limit, 0)))
+	for i := len(items) - 1; i >= 0 && int64(len(res)) < limit; i-- {
+		if cur > 0 && id(items[i]) >= cur {
+			continue
+		}
+		res = append(res, items[i])
+	}
+	return res
+}
+
+// filter 返回满足条件的元素，不会修改原切片
+func filter[T any](items []T, fn func(T) bool) []T {
+	res := make([]T, 0, len(items))
+	for _, item := range items {
+		if fn(item) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
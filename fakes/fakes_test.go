@@ -0,0 +1,29 @@
+package fakes
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPageDesc(t *testing.T) {
+	items := []int64{1, 2, 3, 4, 5}
+	id := func(v int64) int64 { return v }
+	testCases := []struct {
+		name       string
+		cur, limit int64
+		want       []int64
+	}{
+		{name: "第一页", cur: 0, limit: 2, want: []int64{5, 4}},
+		{name: "从游标之后开始", cur: 4, limit: 2, want: []int64{3, 2}},
+		{name: "最后一页不满", cur: 2, limit: 2, want: []int64{1}},
+		{name: "limit 不合法", cur: 0, limit: -1, want: []int64{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := pageDesc(items, id, tc.cur, tc.limit)
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("pageDesc(%d, %d) = %v，期望 %v", tc.cur, tc.limit, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package fakes
+
+import (
+	"context"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	"github.com/MuxiKeStack/bff/events"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// FeedService 其他 fake 不会产生 feed 事件，需要的话用 Push 手动塞
+type FeedService struct {
+	feedv1.FeedServiceClient
+	ids   idGen
+	mu    sync.RWMutex
+	feeds map[int64][]*feedv1.FeedEvent
+	// 和真实的 feed 服务一样，新事件会发出 feed.created 事件给推送用
+	producer events.Producer
+}
+
+func NewFeedService(producer events.Producer) *FeedService {
+	return &FeedService{feeds: make(map[int64][]*feedv1.FeedEvent), producer: producer}
+}
+
+// Push 给 uid 推一条 feed 事件，Id 和 Ctime 会被覆盖
+func (s *FeedService) Push(uid int64, typ string, content map[string]string) {
+	s.PushAt(uid, typ, content, now())
+}
+
+// PushAt 和 Push 一样，但是指定 ctime，用来造同一个 ctime 上的多条事件。ctime 不能比之前推的小
+func (s *FeedService) PushAt(uid int64, typ string, content map[string]string, ctime int64) {
+	evt := &feedv1.FeedEvent{
+		Id:      s.ids.next(),
+		Type:    typ,
+		Content: content,
+		Ctime:   ctime,
+	}
+	s.mu.Lock()
+	s.feeds[uid] = append(s.feeds[uid], evt)
+	s.mu.Unlock()
+	_ = events.Produce(context.Background(), s.producer, 0, events.FeedCreated{
+		Uid:     uid,
+		Id:      evt.Id,
+		Type:    evt.Type,
+		Content: evt.Content,
+		Ctime:   evt.Ctime,
+	})
+}
+
+// FindFeedEvents Before 从 LastTime 往前翻，新的在前，LastTime 为 0 时从最新的开始；After 拿 LastTime 之后的，旧的在前
+func (s *FeedService) FindFeedEvents(ctx context.Context, in *feedv1.FindFeedEventsRequest, opts ...grpc.CallOption) (*feedv1.FindFeedEventsResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := s.feeds[in.GetUid()]
+	res := &feedv1.FindFeedEventsResponse{}
+	if in.GetDirection() == feedv1.Direction_After {
+		for i := 0; i < len(list) && int64(len(res.FeedEvents)) < in.GetLimit(); i++ {
+			if list[i].Ctime > in.GetLastTime() {
+				res.FeedEvents = append(res.FeedEvents, list[i])
+			}
+		}
+		return res, nil
+	}
+	for i := len(list) - 1; i >= 0 && int64(len(res.FeedEvents)) < in.GetLimit(); i-- {
+		if in.GetLastTime() == 0 || list[i].Ctime < in.GetLastTime() {
+			res.FeedEvents = append(res.FeedEvents, list[i])
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,43 @@
+package fakes
+
+import (
+	"context"
+	gradev1 "github.com/MuxiKeStack/be-api/gen/proto/grade/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// GradeService 只记录签约状态，没有分享上来的成绩
+type GradeService struct {
+	gradev1.GradeServiceClient
+	mu     sync.RWMutex
+	signed map[int64]bool
+}
+
+func NewGradeService() *GradeService {
+	return &GradeService{signed: make(map[int64]bool)}
+}
+
+func (s *GradeService) SignForGradeSharing(ctx context.Context, in *gradev1.SignForGradeSharingRequest, opts ...grpc.CallOption) (*gradev1.SignForGradeSharingResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	signed := s.signed[in.GetUid()]
+	switch {
+	case signed && in.GetWantsToSign():
+		return nil, gradev1.ErrorRepeatSigning("重复签约")
+	case !signed && !in.GetWantsToSign():
+		return nil, gradev1.ErrorRepeatCancelSigning("重复取消签约")
+	}
+	s.signed[in.GetUid()] = in.GetWantsToSign()
+	return &gradev1.SignForGradeSharingResponse{}, nil
+}
+
+func (s *GradeService) GetSignStatus(ctx context.Context, in *gradev1.GetSignStatusRequest, opts ...grpc.CallOption) (*gradev1.GetSignStatusResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &gradev1.GetSignStatusResponse{IsSigned: s.signed[in.GetUid()]}, nil
+}
+
+func (s *GradeService) GetGradesByCourseId(ctx context.Context, in *gradev1.GetGradesByCourseIdRequest, opts ...grpc.CallOption) (*gradev1.GetGradesByCourseIdResponse, error) {
+	return &gradev1.GetGradesByCourseIdResponse{}, nil
+}
@@ -0,0 +1,39 @@
+package fakes
+
+import (
+	"context"
+	pointv1 "github.com/MuxiKeStack/be-api/gen/proto/point/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// PointService 没有积分来源，所有人都是零积分，只能用 Title_None
+type PointService struct {
+	pointv1.PointServiceClient
+	mu     sync.RWMutex
+	titles map[int64]pointv1.Title
+}
+
+func NewPointService() *PointService {
+	return &PointService{titles: make(map[int64]pointv1.Title)}
+}
+
+func (s *PointService) GetPointInfoOfUser(ctx context.Context, in *pointv1.GetPointInfoOfUserRequest, opts ...grpc.CallOption) (*pointv1.GetPointInfoOfUserResponse, error) {
+	return &pointv1.GetPointInfoOfUserResponse{}, nil
+}
+
+func (s *PointService) GetTitleOfUser(ctx context.Context, in *pointv1.GetTitleOfUserRequest, opts ...grpc.CallOption) (*pointv1.GetTitleOfUserResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &pointv1.GetTitleOfUserResponse{UsingTitle: s.titles[in.GetUid()]}, nil
+}
+
+func (s *PointService) SaveUsingTitleOfUser(ctx context.Context, in *pointv1.SaveUsingTitleOfUserRequest, opts ...grpc.CallOption) (*pointv1.SaveUsingTitleOfUserResponse, error) {
+	if in.GetTitle() != pointv1.Title_None {
+		return nil, pointv1.ErrorPointNotEnough("积分不足")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.titles[in.GetUid()] = in.GetTitle()
+	return &pointv1.SaveUsingTitleOfUserResponse{}, nil
+}
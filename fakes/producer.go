@@ -0,0 +1,37 @@
+package fakes
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"sync"
+)
+
+// Producer 不发 kafka，把事件记下来，直接交给本进程里订阅了的 Handler
+type Producer struct {
+	l      logger.Logger
+	subs   []events.Subscription
+	mu     sync.Mutex
+	events []events.Envelope
+}
+
+func NewProducer(l logger.Logger, subs []events.Subscription) *Producer {
+	return &Producer{l: l, subs: subs}
+}
+
+func (p *Producer) Produce(ctx context.Context, env events.Envelope) error {
+	p.mu.Lock()
+	p.events = append(p.events, env)
+	p.mu.Unlock()
+	// payload 里可能有密码，不打出来
+	p.l.Info("standalone 模式，事件只在进程内分发", logger.String("type", env.Type), logger.String("id", env.Id))
+	for _, sub := range p.subs {
+		if !sub.Matches(env) {
+			continue
+		}
+		if err := sub.Handler(ctx, env); err != nil {
+			p.l.Error("处理事件失败", logger.String("subscription", sub.Name), logger.Error(err))
+		}
+	}
+	return nil
+}
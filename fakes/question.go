@@ -0,0 +1,115 @@
+package fakes
+
+import (
+	"context"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	"google.golang.org/grpc"
+	"slices"
+	"sync"
+)
+
+type QuestionService struct {
+	questionv1.QuestionServiceClient
+	user      *UserService
+	ids       idGen
+	mu        sync.RWMutex
+	questions []*questionv1.Question
+	// qid -> 被邀请的 uid
+	invitees map[int64]map[int64]struct{}
+}
+
+func NewQuestionService(user *UserService) *QuestionService {
+	return &QuestionService{
+		user:     user,
+		invitees: make(map[int64]map[int64]struct{}),
+	}
+}
+
+func (s *QuestionService) Publish(ctx context.Context, in *questionv1.PublishRequest, opts ...grpc.CallOption) (*questionv1.PublishResponse, error) {
+	q := in.GetQuestion()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := now()
+	nq := &questionv1.Question{
+		Id:           s.ids.next(),
+		QuestionerId: q.GetQuestionerId(),
+		Biz:          q.GetBiz(),
+		BizId:        q.GetBizId(),
+		Content:      q.GetContent(),
+		Utime:        t,
+		Ctime:        t,
+	}
+	s.questions = append(s.questions, nq)
+	return &questionv1.PublishResponse{QuestionId: nq.Id}, nil
+}
+
+func (s *QuestionService) GetDetailById(ctx context.Context, in *questionv1.GetDetailByIdRequest, opts ...grpc.CallOption) (*questionv1.GetDetailByIdResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	idx := slices.IndexFunc(s.questions, func(q *questionv1.Question) bool {
+		return q.Id == in.GetQuestionId()
+	})
+	if idx < 0 {
+		return nil, questionv1.ErrorQuestionNotFound("问题不存在")
+	}
+	return &questionv1.GetDetailByIdResponse{Question: s.questions[idx]}, nil
+}
+
+// GetRecommendationInviteeUids 所有人都上过所有课，所以按 uid 顺序推荐就行，CurUid 是游标
+func (s *QuestionService) GetRecommendationInviteeUids(ctx context.Context, in *questionv1.GetRecommendationInviteeUidsRequest, opts ...grpc.CallOption) (*questionv1.GetRecommendationInviteeUidsResponse, error) {
+	res := &questionv1.GetRecommendationInviteeUidsResponse{}
+	for _, uid := range s.user.uids() {
+		if int64(len(res.InviteeUids)) >= in.GetLimit() {
+			break
+		}
+		if uid > in.GetCurUid() {
+			res.InviteeUids = append(res.InviteeUids, uid)
+		}
+	}
+	return res, nil
+}
+
+func (s *QuestionService) InviteUserToAnswer(ctx context.Context, in *questionv1.InviteUserToAnswerRequest, opts ...grpc.CallOption) (*questionv1.InviteUserToAnswerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	invitees, ok := s.invitees[in.GetQuestionId()]
+	if !ok {
+		invitees = make(map[int64]struct{})
+		s.invitees[in.GetQuestionId()] = invitees
+	}
+	for _, uid := range in.GetInvitees() {
+		invitees[uid] = struct{}{}
+	}
+	return &questionv1.InviteUserToAnswerResponse{}, nil
+}
+
+func (s *QuestionService) CountBizQuestions(ctx context.Context, in *questionv1.CountQuestionsRequest, opts ...grpc.CallOption) (*questionv1.CountQuestionsResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	questions := filter(s.questions, func(q *questionv1.Question) bool {
+		return q.Biz == in.GetBiz() && q.BizId == in.GetBizId()
+	})
+	return &questionv1.CountQuestionsResponse{Count: int64(len(questions))}, nil
+}
+
+func (s *QuestionService) ListBizQuestions(ctx context.Context, in *questionv1.ListBizQuestionsRequest, opts ...grpc.CallOption) (*questionv1.ListBizQuestionsResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	questions := filter(s.questions, func(q *questionv1.Question) bool {
+		return q.Biz == in.GetBiz() && q.BizId == in.GetBizId()
+	})
+	return &questionv1.ListBizQuestionsResponse{
+		Questions: pageDesc(questions, (*questionv1.Question).GetId, in.GetCurQuestionId(), in.GetLimit()),
+	}, nil
+}
+
+func (s *QuestionService) ListUserQuestions(ctx context.Context, in *questionv1.ListUserQuestionsRequest, opts ...grpc.CallOption) (*questionv1.ListUserQuestionsResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	questions := filter(s.questions, func(q *questionv1.Question) bool {
+		return q.QuestionerId == in.GetUid()
+	})
+	return &questionv1.ListUserQuestionsResponse{
+		Questions: pageDesc(questions, (*questionv1.Question).GetId, in.GetCurQuestionId(), in.GetLimit()),
+	}, nil
+}
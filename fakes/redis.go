@@ -0,0 +1,470 @@
+package fakes
+
+import (
+	"cmp"
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type redisEntry struct {
+	val      string
+	expireAt time.Time
+}
+
+func (e redisEntry) expired() bool {
+	return !e.expireAt.IsZero() && time.Now().After(e.expireAt)
+}
+
+// Redis 内存版的 redis.Cmdable，只支持 string、hash、list 和 sorted set 类型，够 jwt、缓存、feed 已读状态和 webhook 用了。
+// lua 脚本不会真的执行，按脚本名字换成 redis_script.go 里的 Go 实现。
+// 没实现的命令返回 ErrRedisNotImplemented，不会真的去连 redis
+type Redis struct {
+	redis.Cmdable
+	mu   sync.Mutex
+	data map[string]redisEntry
+	// hash、list 和 sorted set 不支持过期
+	hashes map[string]map[string]string
+	lists  map[string][]string
+	zsets  map[string]map[string]float64
+}
+
+var ErrRedisNotImplemented = errors.New("fakes: Redis 没有实现这个命令")
+
+func NewRedis() *Redis {
+	unimplemented := redis.NewClient(&redis.Options{})
+	unimplemented.AddHook(notImplementedHook{})
+	return &Redis{
+		Cmdable: unimplemented,
+		data:    make(map[string]redisEntry),
+		hashes:  make(map[string]map[string]string),
+		lists:   make(map[string][]string),
+		zsets:   make(map[string]map[string]float64),
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.get(key)
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(e.val, nil)
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	val, err := toString(value)
+	if err != nil {
+		return redis.NewStatusResult("", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(key, val, expiration)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	val, err := toString(value)
+	if err != nil {
+		return redis.NewBoolResult(false, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.get(key); ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	r.set(key, val, expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (r *Redis) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cnt int64
+	for _, key := range keys {
+		if _, ok := r.get(key); ok {
+			cnt++
+		} else if _, ok = r.hashes[key]; ok {
+			cnt++
+		} else if _, ok = r.lists[key]; ok {
+			cnt++
+		} else if _, ok = r.zsets[key]; ok {
+			cnt++
+		}
+	}
+	return redis.NewIntResult(cnt, nil)
+}
+
+func (r *Redis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cnt int64
+	for _, key := range keys {
+		if _, ok := r.get(key); ok {
+			delete(r.data, key)
+			cnt++
+		} else if _, ok = r.hashes[key]; ok {
+			delete(r.hashes, key)
+			cnt++
+		} else if _, ok = r.lists[key]; ok {
+			delete(r.lists, key)
+			cnt++
+		} else if _, ok = r.zsets[key]; ok {
+			delete(r.zsets, key)
+			cnt++
+		}
+	}
+	return redis.NewIntResult(cnt, nil)
+}
+
+// Expire 只支持 string，hash、list 和 sorted set 返回 ErrRedisNotImplemented
+func (r *Redis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.hashes[key]; ok {
+		return redis.NewBoolResult(false, fmt.Errorf("%w：hash 的 expire", ErrRedisNotImplemented))
+	}
+	if _, ok := r.lists[key]; ok {
+		return redis.NewBoolResult(false, fmt.Errorf("%w：list 的 expire", ErrRedisNotImplemented))
+	}
+	if _, ok := r.zsets[key]; ok {
+		return redis.NewBoolResult(false, fmt.Errorf("%w：sorted set 的 expire", ErrRedisNotImplemented))
+	}
+	e, ok := r.get(key)
+	if !ok {
+		return redis.NewBoolResult(false, nil)
+	}
+	r.set(key, e.val, expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+func (r *Redis) Incr(ctx context.Context, key string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, _ := r.get(key)
+	var n int64
+	if e.val != "" {
+		var err error
+		n, err = strconv.ParseInt(e.val, 10, 64)
+		if err != nil {
+			return redis.NewIntResult(0, fmt.Errorf("fakes: %s 不是整数", key))
+		}
+	}
+	n++
+	// 和 redis 一样保留原来的过期时间
+	e.val = strconv.FormatInt(n, 10)
+	r.data[key] = e
+	return redis.NewIntResult(n, nil)
+}
+
+func (r *Redis) HGetAll(ctx context.Context, key string) *redis.MapStringStringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make(map[string]string, len(r.hashes[key]))
+	for field, val := range r.hashes[key] {
+		res[field] = val
+	}
+	return redis.NewMapStringStringResult(res, nil)
+}
+
+// HSet 只支持 field, value 交替和 map[string]interface{} 两种传法
+func (r *Redis) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	pairs := make(map[string]interface{}, len(values)/2)
+	if len(values) == 1 {
+		m, ok := values[0].(map[string]interface{})
+		if !ok {
+			return redis.NewIntResult(0, fmt.Errorf("fakes: HSet 不支持 %T", values[0]))
+		}
+		pairs = m
+	} else {
+		if len(values)%2 != 0 {
+			return redis.NewIntResult(0, fmt.Errorf("fakes: HSet 的参数个数不对"))
+		}
+		for i := 0; i < len(values); i += 2 {
+			pairs[fmt.Sprint(values[i])] = values[i+1]
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hashes[key]
+	if !ok {
+		h = make(map[string]string, len(pairs))
+		r.hashes[key] = h
+	}
+	var cnt int64
+	for field, value := range pairs {
+		val, err := toString(value)
+		if err != nil {
+			return redis.NewIntResult(cnt, err)
+		}
+		if _, exists := h[field]; !exists {
+			cnt++
+		}
+		h[field] = val
+	}
+	return redis.NewIntResult(cnt, nil)
+}
+
+func (r *Redis) HDel(ctx context.Context, key string, fields ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.hashes[key]
+	var cnt int64
+	for _, field := range fields {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			cnt++
+		}
+	}
+	if h != nil && len(h) == 0 {
+		delete(r.hashes, key)
+	}
+	return redis.NewIntResult(cnt, nil)
+}
+
+func (r *Redis) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, value := range values {
+		val, err := toString(value)
+		if err != nil {
+			return redis.NewIntResult(0, err)
+		}
+		r.lists[key] = append([]string{val}, r.lists[key]...)
+	}
+	return redis.NewIntResult(int64(len(r.lists[key])), nil)
+}
+
+func (r *Redis) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := r.lists[key]
+	start, stop = listRange(int64(len(l)), start, stop)
+	res := make([]string, 0, stop-start)
+	res = append(res, l[start:stop]...)
+	return redis.NewStringSliceResult(res, nil)
+}
+
+func (r *Redis) LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	l := r.lists[key]
+	start, stop = listRange(int64(len(l)), start, stop)
+	if start >= stop {
+		delete(r.lists, key)
+	} else {
+		r.lists[key] = append([]string(nil), l[start:stop]...)
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+// listRange 把 redis 的闭区间下标（可以是负数）换成切片的 [start, stop)
+func listRange(n, start, stop int64) (int64, int64) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start = max(start, 0)
+	stop = min(stop+1, n)
+	if start > stop {
+		start = stop
+	}
+	return start, stop
+}
+
+func (r *Redis) ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	z, ok := r.zsets[key]
+	if !ok {
+		z = make(map[string]float64, len(members))
+		r.zsets[key] = z
+	}
+	var cnt int64
+	for _, m := range members {
+		member, err := toString(m.Member)
+		if err != nil {
+			return redis.NewIntResult(cnt, err)
+		}
+		if _, exists := z[member]; !exists {
+			cnt++
+		}
+		z[member] = m.Score
+	}
+	return redis.NewIntResult(cnt, nil)
+}
+
+func (r *Redis) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var cnt int64
+	for _, m := range members {
+		member, err := toString(m)
+		if err != nil {
+			return redis.NewIntResult(cnt, err)
+		}
+		if _, ok := r.zsets[key][member]; ok {
+			delete(r.zsets[key], member)
+			cnt++
+		}
+	}
+	r.dropEmptyZSet(key)
+	return redis.NewIntResult(cnt, nil)
+}
+
+// ZRangeByScore 不支持 Offset，Count 为 0 表示不限
+func (r *Redis) ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	if opt.Offset != 0 {
+		return redis.NewStringSliceResult(nil, fmt.Errorf("%w：ZRANGEBYSCORE 的 offset", ErrRedisNotImplemented))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inRange, err := scoreRange(opt.Min, opt.Max)
+	if err != nil {
+		return redis.NewStringSliceResult(nil, err)
+	}
+	res := r.zrange(key, inRange)
+	if opt.Count > 0 && int64(len(res)) > opt.Count {
+		res = res[:opt.Count]
+	}
+	return redis.NewStringSliceResult(res, nil)
+}
+
+func (r *Redis) ZRemRangeByScore(ctx context.Context, key, min, max string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	inRange, err := scoreRange(min, max)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	members := r.zrange(key, inRange)
+	for _, member := range members {
+		delete(r.zsets[key], member)
+	}
+	r.dropEmptyZSet(key)
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+// zrange 调用方要持有锁，按 score 从小到大，score 相同的按 member 排
+func (r *Redis) zrange(key string, inRange func(float64) bool) []string {
+	z := r.zsets[key]
+	res := make([]string, 0, len(z))
+	for member, score := range z {
+		if inRange(score) {
+			res = append(res, member)
+		}
+	}
+	slices.SortFunc(res, func(a, b string) int {
+		return cmp.Or(cmp.Compare(z[a], z[b]), cmp.Compare(a, b))
+	})
+	return res
+}
+
+// dropEmptyZSet 调用方要持有锁，和 redis 一样，空的 sorted set 就不存在了
+func (r *Redis) dropEmptyZSet(key string) {
+	if z, ok := r.zsets[key]; ok && len(z) == 0 {
+		delete(r.zsets, key)
+	}
+}
+
+// scoreRange 解析 ZRANGEBYSCORE 的 min 和 max，支持 -inf、+inf 和表示开区间的 (
+func scoreRange(min, max string) (func(float64) bool, error) {
+	lo, loOpen, err := parseScore(min)
+	if err != nil {
+		return nil, err
+	}
+	hi, hiOpen, err := parseScore(max)
+	if err != nil {
+		return nil, err
+	}
+	return func(score float64) bool {
+		return (score > lo || !loOpen && score == lo) && (score < hi || !hiOpen && score == hi)
+	}, nil
+}
+
+func parseScore(s string) (float64, bool, error) {
+	open := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch s {
+	case "-inf":
+		return math.Inf(-1), open, nil
+	case "+inf", "inf":
+		return math.Inf(1), open, nil
+	}
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("fakes: 不合法的 score %q", s)
+	}
+	return score, open, nil
+}
+
+// notImplementedHook 拦下所有命令，直接返回错误
+type notImplementedHook struct{}
+
+func (notImplementedHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (notImplementedHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := fmt.Errorf("%w：%s", ErrRedisNotImplemented, cmd.Name())
+		cmd.SetErr(err)
+		return err
+	}
+}
+
+func (notImplementedHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			cmd.SetErr(fmt.Errorf("%w：%s", ErrRedisNotImplemented, cmd.Name()))
+		}
+		return ErrRedisNotImplemented
+	}
+}
+
+// get 调用方要持有锁，顺手惰性删除过期的 key
+func (r *Redis) get(key string) (redisEntry, bool) {
+	e, ok := r.data[key]
+	if !ok {
+		return redisEntry{}, false
+	}
+	if e.expired() {
+		delete(r.data, key)
+		return redisEntry{}, false
+	}
+	return e, true
+}
+
+// set 调用方要持有锁
+func (r *Redis) set(key, val string, expiration time.Duration) {
+	e := redisEntry{val: val}
+	if expiration > 0 {
+		e.expireAt = time.Now().Add(expiration)
+	}
+	r.data[key] = e
+}
+
+func toString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case encoding.BinaryMarshaler:
+		data, err := v.MarshalBinary()
+		return string(data), err
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
@@ -0,0 +1,151 @@
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// redisScript lua 脚本对应的 Go 实现，调用时已经持有锁
+type redisScript func(r *Redis, keys []string, args []string) (interface{}, error)
+
+// redisScripts 按脚本第一行注释里的名字（-- name）找到对应的实现，没有的返回 ErrRedisNotImplemented
+var redisScripts = map[string]redisScript{
+	"feed_read_mark_all":   feedReadMarkAll,
+	"feed_read_mark_type":  feedReadMarkType,
+	"feed_read_mark_event": feedReadMarkEvent,
+}
+
+// redisError 实现 redis.Error，redis.Script 靠它认出 NOSCRIPT
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func (redisError) RedisError() {}
+
+// EvalSha 总是返回 NOSCRIPT，redis.Script.Run 会退回到 Eval
+func (r *Redis) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, "evalsha", sha1)
+	cmd.SetErr(redisError("NOSCRIPT No matching script"))
+	return cmd
+}
+
+func (r *Redis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, "eval")
+	name, _, _ := strings.Cut(script, "\n")
+	fn, ok := redisScripts[strings.TrimSpace(strings.TrimPrefix(name, "--"))]
+	if !ok {
+		cmd.SetErr(fmt.Errorf("%w：eval %s", ErrRedisNotImplemented, name))
+		return cmd
+	}
+	strArgs := make([]string, len(args))
+	for i, arg := range args {
+		val, err := toString(arg)
+		if err != nil {
+			cmd.SetErr(err)
+			return cmd
+		}
+		strArgs[i] = val
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	val, err := fn(r, keys, strArgs)
+	if err != nil {
+		cmd.SetErr(err)
+	} else {
+		cmd.SetVal(val)
+	}
+	return cmd
+}
+
+// hashInt 不存在或者不是整数都当作 0，和脚本里的 tonumber(... or '0') 一致
+func (r *Redis) hashInt(key, field string) int64 {
+	n, _ := strconv.ParseInt(r.hashes[key][field], 10, 64)
+	return n
+}
+
+// hashSet 调用方要持有锁
+func (r *Redis) hashSet(key, field, val string) {
+	h, ok := r.hashes[key]
+	if !ok {
+		h = make(map[string]string)
+		r.hashes[key] = h
+	}
+	h[field] = val
+}
+
+// hashDel 调用方要持有锁
+func (r *Redis) hashDel(key string, fields ...string) {
+	h := r.hashes[key]
+	for _, field := range fields {
+		delete(h, field)
+	}
+	if h != nil && len(h) == 0 {
+		delete(r.hashes, key)
+	}
+}
+
+// feedReadMarkAll 对应 web/cache/lua/feed_read_mark_all.lua
+func feedReadMarkAll(r *Redis, keys []string, args []string) (interface{}, error) {
+	key := keys[0]
+	ctime, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if r.hashInt(key, "all") >= ctime {
+		return int64(0), nil
+	}
+	r.hashSet(key, "all", args[0])
+	var stale []string
+	for field, val := range r.hashes[key] {
+		t, _ := strconv.ParseInt(val, 10, 64)
+		if strings.HasPrefix(field, "id:") || strings.HasPrefix(field, "type:") && t <= ctime {
+			stale = append(stale, field)
+		}
+	}
+	r.hashDel(key, stale...)
+	return int64(1), nil
+}
+
+// feedReadMarkType 对应 web/cache/lua/feed_read_mark_type.lua
+func feedReadMarkType(r *Redis, keys []string, args []string) (interface{}, error) {
+	key := keys[0]
+	ctime, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if r.hashInt(key, "all") >= ctime || r.hashInt(key, args[0]) >= ctime {
+		return int64(0), nil
+	}
+	r.hashSet(key, args[0], args[1])
+	return int64(1), nil
+}
+
+// feedReadMarkEvent 对应 web/cache/lua/feed_read_mark_event.lua
+func feedReadMarkEvent(r *Redis, keys []string, args []string) (interface{}, error) {
+	key := keys[0]
+	limit, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, err
+	}
+	r.hashSet(key, "id:"+args[0], "1")
+	var ids []int64
+	for field := range r.hashes[key] {
+		if id, ok := strings.CutPrefix(field, "id:"); ok {
+			n, _ := strconv.ParseInt(id, 10, 64)
+			ids = append(ids, n)
+		}
+	}
+	extra := len(ids) - limit
+	if extra <= 0 {
+		return int64(0), nil
+	}
+	slices.Sort(ids)
+	for _, id := range ids[:extra] {
+		r.hashDel(key, "id:"+strconv.FormatInt(id, 10))
+	}
+	return int64(extra), nil
+}
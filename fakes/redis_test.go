@@ -0,0 +1,198 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRedisString(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	if err := r.Get(ctx, "k").Err(); !errors.Is(err, redis.Nil) {
+		t.Fatalf("不存在的 key 应该返回 redis.Nil，实际是 %v", err)
+	}
+	if err := r.Set(ctx, "k", []byte("v"), 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if val := r.Get(ctx, "k").Val(); val != "v" {
+		t.Fatalf("Get = %q，期望 v", val)
+	}
+	if ok := r.SetNX(ctx, "k", "other", 0).Val(); ok {
+		t.Fatal("key 已经存在时 SetNX 不应该成功")
+	}
+
+	r.Set(ctx, "expire", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n := r.Exists(ctx, "expire").Val(); n != 0 {
+		t.Fatal("过期的 key 不应该存在")
+	}
+	if ok := r.SetNX(ctx, "expire", "v", 0).Val(); !ok {
+		t.Fatal("过期之后 SetNX 应该成功")
+	}
+
+	if ok := r.Expire(ctx, "missing", time.Millisecond).Val(); ok {
+		t.Fatal("不存在的 key Expire 应该返回 false")
+	}
+	r.Expire(ctx, "k", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if n := r.Exists(ctx, "k").Val(); n != 0 {
+		t.Fatal("Expire 之后 key 应该过期")
+	}
+	r.Set(ctx, "k", "v", 0)
+
+	if n := r.Del(ctx, "k", "expire", "missing").Val(); n != 2 {
+		t.Fatalf("Del = %d，期望 2", n)
+	}
+}
+
+func TestRedisIncrKeepsTTL(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	for i := int64(1); i <= 3; i++ {
+		if n := r.Incr(ctx, "cnt").Val(); n != i {
+			t.Fatalf("第 %d 次 Incr = %d", i, n)
+		}
+	}
+
+	r.Set(ctx, "ttl", "1", 10*time.Millisecond)
+	r.Incr(ctx, "ttl")
+	time.Sleep(20 * time.Millisecond)
+	if n := r.Exists(ctx, "ttl").Val(); n != 0 {
+		t.Fatal("Incr 之后原来的过期时间应该还在")
+	}
+
+	r.Set(ctx, "str", "abc", 0)
+	if err := r.Incr(ctx, "str").Err(); err == nil {
+		t.Fatal("不是整数的值 Incr 应该报错")
+	}
+}
+
+func TestRedisHash(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	if n := r.HSet(ctx, "h", "a", 1, "b", "2").Val(); n != 2 {
+		t.Fatalf("HSet = %d，期望 2", n)
+	}
+	if n := r.HSet(ctx, "h", map[string]interface{}{"b": 3, "c": 4}).Val(); n != 1 {
+		t.Fatalf("HSet 覆盖已有的 field 不计数，实际 %d", n)
+	}
+	if err := r.HSet(ctx, "h", "odd").Err(); err == nil {
+		t.Fatal("参数个数不对时 HSet 应该报错")
+	}
+	got := r.HGetAll(ctx, "h").Val()
+	if len(got) != 3 || got["a"] != "1" || got["b"] != "3" || got["c"] != "4" {
+		t.Fatalf("HGetAll = %v", got)
+	}
+
+	r.HDel(ctx, "h", "a", "b", "c")
+	if n := r.Exists(ctx, "h").Val(); n != 0 {
+		t.Fatal("field 删光之后 hash 应该不存在")
+	}
+}
+
+func TestRedisList(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	r.LPush(ctx, "l", 1, 2, 3)
+	r.LPush(ctx, "l", 4)
+	testCases := []struct {
+		name        string
+		start, stop int64
+		want        []string
+	}{
+		{name: "全部", start: 0, stop: -1, want: []string{"4", "3", "2", "1"}},
+		{name: "前两个", start: 0, stop: 1, want: []string{"4", "3"}},
+		{name: "负数下标", start: -2, stop: -1, want: []string{"2", "1"}},
+		{name: "超出范围", start: 2, stop: 100, want: []string{"2", "1"}},
+		{name: "空区间", start: 3, stop: 1, want: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := r.LRange(ctx, "l", tc.start, tc.stop).Val()
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("LRange(%d, %d) = %v，期望 %v", tc.start, tc.stop, got, tc.want)
+			}
+		})
+	}
+
+	r.LTrim(ctx, "l", 0, 1)
+	if got := r.LRange(ctx, "l", 0, -1).Val(); !slices.Equal(got, []string{"4", "3"}) {
+		t.Fatalf("LTrim 之后 = %v", got)
+	}
+	r.LTrim(ctx, "l", 5, 10)
+	if n := r.Exists(ctx, "l").Val(); n != 0 {
+		t.Fatal("LTrim 成空列表之后 key 应该不存在")
+	}
+}
+
+func TestRedisSortedSet(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	r.ZAdd(ctx, "z", redis.Z{Score: 3, Member: "c"}, redis.Z{Score: 1, Member: "a"}, redis.Z{Score: 2, Member: 2})
+	// 已经有的 member 只更新 score
+	if n := r.ZAdd(ctx, "z", redis.Z{Score: 2, Member: "b"}, redis.Z{Score: 1, Member: "a"}).Val(); n != 1 {
+		t.Fatalf("ZAdd 新加了 %d 个，期望 1 个", n)
+	}
+	testCases := []struct {
+		name     string
+		min, max string
+		count    int64
+		want     []string
+	}{
+		{name: "全部", min: "-inf", max: "+inf", want: []string{"a", "2", "b", "c"}},
+		{name: "闭区间", min: "1", max: "2", want: []string{"a", "2", "b"}},
+		{name: "开区间", min: "(1", max: "(3", want: []string{"2", "b"}},
+		{name: "限制条数", min: "-inf", max: "+inf", count: 2, want: []string{"a", "2"}},
+		{name: "没有", min: "4", max: "+inf", want: []string{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := r.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: tc.min, Max: tc.max, Count: tc.count}).Val()
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("ZRangeByScore(%s, %s) = %v，期望 %v", tc.min, tc.max, got, tc.want)
+			}
+		})
+	}
+
+	if n := r.ZRem(ctx, "z", "a", "x").Val(); n != 1 {
+		t.Fatalf("ZRem 删了 %d 个，期望 1 个", n)
+	}
+	if n := r.ZRemRangeByScore(ctx, "z", "-inf", "2").Val(); n != 2 {
+		t.Fatalf("ZRemRangeByScore 删了 %d 个，期望 2 个", n)
+	}
+	if got := r.ZRangeByScore(ctx, "z", &redis.ZRangeBy{Min: "-inf", Max: "+inf"}).Val(); !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("删除之后 = %v", got)
+	}
+	r.ZRem(ctx, "z", "c")
+	if n := r.Exists(ctx, "z").Val(); n != 0 {
+		t.Fatal("删空之后 key 应该不存在")
+	}
+}
+
+func TestRedisNotImplemented(t *testing.T) {
+	ctx := context.Background()
+	r := NewRedis()
+
+	if err := r.SAdd(ctx, "s", "a").Err(); !errors.Is(err, ErrRedisNotImplemented) {
+		t.Fatalf("没实现的命令应该返回 ErrRedisNotImplemented，实际是 %v", err)
+	}
+	if err := r.Eval(ctx, "-- unknown\nreturn 1", []string{"k"}).Err(); !errors.Is(err, ErrRedisNotImplemented) {
+		t.Fatalf("没实现的脚本应该返回 ErrRedisNotImplemented，实际是 %v", err)
+	}
+	_, err := r.Pipelined(ctx, func(p redis.Pipeliner) error {
+		p.Get(ctx, "k")
+		return nil
+	})
+	if !errors.Is(err, ErrRedisNotImplemented) {
+		t.Fatalf("pipeline 应该返回 ErrRedisNotImplemented，实际是 %v", err)
+	}
+}
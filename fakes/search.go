@@ -0,0 +1,109 @@
+package fakes
+
+import (
+	"context"
+	collectv1 "github.com/MuxiKeStack/be-api/gen/proto/collect/v1"
+	searchv1 "github.com/MuxiKeStack/be-api/gen/proto/search/v1"
+	"google.golang.org/grpc"
+	"strings"
+	"sync"
+)
+
+type searchHistoryKey struct {
+	uid      int64
+	location searchv1.SearchLocation
+}
+
+// SearchService 没有 es，直接在课程名和老师里做子串匹配
+type SearchService struct {
+	searchv1.SearchServiceClient
+	course     *CourseService
+	evaluation *EvaluationService
+	collect    *CollectService
+	ids        idGen
+	mu         sync.RWMutex
+	histories  map[searchHistoryKey][]*searchv1.History
+}
+
+func NewSearchService(course *CourseService, evaluation *EvaluationService, collect *CollectService) *SearchService {
+	return &SearchService{
+		course:     course,
+		evaluation: evaluation,
+		collect:    collect,
+		histories:  make(map[searchHistoryKey][]*searchv1.History),
+	}
+}
+
+func (s *SearchService) SearchCourse(ctx context.Context, in *searchv1.SearchCourseRequest, opts ...grpc.CallOption) (*searchv1.SearchCourseResponse, error) {
+	s.record(in.GetUid(), in.GetLocation(), in.GetKeyword())
+	var collected map[int64]struct{}
+	if in.GetLocation() == searchv1.SearchLocation_Collections {
+		collected = make(map[int64]struct{})
+		for _, c := range s.collect.mine(in.GetUid(), collectv1.Biz_Course) {
+			collected[c.BizId] = struct{}{}
+		}
+	}
+	res := &searchv1.SearchCourseResponse{}
+	for _, c := range s.course.list() {
+		if !strings.Contains(c.Name, in.GetKeyword()) && !strings.Contains(c.Teacher, in.GetKeyword()) {
+			continue
+		}
+		if _, ok := collected[c.Id]; collected != nil && !ok {
+			continue
+		}
+		score, _ := s.evaluation.compositeScore(c.Id)
+		res.Courses = append(res.Courses, &searchv1.Course{
+			Id:             c.Id,
+			Name:           c.Name,
+			Teacher:        c.Teacher,
+			CompositeScore: score,
+		})
+	}
+	return res, nil
+}
+
+func (s *SearchService) GetUserSearchHistories(ctx context.Context, in *searchv1.GetUserHistoryRequest, opts ...grpc.CallOption) (*searchv1.GetUserHistoryResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	histories := filter(s.histories[searchHistoryKey{uid: in.GetUid(), location: in.GetLocation()}], func(h *searchv1.History) bool {
+		return h.Status == searchv1.VisibilityStatus_Visible
+	})
+	res := &searchv1.GetUserHistoryResponse{}
+	// 新的在前
+	for i := len(histories) - 1 - int(in.GetOffset()); i >= 0 && int64(len(res.Histories)) < in.GetLimit(); i-- {
+		res.Histories = append(res.Histories, histories[i])
+	}
+	return res, nil
+}
+
+func (s *SearchService) HideUserSearchHistories(ctx context.Context, in *searchv1.HideUserSearchHistoriesRequest, opts ...grpc.CallOption) (*searchv1.HideUserSearchHistoriesResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := searchHistoryKey{uid: in.GetUid(), location: in.GetLocation()}
+	hidden := make(map[int64]struct{}, len(in.GetHistoryIds()))
+	for _, id := range in.GetHistoryIds() {
+		hidden[id] = struct{}{}
+	}
+	// 存下去的对象不改，换成隐藏状态的新对象
+	histories := s.histories[key]
+	for i, h := range histories {
+		if _, ok := hidden[h.Id]; ok || in.GetRemoveAll() {
+			histories[i] = &searchv1.History{Id: h.Id, Keyword: h.Keyword, Status: searchv1.VisibilityStatus_Hidden}
+		}
+	}
+	return &searchv1.HideUserSearchHistoriesResponse{}, nil
+}
+
+func (s *SearchService) record(uid int64, location searchv1.SearchLocation, keyword string) {
+	if uid == 0 || keyword == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := searchHistoryKey{uid: uid, location: location}
+	s.histories[key] = append(s.histories[key], &searchv1.History{
+		Id:      s.ids.next(),
+		Keyword: keyword,
+		Status:  searchv1.VisibilityStatus_Visible,
+	})
+}
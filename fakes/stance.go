@@ -0,0 +1,75 @@
+package fakes
+
+import (
+	"context"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+type stanceBiz struct {
+	biz   stancev1.Biz
+	bizId int64
+}
+
+type StanceService struct {
+	stancev1.StanceServiceClient
+	mu sync.RWMutex
+	// biz -> uid -> stance
+	stances map[stanceBiz]map[int64]stancev1.Stance
+}
+
+func NewStanceService() *StanceService {
+	return &StanceService{stances: make(map[stanceBiz]map[int64]stancev1.Stance)}
+}
+
+func (s *StanceService) Endorse(ctx context.Context, in *stancev1.EndorseRequest, opts ...grpc.CallOption) (*stancev1.EndorseResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := stanceBiz{biz: in.GetBiz(), bizId: in.GetBizId()}
+	users, ok := s.stances[key]
+	if !ok {
+		users = make(map[int64]stancev1.Stance)
+		s.stances[key] = users
+	}
+	if in.GetStance() == stancev1.Stance_None {
+		delete(users, in.GetUid())
+	} else {
+		users[in.GetUid()] = in.GetStance()
+	}
+	return &stancev1.EndorseResponse{}, nil
+}
+
+func (s *StanceService) GetUserStance(ctx context.Context, in *stancev1.GetUserStanceRequest, opts ...grpc.CallOption) (*stancev1.GetUserStanceResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	users := s.stances[stanceBiz{biz: in.GetBiz(), bizId: in.GetBizId()}]
+	supports, opposes := s.count(users)
+	return &stancev1.GetUserStanceResponse{
+		Stance:        users[in.GetUid()],
+		TotalSupports: supports,
+		TotalOpposes:  opposes,
+	}, nil
+}
+
+func (s *StanceService) CountStance(ctx context.Context, in *stancev1.CountStanceRequest, opts ...grpc.CallOption) (*stancev1.CountStanceResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	supports, opposes := s.count(s.stances[stanceBiz{biz: in.GetBiz(), bizId: in.GetBizId()}])
+	return &stancev1.CountStanceResponse{
+		TotalSupports: supports,
+		TotalOpposes:  opposes,
+	}, nil
+}
+
+func (s *StanceService) count(users map[int64]stancev1.Stance) (supports, opposes int64) {
+	for _, stance := range users {
+		switch stance {
+		case stancev1.Stance_Support:
+			supports++
+		case stancev1.Stance_Oppose:
+			opposes++
+		}
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package fakes
+
+import (
+	"context"
+	staticv1 "github.com/MuxiKeStack/be-api/gen/proto/static/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+type StaticService struct {
+	staticv1.StaticServiceClient
+	mu      sync.RWMutex
+	statics map[string]*staticv1.Static
+}
+
+func NewStaticService() *StaticService {
+	return &StaticService{statics: make(map[string]*staticv1.Static)}
+}
+
+func (s *StaticService) GetStaticByName(ctx context.Context, in *staticv1.GetStaticByNameRequest, opts ...grpc.CallOption) (*staticv1.GetStaticByNameResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &staticv1.GetStaticByNameResponse{Static: s.statics[in.GetName()]}, nil
+}
+
+func (s *StaticService) SaveStatic(ctx context.Context, in *staticv1.SaveStaticRequest, opts ...grpc.CallOption) (*staticv1.SaveStaticResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statics[in.GetStatic().GetName()] = in.GetStatic()
+	return &staticv1.SaveStaticResponse{}, nil
+}
+
+// GetStaticsByLabels 返回带有全部指定 label 的静态资源
+func (s *StaticService) GetStaticsByLabels(ctx context.Context, in *staticv1.GetStaticsByLabelsRequest, opts ...grpc.CallOption) (*staticv1.GetStaticsByLabelsResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := &staticv1.GetStaticsByLabelsResponse{}
+	for _, st := range s.statics {
+		matched := true
+		for k, v := range in.GetLabels() {
+			if st.GetLabels()[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			res.Statics = append(res.Statics, st)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,91 @@
+package fakes
+
+import (
+	"context"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+type taggerBiz struct {
+	taggerId int64
+	biz      tagv1.Biz
+	bizId    int64
+}
+
+// TagService Attach 是覆盖语义，存下去的切片不会再改
+type TagService struct {
+	tagv1.TagServiceClient
+	mu          sync.RWMutex
+	assessments map[taggerBiz][]tagv1.AssessmentTag
+	features    map[taggerBiz][]tagv1.FeatureTag
+}
+
+func NewTagService() *TagService {
+	return &TagService{
+		assessments: make(map[taggerBiz][]tagv1.AssessmentTag),
+		features:    make(map[taggerBiz][]tagv1.FeatureTag),
+	}
+}
+
+func (s *TagService) AttachAssessmentTags(ctx context.Context, in *tagv1.AttachAssessmentTagsRequest, opts ...grpc.CallOption) (*tagv1.AttachAssessmentTagsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assessments[taggerBiz{taggerId: in.GetTaggerId(), biz: in.GetBiz(), bizId: in.GetBizId()}] = in.GetTags()
+	return &tagv1.AttachAssessmentTagsResponse{}, nil
+}
+
+func (s *TagService) AttachFeatureTags(ctx context.Context, in *tagv1.AttachFeatureTagsRequest, opts ...grpc.CallOption) (*tagv1.AttachFeatureTagsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.features[taggerBiz{taggerId: in.GetTaggerId(), biz: in.GetBiz(), bizId: in.GetBizId()}] = in.GetTags()
+	return &tagv1.AttachFeatureTagsResponse{}, nil
+}
+
+func (s *TagService) GetAssessmentTagsByTaggerBiz(ctx context.Context, in *tagv1.GetAssessmentTagsByTaggerBizRequest, opts ...grpc.CallOption) (*tagv1.GetAssessmentTagsByTaggerBizResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &tagv1.GetAssessmentTagsByTaggerBizResponse{
+		Tags: s.assessments[taggerBiz{taggerId: in.GetTaggerId(), biz: in.GetBiz(), bizId: in.GetBizId()}],
+	}, nil
+}
+
+func (s *TagService) GetFeatureTagsByTaggerBiz(ctx context.Context, in *tagv1.GetFeatureTagsByTaggerBizRequest, opts ...grpc.CallOption) (*tagv1.GetFeatureTagsByTaggerBizResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return &tagv1.GetFeatureTagsByTaggerBizResponse{
+		Tags: s.features[taggerBiz{taggerId: in.GetTaggerId(), biz: in.GetBiz(), bizId: in.GetBizId()}],
+	}, nil
+}
+
+func (s *TagService) CountAssessmentTagsByCourseTagger(ctx context.Context, in *tagv1.CountAssessmentTagsByCourseTaggerRequest, opts ...grpc.CallOption) (*tagv1.CountAssessmentTagsByCourseTaggerResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cnts := make(map[tagv1.AssessmentTag]int64)
+	for _, taggerId := range in.GetTaggerIds() {
+		for _, tag := range s.assessments[taggerBiz{taggerId: taggerId, biz: tagv1.Biz_Course, bizId: in.GetCourseId()}] {
+			cnts[tag]++
+		}
+	}
+	res := &tagv1.CountAssessmentTagsByCourseTaggerResponse{}
+	for tag, cnt := range cnts {
+		res.Items = append(res.Items, &tagv1.CountAssessmentItem{Tag: tag, Count: cnt})
+	}
+	return res, nil
+}
+
+func (s *TagService) CountFeatureTagsByCourseTagger(ctx context.Context, in *tagv1.CountFeatureTagsByCourseTaggerRequest, opts ...grpc.CallOption) (*tagv1.CountFeatureTagsByCourseTaggerResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cnts := make(map[tagv1.FeatureTag]int64)
+	for _, taggerId := range in.GetTaggerIds() {
+		for _, tag := range s.features[taggerBiz{taggerId: taggerId, biz: tagv1.Biz_Course, bizId: in.GetCourseId()}] {
+			cnts[tag]++
+		}
+	}
+	res := &tagv1.CountFeatureTagsByCourseTaggerResponse{}
+	for tag, cnt := range cnts {
+		res.Items = append(res.Items, &tagv1.CountFeatureItem{Tag: tag, Count: cnt})
+	}
+	return res, nil
+}
@@ -0,0 +1,96 @@
+package fakes
+
+import (
+	"context"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"google.golang.org/grpc"
+	"sync"
+)
+
+// UserService 存下去的对象不会再改，更新时整个换掉，所以可以直接把指针返回出去
+type UserService struct {
+	userv1.UserServiceClient
+	ids   idGen
+	mu    sync.RWMutex
+	users []*userv1.User
+	bySid map[string]*userv1.User
+}
+
+func NewUserService() *UserService {
+	return &UserService{bySid: make(map[string]*userv1.User)}
+}
+
+func (s *UserService) FindOrCreateByStudentId(ctx context.Context, in *userv1.FindOrCreateByStudentIdRequest, opts ...grpc.CallOption) (*userv1.FindOrCreateByStudentIdResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.bySid[in.GetStudentId()]
+	if !ok {
+		t := now()
+		u = &userv1.User{
+			Id:        s.ids.next(),
+			StudentId: in.GetStudentId(),
+			Nickname:  "匿名学生" + in.GetStudentId(),
+			New:       true,
+			Utime:     t,
+			Ctime:     t,
+		}
+		s.users = append(s.users, u)
+		s.bySid[u.StudentId] = u
+	}
+	return &userv1.FindOrCreateByStudentIdResponse{User: u}, nil
+}
+
+func (s *UserService) Profile(ctx context.Context, in *userv1.ProfileRequest, opts ...grpc.CallOption) (*userv1.ProfileResponse, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.find(in.GetUid())
+	if !ok {
+		return nil, userv1.ErrorUserNotFound("用户不存在")
+	}
+	return &userv1.ProfileResponse{User: u}, nil
+}
+
+func (s *UserService) UpdateNonSensitiveInfo(ctx context.Context, in *userv1.UpdateNonSensitiveInfoRequest, opts ...grpc.CallOption) (*userv1.UpdateNonSensitiveInfoResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.find(in.GetUser().GetId())
+	if !ok {
+		return nil, userv1.ErrorUserNotFound("用户不存在")
+	}
+	nu := &userv1.User{
+		Id:        u.Id,
+		StudentId: u.StudentId,
+		Avatar:    u.Avatar,
+		Nickname:  u.Nickname,
+		Utime:     now(),
+		Ctime:     u.Ctime,
+	}
+	if in.GetUser().GetAvatar() != "" {
+		nu.Avatar = in.GetUser().GetAvatar()
+	}
+	if in.GetUser().GetNickname() != "" {
+		nu.Nickname = in.GetUser().GetNickname()
+	}
+	s.users[nu.Id-1] = nu
+	s.bySid[nu.StudentId] = nu
+	return &userv1.UpdateNonSensitiveInfoResponse{}, nil
+}
+
+// uids 按 id 升序返回所有用户的 id，给问题推荐邀请人用
+func (s *UserService) uids() []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]int64, 0, len(s.users))
+	for _, u := range s.users {
+		res = append(res, u.Id)
+	}
+	return res
+}
+
+// find 调用方要持有锁，id 是自增的，下标就是 id-1
+func (s *UserService) find(uid int64) (*userv1.User, bool) {
+	if uid < 1 || uid > int64(len(s.users)) {
+		return nil, false
+	}
+	return s.users[uid-1], true
+}
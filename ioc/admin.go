@@ -0,0 +1,48 @@
+package ioc
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/diag"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/recovery"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/MuxiKeStack/bff/web/middleware"
+	"github.com/ecodeclub/ekit/set"
+	"github.com/gin-gonic/gin"
+	"net"
+	"net/http"
+)
+
+// InitAdminServer 诊断用的管理端口，admin.addr 为空就不启动。建议只监听 127.0.0.1
+func InitAdminServer(jwtHdl ijwt.Handler, administrators *dynconf.Value[map[string]struct{}], dc *dynconf.Manager,
+	recoveryHdl *recovery.Builder, server *ginx.Server, cfg AdminConfig) *diag.Server {
+	engine := gin.New()
+	engine.Use(recoveryHdl.Build())
+	diag.NewHandler(server.Routes, dc.AllSettings).RegisterRoutes(engine, adminAuthHdl(jwtHdl, administrators))
+	return &diag.Server{
+		Server: &ginx.Server{
+			Engine: engine,
+			Addr:   cfg.Addr,
+		},
+	}
+}
+
+// adminAuthHdl 本机来的请求直接放行，其他的要带上管理员的 token
+func adminAuthHdl(jwtHdl ijwt.Handler, administrators *dynconf.Value[map[string]struct{}]) gin.HandlerFunc {
+	// 管理端口没有游客可以访问的路由
+	login := middleware.NewLoginMiddleWareBuilder(jwtHdl, dynconf.NewStatic[set.Set[string]](set.NewMapSet[string](0))).Build()
+	return func(ctx *gin.Context) {
+		// RemoteIP 是直连的地址，不看 X-Forwarded-For，伪造不了
+		if ip := net.ParseIP(ctx.RemoteIP()); ip != nil && ip.IsLoopback() {
+			return
+		}
+		login(ctx)
+		if ctx.IsAborted() {
+			return
+		}
+		uc, _ := ctx.MustGet("user").(ijwt.UserClaims)
+		if _, ok := administrators.Load()[uc.StudentId]; !ok {
+			ctx.AbortWithStatus(http.StatusForbidden)
+		}
+	}
+}
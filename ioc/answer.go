@@ -5,25 +5,16 @@ import (
 	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitAnswerClient(ecli *clientv3.Client) answerv1.AnswerServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.answer", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitAnswerClient(ecli *clientv3.Client, cfg GrpcConfig) answerv1.AnswerServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Answer.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(10*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Answer)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,16 @@
+package ioc
+
+import (
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	"github.com/MuxiKeStack/bff/pkg/cachex"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+func InitCourseCache(cmd redis.Cmdable, course coursev1.CourseServiceClient,
+	evaluation evaluationv1.EvaluationServiceClient, tag tagv1.TagServiceClient, cfg CacheConfig) cache.CourseCache {
+	return cache.NewTwoLevelCourseCache(cachex.NewReadThrough(cmd, cfg.LocalCapacity),
+		course, evaluation, tag, cfg.Course)
+}
@@ -3,34 +3,25 @@ package ioc
 import (
 	"context"
 	ccnuv1 "github.com/MuxiKeStack/be-api/gen/proto/ccnu/v1"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
 	webclient "github.com/MuxiKeStack/bff/web/client"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	etcdv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitCCNUClient(etcdClient *etcdv3.Client) ccnuv1.CCNUServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-		RetryCnt int    `yaml:"retryCnt"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.ccnu", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitCCNUClient(etcdClient *etcdv3.Client, dc *dynconf.Manager, cfg GrpcConfig) ccnuv1.CCNUServiceClient {
 	r := etcd.New(etcdClient)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.CCNU.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(10*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.CCNU)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
 	}
 	ccnuClient := ccnuv1.NewCCNUServiceClient(cc)
-	retryCCNUClient := webclient.NewRetryCCNUClient(ccnuClient, cfg.RetryCnt)
+	retryCCNUClient := webclient.NewRetryCCNUClient(ccnuClient, dynconf.Bind[int](dc, "grpc.client.ccnu.retryCnt"))
 	return retryCCNUClient
 }
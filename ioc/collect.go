@@ -5,25 +5,16 @@ import (
 	collectv1 "github.com/MuxiKeStack/be-api/gen/proto/collect/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitCollectClient(ecli *clientv3.Client) collectv1.CollectServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.collect", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitCollectClient(ecli *clientv3.Client, cfg GrpcConfig) collectv1.CollectServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Collect.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(100*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Collect)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,543 @@
+package ioc
+
+import (
+	"fmt"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/job"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/feature"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/cors"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/maintenance"
+	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/MuxiKeStack/bff/webhook"
+	"github.com/spf13/viper"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config 完整的配置，启动时解析并校验一次，各个 Init 方法通过 wire.FieldsOf 拿到自己的那一段。
+// 可以动态修改的（maintenance、features、http.cors、http.guestPaths、administrators）由 dynconf 绑定，这里只校验初始值
+type Config struct {
+	HTTP           HTTPConfig              `yaml:"http"`
+	Admin          AdminConfig             `yaml:"admin"`
+	DynConf        DynConfConfig           `yaml:"dynconf"`
+	Redis          RedisConfig             `yaml:"redis"`
+	Etcd           clientv3.Config         `yaml:"etcd"`
+	Kafka          KafkaConfig             `yaml:"kafka"`
+	Grpc           GrpcConfig              `yaml:"grpc"`
+	Administrators []string                `yaml:"administrators"`
+	Jwt            JwtConfig               `yaml:"jwt"`
+	Oss            OssConfig               `yaml:"oss"`
+	Cache          CacheConfig             `yaml:"cache"`
+	Aggregation    AggregationConfig       `yaml:"aggregation"`
+	Feed           web.FeedPresentConfig   `yaml:"feed"`
+	Maintenance    maintenance.Config      `yaml:"maintenance"`
+	Features       map[string]feature.Flag `yaml:"features"`
+	Email          EmailConfig             `yaml:"email"`
+	Webhook        webhook.Config          `yaml:"webhook"`
+}
+
+type HTTPConfig struct {
+	Addr    string `yaml:"addr"`
+	Timeout struct {
+		Default time.Duration `yaml:"default"`
+		Routes  []struct {
+			Method  string        `yaml:"method"`
+			Pattern string        `yaml:"pattern"`
+			Timeout time.Duration `yaml:"timeout"`
+		} `yaml:"routes"`
+	} `yaml:"timeout"`
+	Cache struct {
+		SharedTTL time.Duration `yaml:"sharedTTL"`
+		Routes    []struct {
+			Pattern string        `yaml:"pattern"`
+			MaxAge  time.Duration `yaml:"maxAge"`
+			Shared  bool          `yaml:"shared"`
+		} `yaml:"routes"`
+	} `yaml:"cache"`
+	Pagination struct {
+		CursorKey    string `yaml:"cursorKey"`
+		DefaultLimit int64  `yaml:"defaultLimit"`
+		MaxLimit     int64  `yaml:"maxLimit"`
+	} `yaml:"pagination"`
+	Batch struct {
+		MaxRequests int `yaml:"maxRequests"`
+		Concurrency int `yaml:"concurrency"`
+	} `yaml:"batch"`
+	GraphQL struct {
+		MaxDepth       int `yaml:"maxDepth"`
+		MaxComplexity  int `yaml:"maxComplexity"`
+		MaxQueryLength int `yaml:"maxQueryLength"`
+	} `yaml:"graphql"`
+	FeedStream struct {
+		Heartbeat time.Duration `yaml:"heartbeat"`
+	} `yaml:"feedStream"`
+	Idempotency struct {
+		TTL         time.Duration `yaml:"ttl"`
+		InflightTTL time.Duration `yaml:"inflightTTL"`
+	} `yaml:"idempotency"`
+	Cors struct {
+		Profile  string                 `yaml:"profile"`
+		Profiles map[string]cors.Config `yaml:"profiles"`
+	} `yaml:"cors"`
+	GuestPaths []string `yaml:"guestPaths"`
+}
+
+type AdminConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type DynConfConfig struct {
+	EtcdPrefix string `yaml:"etcdPrefix"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+}
+
+type KafkaConfig struct {
+	Addrs    []string              `yaml:"addrs"`
+	Consumer events.ConsumerConfig `yaml:"consumer"`
+}
+
+type GrpcConfig struct {
+	Client struct {
+		// Timeout 单次调用下游的上限，各个客户端可以单独配置
+		Timeout time.Duration `yaml:"timeout"`
+		// HopReserve 每一跳从截止时间里扣掉的时间，留给 BFF 自己处理超时
+		HopReserve time.Duration    `yaml:"hopReserve"`
+		User       GrpcClientConfig `yaml:"user"`
+		CCNU       GrpcClientConfig `yaml:"ccnu"`
+		Course     GrpcClientConfig `yaml:"course"`
+		Evaluation GrpcClientConfig `yaml:"evaluation"`
+		Question   GrpcClientConfig `yaml:"question"`
+		Tag        GrpcClientConfig `yaml:"tag"`
+		Comment    GrpcClientConfig `yaml:"comment"`
+		Stance     GrpcClientConfig `yaml:"stance"`
+		Collect    GrpcClientConfig `yaml:"collect"`
+		Search     GrpcClientConfig `yaml:"search"`
+		Grade      GrpcClientConfig `yaml:"grade"`
+		Static     GrpcClientConfig `yaml:"static"`
+		Answer     GrpcClientConfig `yaml:"answer"`
+		Point      GrpcClientConfig `yaml:"point"`
+		Feed       GrpcClientConfig `yaml:"feed"`
+	} `yaml:"client"`
+}
+
+type GrpcClientConfig struct {
+	Endpoint string        `yaml:"endpoint"`
+	Timeout  time.Duration `yaml:"timeout"`
+	RetryCnt int           `yaml:"retryCnt"`
+}
+
+type JwtConfig struct {
+	JwtKey     string `yaml:"jwtKey"`
+	RefreshKey string `yaml:"refreshKey"`
+}
+
+type OssConfig struct {
+	AccessKey  string `yaml:"accessKey"`
+	SecretKey  string `yaml:"secretKey"`
+	BucketName string `yaml:"bucketName"`
+	DomainName string `yaml:"domainName"`
+}
+
+type CacheConfig struct {
+	LocalCapacity int                     `yaml:"localCapacity"`
+	Course        cache.CourseCacheConfig `yaml:"course"`
+}
+
+type AggregationConfig struct {
+	Concurrency int `yaml:"concurrency"`
+}
+
+type EmailConfig struct {
+	Smtp   email.SMTPConfig        `yaml:"smtp"`
+	Verify cache.EmailVerifyConfig `yaml:"verify"`
+	Digest job.DigestConfig        `yaml:"digest"`
+}
+
+// clients 所有的下游服务，key 是配置里的名字
+func (c GrpcConfig) clients() map[string]GrpcClientConfig {
+	return map[string]GrpcClientConfig{
+		"user": c.Client.User, "ccnu": c.Client.CCNU, "course": c.Client.Course, "evaluation": c.Client.Evaluation,
+		"question": c.Client.Question, "tag": c.Client.Tag, "comment": c.Client.Comment, "stance": c.Client.Stance,
+		"collect": c.Client.Collect, "search": c.Client.Search, "grade": c.Client.Grade, "static": c.Client.Static,
+		"answer": c.Client.Answer, "point": c.Client.Point, "feed": c.Client.Feed,
+	}
+}
+
+// jwt 和分页游标用的都是 HMAC-SHA256，key 至少要 32 字节
+const minKeyLen = 32
+
+// LoadConfig 启动时解析并校验配置，把所有问题一次性列出来，而不是在某个 Init 方法里 panic 一个。
+// standalone 模式不连 redis、etcd、kafka 和下游服务，这些配置不校验。
+// warnings 是不影响启动、但是有功能用不了的配置，比如本地开发没有七牛的 key
+func LoadConfig(standalone bool) (cfg *Config, warnings []string, err error) {
+	cfg = &Config{}
+	err = viper.Unmarshal(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析配置失败：%w", err)
+	}
+	warnings, err = cfg.check(standalone)
+	if err != nil {
+		return nil, warnings, err
+	}
+	return cfg, warnings, nil
+}
+
+func (cfg *Config) check(standalone bool) ([]string, error) {
+	var c checker
+
+	c.addr("http.addr", cfg.HTTP.Addr, true)
+	c.addr("admin.addr", cfg.Admin.Addr, false)
+	if cfg.Admin.Addr != "" && cfg.Admin.Addr == cfg.HTTP.Addr {
+		c.add("admin.addr", "不能和 http.addr 相同")
+	}
+	if cfg.HTTP.Timeout.Default <= 0 {
+		c.add("http.timeout.default", "必须大于 0")
+	}
+	routes := make(map[string]struct{}, len(cfg.HTTP.Timeout.Routes))
+	for i, r := range cfg.HTTP.Timeout.Routes {
+		field := fmt.Sprintf("http.timeout.routes[%d]", i)
+		c.method(field+".method", r.Method)
+		c.pattern(field+".pattern", r.Pattern)
+		if r.Timeout <= 0 {
+			c.add(field+".timeout", "必须大于 0")
+		}
+		key := strings.ToUpper(r.Method) + " " + r.Pattern
+		if _, ok := routes[key]; ok {
+			c.add(field, "和前面的 %s 重复了", key)
+		}
+		routes[key] = struct{}{}
+	}
+	if cfg.HTTP.Cache.SharedTTL < 0 {
+		c.add("http.cache.sharedTTL", "不能小于 0")
+	}
+	for i, r := range cfg.HTTP.Cache.Routes {
+		field := fmt.Sprintf("http.cache.routes[%d]", i)
+		c.pattern(field+".pattern", r.Pattern)
+		if r.MaxAge < 0 {
+			c.add(field+".maxAge", "不能小于 0")
+		}
+	}
+	c.key("http.pagination.cursorKey", cfg.HTTP.Pagination.CursorKey)
+	if cfg.HTTP.Pagination.DefaultLimit <= 0 || cfg.HTTP.Pagination.DefaultLimit > cfg.HTTP.Pagination.MaxLimit {
+		c.add("http.pagination.defaultLimit", "必须大于 0，并且不超过 http.pagination.maxLimit")
+	}
+	if cfg.HTTP.Batch.MaxRequests <= 0 {
+		c.add("http.batch.maxRequests", "必须大于 0")
+	}
+	if cfg.HTTP.Batch.Concurrency <= 0 {
+		c.add("http.batch.concurrency", "必须大于 0")
+	}
+	if cfg.HTTP.GraphQL.MaxDepth <= 0 {
+		c.add("http.graphql.maxDepth", "必须大于 0")
+	}
+	if cfg.HTTP.GraphQL.MaxComplexity <= 0 {
+		c.add("http.graphql.maxComplexity", "必须大于 0")
+	}
+	if cfg.HTTP.GraphQL.MaxQueryLength <= 0 {
+		c.add("http.graphql.maxQueryLength", "必须大于 0")
+	}
+	if cfg.HTTP.FeedStream.Heartbeat <= 0 {
+		c.add("http.feedStream.heartbeat", "必须大于 0")
+	}
+	if cfg.HTTP.Idempotency.TTL <= 0 {
+		c.add("http.idempotency.ttl", "必须大于 0")
+	}
+	if cfg.HTTP.Idempotency.InflightTTL <= 0 {
+		c.add("http.idempotency.inflightTTL", "必须大于 0")
+	}
+	if _, ok := cfg.HTTP.Cors.Profiles[strings.ToLower(cfg.HTTP.Cors.Profile)]; !ok {
+		c.add("http.cors.profile", "http.cors.profiles 里没有 %q", cfg.HTTP.Cors.Profile)
+	}
+	for _, name := range sortedKeys(cfg.HTTP.Cors.Profiles) {
+		profile := cfg.HTTP.Cors.Profiles[name]
+		for i, origin := range profile.AllowOrigins {
+			c.origin(fmt.Sprintf("http.cors.profiles.%s.allowOrigins[%d]", name, i), origin)
+		}
+		for i, method := range profile.AllowMethods {
+			c.method(fmt.Sprintf("http.cors.profiles.%s.allowMethods[%d]", name, i), method)
+		}
+	}
+	for i, p := range cfg.HTTP.GuestPaths {
+		c.pattern(fmt.Sprintf("http.guestPaths[%d]", i), p)
+	}
+	c.duplicates("http.guestPaths", cfg.HTTP.GuestPaths)
+	for i, r := range cfg.HTTP.Cache.Routes {
+		// 共享缓存不会替没写进游客名单的路由放行游客，这样配置共享缓存不会生效
+		if r.Shared && !slices.Contains(cfg.HTTP.GuestPaths, r.Pattern) {
+			c.add(fmt.Sprintf("http.cache.routes[%d].shared", i), "%s 不在 http.guestPaths 里，共享缓存只给游客用", r.Pattern)
+		}
+	}
+
+	c.key("jwt.jwtKey", cfg.Jwt.JwtKey)
+	c.key("jwt.refreshKey", cfg.Jwt.RefreshKey)
+	if cfg.Jwt.JwtKey != "" && cfg.Jwt.JwtKey == cfg.Jwt.RefreshKey {
+		c.add("jwt.refreshKey", "不能和 jwt.jwtKey 相同")
+	}
+
+	if len(cfg.Administrators) == 0 {
+		c.add("administrators", "至少要有一个管理员")
+	}
+	for i, sid := range cfg.Administrators {
+		if sid == "" {
+			c.add(fmt.Sprintf("administrators[%d]", i), "学号不能为空")
+		}
+	}
+	c.duplicates("administrators", cfg.Administrators)
+
+	if cfg.Aggregation.Concurrency < 0 {
+		c.add("aggregation.concurrency", "不能小于 0")
+	}
+	if !maintenance.ValidMode(cfg.Maintenance.Mode) {
+		c.add("maintenance.mode", "只能是空、%s 或者 %s", maintenance.ModeReadOnly, maintenance.ModeFull)
+	}
+	for _, name := range sortedKeys(cfg.Features) {
+		if err := cfg.Features[name].Validate(); err != nil {
+			c.add("features."+name, "%s", err)
+		}
+	}
+
+	for _, biz := range sortedKeys(cfg.Feed.Links) {
+		if !strings.Contains(cfg.Feed.Links[biz], "{id}") {
+			c.add("feed.links."+biz, "要包含 {id}")
+		}
+	}
+	for _, typ := range sortedKeys(cfg.Feed.Types) {
+		if cfg.Feed.Types[typ].GroupWindow < 0 {
+			c.add("feed.types."+typ+".groupWindow", "不能小于 0")
+		}
+		switch setting := cfg.Feed.Types[typ].Setting; setting {
+		case "", cache.NotifyComment, cache.NotifyReply, cache.NotifyStance, cache.NotifyInvitation:
+		default:
+			c.add("feed.types."+typ+".setting", "不认识的通知类型 %q", setting)
+		}
+	}
+
+	if cfg.Email.Verify.TTL <= 0 {
+		c.add("email.verify.ttl", "必须大于 0")
+	}
+	if cfg.Email.Verify.ResendInterval <= 0 {
+		c.add("email.verify.resendInterval", "必须大于 0")
+	}
+	if cfg.Email.Verify.MaxAttempts <= 0 {
+		c.add("email.verify.maxAttempts", "必须大于 0")
+	}
+	if cfg.Email.Digest.Hour < 0 || cfg.Email.Digest.Hour > 23 {
+		c.add("email.digest.hour", "必须在 0 到 23 之间")
+	}
+	if cfg.Email.Digest.Weekday < time.Sunday || cfg.Email.Digest.Weekday > time.Saturday {
+		c.add("email.digest.weekday", "必须在 0（周日）到 6 之间")
+	}
+	if cfg.Email.Digest.MaxEvents <= 0 {
+		c.add("email.digest.maxEvents", "必须大于 0")
+	}
+
+	if cfg.Webhook.Workers <= 0 {
+		c.add("webhook.workers", "必须大于 0")
+	}
+	if cfg.Webhook.Timeout <= 0 {
+		c.add("webhook.timeout", "必须大于 0")
+	}
+	if cfg.Webhook.MaxAttempts <= 0 {
+		c.add("webhook.maxAttempts", "必须大于 0")
+	}
+	if cfg.Webhook.Backoff <= 0 || cfg.Webhook.MaxBackoff < cfg.Webhook.Backoff {
+		c.add("webhook.backoff", "必须大于 0，并且不能超过 webhook.maxBackoff")
+	}
+	if cfg.Webhook.KeepDeliveries <= 0 {
+		c.add("webhook.keepDeliveries", "必须大于 0")
+	}
+	if cfg.Webhook.SweepInterval <= 0 {
+		c.add("webhook.sweepInterval", "必须大于 0")
+	}
+	if cfg.Webhook.DeliveryTTL <= 0 {
+		c.add("webhook.deliveryTTL", "必须大于 0")
+	}
+
+	c.domain("oss.domainName", cfg.Oss.DomainName)
+	if cfg.Oss.BucketName == "" {
+		c.add("oss.bucketName", "不能为空")
+	}
+
+	if !standalone {
+		c.addr("redis.addr", cfg.Redis.Addr, true)
+		c.addrs("etcd.endpoints", cfg.Etcd.Endpoints)
+		c.addrs("kafka.addrs", cfg.Kafka.Addrs)
+		// standalone 模式不消费 kafka
+		if cfg.Kafka.Consumer.MaxRetryTime <= 0 {
+			c.add("kafka.consumer.maxRetryTime", "必须大于 0，不然处理不了的消息会一直卡住分区")
+		}
+		// 没有七牛的 key 只会生成一个用不了的上传凭证，不影响启动，本地开发一般也不配
+		if cfg.Oss.AccessKey == "" {
+			c.warn("oss.accessKey", "为空，上传凭证用不了")
+		}
+		if cfg.Oss.SecretKey == "" {
+			c.warn("oss.secretKey", "为空，上传凭证用不了")
+		}
+		// standalone 模式的邮件只打日志
+		c.addr("email.smtp.addr", cfg.Email.Smtp.Addr, true)
+		if _, err := mail.ParseAddress(cfg.Email.Smtp.From); err != nil {
+			c.add("email.smtp.from", "%q 格式不对，应该形如 课栈 <noreply@example.com>", cfg.Email.Smtp.From)
+		}
+		checkGrpcClients(&c, cfg.Grpc)
+	}
+	return c.warns, c.err()
+}
+
+func checkGrpcClients(c *checker, cfg GrpcConfig) {
+	timeout := cfg.Client.Timeout
+	if timeout <= 0 {
+		c.add("grpc.client.timeout", "必须大于 0")
+	}
+	if hopReserve := cfg.Client.HopReserve; hopReserve < 0 || (timeout > 0 && hopReserve >= timeout) {
+		c.add("grpc.client.hopReserve", "必须在 0 到 grpc.client.timeout 之间")
+	}
+	clients := cfg.clients()
+	endpoints := make(map[string]string, len(clients))
+	for _, name := range sortedKeys(clients) {
+		field := "grpc.client." + name
+		client := clients[name]
+		if client.Timeout < 0 {
+			c.add(field+".timeout", "不能小于 0，不配置就用 grpc.client.timeout")
+		}
+		if client.RetryCnt < 0 {
+			c.add(field+".retryCnt", "不能小于 0")
+		}
+		if client.Endpoint == "" {
+			c.add(field+".endpoint", "不能为空")
+			continue
+		}
+		u, err := url.Parse(client.Endpoint)
+		if err != nil || u.Scheme != "discovery" || strings.Trim(u.Path, "/") == "" {
+			c.add(field+".endpoint", "%q 格式不对，应该形如 discovery:///%s", client.Endpoint, name)
+			continue
+		}
+		if other, ok := endpoints[client.Endpoint]; ok {
+			c.add(field+".endpoint", "和 grpc.client.%s 重复了", other)
+		}
+		endpoints[client.Endpoint] = name
+	}
+}
+
+// checker 收集所有的配置错误和警告
+type checker struct {
+	errs  []string
+	warns []string
+}
+
+func (c *checker) add(field, format string, args ...any) {
+	c.errs = append(c.errs, field+"："+fmt.Sprintf(format, args...))
+}
+
+func (c *checker) warn(field, format string, args ...any) {
+	c.warns = append(c.warns, field+"："+fmt.Sprintf(format, args...))
+}
+
+func (c *checker) err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("配置有 %d 处错误：\n  - %s", len(c.errs), strings.Join(c.errs, "\n  - "))
+}
+
+func (c *checker) addr(field, addr string, required bool) {
+	if addr == "" {
+		if required {
+			c.add(field, "不能为空")
+		}
+		return
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" {
+		c.add(field, "%q 格式不对，应该形如 host:port 或者 :port", addr)
+	}
+}
+
+func (c *checker) addrs(field string, addrs []string) {
+	if len(addrs) == 0 {
+		c.add(field, "不能为空")
+	}
+	for i, addr := range addrs {
+		// etcd 的地址可以带上 http://
+		addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+		c.addr(fmt.Sprintf("%s[%d]", field, i), addr, true)
+	}
+	c.duplicates(field, addrs)
+}
+
+func (c *checker) duplicates(field string, vals []string) {
+	seen := make(map[string]struct{}, len(vals))
+	for i, val := range vals {
+		if _, ok := seen[val]; ok {
+			c.add(fmt.Sprintf("%s[%d]", field, i), "%q 重复了", val)
+		}
+		seen[val] = struct{}{}
+	}
+}
+
+func (c *checker) key(field, key string) {
+	if len(key) < minKeyLen {
+		c.add(field, "长度至少要 %d，现在是 %d", minKeyLen, len(key))
+	}
+}
+
+func (c *checker) method(field, method string) {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		c.add(field, "%q 不是合法的 HTTP 方法", method)
+	}
+}
+
+func (c *checker) pattern(field, pattern string) {
+	if !strings.HasPrefix(pattern, "/") {
+		c.add(field, "%q 要以 / 开头，用注册路由时的写法，例如 /courses/:courseId/detail", pattern)
+	}
+}
+
+func (c *checker) origin(field, origin string) {
+	if origin == "*" {
+		return
+	}
+	if _, err := path.Match(origin, ""); err != nil {
+		c.add(field, "%q 通配符写错了", origin)
+		return
+	}
+	if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+		c.add(field, "%q 要带上 http:// 或者 https://，浏览器发的 Origin 是带协议的", origin)
+	}
+}
+
+func (c *checker) domain(field, domain string) {
+	if domain == "" {
+		c.add(field, "不能为空")
+		return
+	}
+	if strings.Contains(domain, "://") || strings.Contains(domain, "/") {
+		c.add(field, "%q 只要域名，不要带协议和路径", domain)
+	}
+}
+
+// sortedKeys 让报错的顺序固定下来
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
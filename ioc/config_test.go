@@ -0,0 +1,106 @@
+package ioc
+
+import (
+	"github.com/spf13/viper"
+	"strings"
+	"testing"
+)
+
+func loadDevConfig(t *testing.T) *Config {
+	t.Helper()
+	viper.Reset()
+	viper.SetConfigType("yaml")
+	viper.SetConfigFile("../config/dev.yaml")
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := LoadConfig(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// TestDevConfig 仓库里的 dev.yaml 两种模式下都要能通过 --check-config
+func TestDevConfig(t *testing.T) {
+	testCases := []struct {
+		name         string
+		standalone   bool
+		wantWarnings []string
+	}{
+		{name: "standalone", standalone: true},
+		{name: "连真实的服务", wantWarnings: []string{"oss.accessKey", "oss.secretKey"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadDevConfig(t)
+			warnings, err := cfg.check(tc.standalone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(warnings) != len(tc.wantWarnings) {
+				t.Fatalf("警告 = %v，期望 %v", warnings, tc.wantWarnings)
+			}
+			for i, field := range tc.wantWarnings {
+				if !strings.HasPrefix(warnings[i], field+"：") {
+					t.Fatalf("第 %d 个警告 = %s，期望是 %s 的", i, warnings[i], field)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	testCases := []struct {
+		name       string
+		standalone bool
+		modify     func(cfg *Config)
+		wantField  string
+	}{
+		{
+			name:      "共享缓存的路由不是游客路由",
+			modify:    func(cfg *Config) { cfg.HTTP.GuestPaths = nil },
+			wantField: "http.cache.routes",
+		},
+		{
+			name: "功能开关开着但没有规则",
+			modify: func(cfg *Config) {
+				flag := cfg.Features["feed_stream"]
+				flag.Percentage = 0
+				cfg.Features["feed_stream"] = flag
+			},
+			wantField: "features.feed_stream",
+		},
+		{
+			name:      "webhook 不扫漏掉的投递",
+			modify:    func(cfg *Config) { cfg.Webhook.SweepInterval = 0 },
+			wantField: "webhook.sweepInterval",
+		},
+		{
+			name:      "消费者不限制重试时间",
+			modify:    func(cfg *Config) { cfg.Kafka.Consumer.MaxRetryTime = 0 },
+			wantField: "kafka.consumer.maxRetryTime",
+		},
+		{
+			name:       "standalone 不消费 kafka",
+			standalone: true,
+			modify:     func(cfg *Config) { cfg.Kafka.Consumer.MaxRetryTime = 0 },
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := loadDevConfig(t)
+			tc.modify(cfg)
+			_, err := cfg.check(tc.standalone)
+			if tc.wantField == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantField) {
+				t.Fatalf("err = %v，期望 %s 出错", err, tc.wantField)
+			}
+		})
+	}
+}
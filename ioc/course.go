@@ -5,25 +5,16 @@ import (
 	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitCourseClient(ecli *clientv3.Client) coursev1.CourseServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.course", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitCourseClient(ecli *clientv3.Client, cfg GrpcConfig) coursev1.CourseServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Course.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(10*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Course)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,35 @@
+package ioc
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/spf13/viper"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func InitDynConf(l logger.Logger, client *clientv3.Client, cfg DynConfConfig) *dynconf.Manager {
+	m := InitStandaloneDynConf(l)
+	// 没配置前缀就只监听配置文件
+	if cfg.EtcdPrefix == "" {
+		return m
+	}
+	err := m.WatchEtcd(context.Background(), client, cfg.EtcdPrefix)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// InitStandaloneDynConf standalone 模式没有 etcd，只监听配置文件
+func InitStandaloneDynConf(l logger.Logger) *dynconf.Manager {
+	m, err := dynconf.NewManager(l, viper.ConfigFileUsed())
+	if err != nil {
+		panic(err)
+	}
+	err = m.WatchFile()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
@@ -0,0 +1,36 @@
+package ioc
+
+import (
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/job"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+func InitEmailSender(cfg EmailConfig) email.Sender {
+	sender, err := email.NewSMTPSender(cfg.Smtp)
+	if err != nil {
+		panic(err)
+	}
+	return sender
+}
+
+// InitEmailVerification email.verify.ttl 是验证码的有效期，resendInterval 是两次发送的最小间隔，maxAttempts 是最多能输错几次
+func InitEmailVerification(cmd redis.Cmdable, cfg EmailConfig) cache.EmailVerification {
+	return cache.NewRedisEmailVerification(cmd, cfg.Verify)
+}
+
+func InitEmailHandler(userClient userv1.UserServiceClient, settings cache.UserSettingsStore,
+	verification cache.EmailVerification, sender email.Sender, cfg EmailConfig) *web.EmailHandler {
+	return web.NewEmailHandler(userClient, settings, verification, sender, cfg.Verify.TTL)
+}
+
+// InitDigestJob 邮件摘要，每天 email.digest.hour 点（北京时间）发日摘要，周摘要在 email.digest.weekday 发
+func InitDigestJob(feedClient feedv1.FeedServiceClient, userClient userv1.UserServiceClient, settings cache.UserSettingsStore,
+	presenter *web.FeedPresenter, sender email.Sender, cmd redis.Cmdable, l logger.Logger, cfg EmailConfig) *job.Digest {
+	return job.NewDigest(feedClient, userClient, settings, presenter, sender, cmd, cfg.Digest, l)
+}
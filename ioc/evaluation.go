@@ -5,25 +5,16 @@ import (
 	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitEvaluationClient(ecli *clientv3.Client) evaluationv1.EvaluationServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.evaluation", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitEvaluationClient(ecli *clientv3.Client, cfg GrpcConfig) evaluationv1.EvaluationServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Evaluation.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(10*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Evaluation)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
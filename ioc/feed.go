@@ -2,28 +2,28 @@ package ioc
 
 import (
 	"context"
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
 	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
+	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitFeedClient(ecli *clientv3.Client) feedv1.FeedServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.feed", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitFeedClient(ecli *clientv3.Client, cfg GrpcConfig) feedv1.FeedServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Feed.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(100*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Feed)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -31,3 +31,18 @@ func InitFeedClient(ecli *clientv3.Client) feedv1.FeedServiceClient {
 	client := feedv1.NewFeedServiceClient(cc)
 	return client
 }
+
+// InitFeedHub feed 事件的实时推送。feed 服务产生事件后发出 feed.created 事件，
+// BFF 消费之后把 JSON 格式的 FeedEvent 发布到 kstack:feed_stream:{uid} 频道（见 web.FeedStreamHandler），
+// 每个 BFF 实例再推给连在自己身上的客户端
+func InitFeedHub(broker pubsub.Broker, l logger.Logger) *pubsub.Hub {
+	return pubsub.NewHub(broker, "kstack:feed_stream:", l)
+}
+
+// InitFeedPresenter feed 的展示方式，见 feed.links 和 feed.types
+func InitFeedPresenter(userClient userv1.UserServiceClient, settings cache.UserSettingsStore,
+	evaluationClient evaluationv1.EvaluationServiceClient, questionClient questionv1.QuestionServiceClient,
+	answerClient answerv1.AnswerServiceClient, commentClient commentv1.CommentServiceClient,
+	courseCache cache.CourseCache, cfg web.FeedPresentConfig) *web.FeedPresenter {
+	return web.NewFeedPresenter(userClient, settings, evaluationClient, questionClient, answerClient, commentClient, courseCache, cfg)
+}
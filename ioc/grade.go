@@ -5,25 +5,16 @@ import (
 	gradev1 "github.com/MuxiKeStack/be-api/gen/proto/grade/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitGradeClient(ecli *clientv3.Client) gradev1.GradeServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.grade", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitGradeClient(ecli *clientv3.Client, cfg GrpcConfig) gradev1.GradeServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Grade.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(100*time.Second), // TODO
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Grade)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,21 @@
+package ioc
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/grpcx"
+	"google.golang.org/grpc"
+	"time"
+)
+
+// clientTimeout 单次调用下游的上限，没单独配置就用 grpc.client.timeout。
+// 请求本身剩下的时间更短的话以请求的为准
+func (c GrpcConfig) clientTimeout(client GrpcClientConfig) time.Duration {
+	if client.Timeout > 0 {
+		return client.Timeout
+	}
+	return c.Client.Timeout
+}
+
+// deadlineBudget 每一跳都从截止时间里扣掉 grpc.client.hopReserve，留给 BFF 自己处理超时
+func (c GrpcConfig) deadlineBudget() grpc.UnaryClientInterceptor {
+	return grpcx.DeadlineBudget(c.Client.HopReserve)
+}
@@ -1,30 +1,75 @@
 package ioc
 
 import (
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
 	staticv1 "github.com/MuxiKeStack/be-api/gen/proto/static/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/feature"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
 	"github.com/MuxiKeStack/bff/pkg/htmlx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
 	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/MuxiKeStack/bff/web/graphql"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/qiniu/api.v7/v7/auth/qbox"
 	"github.com/qiniu/api.v7/v7/storage"
-	"github.com/spf13/viper"
 )
 
-func InitStaticHandler(staticClient staticv1.StaticServiceClient) *web.StaticHandler {
-	var administrators []string
-	err := viper.UnmarshalKey("administrators", &administrators)
-	if err != nil {
-		panic(err)
-	}
+// InitAdministrators 因为没有管理员系统，所以直接将管理员的学号写入配置文件
+func InitAdministrators(dc *dynconf.Manager) *dynconf.Value[map[string]struct{}] {
+	return dynconf.Map(dynconf.Bind[[]string](dc, "administrators"),
+		func(administrators []string) map[string]struct{} {
+			return slice.ToMapV(administrators, func(element string) (string, struct{}) {
+				return element, struct{}{}
+			})
+		})
+}
+
+func InitStaticHandler(staticClient staticv1.StaticServiceClient,
+	administrators *dynconf.Value[map[string]struct{}]) *web.StaticHandler {
 	return web.NewStaticHandler(staticClient,
 		map[string]htmlx.FileToHTMLConverter{
 			//"docx": &htmlx.DocxToHTMLConverter{},
 		},
-		slice.ToMapV(administrators, func(element string) (string, struct{}) {
-			return element, struct{}{}
-		}))
+		administrators)
+}
+
+// InitPager http.pagination 是所有列表接口统一的分页配置
+func InitPager(cfg HTTPConfig) *ginx.Pager {
+	return ginx.NewPager([]byte(cfg.Pagination.CursorKey), cfg.Pagination.DefaultLimit, cfg.Pagination.MaxLimit)
+}
+
+// InitBatchHandler http.batch.maxRequests 是一次最多的子请求数，concurrency 是同时执行的子请求数
+func InitBatchHandler(cfg HTTPConfig) *web.BatchHandler {
+	return web.NewBatchHandler(cfg.Batch.MaxRequests, cfg.Batch.Concurrency)
+}
+
+// InitGraphQLHandler http.graphql.maxDepth 是查询的最大嵌套深度，maxComplexity 是字段复杂度之和的上限，
+// maxQueryLength 是查询文本的最大字节数
+func InitGraphQLHandler(userClient userv1.UserServiceClient, evaluationClient evaluationv1.EvaluationServiceClient,
+	questionClient questionv1.QuestionServiceClient, answerClient answerv1.AnswerServiceClient,
+	commentClient commentv1.CommentServiceClient, stanceClient stancev1.StanceServiceClient,
+	tagClient tagv1.TagServiceClient, courseCache cache.CourseCache, settings cache.UserSettingsStore, pager *ginx.Pager,
+	l logger.Logger, cfg HTTPConfig) *graphql.GraphQLHandler {
+	return graphql.NewGraphQLHandler(userClient, evaluationClient, questionClient, answerClient, commentClient,
+		stanceClient, tagClient, courseCache, settings, pager, l, cfg.GraphQL.MaxDepth, cfg.GraphQL.MaxComplexity, cfg.GraphQL.MaxQueryLength)
+}
+
+// InitFeedHandler http.feedStream.heartbeat 是推送连接上的心跳间隔，要比网关的空闲超时短
+func InitFeedHandler(feedClient feedv1.FeedServiceClient, readState cache.FeedReadState, settings cache.UserSettingsStore,
+	presenter *web.FeedPresenter, hub *pubsub.Hub, pager *ginx.Pager, flags *feature.Flags, l logger.Logger, cfg HTTPConfig) *web.FeedHandler {
+	return web.NewFeedHandler(feedClient, readState, settings, presenter, hub, cfg.FeedStream.Heartbeat, pager, flags, l)
 }
 
-func InitTubeHandler(putPolicy storage.PutPolicy, mac *qbox.Mac) *web.TubeHandler {
-	return web.NewTubeHandler(putPolicy, mac, viper.GetString("oss.domainName"))
+func InitTubeHandler(putPolicy storage.PutPolicy, mac *qbox.Mac, cfg OssConfig) *web.TubeHandler {
+	return web.NewTubeHandler(putPolicy, mac, cfg.DomainName)
 }
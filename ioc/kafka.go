@@ -3,32 +3,59 @@ package ioc
 import (
 	"github.com/IBM/sarama"
 	"github.com/MuxiKeStack/bff/events"
-	"github.com/spf13/viper"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
+	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/webhook"
 )
 
-func InitKafka() sarama.Client {
-	type Config struct {
-		Addrs []string `yaml:"addrs"`
-	}
+func InitKafka(cfg KafkaConfig) sarama.Client {
 	saramaCfg := sarama.NewConfig()
-	saramaCfg.Producer.Return.Successes = true
+	// 事件是异步发的，只读失败的结果，成功的不返回
+	saramaCfg.Producer.Return.Successes = false
+	saramaCfg.Producer.Return.Errors = true
 	saramaCfg.Producer.Partitioner = sarama.NewConsistentCRCHashPartitioner
-	var cfg Config
-	err := viper.UnmarshalKey("kafka", &cfg)
+	client, err := sarama.NewClient(cfg.Addrs, saramaCfg)
 	if err != nil {
 		panic(err)
 	}
-	client, err := sarama.NewClient(cfg.Addrs, saramaCfg)
+	return client
+}
+
+func InitProducer(client sarama.Client, l logger.Logger) events.Producer {
+	producer, err := sarama.NewAsyncProducerFromClient(client)
 	if err != nil {
 		panic(err)
 	}
-	return client
+	return events.NewSaramaProducer(producer, l)
 }
 
-func InitProducer(client sarama.Client) events.Producer {
-	producer, err := sarama.NewSyncProducerFromClient(client)
+// InitSubscriptions BFF 自己订阅的事件：webhook 投递和 feed 的实时推送
+func InitSubscriptions(dispatcher *webhook.Dispatcher, hub *pubsub.Hub) []events.Subscription {
+	return []events.Subscription{
+		{Name: "webhook", Types: events.WebhookTypes(), Handler: dispatcher.Handle},
+		{Name: "feed_stream", Types: []string{events.TypeFeedCreated}, Handler: web.FeedStreamHandler(hub)},
+	}
+}
+
+// InitConsumers 每个订阅一个消费组，重试超时的消息同步发到死信 topic，确认写进去了才提交
+func InitConsumers(client sarama.Client, cfg KafkaConfig, subs []events.Subscription, l logger.Logger) []events.Consumer {
+	events.InitMetrics("muxi", "kstack_bff")
+	saramaCfg := sarama.NewConfig()
+	saramaCfg.Producer.Return.Successes = true
+	saramaCfg.Producer.RequiredAcks = sarama.WaitForAll
+	deadLetter, err := sarama.NewSyncProducer(cfg.Addrs, saramaCfg)
 	if err != nil {
 		panic(err)
 	}
-	return events.NewSaramaProducer(producer)
+	consumers := make([]events.Consumer, 0, len(subs))
+	for _, sub := range subs {
+		consumers = append(consumers, events.NewSaramaConsumer(client, deadLetter, sub, cfg.Consumer, l))
+	}
+	return consumers
+}
+
+// InitStandaloneConsumers standalone 模式的 fakes.Producer 直接在进程内分发事件，不需要消费者
+func InitStandaloneConsumers() []events.Consumer {
+	return nil
 }
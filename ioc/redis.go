@@ -1,19 +1,16 @@
 package ioc
 
 import (
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
 	"github.com/redis/go-redis/v9"
-	"github.com/spf13/viper"
 )
 
-func InitRedis() redis.Cmdable {
-	type Config struct {
-		Addr     string `yaml:"addr"`
-		Password string `yaml:"password"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("redis", &cfg)
-	if err != nil {
-		panic(err)
-	}
+// InitRedis 返回具体的 *redis.Client，pub/sub 要用；其余地方按 redis.Cmdable 注入
+func InitRedis(cfg RedisConfig) *redis.Client {
 	return redis.NewClient(&redis.Options{Addr: cfg.Addr, Password: cfg.Password})
 }
+
+// InitBroker 跨实例的广播走 Redis 的 pub/sub
+func InitBroker(client *redis.Client) pubsub.Broker {
+	return pubsub.NewRedisBroker(client)
+}
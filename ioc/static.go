@@ -5,23 +5,16 @@ import (
 	staticv1 "github.com/MuxiKeStack/be-api/gen/proto/static/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func InitStaticClient(ecli *clientv3.Client) staticv1.StaticServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.static", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitStaticClient(ecli *clientv3.Client, cfg GrpcConfig) staticv1.StaticServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Static.Endpoint),
 		grpc.WithDiscovery(r),
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Static)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
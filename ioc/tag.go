@@ -5,25 +5,16 @@ import (
 	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
-	"time"
 )
 
-func InitTagClient(ecli *clientv3.Client) tagv1.TagServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.tag", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitTagClient(ecli *clientv3.Client, cfg GrpcConfig) tagv1.TagServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.Tag.Endpoint),
 		grpc.WithDiscovery(r),
-		grpc.WithTimeout(time.Second*100),
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.Tag)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -3,25 +3,15 @@ package ioc
 import (
 	"github.com/qiniu/api.v7/v7/auth/qbox"
 	"github.com/qiniu/api.v7/v7/storage"
-	"github.com/spf13/viper"
 )
 
-func InitPutPolicy() storage.PutPolicy {
+func InitPutPolicy(cfg OssConfig) storage.PutPolicy {
 	return storage.PutPolicy{
-		Scope:   viper.GetString("oss.bucketName"),
+		Scope:   cfg.BucketName,
 		Expires: 60 * 60 * 24, // 一天过期
 	}
 }
 
-func InitMac() *qbox.Mac {
-	type oss struct {
-		AccessKey string `json:"accessKey"`
-		SecretKey string `json:"secretKey"`
-	}
-	var cfg oss
-	err := viper.UnmarshalKey("oss", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitMac(cfg OssConfig) *qbox.Mac {
 	return qbox.NewMac(cfg.AccessKey, cfg.SecretKey)
 }
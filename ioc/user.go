@@ -5,23 +5,16 @@ import (
 	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
 	"github.com/go-kratos/kratos/contrib/registry/etcd/v2"
 	"github.com/go-kratos/kratos/v2/transport/grpc"
-	"github.com/spf13/viper"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
-func InitUserClient(ecli *clientv3.Client) userv1.UserServiceClient {
-	type Config struct {
-		Endpoint string `yaml:"endpoint"`
-	}
-	var cfg Config
-	err := viper.UnmarshalKey("grpc.client.user", &cfg)
-	if err != nil {
-		panic(err)
-	}
+func InitUserClient(ecli *clientv3.Client, cfg GrpcConfig) userv1.UserServiceClient {
 	r := etcd.New(ecli)
 	cc, err := grpc.DialInsecure(context.Background(),
-		grpc.WithEndpoint(cfg.Endpoint),
+		grpc.WithEndpoint(cfg.Client.User.Endpoint),
 		grpc.WithDiscovery(r),
+		grpc.WithTimeout(cfg.clientTimeout(cfg.Client.User)),
+		grpc.WithUnaryInterceptor(cfg.deadlineBudget()),
 	)
 	if err != nil {
 		panic(err)
@@ -1,32 +1,73 @@
 package ioc
 
 import (
-	"context"
+	"fmt"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/cors"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/httpcache"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/idempotency"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/maintenance"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/recovery"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/timeout"
 	"github.com/MuxiKeStack/bff/pkg/logger"
 	"github.com/MuxiKeStack/bff/web"
 	"github.com/MuxiKeStack/bff/web/evaluation"
+	"github.com/MuxiKeStack/bff/web/graphql"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/MuxiKeStack/bff/web/middleware"
 	"github.com/MuxiKeStack/bff/web/search"
-	"github.com/gin-contrib/cors"
+	"github.com/ecodeclub/ekit/set"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/spf13/viper"
+	"github.com/redis/go-redis/v9"
+	"regexp"
 	"strings"
 	"time"
 )
 
-func InitGinServer(l logger.Logger, jwtHdl ijwt.Handler, user *web.UserHandler,
+// InitRecovery 业务端口和管理端口共用，panic 的打点只能注册一次
+func InitRecovery(l logger.Logger) *recovery.Builder {
+	return recovery.NewBuilder(l, prometheus.CounterOpts{
+		Namespace: "muxi",
+		Subsystem: "kstack_bff",
+		Name:      "panic",
+		Help:      "处理请求时 panic 的次数",
+	})
+}
+
+func InitGinServer(l logger.Logger, dc *dynconf.Manager, cmd redis.Cmdable, maintenanceHdl *maintenance.Builder,
+	recoveryHdl *recovery.Builder, jwtHdl ijwt.Handler, user *web.UserHandler,
 	course *web.CourseHandler, question *web.QuestionHandler, evaluation *evaluation.EvaluationHandler,
 	comment *web.CommentHandler, search *search.SearchHandler, grade *web.GradeHandler, static *web.StaticHandler,
-	answer *web.AnswerHandler, point *web.PointHandler, feed *web.FeedHandler, tube *web.TubeHandler) *ginx.Server {
-	engine := gin.Default()
+	answer *web.AnswerHandler, point *web.PointHandler, feed *web.FeedHandler, tube *web.TubeHandler, admin *web.AdminHandler, batch *web.BatchHandler,
+	graphql *graphql.GraphQLHandler, email *web.EmailHandler, cfg HTTPConfig, aggregation AggregationConfig) *ginx.Server {
+	// 不用 gin.Default，它自带的 Recovery 只会返回一个空的 500
+	engine := gin.New()
+	// 让 gin.Context 的 Deadline/Done 跟随 Request.Context，请求取消时聚合的下游调用一并取消
+	engine.ContextWithFallback = true
+	guestPaths := dynconf.Map(dynconf.Bind[[]string](dc, "http.guestPaths"), func(paths []string) set.Set[string] {
+		s := set.NewMapSet[string](len(paths))
+		for _, path := range paths {
+			s.Add(path)
+		}
+		return s
+	})
 	engine.Use(
-		corsHdl(),
+		accessLogHdl(),
+		recoveryHdl.Build(),
+		corsHdl(dc),
+		maintenanceHdl.Build(),
+		timeoutHdl(cfg),
+		cacheHdl(cmd, l, cfg, guestPaths),
 		//middleware.NewLoginMiddleWareBuilder(jwtHdl).Build(),
 	)
-	authMiddleware := middleware.NewLoginMiddleWareBuilder(jwtHdl).Build()
+	authMiddleware := chain(
+		middleware.NewLoginMiddleWareBuilder(jwtHdl, guestPaths).Build(),
+		// 幂等要拿到 uid，所以和登录放在一起
+		idempotencyHdl(cmd, l, cfg),
+	)
 	user.RegisterRoutes(engine, authMiddleware)
 	course.RegisterRoutes(engine, authMiddleware)
 	question.RegisterRoutes(engine, authMiddleware)
@@ -39,46 +80,121 @@ func InitGinServer(l logger.Logger, jwtHdl ijwt.Handler, user *web.UserHandler,
 	point.RegisterRoutes(engine, authMiddleware)
 	feed.RegisterRoutes(engine, authMiddleware)
 	tube.RegisterRoutes(engine, authMiddleware)
-	addr := viper.GetString("http.addr")
+	admin.RegisterRoutes(engine, authMiddleware)
+	batch.RegisterRoutes(engine, authMiddleware)
+	graphql.RegisterRoutes(engine, authMiddleware)
+	email.RegisterRoutes(engine, authMiddleware)
 	ginx.InitCounter(prometheus.CounterOpts{
 		Namespace: "muxi",
 		Subsystem: "kstack_bff",
 		Name:      "http",
 	})
 	ginx.SetLogger(l)
+	aggregate.InitCounter(prometheus.CounterOpts{
+		Namespace: "muxi",
+		Subsystem: "kstack_bff",
+		Name:      "aggregate_degraded",
+	})
+	aggregate.InitTimer(prometheus.SummaryOpts{
+		Namespace: "muxi",
+		Subsystem: "kstack_bff",
+		Name:      "aggregate_leg",
+		Help:      "聚合项的耗时，单位 ms",
+		Objectives: map[float64]float64{
+			0.5:   0.01,
+			0.9:   0.01,
+			0.99:  0.001,
+			0.999: 0.0001,
+		},
+	})
+	aggregate.SetLogger(l)
+	aggregate.SetDefaultLimit(aggregation.Concurrency)
 	return &ginx.Server{
 		Engine: engine,
-		Addr:   addr,
+		Addr:   cfg.Addr,
 	}
 }
 
-func timeout() gin.HandlerFunc {
+// 访问日志里要打码的查询参数
+var secretQuery = regexp.MustCompile(`([?&]access_token=)[^&]*`)
+
+// accessLogHdl 和 gin.Logger 的格式一样，只是把 /feed/stream 的 access_token 参数打码，token 不能落到日志里
+func accessLogHdl() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: func(param gin.LogFormatterParams) string {
+			var statusColor, methodColor, resetColor string
+			if param.IsOutputColor() {
+				statusColor = param.StatusCodeColor()
+				methodColor = param.MethodColor()
+				resetColor = param.ResetColor()
+			}
+			if param.Latency > time.Minute {
+				param.Latency = param.Latency.Truncate(time.Second)
+			}
+			return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+				statusColor, param.StatusCode, resetColor,
+				param.Latency,
+				param.ClientIP,
+				methodColor, param.Method, resetColor,
+				secretQuery.ReplaceAllString(param.Path, "${1}***"),
+				param.ErrorMessage,
+			)
+		},
+	})
+}
+
+// timeoutHdl 每个请求的时间预算，慢接口在 http.timeout.routes 里单独配置
+func timeoutHdl(cfg HTTPConfig) gin.HandlerFunc {
+	builder := timeout.NewBuilder(cfg.Timeout.Default)
+	for _, r := range cfg.Timeout.Routes {
+		builder.Route(strings.ToUpper(r.Method), r.Pattern, r.Timeout)
+	}
+	return builder.Build()
+}
+
+// cacheHdl 公开的读接口的 ETag 和 Cache-Control，在 http.cache.routes 里按路由开启
+// cacheHdl 共享缓存只用在 http.guestPaths 里的路由上，游客名单改了立刻生效
+func cacheHdl(cmd redis.Cmdable, l logger.Logger, cfg HTTPConfig, guestPaths *dynconf.Value[set.Set[string]]) gin.HandlerFunc {
+	builder := httpcache.NewBuilder(cmd, l).SharedTTL(cfg.Cache.SharedTTL).Guest(func(pattern string) bool {
+		return guestPaths.Load().Exist(pattern)
+	})
+	for _, r := range cfg.Cache.Routes {
+		builder.Route(r.Pattern, httpcache.Route{MaxAge: r.MaxAge, Shared: r.Shared})
+	}
+	return builder.Build()
+}
+
+// idempotencyHdl 写接口的幂等，http.idempotency.ttl 是结果保存的时间
+func idempotencyHdl(cmd redis.Cmdable, l logger.Logger, cfg HTTPConfig) gin.HandlerFunc {
+	return idempotency.NewBuilder(cmd, l, cfg.Idempotency.TTL, cfg.Idempotency.InflightTTL).Build()
+}
+
+// chain 把几个中间件合成一个，前面的 Abort 了后面的就不执行
+func chain(hdls ...gin.HandlerFunc) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		_, ok := ctx.Request.Context().Deadline()
-		if !ok {
-			// 强制给一个超时，省得我前端调试等得不耐烦
-			newCtx, cancel := context.WithTimeout(ctx.Request.Context(), time.Second*10)
-			defer cancel()
-			ctx.Request = ctx.Request.Clone(newCtx)
+		for _, hdl := range hdls {
+			hdl(ctx)
+			if ctx.IsAborted() {
+				return
+			}
 		}
-		ctx.Next()
 	}
 }
 
-func corsHdl() gin.HandlerFunc {
-	return cors.New(cors.Config{
-		//AllowOrigins: []string{"*"},
-		//AllowMethods: []string{"POST", "GET"},
-		AllowHeaders:     []string{"Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"x-jwt-token", "x-refresh-token"},
-		AllowCredentials: true,
-		AllowOriginFunc: func(origin string) bool {
-			if strings.HasPrefix(origin, "localhost") {
-				// 你的开发环境
-				return true
-			}
-			return strings.Contains(origin, "bigdust.space")
-		},
-		MaxAge: 12 * time.Hour,
-	})
+// corsHdl 跨域策略，http.cors.profiles 下面按环境配置，用 http.cors.profile 选一个，可以动态修改
+func corsHdl(dc *dynconf.Manager) gin.HandlerFunc {
+	type Config struct {
+		Profile  string                 `yaml:"profile"`
+		Profiles map[string]cors.Config `yaml:"profiles"`
+	}
+	cfg := dynconf.Bind[Config](dc, "http.cors")
+	// viper 会把 key 转成小写
+	if _, ok := cfg.Load().Profiles[strings.ToLower(cfg.Load().Profile)]; !ok {
+		panic(fmt.Sprintf("http.cors.profiles 里没有 %s", cfg.Load().Profile))
+	}
+	// 改配置时选了不存在的环境，就退化成不允许任何跨域请求
+	return cors.NewBuilder(dynconf.Map(cfg, func(cfg Config) cors.Config {
+		return cfg.Profiles[strings.ToLower(cfg.Profile)]
+	})).Build()
 }
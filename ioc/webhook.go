@@ -0,0 +1,11 @@
+package ioc
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/webhook"
+)
+
+// InitWebhookDispatcher 每个实例投递自己消费到的事件，重试排在进程内，丢了的由 sweep 捞回来
+func InitWebhookDispatcher(store webhook.Store, cfg webhook.Config, l logger.Logger) *webhook.Dispatcher {
+	return webhook.NewDispatcher(store, cfg, l)
+}
@@ -0,0 +1,220 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/redis/go-redis/v9"
+	"html/template"
+	"time"
+)
+
+//go:embed templates/digest.html
+var digestTemplate string
+
+var digestTmpl = template.Must(template.New("digest").Funcs(template.FuncMap{
+	// 深链接来自配置，不是 http 开头的会被 html/template 当成不安全的 URL 换掉
+	"link": func(link string) template.URL {
+		return template.URL(link)
+	},
+}).Parse(digestTemplate))
+
+// 和免打扰时段一样按北京时间算
+var digestZone = time.FixedZone("CST", 8*60*60)
+
+const (
+	// 拉 feed 时一次拉多少条
+	digestBatch = 100
+	// 单个用户的摘要最长花多久
+	digestTimeout = 30 * time.Second
+	// 发过的标记保留多久，要比一周长
+	digestSentTTL = 8 * 24 * time.Hour
+)
+
+type DigestConfig struct {
+	// Hour 每天几点发（北京时间）
+	Hour int `yaml:"hour"`
+	// Weekday 周摘要星期几发，0 是周日
+	Weekday time.Weekday `yaml:"weekday"`
+	// MaxEvents 一封摘要最多带多少条事件
+	MaxEvents int `yaml:"maxEvents"`
+}
+
+// Digest 给开了邮件摘要的用户定时发 feed 摘要，邀请回答单独列在最前面。
+// 每个实例都会跑，靠 Redis 里的发送标记保证同一个周期每个用户只发一封
+type Digest struct {
+	feedClient feedv1.FeedServiceClient
+	userClient userv1.UserServiceClient
+	settings   cache.UserSettingsStore
+	presenter  *web.FeedPresenter
+	sender     email.Sender
+	cmd        redis.Cmdable
+	cfg        DigestConfig
+	l          logger.Logger
+}
+
+func NewDigest(feedClient feedv1.FeedServiceClient, userClient userv1.UserServiceClient, settings cache.UserSettingsStore,
+	presenter *web.FeedPresenter, sender email.Sender, cmd redis.Cmdable, cfg DigestConfig, l logger.Logger) *Digest {
+	return &Digest{
+		feedClient: feedClient,
+		userClient: userClient,
+		settings:   settings,
+		presenter:  presenter,
+		sender:     sender,
+		cmd:        cmd,
+		cfg:        cfg,
+		l:          l,
+	}
+}
+
+// Run 一直运行到 ctx 取消，每天 cfg.Hour 点跑一次
+func (d *Digest) Run(ctx context.Context) {
+	for {
+		next := d.next(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+		}
+		d.RunOnce(ctx, next)
+	}
+}
+
+// RunOnce 发 at 这个时间点该发的摘要，日摘要每天都发，周摘要只在 cfg.Weekday 发
+func (d *Digest) RunOnce(ctx context.Context, at time.Time) {
+	subs, err := d.settings.ListDigest(ctx)
+	if err != nil {
+		d.l.Error("查询邮件摘要的订阅失败", logger.Error(err))
+		return
+	}
+	at = at.In(digestZone)
+	for uid, freq := range subs {
+		if freq == cache.DigestWeekly && at.Weekday() != d.cfg.Weekday {
+			continue
+		}
+		if err = d.send(ctx, uid, freq, at); err != nil {
+			d.l.Error("发送邮件摘要失败", logger.Int64("uid", uid), logger.String("digest", freq), logger.Error(err))
+		}
+	}
+}
+
+func (d *Digest) send(ctx context.Context, uid int64, freq string, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, digestTimeout)
+	defer cancel()
+	period, since := "今日", at.Add(-24*time.Hour)
+	if freq == cache.DigestWeekly {
+		period, since = "本周", at.Add(-7*24*time.Hour)
+	}
+	sentKey := fmt.Sprintf("kstack:email_digest_sent:%d:%s:%s", uid, freq, at.Format("20060102"))
+	ok, err := d.cmd.SetNX(ctx, sentKey, 1, digestSentTTL).Result()
+	if err != nil || !ok {
+		// 别的实例已经发过了
+		return err
+	}
+	sent := false
+	defer func() {
+		if !sent {
+			// 没发出去就把标记删掉，手动重跑时还能再发
+			_ = d.cmd.Del(context.Background(), sentKey).Err()
+		}
+	}()
+
+	settings, err := d.settings.Get(ctx, uid)
+	if err != nil {
+		return err
+	}
+	// 列表是定时任务开始时查的，这期间可能已经关掉了
+	if !settings.Email.DigestEnabled() || settings.Email.Digest != freq {
+		sent = true
+		return nil
+	}
+	events, err := d.collect(ctx, uid, since.UnixMilli(), settings)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		sent = true
+		return nil
+	}
+	vos, _, err := d.presenter.Present(ctx, events)
+	if err != nil {
+		return err
+	}
+	data := digestData{Period: period, Total: len(events)}
+	for _, vo := range vos {
+		if d.presenter.Setting(vo.Type) == cache.NotifyInvitation {
+			data.Invitations = append(data.Invitations, vo)
+		} else {
+			data.Others = append(data.Others, vo)
+		}
+	}
+	// 昵称只是用来称呼，查不到也照样发
+	profile, _ := d.userClient.Profile(ctx, &userv1.ProfileRequest{Uid: uid})
+	data.Nickname = profile.GetUser().GetNickname()
+	var body bytes.Buffer
+	if err = digestTmpl.Execute(&body, data); err != nil {
+		return err
+	}
+	err = d.sender.Send(ctx, email.Message{
+		To:      []string{settings.Email.Address},
+		Subject: fmt.Sprintf("课栈%s摘要：%d 条新动态", period, data.Total),
+		HTML:    body.String(),
+	})
+	sent = err == nil
+	return err
+}
+
+// collect 从新往旧拉 since 之后的事件，跳过用户关掉的通知类型，最多 cfg.MaxEvents 条。
+// 和 /feed/events_list 一样按 (ctime, id) 翻页，同一个 ctime 的事件跨了两批也不会漏
+func (d *Digest) collect(ctx context.Context, uid int64, since int64, settings cache.UserSettings) ([]*feedv1.FeedEvent, error) {
+	var res []*feedv1.FeedEvent
+	cur := web.NewFeedCursor(feedv1.Direction_Before)
+	for len(res) < d.cfg.MaxEvents {
+		events, more, err := cur.Find(ctx, d.feedClient, uid, digestBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, evt := range events {
+			if evt.GetCtime() < since {
+				return res, nil
+			}
+			if !d.presenter.Notify(settings, evt) {
+				continue
+			}
+			res = append(res, evt)
+			if len(res) >= d.cfg.MaxEvents {
+				return res, nil
+			}
+		}
+		if !more {
+			break
+		}
+		cur = cur.Next(events)
+	}
+	return res, nil
+}
+
+// next now 之后第一个 cfg.Hour 点整
+func (d *Digest) next(now time.Time) time.Time {
+	now = now.In(digestZone)
+	next := time.Date(now.Year(), now.Month(), now.Day(), d.cfg.Hour, 0, 0, 0, digestZone)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+type digestData struct {
+	Nickname    string
+	Period      string
+	Total       int
+	Invitations []web.FeedEventVo
+	Others      []web.FeedEventVo
+}
@@ -0,0 +1,237 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"github.com/MuxiKeStack/bff/fakes"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSender 记下发出去的邮件，fail 为 true 时发送失败
+type testSender struct {
+	fail bool
+	sent []email.Message
+}
+
+func (s *testSender) Send(ctx context.Context, msg email.Message) error {
+	if s.fail {
+		return errors.New("发送失败")
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+type digestEnv struct {
+	digest   *Digest
+	feed     *fakes.FeedService
+	settings cache.UserSettingsStore
+	sender   *testSender
+}
+
+func newDigestEnv(cfg DigestConfig) digestEnv {
+	l := logger.NewNopLogger()
+	r := fakes.NewRedis()
+	users := fakes.NewUserService()
+	course := fakes.NewCourseService()
+	settings := cache.NewRedisUserSettings(r)
+	feed := fakes.NewFeedService(fakes.NewProducer(l, nil))
+	// 测试里的事件不带对象，用不到课程缓存
+	presenter := web.NewFeedPresenter(users, settings, fakes.NewEvaluationService(course), fakes.NewQuestionService(users),
+		fakes.NewAnswerService(), fakes.NewCommentService(), nil, web.FeedPresentConfig{
+			Types: map[string]web.FeedTypeConfig{
+				"comment": {Action: "评论了你的", Setting: cache.NotifyComment},
+				"invite":  {Action: "邀请你回答", Setting: cache.NotifyInvitation},
+			},
+		})
+	sender := &testSender{}
+	return digestEnv{
+		digest:   NewDigest(feed, users, settings, presenter, sender, r, cfg, l),
+		feed:     feed,
+		settings: settings,
+		sender:   sender,
+	}
+}
+
+func (e digestEnv) subscribe(t *testing.T, uid int64, freq string) {
+	t.Helper()
+	settings := cache.DefaultUserSettings()
+	settings.Email = cache.EmailSettings{Address: "u@ccnu.edu.cn", Digest: freq}
+	if err := e.settings.Set(context.Background(), uid, settings); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDigestRunOnce(t *testing.T) {
+	// 事件的 ctime 是现在，摘要在一小时之后发，都在窗口里
+	at := time.Now().Add(time.Hour)
+	today := at.In(digestZone).Weekday()
+	testCases := []struct {
+		name    string
+		freq    string
+		weekday time.Weekday
+		at      time.Time
+		// 期望的标题，为空表示不发
+		wantSubject string
+	}{
+		{name: "日摘要", freq: cache.DigestDaily, weekday: (today + 1) % 7, at: at, wantSubject: "课栈今日摘要：2 条新动态"},
+		{name: "周摘要当天", freq: cache.DigestWeekly, weekday: today, at: at, wantSubject: "课栈本周摘要：2 条新动态"},
+		{name: "周摘要不是当天", freq: cache.DigestWeekly, weekday: (today + 1) % 7, at: at},
+		{name: "事件在窗口之前", freq: cache.DigestDaily, at: at.Add(24 * time.Hour)},
+		{name: "没有订阅", freq: cache.DigestOff, at: at},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newDigestEnv(DigestConfig{Hour: 8, Weekday: tc.weekday, MaxEvents: 10})
+			env.subscribe(t, 1, tc.freq)
+			env.feed.Push(1, "comment", nil)
+			env.feed.Push(1, "invite", nil)
+
+			env.digest.RunOnce(context.Background(), tc.at)
+			if tc.wantSubject == "" {
+				if len(env.sender.sent) != 0 {
+					t.Fatalf("不应该发邮件，实际发了 %q", env.sender.sent[0].Subject)
+				}
+				return
+			}
+			if len(env.sender.sent) != 1 {
+				t.Fatalf("发了 %d 封邮件，期望 1 封", len(env.sender.sent))
+			}
+			msg := env.sender.sent[0]
+			if msg.Subject != tc.wantSubject || msg.To[0] != "u@ccnu.edu.cn" {
+				t.Fatalf("邮件 = %s -> %v，期望 %s", msg.Subject, msg.To, tc.wantSubject)
+			}
+			// 邀请回答单独列在最前面
+			invite, comment := strings.Index(msg.HTML, "邀请你回答"), strings.Index(msg.HTML, "评论了你的")
+			if invite < 0 || comment < 0 || invite > comment {
+				t.Fatal("邀请回答应该排在其他事件前面")
+			}
+		})
+	}
+}
+
+func TestDigestSentOnce(t *testing.T) {
+	ctx := context.Background()
+	at := time.Now().Add(time.Hour)
+	env := newDigestEnv(DigestConfig{Hour: 8, MaxEvents: 10})
+	env.subscribe(t, 1, cache.DigestDaily)
+	env.feed.Push(1, "comment", nil)
+
+	// 发送失败时删掉标记，重跑还能再发
+	env.sender.fail = true
+	env.digest.RunOnce(ctx, at)
+	env.sender.fail = false
+	env.digest.RunOnce(ctx, at)
+	// 同一个周期已经发过了，别的实例或者重跑都不会再发
+	env.digest.RunOnce(ctx, at)
+	if len(env.sender.sent) != 1 {
+		t.Fatalf("发了 %d 封邮件，期望 1 封", len(env.sender.sent))
+	}
+}
+
+func TestDigestCollect(t *testing.T) {
+	ctx := context.Background()
+	env := newDigestEnv(DigestConfig{Hour: 8, MaxEvents: 3})
+	for i := 0; i < 3; i++ {
+		env.feed.Push(1, "comment", nil)
+		env.feed.Push(1, "invite", nil)
+	}
+	since := time.Now().Add(-time.Hour).UnixMilli()
+
+	settings := cache.DefaultUserSettings()
+	events, err := env.digest.collect(ctx, 1, since, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("拿到 %d 条事件，期望最多 MaxEvents 条", len(events))
+	}
+
+	// 关掉的通知类型不算
+	settings.Notifications.Comment = false
+	events, err = env.digest.collect(ctx, 1, since, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, evt := range events {
+		if evt.GetType() != "invite" {
+			t.Fatalf("关掉的 %s 类型不应该出现在摘要里", evt.GetType())
+		}
+	}
+
+	events, err = env.digest.collect(ctx, 1, time.Now().Add(time.Hour).UnixMilli(), settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("since 之前的事件不应该拿到，实际拿到 %d 条", len(events))
+	}
+}
+
+func TestDigestCollectSameCtime(t *testing.T) {
+	ctx := context.Background()
+	env := newDigestEnv(DigestConfig{Hour: 8, MaxEvents: 1000})
+	// 一批拉 digestBatch 条，第一批的边界落在 ctime 为 now 的 120 条中间
+	now := time.Now().UnixMilli()
+	for i := 0; i < 50; i++ {
+		env.feed.PushAt(1, "comment", nil, now-1)
+	}
+	for i := 0; i < 120; i++ {
+		env.feed.PushAt(1, "comment", nil, now)
+	}
+
+	events, err := env.digest.collect(ctx, 1, now-time.Hour.Milliseconds(), cache.DefaultUserSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[int64]struct{}, len(events))
+	for _, evt := range events {
+		ids[evt.GetId()] = struct{}{}
+	}
+	if len(events) != 170 || len(ids) != 170 {
+		t.Fatalf("拿到 %d 条事件（%d 条不重复），期望 170 条，同一个 ctime 的事件跨批次时不能漏也不能重复", len(events), len(ids))
+	}
+}
+
+func TestDigestNext(t *testing.T) {
+	d := &Digest{cfg: DigestConfig{Hour: 8}}
+	testCases := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{
+			name: "当天还没到点",
+			now:  time.Date(2024, 5, 1, 7, 59, 0, 0, digestZone),
+			want: time.Date(2024, 5, 1, 8, 0, 0, 0, digestZone),
+		},
+		{
+			name: "正好到点算下一天",
+			now:  time.Date(2024, 5, 1, 8, 0, 0, 0, digestZone),
+			want: time.Date(2024, 5, 2, 8, 0, 0, 0, digestZone),
+		},
+		{
+			name: "跨月",
+			now:  time.Date(2024, 5, 31, 20, 0, 0, 0, digestZone),
+			want: time.Date(2024, 6, 1, 8, 0, 0, 0, digestZone),
+		},
+		{
+			// UTC 的 23:30 已经是北京时间第二天 7:30
+			name: "按北京时间算",
+			now:  time.Date(2024, 5, 1, 23, 30, 0, 0, time.UTC),
+			want: time.Date(2024, 5, 2, 8, 0, 0, 0, digestZone),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := d.next(tc.now); !got.Equal(tc.want) {
+				t.Fatalf("next(%s) = %s，期望 %s", tc.now, got, tc.want)
+			}
+		})
+	}
+}
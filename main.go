@@ -1,15 +1,57 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/MuxiKeStack/bff/ioc"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"os"
 )
 
 func main() {
+	mode := pflag.String("mode", "", "启动模式，standalone 不依赖 etcd、kafka、redis 和下游服务，全部换成内存实现")
+	checkOnly := pflag.Bool("check-config", false, "只校验配置，校验完就退出")
 	initViper()
+	cfg, warnings, err := ioc.LoadConfig(*mode == "standalone")
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "配置警告：%s\n", w)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *checkOnly {
+		fmt.Println("配置没有问题")
+		return
+	}
 	//client.InitPath("config/seatago.yaml")
-	server := InitWebServer()
-	err := server.Start()
+	var app *App
+	switch *mode {
+	case "standalone":
+		app = InitStandaloneApp(cfg)
+	default:
+		app = InitApp(cfg)
+	}
+	// 后台循环跟着进程走，main 返回时取消
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.feedHub.Run(ctx)
+	go app.webhooks.Run(ctx)
+	go app.digest.Run(ctx)
+	for _, c := range app.consumers {
+		err = c.Start()
+		if err != nil {
+			panic(err)
+		}
+	}
+	go func() {
+		err := app.admin.Start()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	err = app.server.Start()
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,147 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 和 ginx 一样，用包变量来配置，省得每个 handler 都注入一遍
+var log logger.Logger = logger.NewNopLogger()
+
+var (
+	vector *prometheus.CounterVec
+	timer  *prometheus.SummaryVec
+)
+
+// 单个 Group 同时在途的聚合项上限，在 ioc 里按配置设置
+var defaultLimit = 8
+
+func InitCounter(opt prometheus.CounterOpts) {
+	vector = prometheus.NewCounterVec(opt, []string{"field"})
+	prometheus.MustRegister(vector)
+}
+
+// InitTimer 统计每一路聚合项的耗时，result 是 ok/error/panic
+func InitTimer(opt prometheus.SummaryOpts) {
+	timer = prometheus.NewSummaryVec(opt, []string{"leg", "result"})
+	prometheus.MustRegister(timer)
+}
+
+func SetLogger(l logger.Logger) {
+	log = l
+}
+
+func SetDefaultLimit(n int) {
+	if n > 0 {
+		defaultLimit = n
+	}
+}
+
+// Group 聚合多路下游调用，所有 handler 里的并发聚合都应该走这里。
+// 错误策略：
+//  1. Required 的调用失败会让整个聚合失败，并取消其余还没完成的聚合项；
+//  2. Optional 的调用失败只会降级：对应字段保持零值（proto 的 Getter 对 nil 安全），
+//     并记录到 degraded 列表里返回给前端，不会取消其他聚合项；
+//  3. 聚合项 panic 按失败处理，不会打挂整个进程。
+//
+// 聚合项拿到的 ctx 派生自请求的 ctx，请求超时或者客户端断开时会一并取消
+type Group struct {
+	eg       *errgroup.Group
+	ctx      context.Context
+	mu       sync.Mutex
+	degraded []string
+}
+
+func NewGroup(ctx context.Context) *Group {
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(defaultLimit)
+	return &Group{eg: eg, ctx: ctx}
+}
+
+// Limit 覆盖默认的并发上限，必须在添加聚合项之前调用
+func (g *Group) Limit(n int) *Group {
+	if n > 0 {
+		g.eg.SetLimit(n)
+	}
+	return g
+}
+
+// Required 必选的聚合项，leg 是聚合项的名字，用于日志和监控
+func (g *Group) Required(leg string, fn func(ctx context.Context) error) {
+	g.eg.Go(func() error {
+		return g.run(leg, fn)
+	})
+}
+
+// Optional 可选的聚合项，fields 是失败时被降级的字段，用 json 字段名，前端据此判断哪些数据不可信
+func (g *Group) Optional(leg string, fn func(ctx context.Context) error, fields ...string) {
+	g.eg.Go(func() error {
+		err := g.run(leg, fn)
+		if err == nil {
+			return nil
+		}
+		log.Warn("聚合可选字段失败，已降级",
+			logger.String("leg", leg),
+			logger.Error(err),
+			logger.Any("fields", fields))
+		if vector != nil {
+			for _, field := range fields {
+				vector.WithLabelValues(field).Inc()
+			}
+		}
+		g.mu.Lock()
+		g.degraded = append(g.degraded, fields...)
+		g.mu.Unlock()
+		return nil
+	})
+}
+
+// Wait 等待所有聚合项完成，返回被降级的字段和第一个必选项的错误
+func (g *Group) Wait() ([]string, error) {
+	err := g.eg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// 并发完成的顺序不固定，排个序，方便前端和日志比对
+	sort.Strings(g.degraded)
+	return g.degraded, err
+}
+
+func (g *Group) run(leg string, fn func(ctx context.Context) error) (err error) {
+	start := time.Now()
+	result := "ok"
+	defer func() {
+		if r := recover(); r != nil {
+			result = "panic"
+			err = fmt.Errorf("聚合项 %s panic: %v", leg, r)
+			log.Error("聚合项 panic",
+				logger.String("leg", leg),
+				logger.Any("panic", r),
+				logger.String("stack", string(debug.Stack())))
+		} else if err != nil {
+			result = "error"
+		}
+		if timer != nil {
+			timer.WithLabelValues(leg, result).Observe(float64(time.Since(start).Milliseconds()))
+		}
+	}()
+	return fn(g.ctx)
+}
+
+// ForEach 有界地并发处理 items 里的每一项，任何一项失败都会取消其余的，返回第一个错误
+func ForEach[T any](ctx context.Context, leg string, items []T, fn func(ctx context.Context, i int, item T) error) error {
+	g := NewGroup(ctx)
+	for i, item := range items {
+		g.Required(leg, func(ctx context.Context) error {
+			return fn(ctx, i, item)
+		})
+	}
+	_, err := g.Wait()
+	return err
+}
@@ -0,0 +1,154 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	testCases := []struct {
+		name         string
+		add          func(g *Group)
+		wantDegraded []string
+		wantErr      bool
+	}{
+		{
+			name: "都成功",
+			add: func(g *Group) {
+				g.Required("a", func(ctx context.Context) error { return nil })
+				g.Optional("b", func(ctx context.Context) error { return nil }, "b")
+			},
+		},
+		{
+			name: "可选项失败只降级",
+			add: func(g *Group) {
+				g.Required("a", func(ctx context.Context) error { return nil })
+				g.Optional("tags", func(ctx context.Context) error { return errors.New("tag 服务挂了") }, "tags", "features")
+				g.Optional("stance", func(ctx context.Context) error { return errors.New("stance 服务挂了") }, "stance")
+			},
+			wantDegraded: []string{"features", "stance", "tags"},
+		},
+		{
+			name: "必选项失败",
+			add: func(g *Group) {
+				g.Required("a", func(ctx context.Context) error { return errors.New("user 服务挂了") })
+				g.Optional("b", func(ctx context.Context) error { return nil }, "b")
+			},
+			wantErr: true,
+		},
+		{
+			name: "必选项 panic 算失败",
+			add: func(g *Group) {
+				g.Required("a", func(ctx context.Context) error { panic("空指针") })
+			},
+			wantErr: true,
+		},
+		{
+			name: "可选项 panic 只降级",
+			add: func(g *Group) {
+				g.Required("a", func(ctx context.Context) error { return nil })
+				g.Optional("b", func(ctx context.Context) error { panic("空指针") }, "b")
+			},
+			wantDegraded: []string{"b"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGroup(context.Background())
+			tc.add(g)
+			degraded, err := g.Wait()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v，期望出错 %v", err, tc.wantErr)
+			}
+			if !slices.Equal(degraded, tc.wantDegraded) {
+				t.Fatalf("降级字段 = %v，期望 %v", degraded, tc.wantDegraded)
+			}
+		})
+	}
+}
+
+func TestGroupRequiredCancelsOthers(t *testing.T) {
+	g := NewGroup(context.Background())
+	g.Required("a", func(ctx context.Context) error { return errors.New("user 服务挂了") })
+	var canceled atomic.Bool
+	g.Optional("b", func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			canceled.Store(true)
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	}, "b")
+	if _, err := g.Wait(); err == nil {
+		t.Fatal("必选项失败应该返回错误")
+	}
+	if !canceled.Load() {
+		t.Fatal("必选项失败应该取消其他聚合项")
+	}
+}
+
+func TestGroupLimit(t *testing.T) {
+	testCases := []struct {
+		name  string
+		limit int
+		want  int64
+	}{
+		{name: "默认上限", want: int64(defaultLimit)},
+		{name: "覆盖上限", limit: 2, want: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewGroup(context.Background()).Limit(tc.limit)
+			var running, peak atomic.Int64
+			for i := 0; i < 20; i++ {
+				g.Required("leg", func(ctx context.Context) error {
+					n := running.Add(1)
+					defer running.Add(-1)
+					for {
+						p := peak.Load()
+						if n <= p || peak.CompareAndSwap(p, n) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					return nil
+				})
+			}
+			if _, err := g.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if peak.Load() != tc.want {
+				t.Fatalf("同时在途的聚合项最多 %d 个，期望 %d 个", peak.Load(), tc.want)
+			}
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	items := []int{1, 2, 3, 4}
+	res := make([]int, len(items))
+	err := ForEach(context.Background(), "double", items, func(ctx context.Context, i int, item int) error {
+		res[i] = item * 2
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(res, []int{2, 4, 6, 8}) {
+		t.Fatalf("结果 = %v", res)
+	}
+	err = ForEach(context.Background(), "fail", items, func(ctx context.Context, i int, item int) error {
+		if item == 3 {
+			return errors.New("第 3 个失败了")
+		}
+		return nil
+	})
+	if err == nil {
+		t.Fatal("有一项失败应该返回错误")
+	}
+}
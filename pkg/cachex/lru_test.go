@@ -0,0 +1,61 @@
+package cachex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	testCases := []struct {
+		name string
+		ops  func(c *LRU)
+		want map[string]bool
+	}{
+		{
+			name: "容量满了淘汰最久没访问的",
+			ops: func(c *LRU) {
+				c.Set("a", 1, time.Minute)
+				c.Set("b", 2, time.Minute)
+				c.Get("a")
+				c.Set("c", 3, time.Minute)
+			},
+			want: map[string]bool{"a": true, "b": false, "c": true},
+		},
+		{
+			name: "过期了拿不到",
+			ops: func(c *LRU) {
+				c.Set("a", 1, -time.Second)
+				c.Set("b", 2, time.Minute)
+			},
+			want: map[string]bool{"a": false, "b": true},
+		},
+		{
+			name: "覆盖不占容量",
+			ops: func(c *LRU) {
+				c.Set("a", 1, time.Minute)
+				c.Set("a", 2, time.Minute)
+				c.Set("b", 3, time.Minute)
+			},
+			want: map[string]bool{"a": true, "b": true},
+		},
+		{
+			name: "删除",
+			ops: func(c *LRU) {
+				c.Set("a", 1, time.Minute)
+				c.Delete("a")
+			},
+			want: map[string]bool{"a": false},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewLRU(2)
+			tc.ops(c)
+			for key, want := range tc.want {
+				if _, ok := c.Get(key); ok != want {
+					t.Fatalf("%s 命中 = %v，期望 %v", key, ok, want)
+				}
+			}
+		})
+	}
+}
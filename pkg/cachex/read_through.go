@@ -0,0 +1,115 @@
+package cachex
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"time"
+)
+
+// TTL 两级缓存各自的过期时间，本地的要短一些，因为失效只能清掉本实例的本地缓存
+type TTL struct {
+	Local  time.Duration `yaml:"local"`
+	Remote time.Duration `yaml:"remote"`
+}
+
+// ReadThrough 本地 LRU + Redis 的读穿透缓存，并发的未命中会被 singleflight 合并成一次回源
+type ReadThrough struct {
+	local *LRU
+	cmd   redis.Cmdable
+	group singleflight.Group
+}
+
+func NewReadThrough(cmd redis.Cmdable, localCapacity int) *ReadThrough {
+	return &ReadThrough{
+		local: NewLRU(localCapacity),
+		cmd:   cmd,
+	}
+}
+
+// Get 受制于泛型，方法上不能有类型参数，所以做成函数
+func Get[T any](ctx context.Context, c *ReadThrough, key string, ttl TTL,
+	load func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	if val, ok := c.local.Get(key); ok {
+		if t, ok := val.(T); ok {
+			return t, nil
+		}
+	}
+	// 回源是合并的，不能因为第一个请求断开了就让所有等着的请求一起失败，
+	// 所以去掉取消信号，只保留超时
+	ch := c.group.DoChan(key, func() (any, error) {
+		ctx, cancel := detach(ctx)
+		defer cancel()
+		data, err := c.cmd.Get(ctx, key).Bytes()
+		if err == nil {
+			if t, er := unmarshal[T](data); er == nil {
+				c.local.Set(key, t, ttl.Local)
+				return t, nil
+			}
+		}
+		// 未命中、redis 崩了、数据坏了，都回源
+		t, err := load(ctx)
+		if err != nil {
+			return t, err
+		}
+		c.local.Set(key, t, ttl.Local)
+		data, err = marshal(t)
+		if err == nil {
+			// 回写失败不影响这次的结果，下次再回源就是了
+			_ = c.cmd.Set(ctx, key, data, ttl.Remote).Err()
+		}
+		return t, nil
+	})
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	ctx = context.WithoutCancel(ctx)
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// marshal 课程这些 protobuf 消息要用 protojson，encoding/json 处理不了 oneof 和枚举的名字
+func marshal[T any](t T) ([]byte, error) {
+	if m, ok := any(t).(proto.Message); ok {
+		return protojson.Marshal(m)
+	}
+	return json.Marshal(t)
+}
+
+func unmarshal[T any](data []byte) (T, error) {
+	var t T
+	if m, ok := any(t).(proto.Message); ok {
+		// T 是消息的指针，零值是 nil，得先 new 一个出来
+		msg := m.ProtoReflect().New().Interface()
+		if err := protojson.Unmarshal(data, msg); err != nil {
+			return t, err
+		}
+		return msg.(T), nil
+	}
+	err := json.Unmarshal(data, &t)
+	return t, err
+}
+
+// Delete 删除本地和 Redis 中的 key，别的实例上的本地缓存只能等它过期
+func (c *ReadThrough) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		c.local.Delete(key)
+	}
+	return c.cmd.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,172 @@
+package cachex
+
+import (
+	"context"
+	"errors"
+	"github.com/MuxiKeStack/bff/fakes"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testTTL = TTL{Local: time.Minute, Remote: time.Hour}
+
+func TestGetSingleflight(t *testing.T) {
+	c := NewReadThrough(fakes.NewRedis(), 16)
+	var loads atomic.Int64
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		loads.Add(1)
+		<-release
+		return "course", nil
+	}
+	var wg sync.WaitGroup
+	res := make([]string, 10)
+	errs := make([]error, 10)
+	for i := range res {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res[i], errs[i] = Get(context.Background(), c, "course:1", testTTL, load)
+		}()
+	}
+	// 等所有请求都进了 singleflight 再放行
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads.Load() != 1 {
+		t.Fatalf("并发未命中回源了 %d 次，期望 1 次", loads.Load())
+	}
+	for i := range res {
+		if errs[i] != nil || res[i] != "course" {
+			t.Fatalf("第 %d 个请求拿到 %q, %v", i, res[i], errs[i])
+		}
+	}
+}
+
+func TestGetCallerCanceled(t *testing.T) {
+	c := NewReadThrough(fakes.NewRedis(), 16)
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		<-release
+		// 第一个请求断开了，合并的回源不应该被取消
+		return "course", ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := Get(ctx, c, "course:1", testTTL, load)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	waiter := make(chan string)
+	go func() {
+		val, _ := Get(context.Background(), c, "course:1", testTTL, load)
+		waiter <- val
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("断开的请求应该返回 context.Canceled，拿到 %v", err)
+	}
+	close(release)
+	if val := <-waiter; val != "course" {
+		t.Fatalf("等着的请求拿到 %q，期望 course", val)
+	}
+}
+
+func TestGetRoundTrip(t *testing.T) {
+	msg, err := structpb.NewStruct(map[string]any{
+		"name":  "高等数学",
+		"tags":  []any{"给分好", "作业少"},
+		"score": 4.5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type course struct {
+		Id   int64  `json:"id"`
+		Name string `json:"name"`
+	}
+	testCases := []struct {
+		name string
+		// 先用一个实例回源写进 redis，再用另一个实例（本地缓存是空的）从 redis 读出来
+		roundTrip func(t *testing.T, first, second *ReadThrough)
+	}{
+		{
+			name: "protobuf 消息用 protojson",
+			roundTrip: func(t *testing.T, first, second *ReadThrough) {
+				if _, err := Get(context.Background(), first, "k", testTTL, func(ctx context.Context) (*structpb.Struct, error) {
+					return msg, nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+				got, err := Get(context.Background(), second, "k", testTTL, func(ctx context.Context) (*structpb.Struct, error) {
+					return nil, errors.New("不应该回源")
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !proto.Equal(got, msg) {
+					t.Fatalf("拿到 %v，期望 %v", got, msg)
+				}
+			},
+		},
+		{
+			name: "普通结构体用 json",
+			roundTrip: func(t *testing.T, first, second *ReadThrough) {
+				want := course{Id: 1, Name: "高等数学"}
+				if _, err := Get(context.Background(), first, "k", testTTL, func(ctx context.Context) (course, error) {
+					return want, nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+				got, err := Get(context.Background(), second, "k", testTTL, func(ctx context.Context) (course, error) {
+					return course{}, errors.New("不应该回源")
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != want {
+					t.Fatalf("拿到 %v，期望 %v", got, want)
+				}
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := fakes.NewRedis()
+			tc.roundTrip(t, NewReadThrough(cmd, 16), NewReadThrough(cmd, 16))
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	c := NewReadThrough(fakes.NewRedis(), 16)
+	var loads int
+	load := func(ctx context.Context) (int, error) {
+		loads++
+		return loads, nil
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := Get(context.Background(), c, "k", testTTL, load); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("命中缓存还回源了，一共 %d 次", loads)
+	}
+	if err := c.Delete(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	val, err := Get(context.Background(), c, "k", testTTL, load)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != 2 {
+		t.Fatalf("删除之后应该重新回源，拿到 %d", val)
+	}
+}
@@ -0,0 +1,89 @@
+package dataloader
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"sync"
+)
+
+// BatchFunc 批量查询，返回的 map 里缺失的 key 视为零值
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader 把列表里逐条的查询合并起来：key 去重，按 maxBatch 切分，再以有限的并发调用下游。
+// 下游有批量接口就用 NewBatchLoader，没有就用 NewLoader 退化成一次一个 key
+type Loader[K comparable, V any] struct {
+	batchFn  BatchFunc[K, V]
+	maxBatch int
+	// 0 表示沿用 aggregate.Group 的上限
+	concurrency int
+}
+
+func NewBatchLoader[K comparable, V any](batchFn BatchFunc[K, V], maxBatch int) *Loader[K, V] {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	return &Loader[K, V]{
+		batchFn:  batchFn,
+		maxBatch: maxBatch,
+	}
+}
+
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, key K) (V, error)) *Loader[K, V] {
+	return NewBatchLoader(func(ctx context.Context, keys []K) (map[K]V, error) {
+		res := make(map[K]V, len(keys))
+		for _, key := range keys {
+			val, err := fetch(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			res[key] = val
+		}
+		return res, nil
+	}, 1)
+}
+
+// Concurrency 覆盖默认的并发上限，不设置时和 aggregate.Group 的上限一致
+func (l *Loader[K, V]) Concurrency(n int) *Loader[K, V] {
+	if n > 0 {
+		l.concurrency = n
+	}
+	return l
+}
+
+// LoadMany 任何一批失败都会让整体失败
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) (map[K]V, error) {
+	uniq := make([]K, 0, len(keys))
+	seen := make(map[K]struct{}, len(keys))
+	for _, key := range keys {
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		uniq = append(uniq, key)
+	}
+	var (
+		mu  sync.Mutex
+		res = make(map[K]V, len(uniq))
+	)
+	g := aggregate.NewGroup(ctx).Limit(l.concurrency)
+	for start := 0; start < len(uniq); start += l.maxBatch {
+		batch := uniq[start:min(start+l.maxBatch, len(uniq))]
+		g.Required("dataloader", func(ctx context.Context) error {
+			vals, err := l.batchFn(ctx, batch)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for k, v := range vals {
+				res[k] = v
+			}
+			return nil
+		})
+	}
+	_, err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,119 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestLoadMany(t *testing.T) {
+	testCases := []struct {
+		name     string
+		keys     []int64
+		maxBatch int
+		// 每批的 key，顺序不固定，比较前排序
+		wantBatches [][]int64
+		wantErr     bool
+	}{
+		{
+			name:        "去重",
+			keys:        []int64{1, 2, 1, 3, 2},
+			maxBatch:    10,
+			wantBatches: [][]int64{{1, 2, 3}},
+		},
+		{
+			name:        "按 maxBatch 切分",
+			keys:        []int64{1, 2, 3, 4, 5},
+			maxBatch:    2,
+			wantBatches: [][]int64{{1, 2}, {3, 4}, {5}},
+		},
+		{
+			name:        "去重之后再切分",
+			keys:        []int64{1, 1, 2, 2, 3},
+			maxBatch:    2,
+			wantBatches: [][]int64{{1, 2}, {3}},
+		},
+		{
+			name:     "没有 key 不调用下游",
+			keys:     nil,
+			maxBatch: 2,
+		},
+		{
+			name:        "一批失败整体失败",
+			keys:        []int64{1, 2, 3, 404},
+			maxBatch:    2,
+			wantBatches: [][]int64{{1, 2}, {3, 404}},
+			wantErr:     true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				batches [][]int64
+			)
+			l := NewBatchLoader(func(ctx context.Context, keys []int64) (map[int64]string, error) {
+				mu.Lock()
+				batches = append(batches, slices.Clone(keys))
+				mu.Unlock()
+				if slices.Contains(keys, 404) {
+					return nil, errors.New("下游挂了")
+				}
+				res := make(map[int64]string, len(keys))
+				for _, key := range keys {
+					// 缺失的 key 视为零值
+					if key != 3 {
+						res[key] = "v"
+					}
+				}
+				return res, nil
+			}, tc.maxBatch)
+			res, err := l.LoadMany(context.Background(), tc.keys)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v，期望出错 %v", err, tc.wantErr)
+			}
+			slices.SortFunc(batches, func(a, b []int64) int { return int(a[0] - b[0]) })
+			if !slices.EqualFunc(batches, tc.wantBatches, slices.Equal[[]int64]) {
+				t.Fatalf("批次 = %v，期望 %v", batches, tc.wantBatches)
+			}
+			if tc.wantErr {
+				return
+			}
+			for _, key := range tc.keys {
+				want := "v"
+				if key == 3 {
+					want = ""
+				}
+				if res[key] != want {
+					t.Fatalf("key %d = %q，期望 %q", key, res[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewLoader(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []int64
+	)
+	l := NewLoader(func(ctx context.Context, key int64) (int64, error) {
+		mu.Lock()
+		calls = append(calls, key)
+		mu.Unlock()
+		return key * 10, nil
+	}).Concurrency(2)
+	res, err := l.LoadMany(context.Background(), []int64{3, 1, 3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(calls)
+	if !slices.Equal(calls, []int64{1, 2, 3}) {
+		t.Fatalf("调用 = %v，重复的 key 只应该查一次", calls)
+	}
+	if res[1] != 10 || res[2] != 20 || res[3] != 30 {
+		t.Fatalf("结果 = %v", res)
+	}
+}
@@ -0,0 +1,115 @@
+package diag
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Server 诊断用的管理端口，和业务端口分开，Addr 为空就不启动
+type Server struct {
+	*ginx.Server
+}
+
+func (s *Server) Start() error {
+	if s.Addr == "" {
+		return nil
+	}
+	return s.Server.Start()
+}
+
+// Handler 运行时诊断：pprof、运行时信息、路由表和脱敏后的配置
+type Handler struct {
+	// 业务端口的路由表
+	routes func() gin.RoutesInfo
+	// 当前生效的配置，每次调用都要返回一份新的快照
+	settings func() map[string]any
+	start    time.Time
+}
+
+func NewHandler(routes func() gin.RoutesInfo, settings func() map[string]any) *Handler {
+	return &Handler{routes: routes, settings: settings, start: time.Now()}
+}
+
+func (h *Handler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
+	dg := s.Group("/debug", authMiddleware)
+	// gin 里通配的路由不能和固定的路由挂在同一级，所以统一进来再分发
+	dg.Any("/pprof/*name", h.Pprof)
+	dg.GET("/runtime", h.Runtime)
+	dg.GET("/routes", h.Routes)
+	dg.GET("/config", h.Config)
+}
+
+func (h *Handler) Pprof(ctx *gin.Context) {
+	switch ctx.Param("name") {
+	case "/cmdline":
+		pprof.Cmdline(ctx.Writer, ctx.Request)
+	case "/profile":
+		pprof.Profile(ctx.Writer, ctx.Request)
+	case "/symbol":
+		pprof.Symbol(ctx.Writer, ctx.Request)
+	case "/trace":
+		pprof.Trace(ctx.Writer, ctx.Request)
+	default:
+		// 首页和 heap、goroutine 这些命名的 profile 都由 Index 按路径处理
+		pprof.Index(ctx.Writer, ctx.Request)
+	}
+}
+
+func (h *Handler) Runtime(ctx *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	vo := RuntimeVo{
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		StartTime:  h.start.UnixMilli(),
+		Uptime:     time.Since(h.start).Truncate(time.Second).String(),
+		HeapAlloc:  mem.HeapAlloc,
+		HeapInuse:  mem.HeapInuse,
+		NumGC:      mem.NumGC,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		vo.Module = info.Main.Path
+		vo.Version = info.Main.Version
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				vo.Revision = setting.Value
+			case "vcs.time":
+				vo.BuildTime = setting.Value
+			case "vcs.modified":
+				vo.Modified = setting.Value == "true"
+			}
+		}
+	}
+	ctx.JSON(http.StatusOK, ginx.Result{
+		Msg:  "Success",
+		Data: vo,
+	})
+}
+
+func (h *Handler) Routes(ctx *gin.Context) {
+	routes := h.routes()
+	vos := make([]RouteVo, 0, len(routes))
+	for _, r := range routes {
+		vos = append(vos, RouteVo{Method: r.Method, Path: r.Path, Handler: r.Handler})
+	}
+	ctx.JSON(http.StatusOK, ginx.Result{
+		Msg:  "Success",
+		Data: vos,
+	})
+}
+
+// Config 当前生效的配置，包括 etcd 上覆盖的部分，敏感的值会打码
+func (h *Handler) Config(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, ginx.Result{
+		Msg:  "Success",
+		Data: Mask(h.settings()),
+	})
+}
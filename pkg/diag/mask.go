@@ -0,0 +1,57 @@
+package diag
+
+import "strings"
+
+// 名字里带这些词的配置项都当成敏感的，viper 会把 key 转成小写
+var sensitiveWords = []string{"key", "secret", "password", "token"}
+
+const masked = "******"
+
+// Mask 返回一份打码后的配置，不会修改原来的 settings。空值不打码，方便看出来是不是漏配了。
+// 敏感的 key 下面整棵子树都打码，比如 smtp.password 是 map 的时候
+func Mask(settings map[string]any) map[string]any {
+	return maskMap(false, settings)
+}
+
+func maskMap(parent bool, settings map[string]any) map[string]any {
+	res := make(map[string]any, len(settings))
+	for key, val := range settings {
+		res[key] = maskValue(parent || sensitive(key), val)
+	}
+	return res
+}
+
+func maskValue(sensitive bool, val any) any {
+	switch v := val.(type) {
+	case map[string]any:
+		return maskMap(sensitive, v)
+	case []any:
+		res := make([]any, len(v))
+		for i, elem := range v {
+			res[i] = maskValue(sensitive, elem)
+		}
+		return res
+	case nil:
+		return nil
+	case string:
+		if sensitive && v != "" {
+			return masked
+		}
+		return v
+	default:
+		if sensitive {
+			return masked
+		}
+		return v
+	}
+}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range sensitiveWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package diag
+
+type RuntimeVo struct {
+	GoVersion  string `json:"goVersion"`
+	Module     string `json:"module"`
+	Version    string `json:"version"`
+	Revision   string `json:"revision"`
+	BuildTime  string `json:"buildTime"`
+	Modified   bool   `json:"modified"`
+	Goroutines int    `json:"goroutines"`
+	NumCPU     int    `json:"numCPU"`
+	GOMAXPROCS int    `json:"GOMAXPROCS"`
+	StartTime  int64  `json:"startTime"`
+	Uptime     string `json:"uptime"`
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	HeapInuse  uint64 `json:"heapInuse"`
+	NumGC      uint32 `json:"numGC"`
+}
+
+type RouteVo struct {
+	Method  string `json:"method"`
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+}
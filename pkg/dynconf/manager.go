@@ -0,0 +1,233 @@
+package dynconf
+
+import (
+	"bytes"
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// Manager 动态配置。配置的来源有两个：
+//  1. 配置文件，文件变了就重新读；
+//  2. etcd 的某个前缀下的所有 key，每个 value 都是一段 yaml，按 key 的字典序依次合并到配置文件之上。
+//
+// 任何一个来源变化都会在一个新的 viper 实例里从头构建一遍完整的配置，构建好了再整体换上，
+// 然后重新解析所有通过 Bind 绑定的配置项，解析出来和原来不一样的才会替换并通知订阅者。解析失败的保留旧值，只打日志。
+//
+// viper 不是并发安全的，所以不碰全局实例（ioc 启动时读完就不再变了），自己的实例只在持有 mu 时读写
+type Manager struct {
+	l    logger.Logger
+	mu   sync.Mutex
+	file string
+	// 当前生效的完整配置，构建好之后不会再修改
+	v *viper.Viper
+	// etcd key（或者本地覆盖的名字） -> yaml
+	etcdDocs  map[string][]byte
+	reloaders []func(v *viper.Viper) error
+	// WatchEtcd 之后才有，Put 和 Delete 据此决定写 etcd 还是只改本地
+	client *clientv3.Client
+	prefix string
+}
+
+// NewManager file 是 yaml 格式的配置文件
+func NewManager(l logger.Logger, file string) (*Manager, error) {
+	m := &Manager{
+		l:        l,
+		file:     file,
+		etcdDocs: make(map[string][]byte),
+	}
+	v, err := m.build()
+	if err != nil {
+		return nil, err
+	}
+	m.v = v
+	return m, nil
+}
+
+// Bind 绑定一个配置项，立刻解析一次，解析失败直接 panic，和 ioc 里的 Init 方法一样
+func Bind[T any](m *Manager, key string) *Value[T] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var init T
+	err := m.v.UnmarshalKey(key, &init)
+	if err != nil {
+		panic(err)
+	}
+	v := newValue(init)
+	m.reloaders = append(m.reloaders, func(cfg *viper.Viper) error {
+		var val T
+		er := cfg.UnmarshalKey(key, &val)
+		if er != nil {
+			return er
+		}
+		if !reflect.DeepEqual(val, v.Load()) {
+			m.l.Info("配置项已更新", logger.String("key", key))
+			v.store(val)
+		}
+		return nil
+	})
+	return v
+}
+
+// Reload 从头构建一遍配置，并重新解析所有的配置项
+func (m *Manager) Reload() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reload()
+}
+
+// reload 调用方要持有锁
+func (m *Manager) reload() {
+	v, err := m.build()
+	if err != nil {
+		m.l.Error("重新读取配置文件失败", logger.Error(err))
+		return
+	}
+	m.v = v
+	for _, reload := range m.reloaders {
+		err = reload(v)
+		if err != nil {
+			m.l.Error("解析配置项失败，保留旧值", logger.Error(err))
+		}
+	}
+}
+
+// AllSettings 当前生效的完整配置的快照，可以随便改
+func (m *Manager) AllSettings() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.v.AllSettings()
+}
+
+// build 读配置文件，再合并 etcd 上的配置，调用方要持有锁
+func (m *Manager) build() (*viper.Viper, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetConfigFile(m.file)
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(m.etcdDocs))
+	for key := range m.etcdDocs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		err = v.MergeConfig(bytes.NewReader(m.etcdDocs[key]))
+		if err != nil {
+			// 一段坏的配置不影响其他的
+			m.l.Error("合并 etcd 上的配置失败", logger.String("key", key), logger.Error(err))
+		}
+	}
+	return v, nil
+}
+
+// WatchFile 监听配置文件。监听的是所在的目录，这样编辑器先删后写、k8s 的 ConfigMap 换软链接也能感知到
+func (m *Manager) WatchFile() error {
+	file := m.file
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	err = watcher.Add(filepath.Dir(file))
+	if err != nil {
+		_ = watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case evt, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(evt.Name) != filepath.Clean(file) ||
+					!evt.Has(fsnotify.Write|fsnotify.Create) {
+					continue
+				}
+				m.l.Info("配置文件变化，重新加载", logger.String("file", file))
+				m.Reload()
+			case er, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				m.l.Error("监听配置文件失败", logger.Error(er))
+			}
+		}
+	}()
+	return nil
+}
+
+// WatchEtcd 先把 prefix 下已有的配置合并进来，再持续监听。ctx 取消后停止监听
+func (m *Manager) WatchEtcd(ctx context.Context, client *clientv3.Client, prefix string) error {
+	res, err := client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	for _, kv := range res.Kvs {
+		m.etcdDocs[string(kv.Key)] = kv.Value
+	}
+	m.client, m.prefix = client, prefix
+	m.reload()
+	m.mu.Unlock()
+	// 从 Get 的版本之后开始监听，中间的变化不会丢
+	ch := client.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(res.Header.Revision+1))
+	go func() {
+		for wres := range ch {
+			if er := wres.Err(); er != nil {
+				m.l.Error("监听 etcd 配置失败", logger.Error(er))
+				continue
+			}
+			m.mu.Lock()
+			for _, evt := range wres.Events {
+				key := string(evt.Kv.Key)
+				switch evt.Type {
+				case clientv3.EventTypePut:
+					m.etcdDocs[key] = evt.Kv.Value
+				case clientv3.EventTypeDelete:
+					delete(m.etcdDocs, key)
+				}
+			}
+			m.l.Info("etcd 上的配置变化，重新加载", logger.String("prefix", prefix))
+			m.reload()
+			m.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Put 在配置之上覆盖一段 yaml，name 是这段配置的名字，相同名字的会被替换。
+// 监听了 etcd 的时候写到 etcd 上，所有实例都会通过 watch 生效；否则只在本实例生效，重启后丢失
+func (m *Manager) Put(ctx context.Context, name string, doc []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.client != nil {
+		_, err := m.client.Put(ctx, m.prefix+name, string(doc))
+		return err
+	}
+	m.etcdDocs[name] = doc
+	m.reload()
+	return nil
+}
+
+// Delete 删除 Put 写入的覆盖，恢复成原来的配置
+func (m *Manager) Delete(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.client != nil {
+		_, err := m.client.Delete(ctx, m.prefix+name)
+		return err
+	}
+	delete(m.etcdDocs, name)
+	m.reload()
+	return nil
+}
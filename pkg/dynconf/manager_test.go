@@ -0,0 +1,162 @@
+package dynconf
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+type testLimits struct {
+	Size int64    `yaml:"size"`
+	Tags []string `yaml:"tags"`
+}
+
+func newTestManager(t *testing.T, content string) (*Manager, string) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewManager(logger.NewNopLogger(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, file
+}
+
+func TestBind(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 在 limits.size: 10 的基础上做的修改
+		change     func(t *testing.T, m *Manager, file string)
+		wantSize   int64
+		wantNotify int
+	}{
+		{
+			name: "覆盖",
+			change: func(t *testing.T, m *Manager, file string) {
+				if err := m.Put(context.Background(), "a", []byte("limits:\n  size: 20\n")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantSize:   20,
+			wantNotify: 1,
+		},
+		{
+			name: "按名字的字典序合并",
+			change: func(t *testing.T, m *Manager, file string) {
+				_ = m.Put(context.Background(), "b", []byte("limits:\n  size: 30\n"))
+				_ = m.Put(context.Background(), "a", []byte("limits:\n  size: 20\n"))
+			},
+			wantSize:   30,
+			wantNotify: 1,
+		},
+		{
+			name: "删掉覆盖恢复原来的",
+			change: func(t *testing.T, m *Manager, file string) {
+				_ = m.Put(context.Background(), "a", []byte("limits:\n  size: 20\n"))
+				_ = m.Delete(context.Background(), "a")
+			},
+			wantSize:   10,
+			wantNotify: 2,
+		},
+		{
+			name: "别的配置项变了不通知",
+			change: func(t *testing.T, m *Manager, file string) {
+				_ = m.Put(context.Background(), "a", []byte("other: 1\n"))
+			},
+			wantSize: 10,
+		},
+		{
+			name: "解析失败保留旧值",
+			change: func(t *testing.T, m *Manager, file string) {
+				_ = m.Put(context.Background(), "a", []byte("limits:\n  size: 不是数字\n"))
+			},
+			wantSize: 10,
+		},
+		{
+			name: "坏的 yaml 不影响别的覆盖",
+			change: func(t *testing.T, m *Manager, file string) {
+				_ = m.Put(context.Background(), "a", []byte("limits: [\n"))
+				_ = m.Put(context.Background(), "b", []byte("limits:\n  size: 30\n"))
+			},
+			wantSize:   30,
+			wantNotify: 1,
+		},
+		{
+			name: "配置文件改了重新加载",
+			change: func(t *testing.T, m *Manager, file string) {
+				if err := os.WriteFile(file, []byte("limits:\n  size: 40\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				m.Reload()
+			},
+			wantSize:   40,
+			wantNotify: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, file := newTestManager(t, "limits:\n  size: 10\n  tags: [a]\n")
+			v := Bind[testLimits](m, "limits")
+			if v.Load().Size != 10 {
+				t.Fatalf("初始值 = %d，期望 10", v.Load().Size)
+			}
+			notify := 0
+			v.Subscribe(func(old, new testLimits) {
+				notify++
+			})
+			tc.change(t, m, file)
+			if v.Load().Size != tc.wantSize {
+				t.Fatalf("size = %d，期望 %d", v.Load().Size, tc.wantSize)
+			}
+			if notify != tc.wantNotify {
+				t.Fatalf("通知了 %d 次，期望 %d 次", notify, tc.wantNotify)
+			}
+		})
+	}
+}
+
+func TestBindPanic(t *testing.T) {
+	m, _ := newTestManager(t, "limits:\n  size: 不是数字\n")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("启动时解析失败应该 panic")
+		}
+	}()
+	Bind[testLimits](m, "limits")
+}
+
+func TestMap(t *testing.T) {
+	m, _ := newTestManager(t, "limits:\n  size: 10\n  tags: [a, b]\n")
+	v := Bind[testLimits](m, "limits")
+	tags := Map(v, func(l testLimits) map[string]bool {
+		res := make(map[string]bool, len(l.Tags))
+		for _, tag := range l.Tags {
+			res[tag] = true
+		}
+		return res
+	})
+	if !tags.Load()["a"] || tags.Load()["c"] {
+		t.Fatalf("派生的配置 = %v", tags.Load())
+	}
+	var olds [][]string
+	v.Subscribe(func(old, new testLimits) {
+		olds = append(olds, old.Tags)
+	})
+	if err := m.Put(context.Background(), "a", []byte("limits:\n  tags: [c]\n")); err != nil {
+		t.Fatal(err)
+	}
+	if tags.Load()["a"] || !tags.Load()["c"] {
+		t.Fatalf("源配置变了，派生的配置 = %v", tags.Load())
+	}
+	if len(olds) != 1 || !slices.Equal(olds[0], []string{"a", "b"}) {
+		t.Fatalf("订阅者拿到的旧值 = %v", olds)
+	}
+	if static := NewStatic(3); static.Load() != 3 {
+		t.Fatalf("NewStatic = %d", static.Load())
+	}
+}
@@ -0,0 +1,55 @@
+package dynconf
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Value 某个配置项的类型化快照，重新加载时整体原子替换，读的时候不用加锁。
+// Load 拿到的快照不要修改，切片和 map 是和其他读者共享的
+type Value[T any] struct {
+	v    atomic.Pointer[T]
+	mu   sync.Mutex
+	subs []func(old, new T)
+}
+
+func newValue[T any](init T) *Value[T] {
+	v := &Value[T]{}
+	v.v.Store(&init)
+	return v
+}
+
+// NewStatic 不会变的配置，方便在不需要动态配置的地方（比如 standalone 或者测试）构造
+func NewStatic[T any](val T) *Value[T] {
+	return newValue(val)
+}
+
+func (v *Value[T]) Load() T {
+	return *v.v.Load()
+}
+
+// Subscribe 配置变化后回调，回调是在加载配置的 goroutine 里同步执行的，不要阻塞
+func (v *Value[T]) Subscribe(fn func(old, new T)) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.subs = append(v.subs, fn)
+}
+
+func (v *Value[T]) store(val T) {
+	old := v.v.Swap(&val)
+	v.mu.Lock()
+	subs := v.subs
+	v.mu.Unlock()
+	for _, fn := range subs {
+		fn(*old, val)
+	}
+}
+
+// Map 派生一个配置项，源配置项变了会跟着重新计算，适合把配置转换成用起来更方便的结构，比如切片转集合
+func Map[T, R any](src *Value[T], fn func(T) R) *Value[R] {
+	dst := newValue(fn(src.Load()))
+	src.Subscribe(func(old, new T) {
+		dst.store(fn(new))
+	})
+	return dst
+}
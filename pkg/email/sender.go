@@ -0,0 +1,15 @@
+package email
+
+import "context"
+
+// Sender 发邮件，生产环境是 SMTP，standalone 只打日志
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+type Message struct {
+	To      []string
+	Subject string
+	// HTML 邮件正文
+	HTML string
+}
@@ -0,0 +1,186 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer 本地的 SMTP 替身，只处理一个连接，记下收到的内容
+type smtpServer struct {
+	ln net.Listener
+	// rejectRcpt 这个收件人返回 550
+	rejectRcpt string
+
+	auth string
+	from string
+	rcpt []string
+	data string
+	done chan struct{}
+}
+
+func newSMTPServer(t *testing.T, rejectRcpt string) *smtpServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{ln: ln, rejectRcpt: rejectRcpt, done: make(chan struct{})}
+	t.Cleanup(func() { _ = ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	defer close(s.done)
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	tp := textproto.NewConn(conn)
+	reply := func(line string) { _ = tp.PrintfLine("%s", line) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			_, s.auth, _ = strings.Cut(arg, " ")
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			s.from = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			reply("250 OK")
+		case "RCPT":
+			rcpt := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if rcpt == s.rejectRcpt {
+				reply("550 no such user")
+				continue
+			}
+			s.rcpt = append(s.rcpt, rcpt)
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.data = string(data)
+			reply("250 OK")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *smtpServer) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SMTP 连接没有结束")
+	}
+}
+
+func TestSMTPSenderSend(t *testing.T) {
+	srv := newSMTPServer(t, "")
+	sender, err := NewSMTPSender(SMTPConfig{
+		Addr:     srv.ln.Addr().String(),
+		Username: "noreply@bigdust.space",
+		Password: "secret",
+		From:     "课栈 <noreply@bigdust.space>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 正文足够长，base64 之后要折行
+	html := "<p>" + strings.Repeat("你好，课栈！", 20) + "</p>"
+	err = sender.Send(context.Background(), Message{
+		To:      []string{"a@ccnu.edu.cn", "b@ccnu.edu.cn"},
+		Subject: "课栈验证码：123456",
+		HTML:    html,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.wait(t)
+
+	auth, err := base64.StdEncoding.DecodeString(srv.auth)
+	if err != nil || string(auth) != "\x00noreply@bigdust.space\x00secret" {
+		t.Fatalf("AUTH PLAIN 的凭证不对：%q", auth)
+	}
+	if srv.from != "noreply@bigdust.space" {
+		t.Fatalf("MAIL FROM = %s", srv.from)
+	}
+	if !slices.Equal(srv.rcpt, []string{"a@ccnu.edu.cn", "b@ccnu.edu.cn"}) {
+		t.Fatalf("RCPT TO = %v", srv.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(srv.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawSubject := msg.Header.Get("Subject")
+	if !strings.HasPrefix(rawSubject, "=?UTF-8?b?") {
+		t.Fatalf("标题应该是 B 编码，实际是 %q", rawSubject)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(rawSubject)
+	if err != nil || subject != "课栈验证码：123456" {
+		t.Fatalf("标题 = %q，%v", subject, err)
+	}
+	if msg.Header.Get("Content-Transfer-Encoding") != "base64" {
+		t.Fatalf("Content-Transfer-Encoding = %s", msg.Header.Get("Content-Transfer-Encoding"))
+	}
+	var lines []string
+	scanner := bufio.NewScanner(msg.Body)
+	for scanner.Scan() {
+		if len(scanner.Text()) > 76 {
+			t.Fatalf("正文一行 %d 个字符，超过了 76", len(scanner.Text()))
+		}
+		lines = append(lines, scanner.Text())
+	}
+	body, err := base64.StdEncoding.DecodeString(strings.Join(lines, ""))
+	if err != nil || string(body) != html {
+		t.Fatalf("正文解出来是 %q，%v", body, err)
+	}
+}
+
+func TestSMTPSenderRcptRejected(t *testing.T) {
+	srv := newSMTPServer(t, "b@ccnu.edu.cn")
+	sender, err := NewSMTPSender(SMTPConfig{Addr: srv.ln.Addr().String(), From: "noreply@bigdust.space"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sender.Send(context.Background(), Message{
+		To:      []string{"a@ccnu.edu.cn", "b@ccnu.edu.cn"},
+		Subject: "测试",
+		HTML:    "<p>测试</p>",
+	})
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("收件人被拒绝时应该返回错误，实际是 %v", err)
+	}
+	srv.wait(t)
+	// 没配置用户名就不认证
+	if srv.auth != "" || srv.data != "" {
+		t.Fatalf("不应该认证也不应该发出正文：auth = %q，data = %q", srv.auth, srv.data)
+	}
+}
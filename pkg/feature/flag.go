@@ -0,0 +1,68 @@
+package feature
+
+import (
+	"errors"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// Flag 一个功能开关。Enabled 是总开关，关着的时候谁都拿不到；开着的时候命中任意一条规则即可：
+//  1. Uids 里的用户；
+//  2. 学号以 StudentIdPrefixes 里某个前缀开头的用户，比如 "2023" 就是 23 级；
+//  3. 按 uid 哈希分桶，落在前 Percentage% 的用户。同一个开关下同一个用户的结果是稳定的。
+//
+// 全量要显式写 Percentage 100，开着却一条规则都没有的开关谁都拿不到，配置检查和管理接口会拒绝
+type Flag struct {
+	Enabled           bool     `json:"enabled"`
+	Description       string   `json:"description"`
+	Uids              []int64  `json:"uids"`
+	StudentIdPrefixes []string `json:"studentIdPrefixes"`
+	// 0 到 100
+	Percentage int `json:"percentage"`
+}
+
+// Target 判断开关时的用户，游客的 Uid 是 0，只能命中全量的开关
+type Target struct {
+	Uid       int64
+	StudentId string
+}
+
+// Validate 配置检查和管理接口保存前调用
+func (f Flag) Validate() error {
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return errors.New("percentage 必须在 0 到 100 之间")
+	}
+	if f.Enabled && len(f.Uids) == 0 && len(f.StudentIdPrefixes) == 0 && f.Percentage == 0 {
+		return errors.New("开着但是没有任何规则，全量请写 percentage: 100")
+	}
+	return nil
+}
+
+func (f Flag) Evaluate(name string, t Target) bool {
+	if !f.Enabled {
+		return false
+	}
+	if f.Percentage >= 100 {
+		return true
+	}
+	if t.Uid == 0 {
+		return false
+	}
+	for _, uid := range f.Uids {
+		if uid == t.Uid {
+			return true
+		}
+	}
+	for _, prefix := range f.StudentIdPrefixes {
+		if prefix != "" && strings.HasPrefix(t.StudentId, prefix) {
+			return true
+		}
+	}
+	return bucket(name, t.Uid) < f.Percentage
+}
+
+// bucket 把开关名也算进去，不然每次放量命中的都是同一批用户
+func bucket(name string, uid int64) int {
+	return int(crc32.ChecksumIEEE([]byte(name+":"+strconv.FormatInt(uid, 10))) % 100)
+}
@@ -0,0 +1,77 @@
+package feature
+
+import (
+	"testing"
+)
+
+func TestFlagEvaluate(t *testing.T) {
+	user := Target{Uid: 42, StudentId: "2023214001"}
+	testCases := []struct {
+		name   string
+		flag   Flag
+		target Target
+		want   bool
+	}{
+		{name: "关着", flag: Flag{Percentage: 100}, target: user},
+		{name: "全量", flag: Flag{Enabled: true, Percentage: 100}, target: user, want: true},
+		{name: "全量包括游客", flag: Flag{Enabled: true, Percentage: 100}, want: true},
+		{name: "没有规则谁都拿不到", flag: Flag{Enabled: true}, target: user},
+		{name: "命中 uid", flag: Flag{Enabled: true, Uids: []int64{1, 42}}, target: user, want: true},
+		{name: "没命中 uid", flag: Flag{Enabled: true, Uids: []int64{1}}, target: user},
+		{name: "命中学号前缀", flag: Flag{Enabled: true, StudentIdPrefixes: []string{"2022", "2023"}}, target: user, want: true},
+		{name: "空前缀不算", flag: Flag{Enabled: true, StudentIdPrefixes: []string{""}}, target: user},
+		{name: "游客只能命中全量", flag: Flag{Enabled: true, StudentIdPrefixes: []string{""}, Percentage: 99}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.flag.Evaluate("test", tc.target); got != tc.want {
+				t.Fatalf("Evaluate = %v，期望 %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFlagPercentage(t *testing.T) {
+	// 分桶是稳定的，放量只会增加命中的用户
+	flag := Flag{Enabled: true, Percentage: 30}
+	hit := 0
+	for uid := int64(1); uid <= 1000; uid++ {
+		target := Target{Uid: uid}
+		got := flag.Evaluate("test", target)
+		if got != flag.Evaluate("test", target) {
+			t.Fatalf("uid %d 两次结果不一样", uid)
+		}
+		if got {
+			hit++
+			more := Flag{Enabled: true, Percentage: 60}
+			if !more.Evaluate("test", target) {
+				t.Fatalf("放量到 60%% 之后 uid %d 反而拿不到了", uid)
+			}
+		}
+	}
+	if hit < 250 || hit > 350 {
+		t.Fatalf("30%% 放量命中了 %d/1000 个用户", hit)
+	}
+}
+
+func TestFlagValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		flag    Flag
+		wantErr bool
+	}{
+		{name: "关着的没有规则也行", flag: Flag{}},
+		{name: "全量", flag: Flag{Enabled: true, Percentage: 100}},
+		{name: "按 uid", flag: Flag{Enabled: true, Uids: []int64{1}}},
+		{name: "开着但没有规则", flag: Flag{Enabled: true}, wantErr: true},
+		{name: "比例小于 0", flag: Flag{Percentage: -1}, wantErr: true},
+		{name: "比例大于 100", flag: Flag{Enabled: true, Percentage: 101}, wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.flag.Validate(); (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v，期望出错 %v", err, tc.wantErr)
+			}
+		})
+	}
+}
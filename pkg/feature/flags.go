@@ -0,0 +1,79 @@
+package feature
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// Flags 所有的功能开关，配置在 features 下面，key 是开关名。
+// viper 会把 key 转成小写，所以开关名统一用小写加下划线，比如 new_course_list
+type Flags struct {
+	dc    *dynconf.Manager
+	flags *dynconf.Value[map[string]Flag]
+}
+
+func NewFlags(dc *dynconf.Manager) *Flags {
+	return &Flags{
+		dc:    dc,
+		flags: dynconf.Bind[map[string]Flag](dc, "features"),
+	}
+}
+
+// Enabled 给 handler 里用，没有配置的开关一律是关的
+func (f *Flags) Enabled(name string, t Target) bool {
+	name = strings.ToLower(name)
+	flag, ok := f.flags.Load()[name]
+	return ok && flag.Evaluate(name, t)
+}
+
+// EnabledFor 从登录中间件放进去的用户信息里取 Target，没登录的按游客算
+func (f *Flags) EnabledFor(ctx *gin.Context, name string) bool {
+	var t Target
+	if val, ok := ctx.Get("user"); ok {
+		if uc, ok := val.(ijwt.UserClaims); ok {
+			t = Target{Uid: uc.Uid, StudentId: uc.StudentId}
+		}
+	}
+	return f.Enabled(name, t)
+}
+
+// Guard 给注册路由用，开关没开的用户当这个路由不存在，要放在登录中间件后面
+func (f *Flags) Guard(name string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !f.EnabledFor(ctx, name) {
+			ctx.AbortWithStatus(http.StatusNotFound)
+		}
+	}
+}
+
+// List 返回的 map 是共享的快照，不要修改
+func (f *Flags) List() map[string]Flag {
+	return f.flags.Load()
+}
+
+// Save 覆盖配置文件里的开关，配了 etcd 的时候所有实例都会生效
+func (f *Flags) Save(ctx context.Context, name string, flag Flag) error {
+	name = strings.ToLower(name)
+	// json 也是合法的 yaml
+	doc, err := json.Marshal(map[string]any{
+		"features": map[string]Flag{name: flag},
+	})
+	if err != nil {
+		return err
+	}
+	return f.dc.Put(ctx, overrideName(name), doc)
+}
+
+// Reset 删除 Save 的覆盖，恢复成配置文件里的开关
+func (f *Flags) Reset(ctx context.Context, name string) error {
+	return f.dc.Delete(ctx, overrideName(strings.ToLower(name)))
+}
+
+func overrideName(name string) string {
+	return "features/" + name
+}
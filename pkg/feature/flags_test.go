@@ -0,0 +1,74 @@
+package feature
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlagsGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	content := "features:\n  beta:\n    enabled: true\n    uids: [42]\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := dynconf.NewManager(logger.NewNopLogger(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flags := NewFlags(dc)
+	serve := func(name string, uid int64) int {
+		engine := gin.New()
+		engine.GET("/beta", func(ctx *gin.Context) {
+			if uid != 0 {
+				ctx.Set("user", ijwt.UserClaims{Uid: uid})
+			}
+		}, flags.Guard(name), func(ctx *gin.Context) {
+			ctx.Status(http.StatusOK)
+		})
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/beta", nil))
+		return rec.Code
+	}
+	testCases := []struct {
+		name string
+		flag string
+		uid  int64
+		want int
+	}{
+		{name: "命中", flag: "beta", uid: 42, want: http.StatusOK},
+		{name: "开关名不区分大小写", flag: "BETA", uid: 42, want: http.StatusOK},
+		{name: "没命中", flag: "beta", uid: 1, want: http.StatusNotFound},
+		{name: "游客", flag: "beta", want: http.StatusNotFound},
+		{name: "没有配置的开关", flag: "unknown", uid: 42, want: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := serve(tc.flag, tc.uid); got != tc.want {
+				t.Fatalf("状态码 %d，期望 %d", got, tc.want)
+			}
+		})
+	}
+
+	// 管理接口改成全量之后游客也能访问
+	if err = flags.Save(context.Background(), "beta", Flag{Enabled: true, Percentage: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if got := serve("beta", 0); got != http.StatusOK {
+		t.Fatalf("全量之后游客拿到 %d", got)
+	}
+	if err = flags.Reset(context.Background(), "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if got := serve("beta", 0); got != http.StatusNotFound {
+		t.Fatalf("重置之后游客拿到 %d", got)
+	}
+}
@@ -1,6 +1,8 @@
 package ginx
 
 import (
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/grpcx"
 	"github.com/MuxiKeStack/bff/pkg/logger"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/gin-gonic/gin"
@@ -48,12 +50,13 @@ func WrapClaimsAndReq[Req any](fn func(*gin.Context, Req, ijwt.UserClaims) (Resu
 			return
 		}
 		res, err := fn(ctx, req, claims)
+		res = timeoutResult(res, err)
 		vector.WithLabelValues(strconv.Itoa(res.Code)).Inc()
 		if err != nil {
 			log.Error("执行业务逻辑失败",
 				logger.Error(err))
 		}
-		ctx.JSON(http.StatusOK, res)
+		render(ctx, res)
 	}
 }
 
@@ -66,24 +69,26 @@ func WrapReq[Req any](fn func(*gin.Context, Req) (Result, error)) gin.HandlerFun
 			return
 		}
 		res, err := fn(ctx, req)
+		res = timeoutResult(res, err)
 		if err != nil {
 			log.Error("执行业务逻辑失败",
 				logger.Error(err))
 		}
 		vector.WithLabelValues(strconv.Itoa(res.Code)).Inc()
-		ctx.JSON(http.StatusOK, res)
+		render(ctx, res)
 	}
 }
 
 func Wrap(fn func(*gin.Context) (Result, error)) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		res, err := fn(ctx)
+		res = timeoutResult(res, err)
 		if err != nil {
 			log.Error("执行业务逻辑失败",
 				logger.Error(err))
 		}
 		vector.WithLabelValues(strconv.Itoa(res.Code)).Inc()
-		ctx.JSON(http.StatusOK, res)
+		render(ctx, res)
 	}
 }
 
@@ -107,11 +112,41 @@ func WrapClaims(fn func(*gin.Context, ijwt.UserClaims) (Result, error)) gin.Hand
 			return
 		}
 		res, err := fn(ctx, claims)
+		res = timeoutResult(res, err)
 		if err != nil {
 			log.Error("执行业务逻辑失败",
 				logger.Error(err))
 		}
 		vector.WithLabelValues(strconv.Itoa(res.Code)).Inc()
-		ctx.JSON(http.StatusOK, res)
+		render(ctx, res)
 	}
 }
+
+// timeoutResult handler 一般把下游错误都当作系统异常，这里统一把超时换成单独的错误码
+func timeoutResult(res Result, err error) Result {
+	if res.Code == 0 || !grpcx.IsDeadlineExceeded(err) {
+		return res
+	}
+	return Result{
+		Code: errs.Timeout,
+		Msg:  "请求超时，请稍后重试",
+	}
+}
+
+// 放在 gin.Context 里的业务错误码，给 Wrap 之外的中间件用
+const resultCodeKey = "ginx_result_code"
+
+func render(ctx *gin.Context, res Result) {
+	ctx.Set(resultCodeKey, res.Code)
+	ctx.JSON(http.StatusOK, res)
+}
+
+// ResultCode 拿到 Wrap 系列方法返回的业务错误码，没有经过 Wrap 的请求 ok 为 false
+func ResultCode(ctx *gin.Context) (int, bool) {
+	val, ok := ctx.Get(resultCodeKey)
+	if !ok {
+		return 0, false
+	}
+	code, ok := val.(int)
+	return code, ok
+}
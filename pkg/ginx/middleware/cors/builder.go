@@ -0,0 +1,70 @@
+package cors
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"path"
+	"strings"
+	"time"
+)
+
+// Config 跨域策略
+type Config struct {
+	// 允许的 Origin，支持通配符：* 匹配除了 / 以外的任意字符，
+	// 比如 https://*.bigdust.space 匹配所有子域名（不包括 bigdust.space 本身），
+	// http://localhost:* 匹配本地的任意端口。单独一个 * 是允许所有来源
+	AllowOrigins     []string      `yaml:"allowOrigins"`
+	AllowMethods     []string      `yaml:"allowMethods"`
+	AllowHeaders     []string      `yaml:"allowHeaders"`
+	ExposeHeaders    []string      `yaml:"exposeHeaders"`
+	AllowCredentials bool          `yaml:"allowCredentials"`
+	MaxAge           time.Duration `yaml:"maxAge"`
+}
+
+// Builder 包了一层 gin-contrib/cors，策略变化的时候重新构造一个，不用重启
+type Builder struct {
+	hdl *dynconf.Value[gin.HandlerFunc]
+}
+
+func NewBuilder(cfg *dynconf.Value[Config]) *Builder {
+	return &Builder{
+		hdl: dynconf.Map(cfg, newHandler),
+	}
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		b.hdl.Load()(ctx)
+	}
+}
+
+func newHandler(cfg Config) gin.HandlerFunc {
+	// 不用 cors.Config 自带的 AllowOrigins，它不支持子域名通配，并且一个写错了会直接 panic
+	patterns := cfg.AllowOrigins
+	return cors.New(cors.Config{
+		AllowMethods:     cfg.AllowMethods,
+		AllowHeaders:     cfg.AllowHeaders,
+		ExposeHeaders:    cfg.ExposeHeaders,
+		AllowCredentials: cfg.AllowCredentials,
+		AllowOriginFunc: func(origin string) bool {
+			return Match(patterns, origin)
+		},
+		MaxAge: cfg.MaxAge,
+	})
+}
+
+// Match origin 是否命中任意一个 pattern，Origin 头形如 http://localhost:3000，大小写不敏感
+func Match(patterns []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		ok, err := path.Match(strings.ToLower(pattern), origin)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package cors
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	patterns := []string{"http://localhost:*", "https://*.bigdust.space", "https://bigdust.space"}
+	testCases := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "http://localhost:3000", want: true},
+		{origin: "HTTP://LOCALHOST:3000", want: true},
+		{origin: "https://bigdust.space", want: true},
+		{origin: "https://kstack.bigdust.space", want: true},
+		// * 不匹配 /，也就匹配不到多级子域名以外的东西
+		{origin: "https://evil.com/.bigdust.space", want: false},
+		{origin: "https://bigdust.space.evil.com", want: false},
+		{origin: "http://bigdust.space", want: false},
+		{origin: "http://127.0.0.1:3000", want: false},
+	}
+	for _, tc := range testCases {
+		if got := Match(patterns, tc.origin); got != tc.want {
+			t.Fatalf("Match(%s) = %v，期望 %v", tc.origin, got, tc.want)
+		}
+	}
+	if !Match([]string{"*"}, "https://any.example.com") {
+		t.Fatal("单独一个 * 应该允许所有来源")
+	}
+}
+
+// TestBuilderConfig 配置文件里的写法能解析出来，策略改了不用重启
+func TestBuilderConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(origin string) {
+		content := "cors:\n  allowOrigins: [\"" + origin + "\"]\n  allowMethods: [GET, POST]\n" +
+			"  exposeHeaders: [x-jwt-token]\n  allowCredentials: true\n  maxAge: 12h\n"
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("https://*.bigdust.space")
+	dc, err := dynconf.NewManager(logger.NewNopLogger(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := dynconf.Bind[Config](dc, "cors")
+	if got := cfg.Load(); got.MaxAge != 12*time.Hour || !got.AllowCredentials || len(got.ExposeHeaders) != 1 {
+		t.Fatalf("解析出来的配置 = %+v", got)
+	}
+	engine := gin.New()
+	engine.Use(NewBuilder(cfg).Build())
+	engine.GET("/ping", func(ctx *gin.Context) {})
+	preflight := func(origin string) int {
+		req := httptest.NewRequest(http.MethodOptions, "/ping", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		rec := httptest.NewRecorder()
+		engine.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := preflight("https://kstack.bigdust.space"); code != http.StatusNoContent {
+		t.Fatalf("允许的来源预检返回 %d", code)
+	}
+	write("https://kstack.muxi.space")
+	dc.Reload()
+	if code := preflight("https://kstack.bigdust.space"); code != http.StatusForbidden {
+		t.Fatalf("策略改了之后原来的来源预检返回 %d", code)
+	}
+}
@@ -0,0 +1,182 @@
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Route struct {
+	// 大于 0 时允许浏览器缓存这么久，否则每次都要带着 If-None-Match 来问
+	MaxAge time.Duration
+	// 游客的请求可以用 redis 里的共享缓存，还要 Builder.Guest 认为这个路由允许游客访问
+	Shared bool
+}
+
+// Builder 公开的读接口的缓存，只处理显式配置了的 GET 路由：
+//  1. 按响应体算 ETag，请求带的 If-None-Match 对得上就返回 304，省掉下行流量；
+//  2. 按路由设置 Cache-Control；
+//  3. 游客的请求可以在 redis 里共享一份短时间的缓存，省掉下游调用。
+//
+// 只有 ginx.Wrap 系列返回成功（code 为 0）的响应才会被缓存
+type Builder struct {
+	cmd       redis.Cmdable
+	l         logger.Logger
+	sharedTTL time.Duration
+	// guest 路由是否允许游客访问。共享缓存在登录检查之前命中，不允许游客的路由不能用
+	guest func(pattern string) bool
+	// 路由的 pattern -> 缓存策略
+	routes map[string]Route
+}
+
+func NewBuilder(cmd redis.Cmdable, l logger.Logger) *Builder {
+	return &Builder{
+		cmd:    cmd,
+		l:      l,
+		routes: make(map[string]Route),
+	}
+}
+
+// SharedTTL 共享缓存的过期时间，不设置就不用共享缓存
+func (b *Builder) SharedTTL(ttl time.Duration) *Builder {
+	b.sharedTTL = ttl
+	return b
+}
+
+// Guest 判断路由是否允许游客访问，每个请求都会调用，游客名单可以动态修改。不设置就不用共享缓存
+func (b *Builder) Guest(allowed func(pattern string) bool) *Builder {
+	b.guest = allowed
+	return b
+}
+
+// Route pattern 是注册路由时的写法，例如 /courses/:courseId/simple_detail
+func (b *Builder) Route(pattern string, route Route) *Builder {
+	b.routes[pattern] = route
+	return b
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method != http.MethodGet {
+			return
+		}
+		route, ok := b.routes[ctx.FullPath()]
+		if !ok {
+			return
+		}
+		guest := ctx.GetHeader("Authorization") == ""
+		shared := route.Shared && guest && b.sharedTTL > 0 && b.guest != nil && b.guest(ctx.FullPath())
+		key := b.key(ctx)
+		if shared {
+			body, err := b.cmd.Get(ctx, key).Bytes()
+			if err == nil {
+				ctx.Header("X-Cache", "HIT")
+				b.write(ctx, route, guest, body)
+				ctx.Abort()
+				return
+			}
+			if !errors.Is(err, redis.Nil) {
+				// redis 出问题了就直接回源
+				b.l.Warn("读取共享响应缓存失败", logger.String("key", key), logger.Error(err))
+			}
+		}
+		w := &bufferWriter{ResponseWriter: ctx.Writer, status: http.StatusOK}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+		if code, ok := ginx.ResultCode(ctx); !ok || code != 0 || w.status != http.StatusOK {
+			// 失败的响应原样返回，不缓存
+			ctx.Writer.WriteHeader(w.status)
+			_, _ = ctx.Writer.Write(w.buf.Bytes())
+			return
+		}
+		body := w.buf.Bytes()
+		if shared {
+			ctx.Header("X-Cache", "MISS")
+			err := b.cmd.Set(ctx, key, body, b.sharedTTL).Err()
+			if err != nil {
+				b.l.Warn("写入共享响应缓存失败", logger.String("key", key), logger.Error(err))
+			}
+		}
+		b.write(ctx, route, guest, body)
+	}
+}
+
+func (b *Builder) key(ctx *gin.Context) string {
+	return "kstack:http_cache:" + ctx.Request.URL.RequestURI()
+}
+
+func (b *Builder) write(ctx *gin.Context, route Route, guest bool, body []byte) {
+	etag := ETag(body)
+	ctx.Header("ETag", etag)
+	// 登录和没登录的响应可能不一样，不能被 CDN 之类的混用
+	ctx.Header("Vary", "Authorization")
+	switch {
+	case route.MaxAge <= 0:
+		ctx.Header("Cache-Control", "no-cache")
+	case guest:
+		ctx.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(route.MaxAge.Seconds())))
+	default:
+		ctx.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(route.MaxAge.Seconds())))
+	}
+	if Match(ctx.GetHeader("If-None-Match"), etag) {
+		ctx.Status(http.StatusNotModified)
+		ctx.Writer.WriteHeaderNow()
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// ETag 强校验的 ETag，响应体一个字节都不差才算相同
+func ETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// Match If-None-Match 可能带多个 ETag，也可能是弱校验的 W/"xxx"，比较时不区分强弱
+func Match(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferWriter 先把响应攒起来，算完 ETag 再决定写什么
+type bufferWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *bufferWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferWriter) WriteHeaderNow() {}
+
+func (w *bufferWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *bufferWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
@@ -0,0 +1,129 @@
+package httpcache
+
+import (
+	"github.com/MuxiKeStack/bff/fakes"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	ginx.InitCounter(prometheus.CounterOpts{Namespace: "test", Name: "http"})
+	os.Exit(m.Run())
+}
+
+// testServer /public 允许游客访问，/private 不允许，/fail 返回业务错误，calls 记下每个路由回源的次数
+type testServer struct {
+	engine *gin.Engine
+	calls  map[string]int
+}
+
+func newTestServer() *testServer {
+	s := &testServer{engine: gin.New(), calls: make(map[string]int)}
+	b := NewBuilder(fakes.NewRedis(), logger.NewNopLogger()).
+		SharedTTL(time.Minute).
+		Guest(func(pattern string) bool { return pattern == "/public" || pattern == "/fail" }).
+		Route("/public", Route{MaxAge: time.Minute, Shared: true}).
+		Route("/private", Route{Shared: true}).
+		Route("/fail", Route{MaxAge: time.Minute, Shared: true})
+	s.engine.Use(b.Build())
+	for _, path := range []string{"/public", "/private", "/fail", "/plain"} {
+		s.engine.GET(path, ginx.Wrap(func(ctx *gin.Context) (ginx.Result, error) {
+			s.calls[ctx.FullPath()]++
+			if ctx.FullPath() == "/fail" {
+				return ginx.Result{Code: 500001, Msg: "系统异常"}, nil
+			}
+			return ginx.Result{Msg: "Success", Data: ctx.FullPath()}, nil
+		}))
+	}
+	return s
+}
+
+func (s *testServer) get(path string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, val := range header {
+		req.Header.Set(key, val)
+	}
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBuilderETag(t *testing.T) {
+	s := newTestServer()
+	res := s.get("/public", map[string]string{"Authorization": "Bearer x"})
+	etag := res.Header().Get("ETag")
+	if res.Code != http.StatusOK || etag != ETag(res.Body.Bytes()) {
+		t.Fatalf("第一次请求 = %d，ETag = %s", res.Code, etag)
+	}
+	if cc := res.Header().Get("Cache-Control"); cc != "private, max-age=60" {
+		t.Fatalf("登录用户的 Cache-Control = %s", cc)
+	}
+	testCases := []struct {
+		name        string
+		ifNoneMatch string
+		wantCode    int
+	}{
+		{name: "ETag 对得上", ifNoneMatch: etag, wantCode: http.StatusNotModified},
+		{name: "弱校验", ifNoneMatch: "W/" + etag, wantCode: http.StatusNotModified},
+		{name: "多个 ETag", ifNoneMatch: `"abc", ` + etag, wantCode: http.StatusNotModified},
+		{name: "星号", ifNoneMatch: "*", wantCode: http.StatusNotModified},
+		{name: "ETag 对不上", ifNoneMatch: `"abc"`, wantCode: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := s.get("/public", map[string]string{"Authorization": "Bearer x", "If-None-Match": tc.ifNoneMatch})
+			if res.Code != tc.wantCode {
+				t.Fatalf("状态码 = %d，期望 %d", res.Code, tc.wantCode)
+			}
+			if tc.wantCode == http.StatusNotModified && res.Body.Len() != 0 {
+				t.Fatalf("304 不应该带响应体，实际是 %s", res.Body)
+			}
+		})
+	}
+}
+
+func TestBuilderShared(t *testing.T) {
+	testCases := []struct {
+		name   string
+		path   string
+		header map[string]string
+		// 请求两次之后回源的次数
+		wantCalls int
+		// 第二次请求的 X-Cache
+		wantCache        string
+		wantCacheControl string
+	}{
+		{name: "游客命中共享缓存", path: "/public", wantCalls: 1, wantCache: "HIT", wantCacheControl: "public, max-age=60"},
+		{name: "登录用户不用共享缓存", path: "/public", header: map[string]string{"Authorization": "Bearer x"}, wantCalls: 2, wantCacheControl: "private, max-age=60"},
+		{name: "不在游客名单里的路由不用共享缓存", path: "/private", wantCalls: 2, wantCacheControl: "no-cache"},
+		{name: "失败的响应不缓存", path: "/fail", wantCalls: 2},
+		{name: "没配置的路由不处理", path: "/plain", wantCalls: 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer()
+			s.get(tc.path, tc.header)
+			res := s.get(tc.path, tc.header)
+			if res.Code != http.StatusOK {
+				t.Fatalf("状态码 = %d", res.Code)
+			}
+			if s.calls[tc.path] != tc.wantCalls {
+				t.Fatalf("回源 %d 次，期望 %d 次", s.calls[tc.path], tc.wantCalls)
+			}
+			if got := res.Header().Get("X-Cache"); got != tc.wantCache {
+				t.Fatalf("X-Cache = %q，期望 %q", got, tc.wantCache)
+			}
+			if got := res.Header().Get("Cache-Control"); got != tc.wantCacheControl {
+				t.Fatalf("Cache-Control = %q，期望 %q", got, tc.wantCacheControl)
+			}
+		})
+	}
+}
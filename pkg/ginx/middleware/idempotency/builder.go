@@ -0,0 +1,139 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const Header = "Idempotency-Key"
+
+// 占位的值，表示第一个请求还在处理中。真正的结果是 json，不会和它冲突
+const pending = "pending"
+
+// Builder 写接口的幂等。客户端在请求头里带上 Idempotency-Key，重试时带同一个：
+//  1. 第一个请求正常处理，结果按 (uid, key, 请求路径) 在 redis 里存 ttl 这么久；
+//  2. 之后的重试直接返回存下来的结果，不会重复发评价、评论、回答；
+//  3. 第一个请求还没处理完的时候来的重复请求，返回 errs.RequestInProgress。
+//
+// 系统错误（50 开头的错误码）不存，让客户端可以重试。
+// 要拿到 uid，所以要放在登录中间件后面；没带请求头的、游客的、GET 请求都不处理
+type Builder struct {
+	cmd redis.Cmdable
+	l   logger.Logger
+	ttl time.Duration
+	// 占位的过期时间，防止处理到一半进程挂了，这个 key 永远用不了
+	inflightTTL time.Duration
+}
+
+func NewBuilder(cmd redis.Cmdable, l logger.Logger, ttl, inflightTTL time.Duration) *Builder {
+	return &Builder{cmd: cmd, l: l, ttl: ttl, inflightTTL: inflightTTL}
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		idemKey := ctx.GetHeader(Header)
+		if idemKey == "" || ctx.Request.Method == http.MethodGet {
+			return
+		}
+		uc, _ := ctx.MustGet("user").(ijwt.UserClaims)
+		if uc.Uid == 0 {
+			return
+		}
+		key := b.key(uc.Uid, ctx.Request.Method, ctx.Request.URL.Path, idemKey)
+		ok, err := b.cmd.SetNX(ctx, key, pending, b.inflightTTL).Result()
+		if err != nil {
+			// redis 出问题了就当没有幂等，总比写接口全都不可用好
+			b.l.Warn("幂等检查失败", logger.String("key", key), logger.Error(err))
+			return
+		}
+		if !ok && b.replay(ctx, key) {
+			return
+		}
+		if !ok {
+			// 占位刚好过期了，或者第一个请求失败了删掉了，重新占一次位，占到了就当成第一个请求处理
+			ok, err = b.cmd.SetNX(ctx, key, pending, b.inflightTTL).Result()
+			if err != nil {
+				b.l.Warn("幂等检查失败", logger.String("key", key), logger.Error(err))
+				return
+			}
+			if !ok {
+				b.inProgress(ctx)
+				return
+			}
+		}
+		w := &teeWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = w
+		ctx.Next()
+		ctx.Writer = w.ResponseWriter
+		// 客户端断开、请求超时了也要把结果存下来或者把占位删掉，不然重试只能一直等占位过期
+		saveCtx := context.WithoutCancel(ctx.Request.Context())
+		code, ok := ginx.ResultCode(ctx)
+		if !ok || code/1000 == 500 || ctx.Writer.Status() != http.StatusOK {
+			err = b.cmd.Del(saveCtx, key).Err()
+		} else {
+			err = b.cmd.Set(saveCtx, key, w.buf.Bytes(), b.ttl).Err()
+		}
+		if err != nil {
+			b.l.Warn("保存幂等结果失败", logger.String("key", key), logger.Error(err))
+		}
+	}
+}
+
+// replay 返回存下来的结果，key 已经没了的时候什么都不做，返回 false
+func (b *Builder) replay(ctx *gin.Context, key string) bool {
+	res, err := b.cmd.Get(ctx, key).Bytes()
+	switch {
+	case errors.Is(err, redis.Nil):
+		return false
+	case err == nil && string(res) == pending:
+		b.inProgress(ctx)
+	case err != nil:
+		b.l.Warn("读取幂等结果失败", logger.String("key", key), logger.Error(err))
+		ctx.AbortWithStatusJSON(http.StatusOK, ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		})
+	default:
+		ctx.Header("Idempotent-Replayed", "true")
+		ctx.Data(http.StatusOK, "application/json; charset=utf-8", res)
+		ctx.Abort()
+	}
+	return true
+}
+
+func (b *Builder) inProgress(ctx *gin.Context) {
+	ctx.AbortWithStatusJSON(http.StatusOK, ginx.Result{
+		Code: errs.RequestInProgress,
+		Msg:  "请求正在处理中，请勿重复提交",
+	})
+}
+
+func (b *Builder) key(uid int64, method, path, idemKey string) string {
+	return "kstack:idempotency:" + strconv.FormatInt(uid, 10) + ":" + method + " " + path + ":" + idemKey
+}
+
+// teeWriter 照常写响应，同时留一份，用来存下来
+type teeWriter struct {
+	gin.ResponseWriter
+	buf bytes.Buffer
+}
+
+func (w *teeWriter) Write(data []byte) (int, error) {
+	w.buf.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *teeWriter) WriteString(s string) (int, error) {
+	w.buf.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
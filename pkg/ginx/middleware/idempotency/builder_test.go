@@ -0,0 +1,144 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/fakes"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	ginx.InitCounter(prometheus.CounterOpts{Namespace: "test", Name: "http"})
+	os.Exit(m.Run())
+}
+
+// testServer /write 按 query 里的 code 返回业务错误码，calls 记下处理了几次
+type testServer struct {
+	engine *gin.Engine
+	redis  *fakes.Redis
+	calls  int
+}
+
+func newTestServer() *testServer {
+	s := &testServer{engine: gin.New(), redis: fakes.NewRedis()}
+	s.engine.Use(func(ctx *gin.Context) {
+		// 代替登录中间件
+		uid, _ := strconv.ParseInt(ctx.GetHeader("X-Uid"), 10, 64)
+		ctx.Set("user", ijwt.UserClaims{Uid: uid})
+	})
+	s.engine.Use(NewBuilder(s.redis, logger.NewNopLogger(), time.Hour, time.Minute).Build())
+	handler := ginx.Wrap(func(ctx *gin.Context) (ginx.Result, error) {
+		s.calls++
+		code, _ := strconv.Atoi(ctx.Query("code"))
+		return ginx.Result{Code: code, Msg: "Success", Data: s.calls}, nil
+	})
+	s.engine.POST("/write", handler)
+	s.engine.GET("/write", handler)
+	return s
+}
+
+func (s *testServer) do(method, path string, uid int64, idemKey string) (*httptest.ResponseRecorder, ginx.Result) {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-Uid", strconv.FormatInt(uid, 10))
+	if idemKey != "" {
+		req.Header.Set(Header, idemKey)
+	}
+	rec := httptest.NewRecorder()
+	s.engine.ServeHTTP(rec, req)
+	var res ginx.Result
+	_ = json.Unmarshal(rec.Body.Bytes(), &res)
+	return rec, res
+}
+
+func TestBuilder(t *testing.T) {
+	testCases := []struct {
+		name string
+		// 第一次和重试的请求
+		method, path  string
+		uid, retryUid int64
+		idemKey       string
+		// 重试前 redis 里的这个 key 被改成了什么，空的不改
+		before    string
+		wantCalls int
+		wantCode  int
+		replayed  bool
+	}{
+		{
+			name:   "重试返回第一次的结果",
+			method: http.MethodPost, path: "/write", uid: 1, retryUid: 1, idemKey: "k",
+			wantCalls: 1, replayed: true,
+		},
+		{
+			name:   "业务错误也返回第一次的结果",
+			method: http.MethodPost, path: "/write?code=412001", uid: 1, retryUid: 1, idemKey: "k",
+			wantCalls: 1, wantCode: 412001, replayed: true,
+		},
+		{
+			name:   "系统错误不存，重试重新处理",
+			method: http.MethodPost, path: "/write?code=500001", uid: 1, retryUid: 1, idemKey: "k",
+			wantCalls: 2, wantCode: 500001,
+		},
+		{
+			name:   "第一次还在处理中",
+			method: http.MethodPost, path: "/write", uid: 1, retryUid: 1, idemKey: "k", before: pending,
+			wantCalls: 1, wantCode: errs.RequestInProgress,
+		},
+		{
+			name:   "没带请求头不处理",
+			method: http.MethodPost, path: "/write", uid: 1, retryUid: 1,
+			wantCalls: 2,
+		},
+		{
+			name:   "GET 不处理",
+			method: http.MethodGet, path: "/write", uid: 1, retryUid: 1, idemKey: "k",
+			wantCalls: 2,
+		},
+		{
+			name:   "游客不处理",
+			method: http.MethodPost, path: "/write", idemKey: "k",
+			wantCalls: 2,
+		},
+		{
+			name:   "不同用户的 key 互不影响",
+			method: http.MethodPost, path: "/write", uid: 1, retryUid: 2, idemKey: "k",
+			wantCalls: 2,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer()
+			s.do(tc.method, tc.path, tc.uid, tc.idemKey)
+			if tc.before != "" {
+				key := "kstack:idempotency:1:POST /write:" + tc.idemKey
+				if err := s.redis.Set(context.Background(), key, tc.before, time.Minute).Err(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			rec, res := s.do(tc.method, tc.path, tc.retryUid, tc.idemKey)
+			if s.calls != tc.wantCalls {
+				t.Fatalf("处理了 %d 次，期望 %d 次", s.calls, tc.wantCalls)
+			}
+			if res.Code != tc.wantCode {
+				t.Fatalf("错误码 = %d，期望 %d", res.Code, tc.wantCode)
+			}
+			if replayed := rec.Header().Get("Idempotent-Replayed") == "true"; replayed != tc.replayed {
+				t.Fatalf("replayed = %v，期望 %v", replayed, tc.replayed)
+			}
+			if tc.replayed && res.Data != float64(1) {
+				t.Fatalf("重放的结果 = %v，期望第一次的结果 1", res.Data)
+			}
+		})
+	}
+}
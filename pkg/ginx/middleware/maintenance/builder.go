@@ -0,0 +1,139 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ModeNormal 正常服务
+	ModeNormal = ""
+	// ModeReadOnly 只读，写接口（除了 GET 以外的）一律拒绝，读接口照常
+	ModeReadOnly = "readonly"
+	// ModeFull 全站维护，所有接口都只返回维护公告
+	ModeFull = "full"
+)
+
+type Route struct {
+	Method  string `yaml:"method"`
+	Pattern string `yaml:"pattern"`
+}
+
+// Config 配置在 maintenance 下面，可以动态修改，也可以通过管理接口覆盖 mode 和 notice
+type Config struct {
+	Mode string `yaml:"mode"`
+	// 给用户看的维护公告，比如预计什么时候恢复
+	Notice string `yaml:"notice"`
+	// 维护期间也放行的接口，比如登录、退出登录
+	AllowRoutes []Route `yaml:"allowRoutes"`
+}
+
+// Notice 维护期间被拒绝的请求返回的 data
+type Notice struct {
+	Mode   string `json:"mode"`
+	Notice string `json:"notice"`
+}
+
+// Builder 维护模式。后端迁移的时候切到只读，读接口不受影响；
+// /admin 下的接口永远放行，不然切进全站维护以后就切不回来了。
+// 被拦下的请求照常返回 Result，App 按错误码弹公告；全站维护时浏览器直接打开的页面（Accept 里有 text/html）
+// 返回 503 和一个只有公告的静态页面，不然用户只能看到一段 json
+type Builder struct {
+	dc  *dynconf.Manager
+	cfg *dynconf.Value[Config]
+}
+
+func NewBuilder(dc *dynconf.Manager) *Builder {
+	return &Builder{
+		dc:  dc,
+		cfg: dynconf.Bind[Config](dc, "maintenance"),
+	}
+}
+
+func ValidMode(mode string) bool {
+	return mode == ModeNormal || mode == ModeReadOnly || mode == ModeFull
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		cfg := b.cfg.Load()
+		if cfg.Mode == ModeNormal || !b.reject(ctx, cfg) {
+			return
+		}
+		if cfg.Mode != ModeReadOnly && strings.Contains(ctx.GetHeader("Accept"), "text/html") {
+			ctx.Header("Content-Type", "text/html; charset=utf-8")
+			ctx.Status(http.StatusServiceUnavailable)
+			_ = noticePage.Execute(ctx.Writer, cfg)
+			ctx.Abort()
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusOK, ginx.Result{
+			Code: errs.Maintenance,
+			Msg:  "系统维护中",
+			Data: Notice{Mode: cfg.Mode, Notice: cfg.Notice},
+		})
+	}
+}
+
+// noticePage 全站维护的静态页面，公告会被转义
+var noticePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>系统维护中</title>
+</head>
+<body>
+<h1>系统维护中</h1>
+{{if .Notice}}<p>{{.Notice}}</p>{{end}}
+</body>
+</html>
+`))
+
+func (b *Builder) reject(ctx *gin.Context, cfg Config) bool {
+	method, pattern := ctx.Request.Method, ctx.FullPath()
+	if pattern == "/admin" || strings.HasPrefix(pattern, "/admin/") {
+		return false
+	}
+	for _, r := range cfg.AllowRoutes {
+		if strings.EqualFold(r.Method, method) && r.Pattern == pattern {
+			return false
+		}
+	}
+	switch cfg.Mode {
+	case ModeReadOnly:
+		return method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+	default:
+		// 不认识的模式按全站维护处理，宁可多拦
+		return true
+	}
+}
+
+// Load 当前的维护配置
+func (b *Builder) Load() Config {
+	return b.cfg.Load()
+}
+
+// Save 覆盖配置文件里的 mode 和 notice，配置了 etcd 时所有实例都会生效
+func (b *Builder) Save(ctx context.Context, mode, notice string) error {
+	// json 也是合法的 yaml
+	doc, err := json.Marshal(map[string]any{
+		"maintenance": map[string]string{"mode": mode, "notice": notice},
+	})
+	if err != nil {
+		return err
+	}
+	return b.dc.Put(ctx, "maintenance", doc)
+}
+
+// Reset 删除 Save 的覆盖，恢复成配置文件里的维护配置
+func (b *Builder) Reset(ctx context.Context) error {
+	return b.dc.Delete(ctx, "maintenance")
+}
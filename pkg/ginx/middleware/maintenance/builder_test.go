@@ -0,0 +1,126 @@
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `maintenance:
+  mode: ""
+  notice: ""
+  allowRoutes:
+    - method: POST
+      pattern: /users/login_ccnu
+`
+
+func newTestEngine(t *testing.T) (*gin.Engine, *Builder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dc, err := dynconf.NewManager(logger.NewNopLogger(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder(dc)
+	engine := gin.New()
+	engine.Use(b.Build())
+	ok := func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, ginx.Result{Msg: "Success"})
+	}
+	engine.GET("/courses/:courseId/detail", ok)
+	engine.POST("/evaluations/save", ok)
+	engine.POST("/users/login_ccnu", ok)
+	engine.POST("/admin/maintenance/reset", ok)
+	return engine, b
+}
+
+func TestBuilder(t *testing.T) {
+	testCases := []struct {
+		name   string
+		mode   string
+		method string
+		path   string
+		accept string
+		// 被拦下时的状态码，0 表示放行
+		wantStatus int
+		wantHTML   bool
+	}{
+		{name: "正常服务", mode: ModeNormal, method: http.MethodPost, path: "/evaluations/save"},
+		{name: "只读放行读接口", mode: ModeReadOnly, method: http.MethodGet, path: "/courses/1/detail"},
+		{name: "只读拦写接口", mode: ModeReadOnly, method: http.MethodPost, path: "/evaluations/save", wantStatus: http.StatusOK},
+		{name: "只读时浏览器也拿到 json", mode: ModeReadOnly, method: http.MethodPost, path: "/evaluations/save",
+			accept: "text/html", wantStatus: http.StatusOK},
+		{name: "全站维护拦读接口", mode: ModeFull, method: http.MethodGet, path: "/courses/1/detail", wantStatus: http.StatusOK},
+		{name: "全站维护时浏览器拿到静态页面", mode: ModeFull, method: http.MethodGet, path: "/courses/1/detail",
+			accept: "text/html,application/xhtml+xml", wantStatus: http.StatusServiceUnavailable, wantHTML: true},
+		{name: "配置的接口放行", mode: ModeFull, method: http.MethodPost, path: "/users/login_ccnu"},
+		{name: "admin 永远放行", mode: ModeFull, method: http.MethodPost, path: "/admin/maintenance/reset"},
+		{name: "不认识的模式按全站维护", mode: "unknown", method: http.MethodGet, path: "/courses/1/detail", wantStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			engine, b := newTestEngine(t)
+			if err := b.Save(context.Background(), tc.mode, "预计 <b>22:00</b> 恢复"); err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+			if tc.wantHTML {
+				body := rec.Body.String()
+				if rec.Code != tc.wantStatus || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+					t.Fatalf("状态码 %d，Content-Type %s", rec.Code, rec.Header().Get("Content-Type"))
+				}
+				if !strings.Contains(body, "预计 &lt;b&gt;22:00&lt;/b&gt; 恢复") {
+					t.Fatalf("页面里应该有转义过的公告：%s", body)
+				}
+				return
+			}
+			var res ginx.Result
+			if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("状态码 %d", rec.Code)
+			}
+			rejected := res.Code == errs.Maintenance
+			if rejected != (tc.wantStatus != 0) {
+				t.Fatalf("拦下 = %v，期望 %v", rejected, tc.wantStatus != 0)
+			}
+		})
+	}
+}
+
+func TestBuilderReset(t *testing.T) {
+	_, b := newTestEngine(t)
+	if err := b.Save(context.Background(), ModeFull, "维护中"); err != nil {
+		t.Fatal(err)
+	}
+	cfg := b.Load()
+	if cfg.Mode != ModeFull || cfg.Notice != "维护中" || len(cfg.AllowRoutes) != 1 {
+		t.Fatalf("覆盖之后 = %+v，allowRoutes 应该保留配置文件里的", cfg)
+	}
+	if err := b.Reset(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cfg = b.Load(); cfg.Mode != ModeNormal {
+		t.Fatalf("重置之后 mode = %q", cfg.Mode)
+	}
+}
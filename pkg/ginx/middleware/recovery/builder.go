@@ -0,0 +1,65 @@
+package recovery
+
+import (
+	"fmt"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"runtime/debug"
+)
+
+// Builder 替换 gin 自带的 Recovery：gin 的只会返回一个空的 500，
+// 这里记录带请求上下文的堆栈、打点，并且和正常的业务错误一样返回 ginx.Result
+type Builder struct {
+	l      logger.Logger
+	vector *prometheus.CounterVec
+}
+
+func NewBuilder(l logger.Logger, opt prometheus.CounterOpts) *Builder {
+	vector := prometheus.NewCounterVec(opt, []string{"method", "pattern"})
+	prometheus.MustRegister(vector)
+	return &Builder{l: l, vector: vector}
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// 和 http.Server 一样，ErrAbortHandler 是故意中断连接的，原样抛出去
+			if r == http.ErrAbortHandler {
+				panic(r)
+			}
+			b.vector.WithLabelValues(ctx.Request.Method, ctx.FullPath()).Inc()
+			fields := []logger.Field{
+				logger.String("method", ctx.Request.Method),
+				logger.String("path", ctx.Request.URL.Path),
+				logger.String("pattern", ctx.FullPath()),
+				logger.String("panic", fmt.Sprint(r)),
+				logger.String("stack", string(debug.Stack())),
+			}
+			if uc, ok := ctx.Get("user"); ok {
+				if claims, ok := uc.(ijwt.UserClaims); ok {
+					fields = append(fields, logger.Int64("uid", claims.Uid))
+				}
+			}
+			b.l.Error("处理请求时 panic", fields...)
+			// 已经开始写响应了就没法再改，只能中断
+			if ctx.Writer.Written() {
+				ctx.Abort()
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusOK, ginx.Result{
+				Code: errs.InternalServerError,
+				Msg:  "系统异常",
+			})
+		}()
+		ctx.Next()
+	}
+}
@@ -0,0 +1,47 @@
+package timeout
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// Builder 给每个请求设置截止时间，默认用 defaultTimeout，个别慢接口（比如要去教务系统的）可以单独配置。
+// 截止时间设置在 Request.Context 上，需要 gin.Engine 打开 ContextWithFallback，
+// 这样 handler 把 *gin.Context 直接传给下游时截止时间才会跟着传下去
+type Builder struct {
+	defaultTimeout time.Duration
+	// method + " " + 路由的 pattern -> 超时时间
+	routes map[string]time.Duration
+}
+
+func NewBuilder(defaultTimeout time.Duration) *Builder {
+	return &Builder{
+		defaultTimeout: defaultTimeout,
+		routes:         make(map[string]time.Duration),
+	}
+}
+
+// Route pattern 是注册路由时的写法，例如 /courses/:courseId/detail
+func (b *Builder) Route(method, pattern string, timeout time.Duration) *Builder {
+	b.routes[method+" "+pattern] = timeout
+	return b
+}
+
+func (b *Builder) Build() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		timeout, ok := b.routes[ctx.Request.Method+" "+ctx.FullPath()]
+		if !ok {
+			timeout = b.defaultTimeout
+		}
+		if timeout <= 0 {
+			ctx.Next()
+			return
+		}
+		// 上游已经给了更短的截止时间的话，WithTimeout 会保留更短的那个
+		newCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(newCtx)
+		ctx.Next()
+	}
+}
@@ -0,0 +1,116 @@
+package ginx
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// inRoute 在 path 这个路由里执行 fn，游标是和路由绑定的
+func inRoute(path string, fn func(ctx *gin.Context)) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET(path, fn)
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func TestPagerSize(t *testing.T) {
+	p := NewPager([]byte("key"), 20, 50)
+	testCases := []struct {
+		limit int64
+		want  int64
+	}{
+		{limit: 0, want: 20},
+		{limit: -1, want: 20},
+		{limit: 10, want: 10},
+		{limit: 50, want: 50},
+		{limit: 51, want: 50},
+	}
+	for _, tc := range testCases {
+		if got := p.Size(tc.limit); got != tc.want {
+			t.Fatalf("Size(%d) = %d，期望 %d", tc.limit, got, tc.want)
+		}
+	}
+	if got := NewPager([]byte("key"), 100, 50).Size(0); got != 50 {
+		t.Fatalf("默认值超过上限时应该截断到上限，拿到 %d", got)
+	}
+}
+
+func TestPagerCursor(t *testing.T) {
+	p := NewPager([]byte("key"), 20, 50)
+	var cursor string
+	inRoute("/a", func(ctx *gin.Context) {
+		cursor = p.EncodeFields(ctx, 1700000000000, 42)
+	})
+	tampered := []byte(cursor)
+	tampered[0] ^= 1
+	testCases := []struct {
+		name    string
+		path    string
+		pager   *Pager
+		cursor  string
+		n       int
+		want    []int64
+		wantErr error
+	}{
+		{name: "第一页", path: "/a", pager: p, n: 2},
+		{name: "原样解出来", path: "/a", pager: p, cursor: cursor, n: 2, want: []int64{1700000000000, 42}},
+		{name: "拿到别的路由用", path: "/b", pager: p, cursor: cursor, n: 2, wantErr: ErrInvalidCursor},
+		{name: "换了签名的 key", path: "/a", pager: NewPager([]byte("other"), 20, 50), cursor: cursor, n: 2, wantErr: ErrInvalidCursor},
+		{name: "改过", path: "/a", pager: p, cursor: string(tampered), n: 2, wantErr: ErrInvalidCursor},
+		{name: "字段数不对", path: "/a", pager: p, cursor: cursor, n: 1, wantErr: ErrInvalidCursor},
+		{name: "不是 base64", path: "/a", pager: p, cursor: "不是游标", n: 2, wantErr: ErrInvalidCursor},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inRoute(tc.path, func(ctx *gin.Context) {
+				fields, err := tc.pager.DecodeFields(ctx, PageReq{Cursor: tc.cursor}, tc.n)
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("err = %v，期望 %v", err, tc.wantErr)
+				}
+				if !slices.Equal(fields, tc.want) {
+					t.Fatalf("字段 = %v，期望 %v", fields, tc.want)
+				}
+			})
+		})
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	p := NewPager([]byte("key"), 2, 50)
+	testCases := []struct {
+		name      string
+		items     []int64
+		wantItems []int64
+		wantMore  bool
+	}{
+		{name: "空", items: nil, wantItems: []int64{}},
+		{name: "不满一页", items: []int64{9}, wantItems: []int64{9}},
+		{name: "正好一页", items: []int64{9, 8}, wantItems: []int64{9, 8}},
+		{name: "多查出来一条", items: []int64{9, 8, 7}, wantItems: []int64{9, 8}, wantMore: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			inRoute("/a", func(ctx *gin.Context) {
+				page := NewPage(ctx, p, PageReq{}, tc.items, func(id int64) int64 { return id })
+				if !slices.Equal(page.Items, tc.wantItems) || page.HasMore != tc.wantMore {
+					t.Fatalf("拿到 %v %v，期望 %v %v", page.Items, page.HasMore, tc.wantItems, tc.wantMore)
+				}
+				if !tc.wantMore {
+					if page.NextCursor != "" {
+						t.Fatalf("没有下一页不应该有游标")
+					}
+					return
+				}
+				// 下一页从这一页最后一条开始
+				pos, err := p.Decode(ctx, PageReq{Cursor: page.NextCursor})
+				if err != nil || pos != 8 {
+					t.Fatalf("下一页的位置 = %d, %v，期望 8", pos, err)
+				}
+			})
+		})
+	}
+}
@@ -18,4 +18,6 @@ type Result struct {
 	Code int    `json:"code"` // 错误码，非 0 表示失败
 	Msg  string `json:"msg"`  // 错误或成功 描述
 	Data any    `json:"data"`
+	// Degraded 聚合时降级了的字段，这些字段是默认值，不可信
+	Degraded []string `json:"degraded,omitempty"`
 }
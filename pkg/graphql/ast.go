@@ -0,0 +1,66 @@
+package graphql
+
+// Document 一次请求里的查询文本解析出来的结果
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+type Operation struct {
+	// Type 是 query 或者 mutation，简写的 { ... } 算 query
+	Type         string
+	Name         string
+	Variables    []*VariableDef
+	SelectionSet []Selection
+}
+
+type VariableDef struct {
+	Name    string
+	Default any
+}
+
+type Fragment struct {
+	Name          string
+	TypeCondition string
+	SelectionSet  []Selection
+}
+
+// Selection 是 *Field、*FragmentSpread 或者 *InlineFragment
+type Selection interface {
+	selection()
+}
+
+type Field struct {
+	Alias        string
+	Name         string
+	Arguments    map[string]any
+	SelectionSet []Selection
+}
+
+// Key 返回结果里使用的字段名，有别名时用别名
+func (f *Field) Key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+type FragmentSpread struct {
+	Name string
+}
+
+type InlineFragment struct {
+	TypeCondition string
+	SelectionSet  []Selection
+}
+
+func (*Field) selection()          {}
+func (*FragmentSpread) selection() {}
+func (*InlineFragment) selection() {}
+
+// Variable 参数里对变量的引用，执行时才替换成真正的值。
+// 其余的值直接用 Go 的类型表示：int64、float64、string、bool、nil、[]any、map[string]any，
+// 枚举值当作 string 处理
+type Variable struct {
+	Name string
+}
@@ -0,0 +1,21 @@
+// Package graphql 是只读网关用的 GraphQL 子集，不是完整的实现。
+//
+// 支持的语法：
+//   - query 操作，包括简写的 { ... }，有多个操作时按 operationName 选择
+//   - 字段、别名、参数，参数值可以是整数、浮点数、字符串、true/false/null、列表、对象和变量
+//   - 枚举值当作字符串传给解析器
+//   - 变量声明和默认值，变量的类型只做语法检查，不校验传入的值
+//   - 命名片段和内联片段，类型条件必须和所在的类型一致
+//   - __typename
+//
+// 直接报错的语法：
+//   - mutation 和 subscription，写操作走原来的 REST 接口
+//   - 指令（@include、@skip 等）
+//   - 块字符串（"""）
+//   - 内省（__schema、__type）
+//   - type、schema、extend 等类型系统定义
+//   - 引用了没有声明的变量，重复声明同一个变量
+//
+// 另外查询有长度、深度、复杂度和片段展开次数的限制，超出的查询不会执行。
+// 没有被引用的片段和没有被引用的变量不会报错。
+package graphql
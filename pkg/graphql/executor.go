@@ -0,0 +1,510 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"reflect"
+	"sync"
+)
+
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Response 字段解析失败不会让整个查询失败，对应的字段为 null，原因放在 Errors 里
+type Response struct {
+	Data   any      `json:"data"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+// 一次查询里最多展开多少次片段，同一个选择集里重复的片段只算一次
+const maxFragmentSpreads = 100
+
+// Executor 并发安全，整个进程共用一个
+type Executor struct {
+	schema        *Schema
+	maxDepth      int
+	maxComplexity int
+	// 列表字段没有 limit 参数时，按这个长度估算复杂度
+	defaultListSize int
+	// 查询文本的最大字节数，超过了不解析
+	maxQueryLength int
+	l              logger.Logger
+}
+
+func NewExecutor(schema *Schema, l logger.Logger) *Executor {
+	return &Executor{
+		schema:          schema,
+		maxDepth:        8,
+		maxComplexity:   1000,
+		defaultListSize: 20,
+		maxQueryLength:  8192,
+		l:               l,
+	}
+}
+
+func (e *Executor) MaxDepth(n int) *Executor {
+	if n > 0 {
+		e.maxDepth = n
+	}
+	return e
+}
+
+// MaxComplexity 复杂度是每个字段 Cost 的总和，列表字段的子字段按 limit 参数倍乘
+func (e *Executor) MaxComplexity(n int) *Executor {
+	if n > 0 {
+		e.maxComplexity = n
+	}
+	return e
+}
+
+func (e *Executor) DefaultListSize(n int) *Executor {
+	if n > 0 {
+		e.defaultListSize = n
+	}
+	return e
+}
+
+func (e *Executor) MaxQueryLength(n int) *Executor {
+	if n > 0 {
+		e.maxQueryLength = n
+	}
+	return e
+}
+
+// Execute 返回的 error 表示查询本身有问题（语法、字段不存在、超出限制），这时查询完全没有执行
+func (e *Executor) Execute(ctx context.Context, req Request) (*Response, error) {
+	if len(req.Query) > e.maxQueryLength {
+		return nil, fmt.Errorf("查询不能超过 %d 字节", e.maxQueryLength)
+	}
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return nil, err
+	}
+	if op.Type != "query" {
+		return nil, fmt.Errorf("只支持 query，写操作请使用原来的接口")
+	}
+	vars := make(map[string]any, len(op.Variables))
+	for _, def := range op.Variables {
+		if _, ok := vars[def.Name]; ok {
+			return nil, fmt.Errorf("变量 $%s 重复声明", def.Name)
+		}
+		vars[def.Name] = def.Default
+	}
+	// 没有声明的变量不接收，查询里引用了会在 analyze 时报错
+	for name, val := range req.Variables {
+		if _, ok := vars[name]; ok {
+			vars[name] = val
+		}
+	}
+	ex := &execution{Executor: e, doc: doc, vars: vars, reported: map[string]struct{}{}}
+	complexity, err := ex.analyze(e.schema.Query, op.SelectionSet, 1)
+	if err != nil {
+		return nil, err
+	}
+	if complexity > e.maxComplexity {
+		return nil, fmt.Errorf("查询复杂度超过 %d", e.maxComplexity)
+	}
+	data := ex.executeObject(ctx, e.schema.Query, []any{root{}}, op.SelectionSet, nil)
+	return &Response{Data: data[0], Errors: ex.errs}, nil
+}
+
+func selectOperation(doc *Document, name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) > 1 {
+			return nil, errors.New("有多个操作时必须指定 operationName")
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("找不到操作 %s", name)
+}
+
+// root 根对象的占位，nil 的父对象不会被解析
+type root struct{}
+
+type execution struct {
+	*Executor
+	doc  *Document
+	vars map[string]any
+
+	// analyze 时展开过的片段次数
+	spreads int
+
+	mu   sync.Mutex
+	errs []*Error
+	// 同一个路径只报一次错，列表里每个元素都失败时不至于刷屏
+	reported map[string]struct{}
+}
+
+// collect 把片段展开，并合并同名的字段，同时返回展开了多少次片段。
+// 同一个选择集里一个片段只展开一次，再展开也只是合并出同样的字段，
+// 否则互相引用两次的片段一层层下去会指数级膨胀
+func (ex *execution) collect(obj *Object, sels []Selection) ([]*Field, int, error) {
+	c := &collector{
+		index:    map[string]*Field{},
+		visiting: map[string]bool{},
+		expanded: map[string]bool{},
+	}
+	err := ex.collectInto(obj, sels, c)
+	return c.fields, len(c.expanded), err
+}
+
+type collector struct {
+	fields []*Field
+	index  map[string]*Field
+	// 正在展开的片段，用来发现循环引用
+	visiting map[string]bool
+	// 已经展开过的片段
+	expanded map[string]bool
+}
+
+func (ex *execution) collectInto(obj *Object, sels []Selection, c *collector) error {
+	for _, sel := range sels {
+		switch s := sel.(type) {
+		case *Field:
+			existing, ok := c.index[s.Key()]
+			if !ok {
+				f := *s
+				c.index[s.Key()] = &f
+				c.fields = append(c.fields, &f)
+				continue
+			}
+			if existing.Name != s.Name {
+				return fmt.Errorf("%s 同时指向了 %s 和 %s", s.Key(), existing.Name, s.Name)
+			}
+			existing.SelectionSet = append(existing.SelectionSet[:len(existing.SelectionSet):len(existing.SelectionSet)],
+				s.SelectionSet...)
+		case *InlineFragment:
+			if s.TypeCondition != "" && s.TypeCondition != obj.Name {
+				return fmt.Errorf("片段的类型 %s 和 %s 不匹配", s.TypeCondition, obj.Name)
+			}
+			if err := ex.collectInto(obj, s.SelectionSet, c); err != nil {
+				return err
+			}
+		case *FragmentSpread:
+			frag, ok := ex.doc.Fragments[s.Name]
+			if !ok {
+				return fmt.Errorf("片段 %s 没有定义", s.Name)
+			}
+			if c.visiting[s.Name] {
+				return fmt.Errorf("片段 %s 循环引用", s.Name)
+			}
+			if c.expanded[s.Name] {
+				continue
+			}
+			if frag.TypeCondition != obj.Name {
+				return fmt.Errorf("片段的类型 %s 和 %s 不匹配", frag.TypeCondition, obj.Name)
+			}
+			c.visiting[s.Name] = true
+			c.expanded[s.Name] = true
+			if err := ex.collectInto(obj, frag.SelectionSet, c); err != nil {
+				return err
+			}
+			delete(c.visiting, s.Name)
+		}
+	}
+	return nil
+}
+
+// analyze 在执行前校验字段并计算复杂度，超出深度时立刻返回
+func (ex *execution) analyze(obj *Object, sels []Selection, depth int) (int, error) {
+	if depth > ex.maxDepth {
+		return 0, fmt.Errorf("查询深度超过 %d", ex.maxDepth)
+	}
+	fields, spreads, err := ex.collect(obj, sels)
+	if err != nil {
+		return 0, err
+	}
+	ex.spreads += spreads
+	if ex.spreads > maxFragmentSpreads {
+		return 0, fmt.Errorf("展开的片段超过 %d 次", maxFragmentSpreads)
+	}
+	total := 0
+	for _, f := range fields {
+		if f.Name == "__typename" {
+			continue
+		}
+		def, ok := obj.Fields[f.Name]
+		if !ok {
+			return 0, fmt.Errorf("类型 %s 没有字段 %s", obj.Name, f.Name)
+		}
+		if err = ex.checkVariables(f.Arguments); err != nil {
+			return 0, err
+		}
+		cost := max(def.Cost, 1)
+		switch {
+		case def.Type == nil && len(f.SelectionSet) > 0:
+			return 0, fmt.Errorf("%s.%s 是标量，不能选择子字段", obj.Name, f.Name)
+		case def.Type != nil && len(f.SelectionSet) == 0:
+			return 0, fmt.Errorf("%s.%s 必须选择子字段", obj.Name, f.Name)
+		case def.Type != nil:
+			child, err := ex.analyze(def.Type, f.SelectionSet, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			if def.List {
+				size := ex.args(f).Int("limit", int64(ex.defaultListSize))
+				child *= int(min(max(size, 1), int64(ex.maxComplexity)))
+			}
+			cost += child
+		}
+		total += cost
+		if total > ex.maxComplexity {
+			return 0, fmt.Errorf("查询复杂度超过 %d", ex.maxComplexity)
+		}
+	}
+	return total, nil
+}
+
+// checkVariables 参数里引用的变量必须在操作上声明过
+func (ex *execution) checkVariables(val any) error {
+	switch v := val.(type) {
+	case Variable:
+		if _, ok := ex.vars[v.Name]; !ok {
+			return fmt.Errorf("变量 $%s 没有声明", v.Name)
+		}
+	case []any:
+		for i := range v {
+			if err := ex.checkVariables(v[i]); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for k := range v {
+			if err := ex.checkVariables(v[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ex *execution) args(f *Field) Args {
+	args := make(Args, len(f.Arguments))
+	for name, val := range f.Arguments {
+		args[name] = ex.value(val)
+	}
+	return args
+}
+
+func (ex *execution) value(val any) any {
+	switch v := val.(type) {
+	case Variable:
+		return ex.vars[v.Name]
+	case []any:
+		res := make([]any, len(v))
+		for i := range v {
+			res[i] = ex.value(v[i])
+		}
+		return res
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k := range v {
+			res[k] = ex.value(v[k])
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// executeObject 一次解析同一层的所有父对象，返回值和 sources 一一对应，nil 的父对象结果也是 nil
+func (ex *execution) executeObject(ctx context.Context, obj *Object, sources []any,
+	sels []Selection, path []string) []any {
+	// analyze 已经校验过了，这里不会出错
+	fields, _, _ := ex.collect(obj, sels)
+	live := make([]any, 0, len(sources))
+	for _, src := range sources {
+		if !isNil(src) {
+			live = append(live, src)
+		}
+	}
+	res := make([]any, len(sources))
+	if len(live) == 0 {
+		return res
+	}
+	columns := make([][]any, len(fields))
+	g := aggregate.NewGroup(ctx)
+	for i, f := range fields {
+		// 字段的错误都记在 errs 里，不会让其他字段失败
+		g.Required("graphql."+obj.Name+"."+f.Name, func(ctx context.Context) error {
+			columns[i] = ex.executeField(ctx, obj, f, live, append(path[:len(path):len(path)], f.Key()))
+			return nil
+		})
+	}
+	_, _ = g.Wait()
+	for k, f := range fields {
+		if columns[k] == nil {
+			// 解析器 panic 了，aggregate 已经记了日志
+			ex.report(append(path[:len(path):len(path)], f.Key()), errors.New("解析器 panic"))
+			columns[k] = make([]any, len(live))
+		}
+	}
+
+	j := 0
+	for i, src := range sources {
+		if isNil(src) {
+			continue
+		}
+		o := &object{keys: make([]string, len(fields)), values: make([]any, len(fields))}
+		for k, f := range fields {
+			o.keys[k] = f.Key()
+			o.values[k] = columns[k][j]
+		}
+		res[i] = o
+		j++
+	}
+	return res
+}
+
+func (ex *execution) executeField(ctx context.Context, obj *Object, f *Field, sources []any, path []string) []any {
+	values := make([]any, len(sources))
+	if f.Name == "__typename" {
+		for i := range values {
+			values[i] = obj.Name
+		}
+		return values
+	}
+	def := obj.Fields[f.Name]
+	args := ex.args(f)
+	if def.Batch != nil {
+		vals, err := def.Batch(ctx, sources, args)
+		if err == nil && len(vals) != len(sources) {
+			err = fmt.Errorf("%s.%s 批量解析的结果数量不对", obj.Name, f.Name)
+		}
+		if err != nil {
+			ex.report(path, err)
+			return values
+		}
+		values = vals
+	} else {
+		for i, src := range sources {
+			val, err := def.Resolve(ctx, src, args)
+			if err != nil {
+				ex.report(path, err)
+				continue
+			}
+			values[i] = val
+		}
+	}
+	if def.Type == nil {
+		return values
+	}
+
+	// 把这一层所有父对象的子对象摊平，交给下一层一起解析
+	var children []any
+	spans := make([][2]int, len(values))
+	for i, val := range values {
+		start := len(children)
+		if def.List {
+			// 解析器返回 nil 切片时是空列表，只有没有值时才是 null
+			if val == nil {
+				spans[i] = [2]int{start, -1}
+				continue
+			}
+			rv := reflect.ValueOf(val)
+			if rv.Kind() != reflect.Slice {
+				ex.report(path, fmt.Errorf("%s.%s 的结果不是列表", obj.Name, f.Name))
+				spans[i] = [2]int{start, -1}
+				continue
+			}
+			for k := 0; k < rv.Len(); k++ {
+				children = append(children, rv.Index(k).Interface())
+			}
+		} else {
+			children = append(children, val)
+		}
+		spans[i] = [2]int{start, len(children)}
+	}
+	results := ex.executeObject(ctx, def.Type, children, f.SelectionSet, path)
+	for i, span := range spans {
+		switch {
+		case span[1] < 0:
+			values[i] = nil
+		case def.List:
+			values[i] = results[span[0]:span[1]]
+		default:
+			values[i] = results[span[0]]
+		}
+	}
+	return values
+}
+
+func (ex *execution) report(path []string, err error) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	key := fmt.Sprint(path)
+	if _, ok := ex.reported[key]; ok {
+		return
+	}
+	ex.reported[key] = struct{}{}
+	msg := "系统异常"
+	if IsUserError(err) {
+		msg = err.Error()
+	} else {
+		ex.l.Error("解析 GraphQL 字段失败",
+			logger.String("path", key),
+			logger.Error(err))
+	}
+	ex.errs = append(ex.errs, &Error{Message: msg, Path: path})
+}
+
+func isNil(val any) bool {
+	if val == nil {
+		return true
+	}
+	rv := reflect.ValueOf(val)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
+
+// object 按查询里字段的顺序输出
+type object struct {
+	keys   []string
+	values []any
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
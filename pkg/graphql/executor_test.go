@@ -0,0 +1,222 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	Id   int64
+	Name string
+}
+
+// testSchema 用户的 friends 是 id 相邻的两个用户，id 为负数时解析失败
+func testSchema(batches *atomic.Int64) *Schema {
+	user := NewObject("User")
+	user.Fields["id"] = &FieldDef{Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+		return source.(*testUser).Id, nil
+	}}
+	user.Fields["name"] = &FieldDef{Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+		return source.(*testUser).Name, nil
+	}}
+	user.Fields["friends"] = &FieldDef{
+		Type: user,
+		List: true,
+		Cost: 2,
+		Batch: func(ctx context.Context, sources []any, args Args) ([]any, error) {
+			batches.Add(1)
+			res := make([]any, len(sources))
+			for i, src := range sources {
+				id := src.(*testUser).Id
+				res[i] = []*testUser{newTestUser(id + 1), newTestUser(id + 2)}[:args.Int("limit", 2)]
+			}
+			return res, nil
+		},
+	}
+	query := NewObject("Query")
+	query.Fields["user"] = &FieldDef{
+		Type: user,
+		Resolve: func(ctx context.Context, source any, args Args) (any, error) {
+			id := args.Int("id", 0)
+			switch {
+			case id < 0:
+				return nil, NewUserError("用户不存在")
+			case id == 0:
+				return nil, errors.New("下游出错了")
+			}
+			return newTestUser(id), nil
+		},
+	}
+	return &Schema{Query: query}
+}
+
+func newTestUser(id int64) *testUser {
+	return &testUser{Id: id, Name: fmt.Sprintf("u%d", id)}
+}
+
+func execute(t *testing.T, e *Executor, req Request) (string, []*Error, error) {
+	t.Helper()
+	res, err := e.Execute(context.Background(), req)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := json.Marshal(res.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), res.Errors, nil
+}
+
+func TestExecute(t *testing.T) {
+	var batches atomic.Int64
+	e := NewExecutor(testSchema(&batches), logger.NewNopLogger())
+	testCases := []struct {
+		name     string
+		req      Request
+		wantData string
+		wantErrs []string
+	}{
+		{
+			name:     "别名和字段顺序",
+			req:      Request{Query: `{ b: user(id: 2) { name id } a: user(id: 1) { id } }`},
+			wantData: `{"b":{"name":"u2","id":2},"a":{"id":1}}`,
+		},
+		{
+			name:     "变量和默认值",
+			req:      Request{Query: `query($id: Int = 3, $n: Int) { user(id: $id) { friends(limit: $n) { id } } }`, Variables: map[string]any{"n": float64(1)}},
+			wantData: `{"user":{"friends":[{"id":4}]}}`,
+		},
+		{
+			name:     "片段合并同名字段",
+			req:      Request{Query: `{ user(id: 1) { id ...F friends { name } } } fragment F on User { friends { id } }`},
+			wantData: `{"user":{"id":1,"friends":[{"id":2,"name":"u2"},{"id":3,"name":"u3"}]}}`,
+		},
+		{
+			name:     "内联片段和 __typename",
+			req:      Request{Query: `{ user(id: 1) { __typename ... on User { name } } }`},
+			wantData: `{"user":{"__typename":"User","name":"u1"}}`,
+		},
+		{
+			name: "字段失败只影响自己",
+			req:  Request{Query: `{ ok: user(id: 1) { id } missing: user(id: -1) { id } broken: user(id: 0) { id } }`},
+			// 不能展示给用户的错误只返回“系统异常”
+			wantData: `{"ok":{"id":1},"missing":null,"broken":null}`,
+			wantErrs: []string{"broken:系统异常", "missing:用户不存在"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, errs, err := execute(t, e, tc.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data != tc.wantData {
+				t.Fatalf("data = %s，期望 %s", data, tc.wantData)
+			}
+			var gotErrs []string
+			for _, e := range errs {
+				gotErrs = append(gotErrs, strings.Join(e.Path, ".")+":"+e.Message)
+			}
+			// 字段是并发解析的，错误的顺序不固定
+			slices.Sort(gotErrs)
+			if strings.Join(gotErrs, ",") != strings.Join(tc.wantErrs, ",") {
+				t.Fatalf("errors = %v，期望 %v", gotErrs, tc.wantErrs)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchesSameLevel(t *testing.T) {
+	var batches atomic.Int64
+	e := NewExecutor(testSchema(&batches), logger.NewNopLogger())
+	// 第二层有 2 个用户，第三层有 4 个，每一层只调用一次 Batch
+	_, _, err := execute(t, e, Request{Query: `{ user(id: 1) { friends { friends { id } } } }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := batches.Load(); n != 2 {
+		t.Fatalf("Batch 调用了 %d 次，期望 2", n)
+	}
+}
+
+func TestExecuteReject(t *testing.T) {
+	var batches atomic.Int64
+	e := NewExecutor(testSchema(&batches), logger.NewNopLogger()).MaxDepth(3).MaxComplexity(50).MaxQueryLength(4096)
+	// 30 个片段串成一条链，一个选择集里展开 30 次
+	var chain strings.Builder
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&chain, "fragment C%d on User { id ...C%d }\n", i, i+1)
+	}
+	chain.WriteString("fragment C30 on User { name }\n")
+	testCases := []struct {
+		name    string
+		req     Request
+		wantErr string
+	}{
+		{name: "写操作", req: Request{Query: `mutation { user(id: 1) { id } }`}, wantErr: "只支持 query"},
+		{name: "订阅", req: Request{Query: `subscription { user(id: 1) { id } }`}, wantErr: "只支持 query"},
+		{name: "查询太长", req: Request{Query: "{ user(id: 1) { id " + strings.Repeat(" ", 4096) + "} }"}, wantErr: "查询不能超过"},
+		{name: "语法错误", req: Request{Query: `{ user(id: 1) { id @skip(if: true) } }`}, wantErr: "不支持指令"},
+		{name: "变量没有声明", req: Request{Query: `{ user(id: $id) { id } }`, Variables: map[string]any{"id": float64(1)}}, wantErr: "变量 $id 没有声明"},
+		{name: "片段里的变量没有声明", req: Request{Query: `query($n: Int) { user(id: 1) { ...F } } fragment F on User { friends(limit: $m) { id } }`}, wantErr: "变量 $m 没有声明"},
+		{name: "变量重复声明", req: Request{Query: `query($id: Int, $id: Int) { user(id: $id) { id } }`}, wantErr: "重复声明"},
+		{name: "内省 __schema", req: Request{Query: `{ __schema { types { name } } }`}, wantErr: "没有字段 __schema"},
+		{name: "内省 __type", req: Request{Query: `{ __type(name: "User") { name } }`}, wantErr: "没有字段 __type"},
+		{name: "多个操作没有指定名字", req: Request{Query: `query A { user(id: 1) { id } } query B { user(id: 2) { id } }`}, wantErr: "operationName"},
+		{name: "找不到操作", req: Request{Query: `query A { user(id: 1) { id } }`, OperationName: "B"}, wantErr: "找不到操作"},
+		{name: "字段不存在", req: Request{Query: `{ user(id: 1) { age } }`}, wantErr: "没有字段 age"},
+		{name: "标量选择子字段", req: Request{Query: `{ user(id: 1) { id { x } } }`}, wantErr: "是标量"},
+		{name: "对象没有选择子字段", req: Request{Query: `{ user(id: 1) }`}, wantErr: "必须选择子字段"},
+		{name: "别名冲突", req: Request{Query: `{ user(id: 1) { a: id a: name } }`}, wantErr: "同时指向了"},
+		{name: "片段没有定义", req: Request{Query: `{ user(id: 1) { ...F } }`}, wantErr: "没有定义"},
+		{name: "片段类型不匹配", req: Request{Query: `{ user(id: 1) { ...F } } fragment F on Query { id }`}, wantErr: "不匹配"},
+		{name: "片段循环引用", req: Request{Query: `{ user(id: 1) { ...A } } fragment A on User { id ...B } fragment B on User { ...A }`}, wantErr: "循环引用"},
+		{name: "深度超过限制", req: Request{Query: `{ user(id: 1) { friends { friends { id } } } }`}, wantErr: "深度超过"},
+		{name: "复杂度超过限制", req: Request{Query: `{ user(id: 1) { friends(limit: 100) { id name } } }`}, wantErr: "复杂度超过"},
+		{
+			name:    "展开的片段太多",
+			req:     Request{Query: `{ a: user(id: 1) { ...C0 } b: user(id: 2) { ...C0 } c: user(id: 3) { ...C0 } d: user(id: 4) { ...C0 } }` + chain.String()},
+			wantErr: "展开的片段超过",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := execute(t, e, tc.req)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("错误 = %v，期望包含 %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecuteFragmentFanOut(t *testing.T) {
+	var batches atomic.Int64
+	e := NewExecutor(testSchema(&batches), logger.NewNopLogger())
+	// 每个片段引用下一个片段两次，不去重的话要展开 2^40 次
+	var query strings.Builder
+	query.WriteString("{ user(id: 1) { ...F0 } }\n")
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&query, "fragment F%d on User { id ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	query.WriteString("fragment F40 on User { name }\n")
+
+	start := time.Now()
+	data, _, err := execute(t, e, Request{Query: query.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != `{"user":{"id":1,"name":"u1"}}` {
+		t.Fatalf("data = %s", data)
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("展开片段用了 %s，重复的片段应该只展开一次", cost)
+	}
+}
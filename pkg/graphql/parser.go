@@ -0,0 +1,525 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+// 选择集、列表和对象值最多嵌套多少层，防止构造出来的深层嵌套把解析的栈打爆。
+// 执行时按 MaxDepth 限制字段的深度，这里只是兜底，比它宽松得多
+const maxNesting = 64
+
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+// Parse 解析查询文本，支持的子集见包注释，其余的语法直接报错
+func Parse(src string) (*Document, error) {
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	doc := &Document{Fragments: map[string]*Fragment{}}
+	for p.tok.kind != tokenEOF {
+		if p.tok.kind == tokenName && p.tok.val == "fragment" {
+			frag, err := p.parseFragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := doc.Fragments[frag.Name]; ok {
+				return nil, p.errorf("片段 %s 重复定义", frag.Name)
+			}
+			doc.Fragments[frag.Name] = frag
+			continue
+		}
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		doc.Operations = append(doc.Operations, op)
+	}
+	if len(doc.Operations) == 0 {
+		return nil, p.errorf("没有可执行的操作")
+	}
+	return doc, nil
+}
+
+type parser struct {
+	src string
+	pos int
+	tok token
+	// 当前的嵌套层数
+	depth int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("语法错误（位置 %d）：%s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// enter 进入一层嵌套，和 leave 成对调用
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxNesting {
+		return p.errorf("嵌套超过 %d 层", maxNesting)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+// next 读下一个 token，逗号和注释都当作空白
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+			continue
+		}
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		break
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokenEOF, pos: start}
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokenPunct, val: "...", pos: start}
+	case strings.IndexByte("{}():$!=[]", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokenPunct, val: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, val: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		return p.lexNumber()
+	case c == '@':
+		p.tok = token{pos: start}
+		return p.errorf("不支持指令")
+	case strings.HasPrefix(p.src[p.pos:], `"""`):
+		p.tok = token{pos: start}
+		return p.errorf("不支持块字符串")
+	case c == '"':
+		return p.lexString()
+	default:
+		p.tok = token{pos: start}
+		return p.errorf("不认识的字符 %q", c)
+	}
+	return nil
+}
+
+func (p *parser) lexNumber() error {
+	start := p.pos
+	kind := tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case isDigit(c):
+		case c == '.' || c == 'e' || c == 'E' || c == '+' || (c == '-' && kind == tokenFloat):
+			kind = tokenFloat
+		default:
+			p.tok = token{kind: kind, val: p.src[start:p.pos], pos: start}
+			return nil
+		}
+		p.pos++
+	}
+	p.tok = token{kind: kind, val: p.src[start:p.pos], pos: start}
+	return nil
+}
+
+func (p *parser) lexString() error {
+	start := p.pos
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			p.tok = token{kind: tokenString, val: sb.String(), pos: start}
+			return nil
+		case '\n':
+			p.tok = token{pos: start}
+			return p.errorf("字符串没有结束")
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				p.tok = token{pos: start}
+				return p.errorf("字符串没有结束")
+			}
+			esc := p.src[p.pos+1]
+			switch esc {
+			case '"', '\\', '/':
+				sb.WriteByte(esc)
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'u':
+				if p.pos+6 > len(p.src) {
+					p.tok = token{pos: start}
+					return p.errorf("不合法的转义")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos+2:p.pos+6], 16, 32)
+				if err != nil {
+					p.tok = token{pos: start}
+					return p.errorf("不合法的转义")
+				}
+				sb.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				p.tok = token{pos: start}
+				return p.errorf("不合法的转义 \\%c", esc)
+			}
+			p.pos += 2
+		default:
+			sb.WriteByte(c)
+			p.pos++
+		}
+	}
+	p.tok = token{pos: start}
+	return p.errorf("字符串没有结束")
+}
+
+func (p *parser) peek(val string) bool {
+	return p.tok.kind == tokenPunct && p.tok.val == val
+}
+
+func (p *parser) expect(val string) error {
+	if !p.peek(val) {
+		return p.errorf("期望 %s", val)
+	}
+	return p.next()
+}
+
+func (p *parser) name() (string, error) {
+	if p.tok.kind != tokenName {
+		return "", p.errorf("期望名字")
+	}
+	val := p.tok.val
+	return val, p.next()
+}
+
+func (p *parser) parseOperation() (*Operation, error) {
+	op := &Operation{Type: "query"}
+	if p.peek("{") {
+		sels, err := p.parseSelectionSet()
+		op.SelectionSet = sels
+		return op, err
+	}
+	typ, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if typ != "query" && typ != "mutation" && typ != "subscription" {
+		return nil, p.errorf("不认识的操作类型 %s", typ)
+	}
+	op.Type = typ
+	if p.tok.kind == tokenName {
+		op.Name = p.tok.val
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		op.Variables, err = p.parseVariableDefs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	op.SelectionSet, err = p.parseSelectionSet()
+	return op, err
+}
+
+func (p *parser) parseVariableDefs() ([]*VariableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var defs []*VariableDef
+	for !p.peek(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		// 变量的类型只做语法检查，执行时按实际传入的值处理
+		if err = p.skipType(); err != nil {
+			return nil, err
+		}
+		def := &VariableDef{Name: name}
+		if p.peek("=") {
+			if err = p.next(); err != nil {
+				return nil, err
+			}
+			def.Default, err = p.parseValue(true)
+			if err != nil {
+				return nil, err
+			}
+		}
+		defs = append(defs, def)
+	}
+	return defs, p.next()
+}
+
+func (p *parser) skipType() error {
+	if p.peek("[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek("!") {
+		return p.next()
+	}
+	return nil
+}
+
+func (p *parser) parseFragment() (*Fragment, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenName || p.tok.val != "on" {
+		return nil, p.errorf("期望 on")
+	}
+	if err = p.next(); err != nil {
+		return nil, err
+	}
+	typ, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	sels, err := p.parseSelectionSet()
+	return &Fragment{Name: name, TypeCondition: typ, SelectionSet: sels}, err
+}
+
+func (p *parser) parseSelectionSet() ([]Selection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []Selection
+	for !p.peek("}") {
+		if p.tok.kind == tokenEOF {
+			return nil, p.errorf("期望 }")
+		}
+		sel, err := p.parseSelection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, p.errorf("选择集不能为空")
+	}
+	return sels, p.next()
+}
+
+func (p *parser) parseSelection() (Selection, error) {
+	if p.peek("...") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokenName && p.tok.val != "on" {
+			name := p.tok.val
+			return &FragmentSpread{Name: name}, p.next()
+		}
+		frag := &InlineFragment{}
+		if p.tok.kind == tokenName {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			typ, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			frag.TypeCondition = typ
+		}
+		sels, err := p.parseSelectionSet()
+		frag.SelectionSet = sels
+		return frag, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &Field{Name: name}
+	if p.peek(":") {
+		if err = p.next(); err != nil {
+			return nil, err
+		}
+		f.Alias = name
+		if f.Name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if f.Arguments, err = p.parseArguments(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("{") {
+		f.SelectionSet, err = p.parseSelectionSet()
+	}
+	return f, err
+}
+
+func (p *parser) parseArguments() (map[string]any, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := map[string]any{}
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.parseValue(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.next()
+}
+
+// parseValue const 为 true 时不允许引用变量，用于变量的默认值
+func (p *parser) parseValue(isConst bool) (any, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	tok := p.tok
+	switch {
+	case p.peek("$"):
+		if isConst {
+			return nil, p.errorf("这里不能使用变量")
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return Variable{Name: name}, err
+	case p.peek("["):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []any{}
+		for !p.peek("]") {
+			val, err := p.parseValue(isConst)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, val)
+		}
+		return list, p.next()
+	case p.peek("{"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := map[string]any{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.parseValue(isConst); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.next()
+	case tok.kind == tokenInt:
+		val, err := strconv.ParseInt(tok.val, 10, 64)
+		if err != nil {
+			return nil, p.errorf("不合法的整数 %s", tok.val)
+		}
+		return val, p.next()
+	case tok.kind == tokenFloat:
+		val, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, p.errorf("不合法的浮点数 %s", tok.val)
+		}
+		return val, p.next()
+	case tok.kind == tokenString:
+		return tok.val, p.next()
+	case tok.kind == tokenName:
+		var val any
+		switch tok.val {
+		case "true":
+			val = true
+		case "false":
+			val = false
+		case "null":
+			val = nil
+		default:
+			val = tok.val
+		}
+		return val, p.next()
+	default:
+		return nil, p.errorf("期望一个值")
+	}
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,141 @@
+package graphql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# 注释会被忽略
+		query Profile($id: Int! = 1, $tags: [String]) {
+			me: user(id: $id, filter: {tags: $tags, hidden: false}) {
+				name
+				...UserFields
+				... on User { avatar }
+			}
+		}
+		fragment UserFields on User { nickname, score(scale: 1.5, label: "a\"b中") }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Operations) != 1 {
+		t.Fatalf("操作个数 = %d，期望 1", len(doc.Operations))
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || op.Name != "Profile" {
+		t.Fatalf("操作 = %s %s", op.Type, op.Name)
+	}
+	if len(op.Variables) != 2 || op.Variables[0].Default != int64(1) || op.Variables[1].Default != nil {
+		t.Fatalf("变量解析不对：%+v %+v", op.Variables[0], op.Variables[1])
+	}
+
+	me := op.SelectionSet[0].(*Field)
+	if me.Key() != "me" || me.Name != "user" {
+		t.Fatalf("别名解析不对：key = %s，name = %s", me.Key(), me.Name)
+	}
+	wantArgs := map[string]any{
+		"id":     Variable{Name: "id"},
+		"filter": map[string]any{"tags": Variable{Name: "tags"}, "hidden": false},
+	}
+	if !reflect.DeepEqual(me.Arguments, wantArgs) {
+		t.Fatalf("参数 = %v，期望 %v", me.Arguments, wantArgs)
+	}
+	if len(me.SelectionSet) != 3 {
+		t.Fatalf("选择集长度 = %d，期望 3", len(me.SelectionSet))
+	}
+	if spread, ok := me.SelectionSet[1].(*FragmentSpread); !ok || spread.Name != "UserFields" {
+		t.Fatalf("第二个选择应该是片段 UserFields，实际是 %#v", me.SelectionSet[1])
+	}
+	if inline, ok := me.SelectionSet[2].(*InlineFragment); !ok || inline.TypeCondition != "User" {
+		t.Fatalf("第三个选择应该是 on User 的内联片段，实际是 %#v", me.SelectionSet[2])
+	}
+
+	frag, ok := doc.Fragments["UserFields"]
+	if !ok || frag.TypeCondition != "User" {
+		t.Fatal("片段 UserFields 没有解析出来")
+	}
+	score := frag.SelectionSet[1].(*Field)
+	wantScore := map[string]any{"scale": 1.5, "label": "a\"b中"}
+	if !reflect.DeepEqual(score.Arguments, wantScore) {
+		t.Fatalf("参数 = %v，期望 %v", score.Arguments, wantScore)
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	doc, err := Parse(`{ a b { c } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := doc.Operations[0]
+	if op.Type != "query" || len(op.SelectionSet) != 2 {
+		t.Fatalf("简写的查询解析不对：%+v", op)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	testCases := []struct {
+		name    string
+		query   string
+		wantErr string
+	}{
+		{name: "空文本", query: "", wantErr: "没有可执行的操作"},
+		{name: "只有片段", query: "fragment F on User { a }", wantErr: "没有可执行的操作"},
+		{name: "空选择集", query: "{ }", wantErr: "选择集不能为空"},
+		{name: "没有闭合", query: "{ a { b }", wantErr: "期望 }"},
+		{name: "字符串没有结束", query: `{ a(b: "c) }`, wantErr: "字符串没有结束"},
+		{name: "不合法的转义", query: `{ a(b: "\q") }`, wantErr: "不合法的转义"},
+		{name: "不认识的字符", query: "{ a% }", wantErr: "不认识的字符"},
+		{name: "指令", query: "{ a @include(if: true) }", wantErr: "不支持指令"},
+		{name: "操作上的指令", query: "query Q @cached { a }", wantErr: "不支持指令"},
+		{name: "块字符串", query: `{ a(b: """c""") }`, wantErr: "不支持块字符串"},
+		{name: "不认识的操作", query: "select { a }", wantErr: "不认识的操作类型"},
+		{name: "类型定义", query: "type User { id: Int }", wantErr: "不认识的操作类型"},
+		{name: "schema 定义", query: "schema { query: Query }", wantErr: "不认识的操作类型"},
+		{name: "片段缺少类型条件", query: "{ a } fragment F { a }", wantErr: "期望 on"},
+		{name: "参数缺少值", query: "{ a(b: ) }", wantErr: "期望一个值"},
+		{name: "变量缺少 $", query: "query(a: Int) { a }", wantErr: "期望 $"},
+		{name: "片段重复定义", query: "{ a } fragment F on A { a } fragment F on A { b }", wantErr: "重复定义"},
+		{name: "默认值引用变量", query: "query($a: Int = $b) { a }", wantErr: "不能使用变量"},
+		{
+			name:    "选择集嵌套太深",
+			query:   strings.Repeat("{ a ", maxNesting+1) + strings.Repeat("}", maxNesting+1),
+			wantErr: "嵌套超过",
+		},
+		{
+			name:    "列表嵌套太深",
+			query:   "{ a(b: " + strings.Repeat("[", maxNesting+1) + strings.Repeat("]", maxNesting+1) + ") }",
+			wantErr: "嵌套超过",
+		},
+		{
+			name:    "对象嵌套太深",
+			query:   "{ a(b: " + strings.Repeat("{c: ", maxNesting+1) + "1" + strings.Repeat("}", maxNesting+1) + ") }",
+			wantErr: "嵌套超过",
+		},
+		{
+			// 没有闭合的括号也不能无限递归下去
+			name:    "没有闭合的深层嵌套",
+			query:   "{ a(b: " + strings.Repeat("[", 100000),
+			wantErr: "嵌套超过",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(tc.query)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("错误 = %v，期望包含 %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseNestingLimit(t *testing.T) {
+	// 刚好在上限之内的嵌套可以解析
+	depth := maxNesting
+	query := strings.Repeat("{ a ", depth) + strings.Repeat("}", depth)
+	if _, err := Parse(query); err != nil {
+		t.Fatalf("嵌套 %d 层应该可以解析：%v", depth, err)
+	}
+}
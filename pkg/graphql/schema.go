@@ -0,0 +1,87 @@
+package graphql
+
+import (
+	"context"
+	"errors"
+)
+
+// Schema 只有查询，写操作还是走原来的 REST 接口
+type Schema struct {
+	Query *Object
+}
+
+// Object 对象类型，字段在构造完所有类型之后再填，这样类型之间可以互相引用
+type Object struct {
+	Name   string
+	Fields map[string]*FieldDef
+}
+
+func NewObject(name string) *Object {
+	return &Object{Name: name, Fields: map[string]*FieldDef{}}
+}
+
+// FieldDef 字段定义，Resolve 和 Batch 二选一。
+// 同一层的所有父对象会一起解析，Batch 拿到的是这一层全部的父对象，适合挂 dataloader；
+// Resolve 则是逐个父对象调用，只适合不用访问下游的字段
+type FieldDef struct {
+	// Type 为 nil 表示标量，结果直接序列化成 JSON
+	Type *Object
+	// List 为 true 时解析结果必须是切片
+	List bool
+	// Cost 是这个字段本身的复杂度，0 按 1 计算
+	Cost    int
+	Resolve ResolveFunc
+	Batch   BatchResolveFunc
+}
+
+type ResolveFunc func(ctx context.Context, source any, args Args) (any, error)
+
+// BatchResolveFunc 返回值和 sources 一一对应
+type BatchResolveFunc func(ctx context.Context, sources []any, args Args) ([]any, error)
+
+// Args 字段的参数，变量已经替换成了实际的值
+type Args map[string]any
+
+// Int 变量里传进来的数字是 float64，这里一并处理
+func (a Args) Int(name string, def int64) int64 {
+	switch val := a[name].(type) {
+	case int64:
+		return val
+	case float64:
+		return int64(val)
+	default:
+		return def
+	}
+}
+
+func (a Args) String(name string, def string) string {
+	if val, ok := a[name].(string); ok {
+		return val
+	}
+	return def
+}
+
+func (a Args) Bool(name string, def bool) bool {
+	if val, ok := a[name].(bool); ok {
+		return val
+	}
+	return def
+}
+
+// UserError 可以直接展示给调用方的错误，其余的错误只会返回“系统异常”
+type UserError struct {
+	Msg string
+}
+
+func (e *UserError) Error() string {
+	return e.Msg
+}
+
+func NewUserError(msg string) error {
+	return &UserError{Msg: msg}
+}
+
+func IsUserError(err error) bool {
+	var ue *UserError
+	return errors.As(err, &ue)
+}
@@ -0,0 +1,40 @@
+package grpcx
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+)
+
+// DeadlineBudget 每往下走一跳，就从截止时间里扣掉 reserve，留给 BFF 自己处理下游的错误并响应前端。
+// 这样超时总是先在下游发生，BFF 还能返回一个明确的超时错误码，而不是被前端或网关直接掐断。
+// 剩余时间已经不够 reserve 的话，就不再发起调用，直接返回 DeadlineExceeded
+func DeadlineBudget(reserve time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		deadline, ok := ctx.Deadline()
+		if !ok || reserve <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if time.Until(deadline) <= reserve {
+			return status.Errorf(codes.DeadlineExceeded, "调用 %s 前时间预算已耗尽", method)
+		}
+		newCtx, cancel := context.WithDeadline(ctx, deadline.Add(-reserve))
+		defer cancel()
+		return invoker(newCtx, method, req, reply, cc, opts...)
+	}
+}
+
+// IsDeadlineExceeded 判断是不是超时，兼容 context 的错误和 grpc、kratos 的错误
+func IsDeadlineExceeded(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return status.Code(err) == codes.DeadlineExceeded
+}
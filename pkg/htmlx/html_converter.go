@@ -2,6 +2,7 @@ package htmlx
 
 import (
 	"bytes"
+	"errors"
 	"io"
 )
 
@@ -18,6 +19,6 @@ func (d *DocxToHTMLConverter) ConvertToHTML(reader io.Reader) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	// TODO implement me
-	panic("implement me")
+	// TODO 还没有实现，先返回错误，别让请求 panic
+	return "", errors.New("暂不支持将 docx 转换为 HTML")
 }
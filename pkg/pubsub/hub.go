@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Broker 跨实例广播消息，生产环境是 Redis 的 pub/sub
+type Broker interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe 订阅 pattern 匹配的所有频道，ctx 取消或者连接断开时返回的 channel 会被关闭
+	Subscribe(ctx context.Context, pattern string) (<-chan Message, error)
+}
+
+type Message struct {
+	Channel string
+	Payload []byte
+}
+
+// Hub 每个实例只向 Broker 订阅一次 prefix 下的所有频道，再按 topic 分发给本实例上的订阅者，
+// 这样不管客户端连到哪个实例，都能收到别的实例发布的消息。
+// 分发不会阻塞：订阅者的缓冲满了说明它消费不过来，直接关掉它的 channel，由客户端重连补齐
+type Hub struct {
+	broker Broker
+	prefix string
+	buffer int
+	l      logger.Logger
+
+	mu   sync.RWMutex
+	subs map[string]map[*Subscription]struct{}
+}
+
+func NewHub(broker Broker, prefix string, l logger.Logger) *Hub {
+	return &Hub{
+		broker: broker,
+		prefix: prefix,
+		buffer: 16,
+		l:      l,
+		subs:   make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Run 一直运行到 ctx 取消，和 Broker 的连接断了会重新订阅
+func (h *Hub) Run(ctx context.Context) {
+	const retryInterval = time.Second
+	for ctx.Err() == nil {
+		msgs, err := h.broker.Subscribe(ctx, h.prefix+"*")
+		if err != nil {
+			h.l.Error("订阅广播失败", logger.String("prefix", h.prefix), logger.Error(err))
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		for msg := range msgs {
+			h.deliver(strings.TrimPrefix(msg.Channel, h.prefix), msg.Payload)
+		}
+	}
+}
+
+// Publish 发给所有实例上订阅了 topic 的订阅者
+func (h *Hub) Publish(ctx context.Context, topic string, payload []byte) error {
+	return h.broker.Publish(ctx, h.prefix+topic, payload)
+}
+
+func (h *Hub) Subscribe(topic string) *Subscription {
+	sub := &Subscription{hub: h, topic: topic, ch: make(chan []byte, h.buffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[topic] == nil {
+		h.subs[topic] = make(map[*Subscription]struct{})
+	}
+	h.subs[topic][sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) deliver(topic string, payload []byte) {
+	h.mu.RLock()
+	var slow []*Subscription
+	for sub := range h.subs[topic] {
+		select {
+		case sub.ch <- payload:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	h.mu.RUnlock()
+	for _, sub := range slow {
+		h.l.Warn("订阅者消费太慢，断开", logger.String("topic", topic))
+		sub.Close()
+	}
+}
+
+func (h *Hub) remove(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[sub.topic], sub)
+	if len(h.subs[sub.topic]) == 0 {
+		delete(h.subs, sub.topic)
+	}
+}
+
+type Subscription struct {
+	hub   *Hub
+	topic string
+	ch    chan []byte
+	once  sync.Once
+}
+
+// C 被 Hub 踢掉或者 Close 之后会被关闭
+func (s *Subscription) C() <-chan []byte {
+	return s.ch
+}
+
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.remove(s)
+		close(s.ch)
+	})
+}
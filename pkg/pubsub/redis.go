@@ -0,0 +1,43 @@
+package pubsub
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisBroker struct {
+	client redis.UniversalClient
+}
+
+func NewRedisBroker(client redis.UniversalClient) *RedisBroker {
+	return &RedisBroker{client: client}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	return b.client.Publish(ctx, channel, payload).Err()
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, pattern string) (<-chan Message, error) {
+	ps := b.client.PSubscribe(ctx, pattern)
+	// 等订阅确认，连不上 Redis 时在这里就返回错误
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+	msgs := make(chan Message)
+	go func() {
+		<-ctx.Done()
+		_ = ps.Close()
+	}()
+	go func() {
+		defer close(msgs)
+		for msg := range ps.Channel() {
+			select {
+			case msgs <- Message{Channel: msg.Channel, Payload: []byte(msg.Payload)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return msgs, nil
+}
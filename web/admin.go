@@ -0,0 +1,240 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
+	"github.com/MuxiKeStack/bff/pkg/feature"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/maintenance"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/MuxiKeStack/bff/webhook"
+	"github.com/gin-gonic/gin"
+	"sort"
+)
+
+// AdminHandler 运维用的管理接口，只有管理员能调
+type AdminHandler struct {
+	flags       *feature.Flags
+	maintenance *maintenance.Builder
+	webhooks    webhook.Store
+	dispatcher  *webhook.Dispatcher
+	// 管理员的学号，可以动态修改
+	administrators *dynconf.Value[map[string]struct{}]
+	pager          *ginx.Pager
+}
+
+func NewAdminHandler(flags *feature.Flags, maintenance *maintenance.Builder, webhooks webhook.Store,
+	dispatcher *webhook.Dispatcher, administrators *dynconf.Value[map[string]struct{}], pager *ginx.Pager) *AdminHandler {
+	return &AdminHandler{flags: flags, maintenance: maintenance, webhooks: webhooks, dispatcher: dispatcher,
+		administrators: administrators, pager: pager}
+}
+
+func (h *AdminHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
+	ag := s.Group("/admin", authMiddleware)
+	ag.GET("/features/list", ginx.WrapClaims(h.ListFeatures))
+	ag.POST("/features/save", ginx.WrapClaimsAndReq(h.SaveFeature))
+	ag.POST("/features/reset", ginx.WrapClaimsAndReq(h.ResetFeature))
+	ag.GET("/maintenance", ginx.WrapClaims(h.GetMaintenance))
+	ag.POST("/maintenance/save", ginx.WrapClaimsAndReq(h.SaveMaintenance))
+	ag.POST("/maintenance/reset", ginx.WrapClaims(h.ResetMaintenance))
+	ag.GET("/webhooks/list", ginx.WrapClaims(h.ListWebhooks))
+	ag.POST("/webhooks/save", ginx.WrapClaimsAndReq(h.SaveWebhook))
+	ag.DELETE("/webhooks/:webhookId", ginx.WrapClaims(h.DeleteWebhook))
+	ag.GET("/webhooks/:webhookId/deliveries", ginx.WrapClaimsAndReq(h.ListWebhookDeliveries))
+	ag.POST("/webhooks/deliveries/:deliveryId/redeliver", ginx.WrapClaims(h.Redeliver))
+}
+
+// @Summary 功能开关列表
+// @Description 列出所有的功能开关，按名字排序
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} ginx.Result{data=[]FeatureVo} "成功"
+// @Router /admin/features/list [get]
+func (h *AdminHandler) ListFeatures(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	flags := h.flags.List()
+	featureVos := make([]FeatureVo, 0, len(flags))
+	for name, flag := range flags {
+		featureVos = append(featureVos, FeatureVo{Name: name, Flag: flag})
+	}
+	sort.Slice(featureVos, func(i, j int) bool {
+		return featureVos[i].Name < featureVos[j].Name
+	})
+	return ginx.Result{
+		Msg:  "Success",
+		Data: featureVos,
+	}, nil
+}
+
+// @Summary 保存功能开关
+// @Description 新增或者覆盖一个功能开关，配置了 etcd 时所有实例都会生效
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param request body SaveFeatureReq true "功能开关"
+// @Success 200 {object} ginx.Result "成功"
+// @Router /admin/features/save [post]
+func (h *AdminHandler) SaveFeature(ctx *gin.Context, req SaveFeatureReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	if req.Name == "" {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的功能开关",
+		}, errors.New("不合法的功能开关")
+	}
+	if err := req.Flag.Validate(); err != nil {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的功能开关：" + err.Error(),
+		}, err
+	}
+	err := h.flags.Save(ctx, req.Name, req.Flag)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+	}, nil
+}
+
+// @Summary 重置功能开关
+// @Description 删除通过接口保存的覆盖，恢复成配置文件里的功能开关
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param request body ResetFeatureReq true "功能开关名"
+// @Success 200 {object} ginx.Result "成功"
+// @Router /admin/features/reset [post]
+func (h *AdminHandler) ResetFeature(ctx *gin.Context, req ResetFeatureReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	if req.Name == "" {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的功能开关",
+		}, errors.New("不合法的功能开关")
+	}
+	err := h.flags.Reset(ctx, req.Name)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+	}, nil
+}
+
+// @Summary 维护模式
+// @Description 查看当前的维护模式和公告
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} ginx.Result{data=MaintenanceVo} "成功"
+// @Router /admin/maintenance [get]
+func (h *AdminHandler) GetMaintenance(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	cfg := h.maintenance.Load()
+	routes := make([]MaintenanceRouteVo, 0, len(cfg.AllowRoutes))
+	for _, r := range cfg.AllowRoutes {
+		routes = append(routes, MaintenanceRouteVo{Method: r.Method, Pattern: r.Pattern})
+	}
+	return ginx.Result{
+		Msg: "Success",
+		Data: MaintenanceVo{
+			Mode:        cfg.Mode,
+			Notice:      cfg.Notice,
+			AllowRoutes: routes,
+		},
+	}, nil
+}
+
+// @Summary 切换维护模式
+// @Description 切换到只读或者全站维护，配置了 etcd 时所有实例都会生效
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param request body SaveMaintenanceReq true "维护模式"
+// @Success 200 {object} ginx.Result "成功"
+// @Router /admin/maintenance/save [post]
+func (h *AdminHandler) SaveMaintenance(ctx *gin.Context, req SaveMaintenanceReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	if !maintenance.ValidMode(req.Mode) {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的维护模式",
+		}, fmt.Errorf("不合法的维护模式: %s", req.Mode)
+	}
+	err := h.maintenance.Save(ctx, req.Mode, req.Notice)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+	}, nil
+}
+
+// @Summary 重置维护模式
+// @Description 删除通过接口切换的维护模式，恢复成配置文件里的
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} ginx.Result "成功"
+// @Router /admin/maintenance/reset [post]
+func (h *AdminHandler) ResetMaintenance(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	err := h.maintenance.Reset(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+	}, nil
+}
+
+func (h *AdminHandler) isAdmin(studentId string) bool {
+	_, exists := h.administrators.Load()[studentId]
+	return exists
+}
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"github.com/MuxiKeStack/bff/pkg/feature"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+)
+
+type FeatureVo struct {
+	Name string `json:"name"`
+	feature.Flag
+}
+
+type SaveFeatureReq struct {
+	Name string       `json:"name"`
+	Flag feature.Flag `json:"flag"`
+}
+
+type ResetFeatureReq struct {
+	Name string `json:"name"`
+}
+
+type MaintenanceVo struct {
+	Mode        string               `json:"mode"`
+	Notice      string               `json:"notice"`
+	AllowRoutes []MaintenanceRouteVo `json:"allow_routes"`
+}
+
+type MaintenanceRouteVo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+}
+
+type SaveMaintenanceReq struct {
+	// 空字符串是正常服务，readonly 是只读，full 是全站维护
+	Mode   string `json:"mode"`
+	Notice string `json:"notice"`
+}
+
+type WebhookVo struct {
+	Id          int64    `json:"id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      bool     `json:"active"`
+	// Secret 只在新建和重新生成的时候返回，用来校验 X-KStack-Signature
+	Secret string `json:"secret,omitempty"`
+	Ctime  int64  `json:"ctime"`
+	Utime  int64  `json:"utime"`
+}
+
+type SaveWebhookReq struct {
+	// Id 为 0 是新建
+	Id     int64    `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Active 不传时新建的是启用，修改的保持不变
+	Active      *bool  `json:"active"`
+	Description string `json:"description"`
+	// RotateSecret 重新生成签名密钥
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+type ListWebhookDeliveriesReq struct {
+	ginx.PageReq
+}
+
+type WebhookDeliveryVo struct {
+	Id           int64              `json:"id"`
+	WebhookId    int64              `json:"webhook_id"`
+	EventId      string             `json:"event_id"`
+	EventType    string             `json:"event_type"`
+	Payload      string             `json:"payload"`
+	RedeliveryOf int64              `json:"redelivery_of"`
+	Status       string             `json:"status"`
+	Attempts     []WebhookAttemptVo `json:"attempts"`
+	NextRetryAt  int64              `json:"next_retry_at"`
+	Ctime        int64              `json:"ctime"`
+	Utime        int64              `json:"utime"`
+}
+
+type WebhookAttemptVo struct {
+	At         int64  `json:"at"`
+	StatusCode int    `json:"status_code"`
+	Error      string `json:"error"`
+	Response   string `json:"response"`
+	Duration   int64  `json:"duration"`
+}
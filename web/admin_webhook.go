@@ -0,0 +1,329 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/MuxiKeStack/bff/webhook"
+	"github.com/ecodeclub/ekit/slice"
+	"github.com/gin-gonic/gin"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+// @Summary webhook 列表
+// @Description 列出所有的 webhook，按 id 排序，不返回签名密钥
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Success 200 {object} ginx.Result{data=[]WebhookVo} "成功"
+// @Router /admin/webhooks/list [get]
+func (h *AdminHandler) ListWebhooks(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	hooks, err := h.webhooks.ListWebhooks(ctx)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+		Data: slice.Map(hooks, func(idx int, src webhook.Webhook) WebhookVo {
+			return toWebhookVo(src)
+		}),
+	}, nil
+}
+
+// @Summary 保存 webhook
+// @Description 新建或者修改 webhook，events 是订阅的事件类型：evaluation.published、question.published、answer.published。
+// @Description 新建和 rotate_secret 时返回签名密钥，请求头 X-KStack-Signature 是 sha256= 加上 HMAC-SHA256(密钥, "{X-KStack-Timestamp}.{请求体}") 的十六进制
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param request body SaveWebhookReq true "webhook"
+// @Success 200 {object} ginx.Result{data=WebhookVo} "成功"
+// @Router /admin/webhooks/save [post]
+func (h *AdminHandler) SaveWebhook(ctx *gin.Context, req SaveWebhookReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "webhook 地址要是 http 或者 https 的完整 URL",
+		}, fmt.Errorf("不合法的 webhook 地址: %s", req.URL)
+	}
+	// 域名解析到这些地址的，投递时建立连接之前也会拦下来
+	if webhook.ForbiddenHost(u.Hostname()) {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "webhook 地址不能是回环、内网或者链路本地地址",
+		}, fmt.Errorf("不合法的 webhook 地址: %s", req.URL)
+	}
+	if len(req.Events) == 0 {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "至少要订阅一种事件",
+		}, errors.New("没有订阅事件")
+	}
+	for _, typ := range req.Events {
+		if !slices.Contains(events.WebhookTypes(), typ) {
+			return ginx.Result{
+				Code: errs.AdminInvalidInput,
+				Msg:  "不认识的事件类型 " + typ,
+			}, fmt.Errorf("不认识的事件类型: %s", typ)
+		}
+	}
+	hook := webhook.Webhook{Active: true}
+	if req.Id != 0 {
+		hook, err = h.webhooks.GetWebhook(ctx, req.Id)
+		switch {
+		case errors.Is(err, webhook.ErrWebhookNotFound):
+			return ginx.Result{
+				Code: errs.AdminNotFound,
+				Msg:  "webhook 不存在",
+			}, err
+		case err != nil:
+			return ginx.Result{
+				Code: errs.InternalServerError,
+				Msg:  "系统异常",
+			}, err
+		}
+	}
+	hook.URL = req.URL
+	hook.Events = slices.Clone(req.Events)
+	slices.Sort(hook.Events)
+	hook.Events = slices.Compact(hook.Events)
+	hook.Description = req.Description
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	newSecret := hook.Secret == "" || req.RotateSecret
+	if newSecret {
+		if hook.Secret, err = newWebhookSecret(); err != nil {
+			return ginx.Result{
+				Code: errs.InternalServerError,
+				Msg:  "系统异常",
+			}, err
+		}
+	}
+	hook, err = h.webhooks.SaveWebhook(ctx, hook)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	vo := toWebhookVo(hook)
+	if newSecret {
+		vo.Secret = hook.Secret
+	}
+	return ginx.Result{
+		Msg:  "Success",
+		Data: vo,
+	}, nil
+}
+
+// @Summary 删除 webhook
+// @Description 投递记录一起删掉，还在重试的投递会失败
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param webhookId path int true "webhook id"
+// @Success 200 {object} ginx.Result "成功"
+// @Router /admin/webhooks/{webhookId} [delete]
+func (h *AdminHandler) DeleteWebhook(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	id, err := strconv.ParseInt(ctx.Param("webhookId"), 10, 64)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的 webhook id",
+		}, err
+	}
+	err = h.webhooks.DeleteWebhook(ctx, id)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Msg: "Success",
+		}, nil
+	case errors.Is(err, webhook.ErrWebhookNotFound):
+		return ginx.Result{
+			Code: errs.AdminNotFound,
+			Msg:  "webhook 不存在",
+		}, err
+	default:
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+}
+
+// @Summary webhook 投递记录
+// @Description 从新到旧，每个 webhook 只保留最近的一部分（webhook.keepDeliveries），过期的不返回
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param webhookId path int true "webhook id"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[WebhookDeliveryVo]} "成功"
+// @Router /admin/webhooks/{webhookId}/deliveries [get]
+func (h *AdminHandler) ListWebhookDeliveries(ctx *gin.Context, req ListWebhookDeliveriesReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	id, err := strconv.ParseInt(ctx.Param("webhookId"), 10, 64)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的 webhook id",
+		}, err
+	}
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
+	}
+	// 多查一条，用来判断还有没有下一页
+	deliveries, err := h.webhooks.ListDeliveries(ctx, id, cur, h.pager.Size(req.Limit)+1)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(deliveries, func(idx int, src webhook.Delivery) WebhookDeliveryVo {
+		return toWebhookDeliveryVo(src)
+	}), func(vo WebhookDeliveryVo) int64 {
+		return vo.Id
+	})
+	return ginx.Result{
+		Msg:  "Success",
+		Data: page,
+	}, nil
+}
+
+// @Summary 重新投递
+// @Description 把这条投递记录的请求体原样再投递一次，记成一条新的投递记录，redelivery_of 指向原来的
+// @Tags 管理
+// @Accept json
+// @Produce json
+// @Param deliveryId path int true "投递记录 id"
+// @Success 200 {object} ginx.Result{data=WebhookDeliveryVo} "成功"
+// @Router /admin/webhooks/deliveries/{deliveryId}/redeliver [post]
+func (h *AdminHandler) Redeliver(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	if !h.isAdmin(uc.StudentId) {
+		return ginx.Result{
+			Code: errs.AdminPermissionDenied,
+			Msg:  "没有访问权限",
+		}, fmt.Errorf("没有访问权限: %s", uc.StudentId)
+	}
+	id, err := strconv.ParseInt(ctx.Param("deliveryId"), 10, 64)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.AdminInvalidInput,
+			Msg:  "不合法的投递记录 id",
+		}, err
+	}
+	delivery, err := h.dispatcher.Redeliver(ctx, id)
+	switch {
+	case err == nil:
+		return ginx.Result{
+			Msg:  "Success",
+			Data: toWebhookDeliveryVo(delivery),
+		}, nil
+	case errors.Is(err, webhook.ErrDeliveryNotFound):
+		return ginx.Result{
+			Code: errs.AdminNotFound,
+			Msg:  "投递记录不存在或者已经过期",
+		}, err
+	case errors.Is(err, webhook.ErrWebhookNotFound):
+		return ginx.Result{
+			Code: errs.AdminNotFound,
+			Msg:  "webhook 不存在",
+		}, err
+	case errors.Is(err, webhook.ErrQueueFull):
+		// 投递记录已经建好了，停在 pending，稍后可以对它再重新投递
+		return ginx.Result{
+			Code: errs.AdminQueueFull,
+			Msg:  "投递队列满了，请稍后再试",
+		}, err
+	default:
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func toWebhookVo(hook webhook.Webhook) WebhookVo {
+	return WebhookVo{
+		Id:          hook.Id,
+		URL:         hook.URL,
+		Events:      hook.Events,
+		Description: hook.Description,
+		Active:      hook.Active,
+		Ctime:       hook.Ctime,
+		Utime:       hook.Utime,
+	}
+}
+
+func toWebhookDeliveryVo(d webhook.Delivery) WebhookDeliveryVo {
+	return WebhookDeliveryVo{
+		Id:           d.Id,
+		WebhookId:    d.WebhookId,
+		EventId:      d.EventId,
+		EventType:    d.EventType,
+		Payload:      d.Payload,
+		RedeliveryOf: d.RedeliveryOf,
+		Status:       d.Status,
+		Attempts: slice.Map(d.Attempts, func(idx int, src webhook.Attempt) WebhookAttemptVo {
+			return WebhookAttemptVo{
+				At:         src.At,
+				StatusCode: src.StatusCode,
+				Error:      src.Error,
+				Response:   src.Response,
+				Duration:   src.Duration,
+			}
+		}),
+		NextRetryAt: d.NextRetryAt,
+		Ctime:       d.Ctime,
+		Utime:       d.Utime,
+	}
+}
@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	"errors"
 	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
 	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
@@ -8,11 +9,14 @@ import (
 	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
 	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/dataloader"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/sync/errgroup"
 	"strconv"
 )
 
@@ -22,17 +26,23 @@ type AnswerHandler struct {
 	questionClient questionv1.QuestionServiceClient
 	commentClient  commentv1.CommentServiceClient
 	stanceClient   stancev1.StanceServiceClient
+	producer       events.Producer
+	pager          *ginx.Pager
+	l              logger.Logger
 }
 
 func NewAnswerHandler(answerClient answerv1.AnswerServiceClient, courseClient coursev1.CourseServiceClient,
 	questionClient questionv1.QuestionServiceClient, commentClient commentv1.CommentServiceClient,
-	stanceClient stancev1.StanceServiceClient) *AnswerHandler {
+	stanceClient stancev1.StanceServiceClient, producer events.Producer, pager *ginx.Pager, l logger.Logger) *AnswerHandler {
 	return &AnswerHandler{
 		answerClient:   answerClient,
 		courseClient:   courseClient,
 		questionClient: questionClient,
 		commentClient:  commentClient,
 		stanceClient:   stanceClient,
+		producer:       producer,
+		pager:          pager,
+		l:              l,
 	}
 }
 
@@ -103,6 +113,16 @@ func (h *AnswerHandler) Publish(ctx *gin.Context, req AnswerPublishReq, uc ijwt.
 			Msg:  "系统异常",
 		}, err
 	}
+	// 失败了只打日志，不影响发布
+	err = events.Produce(ctx, h.producer, uc.Uid, events.AnswerPublished{
+		Id:          publishRes.GetAnswerId(),
+		QuestionId:  req.QuestionId,
+		PublisherId: uc.Uid,
+		Content:     req.Content,
+	})
+	if err != nil {
+		h.l.Error("发送回答发布事件失败", logger.Error(err), logger.Int64("answerId", publishRes.GetAnswerId()))
+	}
 	return ginx.Result{
 		Msg:  "Success",
 		Data: publishRes.GetAnswerId(),
@@ -127,28 +147,29 @@ func (h *AnswerHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 			Msg:  "不合法的answerId",
 		}, err
 	}
+	g := aggregate.NewGroup(ctx)
 	var (
-		eg         errgroup.Group
 		answerRes  *answerv1.DetailResponse
 		commentRes *commentv1.CountCommentResponse
 		stanceRes  *stancev1.GetUserStanceResponse
 	)
-	eg.Go(func() error {
+	g.Required("answer.Detail", func(ctx context.Context) error {
 		var er error
 		answerRes, er = h.answerClient.Detail(ctx, &answerv1.DetailRequest{
 			AnswerId: aid,
 		})
 		return er
 	})
-	eg.Go(func() error {
+	// 评论数和表态失败了就降级
+	g.Optional("comment.CountComment", func(ctx context.Context) error {
 		var er error
 		commentRes, er = h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
 			Biz:   commentv1.Biz_Answer,
 			BizId: aid,
 		})
 		return er
-	})
-	eg.Go(func() error {
+	}, "total_comment_count")
+	g.Optional("stance.GetUserStance", func(ctx context.Context) error {
 		var er error
 		stanceRes, er = h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
 			Uid:   uc.Uid,
@@ -156,8 +177,8 @@ func (h *AnswerHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 			BizId: aid,
 		})
 		return er
-	})
-	err = eg.Wait()
+	}, "stance", "total_support_count", "total_oppose_count")
+	degraded, err := g.Wait()
 	switch {
 	case err == nil:
 		return ginx.Result{
@@ -174,6 +195,7 @@ func (h *AnswerHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 				Utime:             answerRes.GetAnswer().GetUtime(),
 				Ctime:             answerRes.GetAnswer().GetCtime(),
 			},
+			Degraded: degraded,
 		}, nil
 	case answerv1.IsAnswerNotFound(err):
 		return ginx.Result{
@@ -195,9 +217,9 @@ func (h *AnswerHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 // @Accept json
 // @Produce json
 // @Param questionId path int64 true "问题ID"
-// @Param cur_answer_id query int64 false "当前答案ID"
-// @Param limit query int64 false "返回答案数量限制" default(10)
-// @Success 200 {object} ginx.Result{data=[]AnswerVo} "成功返回答案列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[AnswerVo]} "成功返回答案列表"
 // @Router /answers/list/questions/{questionId} [get]
 func (h *AnswerHandler) ListForQuestion(ctx *gin.Context, req AnswerListReq, uc ijwt.UserClaims) (ginx.Result, error) {
 	qidStr := ctx.Param("questionId")
@@ -208,15 +230,25 @@ func (h *AnswerHandler) ListForQuestion(ctx *gin.Context, req AnswerListReq, uc
 			Msg:  "不合法的answerId",
 		}, err
 	}
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.AnswerInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.answerClient.ListForQuestion(ctx, &answerv1.ListForQuestionRequest{
 		QuestionId:  qid,
-		CurAnswerId: req.CurAnswerId,
-		Limit:       req.Limit,
+		CurAnswerId: cur,
+		Limit:       h.pager.Size(req.Limit) + 1,
 	})
-	answerVos := slice.Map(res.GetAnswers(), func(idx int, src *answerv1.Answer) AnswerVo {
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetAnswers(), func(idx int, src *answerv1.Answer) AnswerVo {
 		return AnswerVo{
 			Id:          src.GetId(),
 			PublisherId: src.GetPublisherId(),
@@ -225,33 +257,11 @@ func (h *AnswerHandler) ListForQuestion(ctx *gin.Context, req AnswerListReq, uc
 			Utime:       src.GetUtime(),
 			Ctime:       src.GetCtime(),
 		}
+	}), func(vo AnswerVo) int64 {
+		return vo.Id
 	})
-	var eg errgroup.Group
-	for i := range answerVos {
-		eg.Go(func() error {
-			commentRes, er := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
-				Biz:   commentv1.Biz_Answer,
-				BizId: answerVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			answerVos[i].TotalCommentCount = commentRes.GetCount()
-			stanceRes, er := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
-				Uid:   uc.Uid,
-				Biz:   stancev1.Biz_Answer,
-				BizId: answerVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			answerVos[i].Stance = int32(stanceRes.GetStance())
-			answerVos[i].TotalSupportCount = stanceRes.GetTotalSupports()
-			answerVos[i].TotalOpposeCount = stanceRes.GetTotalOpposes()
-			return nil
-		})
-	}
-	err = eg.Wait()
+	answerVos := page.Items
+	err = h.aggregateInteractions(ctx, uc.Uid, answerVos)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -260,7 +270,7 @@ func (h *AnswerHandler) ListForQuestion(ctx *gin.Context, req AnswerListReq, uc
 	}
 	return ginx.Result{
 		Msg:  "Success",
-		Data: answerVos,
+		Data: page,
 	}, nil
 }
 
@@ -270,20 +280,30 @@ func (h *AnswerHandler) ListForQuestion(ctx *gin.Context, req AnswerListReq, uc
 // @Tags 回答
 // @Accept json
 // @Produce json
-// @Param cur_answer_id query int64 false "当前答案ID"
-// @Param limit query int64 false "返回答案数量限制" default(10)
-// @Success 200 {object} ginx.Result{data=[]AnswerVo} "成功返回答案列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[AnswerVo]} "成功返回答案列表"
 // @Router /answers/list/mine [get]
 func (h *AnswerHandler) ListForMine(ctx *gin.Context, req AnswerListReq, uc ijwt.UserClaims) (ginx.Result, error) {
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.AnswerInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.answerClient.ListForUser(ctx, &answerv1.ListForUserRequest{
 		Uid:         uc.Uid,
-		CurAnswerId: req.CurAnswerId,
-		Limit:       req.Limit,
+		CurAnswerId: cur,
+		Limit:       h.pager.Size(req.Limit) + 1,
 	})
-	answerVos := slice.Map(res.GetAnswers(), func(idx int, src *answerv1.Answer) AnswerVo {
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetAnswers(), func(idx int, src *answerv1.Answer) AnswerVo {
 		return AnswerVo{
 			Id:          src.GetId(),
 			PublisherId: src.GetPublisherId(),
@@ -292,33 +312,11 @@ func (h *AnswerHandler) ListForMine(ctx *gin.Context, req AnswerListReq, uc ijwt
 			Utime:       src.GetUtime(),
 			Ctime:       src.GetCtime(),
 		}
+	}), func(vo AnswerVo) int64 {
+		return vo.Id
 	})
-	var eg errgroup.Group
-	for i := range answerVos {
-		eg.Go(func() error {
-			commentRes, er := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
-				Biz:   commentv1.Biz_Answer,
-				BizId: answerVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			answerVos[i].TotalCommentCount = commentRes.GetCount()
-			stanceRes, er := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
-				Uid:   uc.Uid,
-				Biz:   stancev1.Biz_Answer,
-				BizId: answerVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			answerVos[i].Stance = int32(stanceRes.GetStance())
-			answerVos[i].TotalSupportCount = stanceRes.GetTotalSupports()
-			answerVos[i].TotalOpposeCount = stanceRes.GetTotalOpposes()
-			return nil
-		})
-	}
-	err = eg.Wait()
+	answerVos := page.Items
+	err = h.aggregateInteractions(ctx, uc.Uid, answerVos)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -327,7 +325,7 @@ func (h *AnswerHandler) ListForMine(ctx *gin.Context, req AnswerListReq, uc ijwt
 	}
 	return ginx.Result{
 		Msg:  "Success",
-		Data: answerVos,
+		Data: page,
 	}, nil
 }
 
@@ -397,3 +395,49 @@ func (h *AnswerHandler) DelAnswer(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Re
 		Msg: "Success",
 	}, nil
 }
+
+// aggregateInteractions 为列表里的回答聚合表态和评论数
+func (h *AnswerHandler) aggregateInteractions(ctx context.Context, uid int64, answerVos []AnswerVo) error {
+	aids := slice.Map(answerVos, func(idx int, src AnswerVo) int64 {
+		return src.Id
+	})
+	g := aggregate.NewGroup(ctx)
+	var (
+		stances  map[int64]*stancev1.GetUserStanceResponse
+		comments map[int64]int64
+	)
+	g.Required("stance.GetUserStance", func(ctx context.Context) error {
+		var er error
+		stances, er = dataloader.NewLoader(func(ctx context.Context, aid int64) (*stancev1.GetUserStanceResponse, error) {
+			return h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
+				Uid:   uid,
+				Biz:   stancev1.Biz_Answer,
+				BizId: aid,
+			})
+		}).LoadMany(ctx, aids)
+		return er
+	})
+	g.Required("comment.CountComment", func(ctx context.Context) error {
+		var er error
+		comments, er = dataloader.NewLoader(func(ctx context.Context, aid int64) (int64, error) {
+			res, err := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
+				Biz:   commentv1.Biz_Answer,
+				BizId: aid,
+			})
+			return res.GetCount(), err
+		}).LoadMany(ctx, aids)
+		return er
+	})
+	_, err := g.Wait()
+	if err != nil {
+		return err
+	}
+	for i := range answerVos {
+		stanceRes := stances[answerVos[i].Id]
+		answerVos[i].Stance = int32(stanceRes.GetStance())
+		answerVos[i].TotalSupportCount = stanceRes.GetTotalSupports()
+		answerVos[i].TotalOpposeCount = stanceRes.GetTotalOpposes()
+		answerVos[i].TotalCommentCount = comments[answerVos[i].Id]
+	}
+	return nil
+}
@@ -1,13 +1,14 @@
 package web
 
+import "github.com/MuxiKeStack/bff/pkg/ginx"
+
 type AnswerPublishReq struct {
 	QuestionId int64  `json:"question_id"`
 	Content    string `json:"content"`
 }
 
 type AnswerListReq struct {
-	CurAnswerId int64 `form:"cur_answer_id"`
-	Limit       int64 `form:"limit"`
+	ginx.PageReq
 }
 
 type AnswerVo struct {
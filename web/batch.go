@@ -0,0 +1,151 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// BatchHandler 一次请求里带多个子请求，在进程内交给 gin 处理，省掉小程序首页的好几次往返。
+// 子请求和直接请求一样会经过所有的中间件，用的是调用方的 token。
+// 子请求的 ctx 继承自 /batch 本身，所以 http.timeout.routes 里给慢接口配的更长的超时不起作用，
+// 最多只有 /batch 的超时（默认的 5s），慢接口请单独调用
+type BatchHandler struct {
+	engine      *gin.Engine
+	maxRequests int
+	concurrency int
+}
+
+func NewBatchHandler(maxRequests, concurrency int) *BatchHandler {
+	return &BatchHandler{maxRequests: maxRequests, concurrency: concurrency}
+}
+
+// 子请求会带上的请求头，其他的不透传，Upgrade 也不会带过去
+var batchForwardHeaders = []string{"Authorization", "User-Agent"}
+
+// batchForbiddenPaths 不能作为子请求的路由。batchRecorder 不支持 Flush 和 Hijack，
+// 长连接的路由在里面跑会 panic，还会占着一个并发名额直到连接超时
+var batchForbiddenPaths = map[string]string{
+	"/batch":       "子请求不能是 /batch",
+	"/feed/stream": "子请求不能是 /feed/stream 这样的长连接",
+}
+
+func (h *BatchHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
+	h.engine = s
+	s.POST("/batch", authMiddleware, ginx.WrapReq(h.Batch))
+}
+
+// @Summary 批量请求
+// @Description 一次执行多个子请求，按顺序返回每个子请求的状态码和结果，单个子请求失败不影响其他的
+// @Tags 批量
+// @Accept json
+// @Produce json
+// @Param request body BatchReq true "子请求"
+// @Success 200 {object} ginx.Result{data=[]BatchItemVo} "Success"
+// @Router /batch [post]
+func (h *BatchHandler) Batch(ctx *gin.Context, req BatchReq) (ginx.Result, error) {
+	if len(req.Requests) == 0 || len(req.Requests) > h.maxRequests {
+		return ginx.Result{
+			Code: errs.BatchInvalidInput,
+			Msg:  fmt.Sprintf("子请求的数量要在 1 到 %d 之间", h.maxRequests),
+		}, fmt.Errorf("子请求的数量不合法: %d", len(req.Requests))
+	}
+	for _, item := range req.Requests {
+		if err := h.validate(item); err != nil {
+			return ginx.Result{
+				Code: errs.BatchInvalidInput,
+				Msg:  err.Error(),
+			}, err
+		}
+	}
+	vos := make([]BatchItemVo, len(req.Requests))
+	g := aggregate.NewGroup(ctx).Limit(h.concurrency)
+	for i, item := range req.Requests {
+		// 子请求之间互不影响，所以这里从不返回 error
+		g.Required("batch", func(c context.Context) error {
+			vos[i] = h.serve(c, ctx.Request, item)
+			return nil
+		})
+	}
+	_, _ = g.Wait()
+	return ginx.Result{
+		Msg:  "Success",
+		Data: vos,
+	}, nil
+}
+
+func (h *BatchHandler) validate(item BatchItemReq) error {
+	switch item.Method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		return fmt.Errorf("不支持的方法: %s", item.Method)
+	}
+	if !strings.HasPrefix(item.Path, "/") || strings.Contains(item.Path, "?") {
+		return fmt.Errorf("不合法的路径: %s", item.Path)
+	}
+	// gin 会把多余的斜杠重定向到规范的路径上，这里按规范的路径比较
+	if msg, ok := batchForbiddenPaths[path.Clean(item.Path)]; ok {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+func (h *BatchHandler) serve(ctx context.Context, parent *http.Request, item BatchItemReq) BatchItemVo {
+	query := make(url.Values, len(item.Query))
+	for key, val := range item.Query {
+		query.Set(key, val)
+	}
+	target := item.Path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	sub, err := http.NewRequestWithContext(ctx, item.Method, target, bytes.NewReader(item.Body))
+	if err != nil {
+		return BatchItemVo{Status: http.StatusBadRequest}
+	}
+	for _, key := range batchForwardHeaders {
+		if val := parent.Header.Get(key); val != "" {
+			sub.Header.Set(key, val)
+		}
+	}
+	if len(item.Body) > 0 {
+		sub.Header.Set("Content-Type", "application/json")
+	}
+	sub.RemoteAddr = parent.RemoteAddr
+	rec := &batchRecorder{header: make(http.Header), status: http.StatusOK}
+	h.engine.ServeHTTP(rec, sub)
+	vo := BatchItemVo{Status: rec.status}
+	if body := rec.body.Bytes(); json.Valid(body) {
+		vo.Result = body
+	}
+	return vo
+}
+
+// batchRecorder 接住子请求的响应，只有状态码和响应体是有用的
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *batchRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *batchRecorder) Write(data []byte) (int, error) {
+	return r.body.Write(data)
+}
+
+func (r *batchRecorder) WriteHeader(code int) {
+	r.status = code
+}
@@ -0,0 +1,84 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchValidate(t *testing.T) {
+	h := NewBatchHandler(10, 2)
+	testCases := []struct {
+		name    string
+		item    BatchItemReq
+		wantErr string
+	}{
+		{name: "普通的 GET", item: BatchItemReq{Method: http.MethodGet, Path: "/users/profile"}},
+		{name: "不支持的方法", item: BatchItemReq{Method: http.MethodPatch, Path: "/users/profile"}, wantErr: "不支持的方法"},
+		{name: "相对路径", item: BatchItemReq{Method: http.MethodGet, Path: "users/profile"}, wantErr: "不合法的路径"},
+		{name: "路径里带查询参数", item: BatchItemReq{Method: http.MethodGet, Path: "/users/profile?a=1"}, wantErr: "不合法的路径"},
+		{name: "套娃", item: BatchItemReq{Method: http.MethodPost, Path: "/batch"}, wantErr: "/batch"},
+		{name: "长连接", item: BatchItemReq{Method: http.MethodGet, Path: "/feed/stream"}, wantErr: "/feed/stream"},
+		{name: "多余的斜杠", item: BatchItemReq{Method: http.MethodGet, Path: "/feed//stream/"}, wantErr: "/feed/stream"},
+		{name: "带点的路径", item: BatchItemReq{Method: http.MethodGet, Path: "/feed/./x/../stream"}, wantErr: "/feed/stream"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := h.validate(tc.item)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("不应该出错，实际是 %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("错误 = %v，期望包含 %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBatchRejectStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	var streamed bool
+	engine.GET("/feed/stream", func(ctx *gin.Context) {
+		// batchRecorder 不是 http.Flusher，真的跑起来会 panic
+		streamed = true
+		ctx.Writer.Flush()
+	})
+	engine.GET("/ping", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"msg": "pong"})
+	})
+	h := NewBatchHandler(10, 2)
+	h.engine = engine
+
+	batch := func(items ...BatchItemReq) (ginx.Result, error) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPost, "/batch", nil)
+		return h.Batch(ctx, BatchReq{Requests: items})
+	}
+
+	res, err := batch(BatchItemReq{Method: http.MethodGet, Path: "/ping"}, BatchItemReq{Method: http.MethodGet, Path: "/feed/stream"})
+	if err == nil || res.Code != errs.BatchInvalidInput {
+		t.Fatalf("带长连接的批量请求应该整体拒绝，实际 code = %d，err = %v", res.Code, err)
+	}
+	if streamed {
+		t.Fatal("被拒绝的批量请求不应该执行任何子请求")
+	}
+
+	res, err = batch(BatchItemReq{Method: http.MethodGet, Path: "/ping"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vos := res.Data.([]BatchItemVo)
+	var body map[string]string
+	if vos[0].Status != http.StatusOK || json.Unmarshal(vos[0].Result, &body) != nil || body["msg"] != "pong" {
+		t.Fatalf("子请求的结果 = %d %s", vos[0].Status, vos[0].Result)
+	}
+}
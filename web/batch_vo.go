@@ -0,0 +1,20 @@
+package web
+
+import "encoding/json"
+
+type BatchReq struct {
+	Requests []BatchItemReq `json:"requests"`
+}
+
+type BatchItemReq struct {
+	Method string            `json:"method"` // GET、POST 等
+	Path   string            `json:"path"`   // 例如 /users/profile，不带查询参数
+	Query  map[string]string `json:"query"`
+	Body   json.RawMessage   `json:"body"`
+}
+
+type BatchItemVo struct {
+	Status int `json:"status"` // 子请求的 HTTP 状态码，比如没登录是 401
+	// 子请求返回的 ginx.Result，不是 json 的时候为空
+	Result json.RawMessage `json:"result"`
+}
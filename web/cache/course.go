@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/cachex"
+	"github.com/ecodeclub/ekit/slice"
+)
+
+type CourseCacheConfig struct {
+	Detail cachex.TTL `yaml:"detail"`
+	Score  cachex.TTL `yaml:"score"`
+	Tags   cachex.TTL `yaml:"tags"`
+}
+
+type TwoLevelCourseCache struct {
+	c          *cachex.ReadThrough
+	course     coursev1.CourseServiceClient
+	evaluation evaluationv1.EvaluationServiceClient
+	tag        tagv1.TagServiceClient
+	cfg        CourseCacheConfig
+}
+
+func NewTwoLevelCourseCache(c *cachex.ReadThrough, course coursev1.CourseServiceClient,
+	evaluation evaluationv1.EvaluationServiceClient, tag tagv1.TagServiceClient, cfg CourseCacheConfig) CourseCache {
+	return &TwoLevelCourseCache{
+		c:          c,
+		course:     course,
+		evaluation: evaluation,
+		tag:        tag,
+		cfg:        cfg,
+	}
+}
+
+func (t *TwoLevelCourseCache) GetDetail(ctx context.Context, courseId int64) (*coursev1.Course, error) {
+	return cachex.Get(ctx, t.c, t.detailKey(courseId), t.cfg.Detail, func(ctx context.Context) (*coursev1.Course, error) {
+		res, err := t.course.GetDetailById(ctx, &coursev1.GetDetailByIdRequest{
+			CourseId: courseId,
+		})
+		return res.GetCourse(), err
+	})
+}
+
+func (t *TwoLevelCourseCache) GetCompositeScore(ctx context.Context, courseId int64) (CompositeScore, error) {
+	return cachex.Get(ctx, t.c, t.scoreKey(courseId), t.cfg.Score, func(ctx context.Context) (CompositeScore, error) {
+		res, err := t.evaluation.CompositeScoreCourse(ctx, &evaluationv1.CompositeScoreCourseRequest{
+			CourseId: courseId,
+		})
+		return CompositeScore{
+			Score:      res.GetScore(),
+			RaterCount: res.GetRaterCount(),
+		}, err
+	})
+}
+
+func (t *TwoLevelCourseCache) GetTags(ctx context.Context, courseId int64) (CourseTags, error) {
+	return cachex.Get(ctx, t.c, t.tagsKey(courseId), t.cfg.Tags, func(ctx context.Context) (CourseTags, error) {
+		// evaluation 找出courseId可见的uid ，然后在tag courseId中根据这些uid来找
+		publishersRes, err := t.evaluation.VisiblePublishersCourse(ctx, &evaluationv1.VisiblePublishersCourseRequest{
+			CourseId: courseId,
+		})
+		if err != nil {
+			return CourseTags{}, err
+		}
+		g := aggregate.NewGroup(ctx)
+		var (
+			caRes *tagv1.CountAssessmentTagsByCourseTaggerResponse
+			cfRes *tagv1.CountFeatureTagsByCourseTaggerResponse
+		)
+		g.Required("tag.CountAssessmentTagsByCourseTagger", func(ctx context.Context) error {
+			var er error
+			caRes, er = t.tag.CountAssessmentTagsByCourseTagger(ctx, &tagv1.CountAssessmentTagsByCourseTaggerRequest{
+				CourseId:  courseId,
+				TaggerIds: publishersRes.GetPublishers(),
+			})
+			return er
+		})
+		g.Required("tag.CountFeatureTagsByCourseTagger", func(ctx context.Context) error {
+			var er error
+			cfRes, er = t.tag.CountFeatureTagsByCourseTagger(ctx, &tagv1.CountFeatureTagsByCourseTaggerRequest{
+				CourseId:  courseId,
+				TaggerIds: publishersRes.GetPublishers(),
+			})
+			return er
+		})
+		_, err = g.Wait()
+		if err != nil {
+			return CourseTags{}, err
+		}
+		return CourseTags{
+			Assessments: slice.ToMapV(caRes.GetItems(), func(element *tagv1.CountAssessmentItem) (string, int64) {
+				return element.GetTag().String(), element.GetCount()
+			}),
+			Features: slice.ToMapV(cfRes.GetItems(), func(element *tagv1.CountFeatureItem) (string, int64) {
+				return element.GetTag().String(), element.GetCount()
+			}),
+		}, nil
+	})
+}
+
+func (t *TwoLevelCourseCache) Invalidate(ctx context.Context, courseId int64) error {
+	return t.c.Delete(ctx, t.scoreKey(courseId), t.tagsKey(courseId))
+}
+
+func (t *TwoLevelCourseCache) detailKey(courseId int64) string {
+	return fmt.Sprintf("kstack:bff:courses:%d:detail", courseId)
+}
+
+func (t *TwoLevelCourseCache) scoreKey(courseId int64) string {
+	return fmt.Sprintf("kstack:bff:courses:%d:score", courseId)
+}
+
+func (t *TwoLevelCourseCache) tagsKey(courseId int64) string {
+	return fmt.Sprintf("kstack:bff:courses:%d:tags", courseId)
+}
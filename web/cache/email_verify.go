@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+var (
+	ErrEmailTooFrequent = errors.New("验证码发送太频繁")
+	ErrEmailCodeInvalid = errors.New("验证码不对或者已经过期")
+)
+
+type EmailVerifyConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+	// ResendInterval 两次发送验证码的最小间隔
+	ResendInterval time.Duration `yaml:"resendInterval"`
+	// MaxAttempts 错这么多次之后验证码作废
+	MaxAttempts int `yaml:"maxAttempts"`
+}
+
+type emailCode struct {
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// RedisEmailVerification 每个用户同时只有一个有效的验证码，重新发送会覆盖上一个。
+// 输错的次数单独用一个计数器，INCR 是原子的，并发地猜也绕不过 MaxAttempts
+type RedisEmailVerification struct {
+	cmd redis.Cmdable
+	cfg EmailVerifyConfig
+}
+
+func NewRedisEmailVerification(cmd redis.Cmdable, cfg EmailVerifyConfig) EmailVerification {
+	return &RedisEmailVerification{cmd: cmd, cfg: cfg}
+}
+
+func (r *RedisEmailVerification) Save(ctx context.Context, uid int64, email string, code string) error {
+	ok, err := r.cmd.SetNX(ctx, r.lockKey(uid), 1, r.cfg.ResendInterval).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrEmailTooFrequent
+	}
+	data, err := json.Marshal(emailCode{Email: email, Code: code})
+	if err != nil {
+		return err
+	}
+	// 新的验证码重新计数
+	if err = r.cmd.Del(ctx, r.attemptsKey(uid)).Err(); err != nil {
+		return err
+	}
+	return r.cmd.Set(ctx, r.key(uid), data, r.cfg.TTL).Err()
+}
+
+func (r *RedisEmailVerification) Verify(ctx context.Context, uid int64, code string) (string, error) {
+	data, err := r.cmd.Get(ctx, r.key(uid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrEmailCodeInvalid
+	}
+	if err != nil {
+		return "", err
+	}
+	var ec emailCode
+	if err = json.Unmarshal(data, &ec); err != nil {
+		return "", err
+	}
+	// 先占一次尝试次数再比较，对的那次也算
+	attempts, err := r.cmd.Incr(ctx, r.attemptsKey(uid)).Result()
+	if err != nil {
+		return "", err
+	}
+	if attempts == 1 {
+		// 计数器最多和验证码活得一样久
+		if err = r.cmd.Expire(ctx, r.attemptsKey(uid), r.cfg.TTL).Err(); err != nil {
+			return "", err
+		}
+	}
+	if attempts > int64(r.cfg.MaxAttempts) {
+		// 次数用完了，并发的请求里只有前 MaxAttempts 个能比较，用完的那个会把验证码删掉
+		return "", ErrEmailCodeInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(ec.Code), []byte(code)) == 1 {
+		return ec.Email, r.cmd.Del(ctx, r.key(uid), r.attemptsKey(uid)).Err()
+	}
+	if attempts == int64(r.cfg.MaxAttempts) {
+		if err = r.cmd.Del(ctx, r.key(uid)).Err(); err != nil {
+			return "", err
+		}
+	}
+	return "", ErrEmailCodeInvalid
+}
+
+func (r *RedisEmailVerification) key(uid int64) string {
+	return fmt.Sprintf("kstack:email_verify:%d", uid)
+}
+
+func (r *RedisEmailVerification) attemptsKey(uid int64) string {
+	return fmt.Sprintf("kstack:email_verify_attempts:%d", uid)
+}
+
+func (r *RedisEmailVerification) lockKey(uid int64) string {
+	return fmt.Sprintf("kstack:email_verify_lock:%d", uid)
+}
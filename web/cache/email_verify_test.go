@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/MuxiKeStack/bff/fakes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestEmailVerification() EmailVerification {
+	return NewRedisEmailVerification(fakes.NewRedis(), EmailVerifyConfig{
+		TTL:            time.Minute,
+		ResendInterval: time.Millisecond,
+		MaxAttempts:    3,
+	})
+}
+
+func TestEmailVerify(t *testing.T) {
+	ctx := context.Background()
+	v := newTestEmailVerification()
+	if err := v.Save(ctx, 1, "a@ccnu.edu.cn", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Save(ctx, 1, "a@ccnu.edu.cn", "654321"); !errors.Is(err, ErrEmailTooFrequent) {
+		t.Fatalf("马上重发应该返回 ErrEmailTooFrequent，实际是 %v", err)
+	}
+	if _, err := v.Verify(ctx, 1, "000000"); !errors.Is(err, ErrEmailCodeInvalid) {
+		t.Fatalf("错误的验证码应该返回 ErrEmailCodeInvalid，实际是 %v", err)
+	}
+	addr, err := v.Verify(ctx, 1, "123456")
+	if err != nil || addr != "a@ccnu.edu.cn" {
+		t.Fatalf("Verify = %q, %v", addr, err)
+	}
+	if _, err = v.Verify(ctx, 1, "123456"); !errors.Is(err, ErrEmailCodeInvalid) {
+		t.Fatal("验证码只能用一次")
+	}
+}
+
+func TestEmailVerifyMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	v := newTestEmailVerification()
+	v.Save(ctx, 1, "a@ccnu.edu.cn", "123456")
+	for i := 0; i < 3; i++ {
+		v.Verify(ctx, 1, "000000")
+	}
+	if _, err := v.Verify(ctx, 1, "123456"); !errors.Is(err, ErrEmailCodeInvalid) {
+		t.Fatal("输错 MaxAttempts 次之后验证码应该作废")
+	}
+
+	// 重新发送之后重新计数
+	time.Sleep(2 * time.Millisecond)
+	v.Save(ctx, 1, "a@ccnu.edu.cn", "654321")
+	v.Verify(ctx, 1, "000000")
+	if _, err := v.Verify(ctx, 1, "654321"); err != nil {
+		t.Fatalf("新的验证码应该能用，实际是 %v", err)
+	}
+}
+
+func TestEmailVerifyConcurrentGuesses(t *testing.T) {
+	ctx := context.Background()
+	v := newTestEmailVerification()
+	v.Save(ctx, 1, "a@ccnu.edu.cn", "123456")
+
+	// 并发地猜，最多只有 MaxAttempts 次真正拿去比较
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v.Verify(ctx, 1, "000000")
+		}()
+	}
+	wg.Wait()
+	if _, err := v.Verify(ctx, 1, "123456"); !errors.Is(err, ErrEmailCodeInvalid) {
+		t.Fatal("并发输错之后验证码应该作废")
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+)
+
+const (
+	feedReadAllField    = "all"
+	feedReadTypePrefix  = "type:"
+	feedReadEventPrefix = "id:"
+	// 单独标记已读的事件最多记这么多条，和未读数往前数的条数一样
+	feedReadMaxEvents = 200
+)
+
+var (
+	//go:embed lua/feed_read_mark_all.lua
+	luaFeedReadMarkAll string
+	//go:embed lua/feed_read_mark_type.lua
+	luaFeedReadMarkType string
+	//go:embed lua/feed_read_mark_event.lua
+	luaFeedReadMarkEvent string
+
+	feedReadMarkAll   = redis.NewScript(luaFeedReadMarkAll)
+	feedReadMarkType  = redis.NewScript(luaFeedReadMarkType)
+	feedReadMarkEvent = redis.NewScript(luaFeedReadMarkEvent)
+)
+
+// RedisFeedReadState 每个用户一个 hash：all 是全部已读的游标，type:{type} 是某类事件的游标，
+// 游标都是事件的 ctime；id:{id} 是游标之后单独标记已读的事件，最多 feedReadMaxEvents 条
+type RedisFeedReadState struct {
+	cmd redis.Cmdable
+}
+
+func NewRedisFeedReadState(cmd redis.Cmdable) FeedReadState {
+	return &RedisFeedReadState{cmd: cmd}
+}
+
+func (r *RedisFeedReadState) Get(ctx context.Context, uid int64) (FeedReadCursor, error) {
+	fields, err := r.cmd.HGetAll(ctx, r.key(uid)).Result()
+	if err != nil {
+		return FeedReadCursor{}, err
+	}
+	cursor := FeedReadCursor{
+		Types:  make(map[string]int64),
+		Events: make(map[int64]struct{}),
+	}
+	for field, val := range fields {
+		switch {
+		case field == feedReadAllField:
+			cursor.All, _ = strconv.ParseInt(val, 10, 64)
+		case strings.HasPrefix(field, feedReadTypePrefix):
+			cursor.Types[strings.TrimPrefix(field, feedReadTypePrefix)], _ = strconv.ParseInt(val, 10, 64)
+		case strings.HasPrefix(field, feedReadEventPrefix):
+			id, er := strconv.ParseInt(strings.TrimPrefix(field, feedReadEventPrefix), 10, 64)
+			if er == nil {
+				cursor.Events[id] = struct{}{}
+			}
+		}
+	}
+	return cursor, nil
+}
+
+// MarkAll 几个 Mark 都用 lua 脚本比较之后再写，并发的请求不会让游标往回退
+func (r *RedisFeedReadState) MarkAll(ctx context.Context, uid int64, ctime int64) error {
+	return feedReadMarkAll.Run(ctx, r.cmd, []string{r.key(uid)}, ctime).Err()
+}
+
+func (r *RedisFeedReadState) MarkType(ctx context.Context, uid int64, typ string, ctime int64) error {
+	return feedReadMarkType.Run(ctx, r.cmd, []string{r.key(uid)}, feedReadTypePrefix+typ, ctime).Err()
+}
+
+func (r *RedisFeedReadState) MarkEvent(ctx context.Context, uid int64, eventId int64) error {
+	return feedReadMarkEvent.Run(ctx, r.cmd, []string{r.key(uid)}, eventId, feedReadMaxEvents).Err()
+}
+
+func (r *RedisFeedReadState) key(uid int64) string {
+	return fmt.Sprintf("kstack:feed_read:%d", uid)
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/fakes"
+	"testing"
+)
+
+func TestFeedReadStateMark(t *testing.T) {
+	ctx := context.Background()
+	state := NewRedisFeedReadState(fakes.NewRedis())
+	const uid = 1
+
+	if err := state.MarkType(ctx, uid, "comment", 100); err != nil {
+		t.Fatal(err)
+	}
+	state.MarkType(ctx, uid, "support", 300)
+	state.MarkEvent(ctx, uid, 7)
+	if err := state.MarkAll(ctx, uid, 200); err != nil {
+		t.Fatal(err)
+	}
+	// 并发的请求里较早的那个后到，游标也不能往回退
+	state.MarkAll(ctx, uid, 150)
+	state.MarkType(ctx, uid, "reply", 180)
+	state.MarkType(ctx, uid, "support", 250)
+
+	cursor, err := state.Get(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.All != 200 {
+		t.Fatalf("All = %d，期望 200", cursor.All)
+	}
+	// comment 被全部已读覆盖，清掉了；reply 比全部已读旧，不用记；support 比较新，保留
+	if len(cursor.Types) != 1 || cursor.Types["support"] != 300 {
+		t.Fatalf("Types = %v，期望只有 support:300", cursor.Types)
+	}
+	if len(cursor.Events) != 0 {
+		t.Fatalf("全部已读之后单独标记的事件应该清掉，实际是 %v", cursor.Events)
+	}
+}
+
+func TestFeedReadStateMarkEventBounded(t *testing.T) {
+	ctx := context.Background()
+	state := NewRedisFeedReadState(fakes.NewRedis())
+	const uid = 1
+
+	for id := int64(feedReadMaxEvents + 10); id > 0; id-- {
+		if err := state.MarkEvent(ctx, uid, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cursor, err := state.Get(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cursor.Events) != feedReadMaxEvents {
+		t.Fatalf("单独标记的事件有 %d 条，期望 %d", len(cursor.Events), feedReadMaxEvents)
+	}
+	// 去掉的是 id 最小的
+	if _, ok := cursor.Events[10]; ok {
+		t.Fatal("id 为 10 的事件应该被去掉")
+	}
+	if _, ok := cursor.Events[11]; !ok {
+		t.Fatal("id 为 11 的事件应该还在")
+	}
+}
@@ -0,0 +1,21 @@
+-- feed_read_mark_all
+-- KEYS[1] 已读状态的 hash，ARGV[1] 新的全部已读游标
+-- 游标只能往前推，推进之后清掉被它覆盖的类型游标和单独标记的事件
+local key = KEYS[1]
+local ctime = tonumber(ARGV[1])
+local all = tonumber(redis.call('HGET', key, 'all') or '0')
+if all >= ctime then
+    return 0
+end
+redis.call('HSET', key, 'all', ARGV[1])
+local fields = redis.call('HGETALL', key)
+for i = 1, #fields, 2 do
+    local field = fields[i]
+    if string.sub(field, 1, 3) == 'id:' then
+        -- 单独标记的事件不知道 ctime，游标推进之后一律清掉
+        redis.call('HDEL', key, field)
+    elseif string.sub(field, 1, 5) == 'type:' and tonumber(fields[i + 1]) <= ctime then
+        redis.call('HDEL', key, field)
+    end
+end
+return 1
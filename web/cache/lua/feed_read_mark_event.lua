@@ -0,0 +1,20 @@
+-- feed_read_mark_event
+-- KEYS[1] 已读状态的 hash，ARGV[1] 事件 id，ARGV[2] 最多保留多少条单独标记的事件
+-- 超过上限时去掉 id 最小（最早）的，它们早就数不到未读数里了
+local key = KEYS[1]
+redis.call('HSET', key, 'id:' .. ARGV[1], 1)
+local ids = {}
+for _, field in ipairs(redis.call('HKEYS', key)) do
+    if string.sub(field, 1, 3) == 'id:' then
+        table.insert(ids, { id = tonumber(string.sub(field, 4)), field = field })
+    end
+end
+local extra = #ids - tonumber(ARGV[2])
+if extra <= 0 then
+    return 0
+end
+table.sort(ids, function(a, b) return a.id < b.id end)
+for i = 1, extra do
+    redis.call('HDEL', key, ids[i].field)
+end
+return extra
@@ -0,0 +1,12 @@
+-- feed_read_mark_type
+-- KEYS[1] 已读状态的 hash，ARGV[1] 类型游标的 field，ARGV[2] 新的游标
+-- 游标只能往前推，已经被全部已读覆盖的不用再记
+local key = KEYS[1]
+local ctime = tonumber(ARGV[2])
+local all = tonumber(redis.call('HGET', key, 'all') or '0')
+local cur = tonumber(redis.call('HGET', key, ARGV[1]) or '0')
+if all >= ctime or cur >= ctime then
+    return 0
+end
+redis.call('HSET', key, ARGV[1], ARGV[2])
+return 1
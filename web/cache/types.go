@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	"time"
+)
+
+// CourseCache 课程详情页的热点聚合数据
+type CourseCache interface {
+	GetDetail(ctx context.Context, courseId int64) (*coursev1.Course, error)
+	GetCompositeScore(ctx context.Context, courseId int64) (CompositeScore, error)
+	// GetTags 只统计可见课评发布者打的标签
+	GetTags(ctx context.Context, courseId int64) (CourseTags, error)
+	// Invalidate 发布或修改课评（Save）、在公开和不公开之间切换课评（UpdateStatus）之后都要调用，
+	// 以后加删除课评之类会改变可见课评的操作也要调用。课程本身的信息不受课评影响，所以不会失效
+	Invalidate(ctx context.Context, courseId int64) error
+}
+
+type CompositeScore struct {
+	Score      float64
+	RaterCount int64
+}
+
+type CourseTags struct {
+	Assessments map[string]int64 // 标签:数量
+	Features    map[string]int64
+}
+
+// FeedReadState feed 的已读状态，游标都是事件的 ctime
+type FeedReadState interface {
+	Get(ctx context.Context, uid int64) (FeedReadCursor, error)
+	// MarkAll ctime 及之前的事件全部已读
+	MarkAll(ctx context.Context, uid int64, ctime int64) error
+	// MarkType ctime 及之前的 typ 类事件已读
+	MarkType(ctx context.Context, uid int64, typ string, ctime int64) error
+	MarkEvent(ctx context.Context, uid int64, eventId int64) error
+}
+
+type FeedReadCursor struct {
+	All    int64
+	Types  map[string]int64
+	Events map[int64]struct{}
+}
+
+func (c FeedReadCursor) IsRead(evt *feedv1.FeedEvent) bool {
+	if evt.GetCtime() <= c.All || evt.GetCtime() <= c.Types[evt.GetType()] {
+		return true
+	}
+	_, ok := c.Events[evt.GetId()]
+	return ok
+}
+
+// UserSettingsStore 用户的个人设置
+type UserSettingsStore interface {
+	Get(ctx context.Context, uid int64) (UserSettings, error)
+	Set(ctx context.Context, uid int64, settings UserSettings) error
+	// ListDigest 开了邮件摘要的用户，uid 到 DigestDaily 或者 DigestWeekly
+	ListDigest(ctx context.Context) (map[int64]string, error)
+}
+
+// 通知的分类，在 feed.types.<type>.setting 里配置每类事件属于哪一类，没配置的总是通知
+const (
+	NotifyComment    = "comment"    // 评论了我的课评、回答
+	NotifyReply      = "reply"      // 回复了我的评论
+	NotifyStance     = "stance"     // 赞同、反对
+	NotifyInvitation = "invitation" // 邀请我回答问题
+)
+
+// 免打扰时段按北京时间算
+var quietHoursZone = time.FixedZone("CST", 8*60*60)
+
+const QuietHoursLayout = "15:04"
+
+// 邮件摘要的频率
+const (
+	DigestOff    = ""
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+type UserSettings struct {
+	Notifications NotificationSettings `json:"notifications"`
+	QuietHours    QuietHours           `json:"quiet_hours"`
+	Privacy       PrivacySettings      `json:"privacy"`
+	Email         EmailSettings        `json:"email"`
+}
+
+// DefaultUserSettings 所有通知都打开，没有免打扰，公开主页
+func DefaultUserSettings() UserSettings {
+	return UserSettings{
+		Notifications: NotificationSettings{
+			Comment:    true,
+			Reply:      true,
+			Stance:     true,
+			Invitation: true,
+		},
+		QuietHours: QuietHours{
+			Start: "23:00",
+			End:   "07:00",
+		},
+	}
+}
+
+type NotificationSettings struct {
+	Comment    bool `json:"comment"`
+	Reply      bool `json:"reply"`
+	Stance     bool `json:"stance"`
+	Invitation bool `json:"invitation"`
+}
+
+// Enabled 不认识的分类总是通知
+func (n NotificationSettings) Enabled(category string) bool {
+	switch category {
+	case NotifyComment:
+		return n.Comment
+	case NotifyReply:
+		return n.Reply
+	case NotifyStance:
+		return n.Stance
+	case NotifyInvitation:
+		return n.Invitation
+	default:
+		return true
+	}
+}
+
+// QuietHours 免打扰时段，这段时间内不实时推送，结束后补发。Start 晚于 End 表示跨天
+type QuietHours struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"` // 15:04 格式
+	End     string `json:"end"`
+}
+
+func (q QuietHours) Contains(t time.Time) bool {
+	if !q.Enabled {
+		return false
+	}
+	start, err := time.Parse(QuietHoursLayout, q.Start)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse(QuietHoursLayout, q.End)
+	if err != nil {
+		return false
+	}
+	t = t.In(quietHoursZone)
+	cur := t.Hour()*60 + t.Minute()
+	from, to := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from <= to {
+		return cur >= from && cur < to
+	}
+	return cur >= from || cur < to
+}
+
+type PrivacySettings struct {
+	// HideProfile 别人看不到我的昵称和头像
+	HideProfile bool `json:"hide_profile"`
+}
+
+// ProfileHidden 给别人展示 uid 的昵称和头像之前都要先查这个：主页、feed、GraphQL、邀请列表用的是同一个判断
+func ProfileHidden(ctx context.Context, store UserSettingsStore, uid int64) (bool, error) {
+	settings, err := store.Get(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	return settings.Privacy.HideProfile, nil
+}
+
+type EmailSettings struct {
+	// Address 验证过的邮箱，没绑定时为空
+	Address string `json:"address"`
+	Digest  string `json:"digest"`
+}
+
+// DigestEnabled 绑定了邮箱并且选了频率
+func (e EmailSettings) DigestEnabled() bool {
+	return e.Address != "" && e.Digest != DigestOff
+}
+
+// EmailVerification 绑定邮箱时的验证码
+type EmailVerification interface {
+	// Save 发送验证码之前调用，距离上次发送太近时返回 ErrEmailTooFrequent
+	Save(ctx context.Context, uid int64, email string, code string) error
+	// Verify 验证通过返回要绑定的邮箱，验证码只能用一次；不对或者过期返回 ErrEmailCodeInvalid
+	Verify(ctx context.Context, uid int64, code string) (string, error)
+}
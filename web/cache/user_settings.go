@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+const userSettingsDigestKey = "kstack:email_digest"
+
+// RedisUserSettings 设置不过期，没设置过的用户返回默认值。
+// 另外在 kstack:email_digest 这个 hash 里维护开了邮件摘要的用户，发摘要时不用扫所有人的设置
+type RedisUserSettings struct {
+	cmd redis.Cmdable
+}
+
+func NewRedisUserSettings(cmd redis.Cmdable) UserSettingsStore {
+	return &RedisUserSettings{cmd: cmd}
+}
+
+func (r *RedisUserSettings) Get(ctx context.Context, uid int64) (UserSettings, error) {
+	data, err := r.cmd.Get(ctx, r.key(uid)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return DefaultUserSettings(), nil
+	}
+	if err != nil {
+		return UserSettings{}, err
+	}
+	// 先填默认值，以后加的字段老数据里没有
+	settings := DefaultUserSettings()
+	err = json.Unmarshal(data, &settings)
+	return settings, err
+}
+
+func (r *RedisUserSettings) Set(ctx context.Context, uid int64, settings UserSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err = r.cmd.Set(ctx, r.key(uid), data, 0).Err(); err != nil {
+		return err
+	}
+	field := strconv.FormatInt(uid, 10)
+	if settings.Email.DigestEnabled() {
+		return r.cmd.HSet(ctx, userSettingsDigestKey, field, settings.Email.Digest).Err()
+	}
+	return r.cmd.HDel(ctx, userSettingsDigestKey, field).Err()
+}
+
+func (r *RedisUserSettings) ListDigest(ctx context.Context) (map[int64]string, error) {
+	fields, err := r.cmd.HGetAll(ctx, userSettingsDigestKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int64]string, len(fields))
+	for field, digest := range fields {
+		uid, er := strconv.ParseInt(field, 10, 64)
+		if er != nil {
+			continue
+		}
+		res[uid] = digest
+	}
+	return res, nil
+}
+
+func (r *RedisUserSettings) key(uid int64) string {
+	return fmt.Sprintf("kstack:user_settings:%d", uid)
+}
@@ -3,15 +3,17 @@ package client
 import (
 	"context"
 	ccnuv1 "github.com/MuxiKeStack/be-api/gen/proto/ccnu/v1"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
 	"google.golang.org/grpc"
 )
 
 type RetryCCNUClient struct {
 	ccnuv1.CCNUServiceClient
-	retryCnt int
+	// 重试次数可以动态修改
+	retryCnt *dynconf.Value[int]
 }
 
-func NewRetryCCNUClient(CCNUServiceClient ccnuv1.CCNUServiceClient, retryCnt int) *RetryCCNUClient {
+func NewRetryCCNUClient(CCNUServiceClient ccnuv1.CCNUServiceClient, retryCnt *dynconf.Value[int]) *RetryCCNUClient {
 	return &RetryCCNUClient{CCNUServiceClient: CCNUServiceClient, retryCnt: retryCnt}
 }
 
@@ -20,7 +22,7 @@ func (r *RetryCCNUClient) Login(ctx context.Context, in *ccnuv1.LoginRequest, op
 		res *ccnuv1.LoginResponse
 		err error
 	)
-	for i := 0; i < r.retryCnt; i++ {
+	for i := 0; i < r.retryCnt.Load(); i++ {
 		res, err = r.CCNUServiceClient.Login(ctx, in, opts...)
 		if err == nil || ccnuv1.IsInvalidSidOrPwd(err) {
 			return res, err
@@ -4,7 +4,9 @@ import (
 	"errors"
 	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
@@ -13,10 +15,13 @@ import (
 
 type CommentHandler struct {
 	commentClient commentv1.CommentServiceClient
+	producer      events.Producer
+	pager         *ginx.Pager
+	l             logger.Logger
 }
 
-func NewCommentHandler(commentClient commentv1.CommentServiceClient) *CommentHandler {
-	return &CommentHandler{commentClient: commentClient}
+func NewCommentHandler(commentClient commentv1.CommentServiceClient, producer events.Producer, pager *ginx.Pager, l logger.Logger) *CommentHandler {
+	return &CommentHandler{commentClient: commentClient, producer: producer, pager: pager, l: l}
 }
 
 func (h *CommentHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
@@ -76,6 +81,18 @@ func (h *CommentHandler) Publish(ctx *gin.Context, req CommentPublishReq, uc ijw
 			Msg:  "系统异常",
 		}, err
 	}
+	// 失败了只打日志，不影响发布
+	err = events.Produce(ctx, h.producer, uc.Uid, events.CommentCreated{
+		Biz:           req.Biz,
+		BizId:         req.BizId,
+		CommentatorId: uc.Uid,
+		RootId:        req.RootId,
+		ParentId:      req.ParentId,
+		Content:       req.Content,
+	})
+	if err != nil {
+		h.l.Error("发送评论事件失败", logger.Error(err), logger.String("biz", req.Biz), logger.Int64("bizId", req.BizId))
+	}
 	return ginx.Result{
 		Msg: "Success",
 	}, nil
@@ -89,9 +106,9 @@ func (h *CommentHandler) Publish(ctx *gin.Context, req CommentPublishReq, uc ijw
 // @Produce json
 // @Param biz query string true "业务类型"
 // @Param biz_id query int64 true "业务ID"
-// @Param cur_comment_id query int64 false "当前评论ID"
-// @Param limit query int64 false "返回数量限制"
-// @Success 200 {object} ginx.Result{data=[]CommentVo} "成功返回评论列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[CommentVo]} "成功返回评论列表"
 // @Router /comments/list [get]
 func (h *CommentHandler) List(ctx *gin.Context, req CommentListReq) (ginx.Result, error) {
 	biz, ok := commentv1.Biz_value[req.Biz]
@@ -101,14 +118,19 @@ func (h *CommentHandler) List(ctx *gin.Context, req CommentListReq) (ginx.Result
 			Msg:  "不合法的Biz(资源)类型",
 		}, errors.New("不合法的Biz(资源)类型")
 	}
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
+	// 多查一条，用来判断还有没有下一页
 	res, err := h.commentClient.GetCommentList(ctx, &commentv1.CommentListRequest{
 		Biz:          commentv1.Biz(biz),
 		BizId:        req.BizId,
-		CurCommentId: req.CurCommentId,
-		Limit:        req.Limit,
+		CurCommentId: cur,
+		Limit:        h.pager.Size(req.Limit) + 1,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -118,7 +140,7 @@ func (h *CommentHandler) List(ctx *gin.Context, req CommentListReq) (ginx.Result
 	}
 	return ginx.Result{
 		Msg: "Success",
-		Data: slice.Map(res.GetComments(), func(idx int, src *commentv1.Comment) CommentVo {
+		Data: ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetComments(), func(idx int, src *commentv1.Comment) CommentVo {
 			return CommentVo{
 				Id:              src.GetId(),
 				CommentatorId:   src.GetCommentatorId(),
@@ -131,6 +153,8 @@ func (h *CommentHandler) List(ctx *gin.Context, req CommentListReq) (ginx.Result
 				Utime:           src.GetUtime(),
 				Ctime:           src.GetCtime(),
 			}
+		}), func(vo CommentVo) int64 {
+			return vo.Id
 		}),
 	}, nil
 }
@@ -142,18 +166,22 @@ func (h *CommentHandler) List(ctx *gin.Context, req CommentListReq) (ginx.Result
 // @Accept json
 // @Produce json
 // @Param root_id query int64 true "根评论ID"
-// @Param cur_comment_id query int64 false "当前评论ID"
-// @Param limit query int64 false "返回数量限制"
-// @Success 200 {object} ginx.Result{data=[]CommentVo} "成功返回评论列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[CommentVo]} "成功返回评论列表"
 // @Router /comments/replies/list [get]
 func (h *CommentHandler) ListReplies(ctx *gin.Context, req CommentListReliesReq) (ginx.Result, error) {
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.CommentInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.commentClient.GetMoreReplies(ctx, &commentv1.GetMoreRepliesRequest{
 		Rid:          req.RootId,
-		CurCommentId: req.CurCommentId,
-		Limit:        req.Limit,
+		CurCommentId: cur,
+		Limit:        h.pager.Size(req.Limit) + 1,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -163,7 +191,7 @@ func (h *CommentHandler) ListReplies(ctx *gin.Context, req CommentListReliesReq)
 	}
 	return ginx.Result{
 		Msg: "Success",
-		Data: slice.Map(res.GetReplies(), func(idx int, src *commentv1.Comment) CommentVo {
+		Data: ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetReplies(), func(idx int, src *commentv1.Comment) CommentVo {
 			return CommentVo{
 				Id:              src.GetId(),
 				CommentatorId:   src.GetCommentatorId(),
@@ -176,6 +204,8 @@ func (h *CommentHandler) ListReplies(ctx *gin.Context, req CommentListReliesReq)
 				Utime:           src.GetUtime(),
 				Ctime:           src.GetCtime(),
 			}
+		}), func(vo CommentVo) int64 {
+			return vo.Id
 		}),
 	}, nil
 }
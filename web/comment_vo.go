@@ -1,5 +1,7 @@
 package web
 
+import "github.com/MuxiKeStack/bff/pkg/ginx"
+
 type CommentPublishReq struct {
 	Biz      string `json:"biz"`
 	BizId    int64  `json:"biz_id"`
@@ -9,10 +11,9 @@ type CommentPublishReq struct {
 }
 
 type CommentListReq struct {
-	Biz          string `form:"biz"`
-	BizId        int64  `form:"biz_id"`
-	CurCommentId int64  `form:"cur_comment_id"`
-	Limit        int64  `form:"limit"`
+	Biz   string `form:"biz"`
+	BizId int64  `form:"biz_id"`
+	ginx.PageReq
 }
 
 type CommentVo struct {
@@ -29,9 +30,8 @@ type CommentVo struct {
 }
 
 type CommentListReliesReq struct {
-	RootId       int64 `form:"root_id"`
-	CurCommentId int64 `form:"cur_comment_id"`
-	Limit        int64 `form:"limit"`
+	RootId int64 `form:"root_id"`
+	ginx.PageReq
 }
 
 type CommentCountReq struct {
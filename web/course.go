@@ -1,6 +1,7 @@
 package web
 
 import (
+	"context"
 	ccnuv1 "github.com/MuxiKeStack/be-api/gen/proto/ccnu/v1"
 	collectv1 "github.com/MuxiKeStack/be-api/gen/proto/collect/v1"
 	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
@@ -8,12 +9,14 @@ import (
 	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
 	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/dataloader"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
 	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/sync/errgroup"
 	"strconv"
 )
 
@@ -24,20 +27,25 @@ type CourseHandler struct {
 	user       userv1.UserServiceClient
 	tag        tagv1.TagServiceClient
 	collect    collectv1.CollectServiceClient
-	l          logger.Logger
+	// 详情、综合评分、标签这些热点数据走缓存
+	courseCache cache.CourseCache
+	pager       *ginx.Pager
+	l           logger.Logger
 }
 
 func NewCourseHandler(handler ijwt.Handler, course coursev1.CourseServiceClient,
 	evaluation evaluationv1.EvaluationServiceClient, user userv1.UserServiceClient, tag tagv1.TagServiceClient,
-	l logger.Logger, collect collectv1.CollectServiceClient) *CourseHandler {
+	l logger.Logger, collect collectv1.CollectServiceClient, courseCache cache.CourseCache, pager *ginx.Pager) *CourseHandler {
 	return &CourseHandler{
-		Handler:    handler,
-		course:     course,
-		evaluation: evaluation,
-		user:       user,
-		tag:        tag,
-		collect:    collect,
-		l:          l,
+		Handler:     handler,
+		course:      course,
+		evaluation:  evaluation,
+		user:        user,
+		tag:         tag,
+		collect:     collect,
+		courseCache: courseCache,
+		pager:       pager,
+		l:           l,
 	}
 }
 
@@ -84,24 +92,20 @@ func (h *CourseHandler) List(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result,
 			}
 		})
 		// 这里要去聚合课评服务
-		var eg errgroup.Group
-		// 基于go1.22的新特性，这里的迭代变量i没有在内层重新copy
-		for i := range courseVos {
-			eg.Go(func() error {
+		er := aggregate.ForEach(ctx, "evaluation.Evaluated", courseVos,
+			func(ctx context.Context, i int, vo ProfileCourseVo) error {
 				res, er := h.evaluation.Evaluated(ctx, &evaluationv1.EvaluatedRequest{
-					CourseId:    courseVos[i].Id,
+					CourseId:    vo.Id,
 					PublisherId: uc.Uid,
 				})
 				courseVos[i].Evaluated = res.GetEvaluated()
 				return er
 			})
-		}
-		er := eg.Wait()
 		if er != nil {
 			return ginx.Result{
 				Code: errs.InternalServerError,
 				Msg:  "系统异常",
-			}, err
+			}, er
 		}
 		return ginx.Result{
 			Msg:  "Success",
@@ -147,31 +151,26 @@ func (h *CourseHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 			Msg:  "输入参数有误",
 		}, err
 	}
-	// 去查
+	// 去查，课程本身和综合评分是必选项，其余的失败了就降级
+	g := aggregate.NewGroup(ctx)
 	var (
-		eg            errgroup.Group
-		detailRes     *coursev1.GetDetailByIdResponse
-		scoreRes      *evaluationv1.CompositeScoreCourseResponse
+		course        *coursev1.Course
+		score         cache.CompositeScore
 		checkRes      *collectv1.CheckCollectionResponse
-		caRes         *tagv1.CountAssessmentTagsByCourseTaggerResponse
-		cfRes         *tagv1.CountFeatureTagsByCourseTaggerResponse
+		tags          cache.CourseTags
 		subscribedRes *coursev1.SubscribedResponse
 	)
-	eg.Go(func() error {
+	g.Required("courseCache.GetDetail", func(ctx context.Context) error {
 		var er error
-		detailRes, er = h.course.GetDetailById(ctx, &coursev1.GetDetailByIdRequest{
-			CourseId: cid,
-		})
+		course, er = h.courseCache.GetDetail(ctx, cid)
 		return er
 	})
-	eg.Go(func() error {
+	g.Required("courseCache.GetCompositeScore", func(ctx context.Context) error {
 		var er error
-		scoreRes, er = h.evaluation.CompositeScoreCourse(ctx, &evaluationv1.CompositeScoreCourseRequest{
-			CourseId: cid,
-		})
+		score, er = h.courseCache.GetCompositeScore(ctx, cid)
 		return er
 	})
-	eg.Go(func() error {
+	g.Optional("collect.CheckCollection", func(ctx context.Context) error {
 		var er error
 		checkRes, er = h.collect.CheckCollection(ctx, &collectv1.CheckCollectionRequest{
 			Uid:   uc.Uid,
@@ -179,42 +178,22 @@ func (h *CourseHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 			BizId: cid,
 		})
 		return er
-	})
-	publishersRes, err := h.evaluation.VisiblePublishersCourse(ctx, &evaluationv1.VisiblePublishersCourseRequest{
-		CourseId: cid,
-	})
-	if err != nil {
-		return ginx.Result{
-			Code: errs.InternalServerError,
-			Msg:  "系统异常",
-		}, err
-	}
-	eg.Go(func() error {
+	}, "is_collected")
+	g.Optional("courseCache.GetTags", func(ctx context.Context) error {
 		var er error
-		caRes, er = h.tag.CountAssessmentTagsByCourseTagger(ctx, &tagv1.CountAssessmentTagsByCourseTaggerRequest{
-			CourseId:  cid,
-			TaggerIds: publishersRes.GetPublishers(),
-		})
+		tags, er = h.courseCache.GetTags(ctx, cid)
 		return er
-	})
-	eg.Go(func() error {
-		var er error
-		cfRes, er = h.tag.CountFeatureTagsByCourseTagger(ctx, &tagv1.CountFeatureTagsByCourseTaggerRequest{
-			CourseId:  cid,
-			TaggerIds: publishersRes.GetPublishers(),
-		})
-		return er
-	})
+	}, "assessments", "features")
 	// 聚合是否是自己的课
-	eg.Go(func() error {
+	g.Optional("course.Subscribed", func(ctx context.Context) error {
 		var er error
 		subscribedRes, er = h.course.Subscribed(ctx, &coursev1.SubscribedRequest{
 			Uid:      uc.Uid,
 			CourseId: cid,
 		})
 		return er
-	})
-	err = eg.Wait()
+	}, "is_subscribed")
+	degraded, err := g.Wait()
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -224,23 +203,20 @@ func (h *CourseHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Resul
 	return ginx.Result{
 		Msg: "Success",
 		Data: PublicCourseVo{
-			Id:             detailRes.GetCourse().GetId(),
-			Name:           detailRes.GetCourse().GetName(),
-			Teacher:        detailRes.GetCourse().GetTeacher(),
-			School:         detailRes.GetCourse().GetSchool(),
-			CompositeScore: scoreRes.GetScore(),
-			RaterCount:     scoreRes.GetRaterCount(),
-			Property:       detailRes.GetCourse().GetProperty().String(),
-			Credit:         detailRes.GetCourse().GetCredit(),
-			Assessments: slice.ToMapV(caRes.GetItems(), func(element *tagv1.CountAssessmentItem) (string, int64) {
-				return element.GetTag().String(), element.GetCount()
-			}),
-			Features: slice.ToMapV(cfRes.GetItems(), func(element *tagv1.CountFeatureItem) (string, int64) {
-				return element.GetTag().String(), element.GetCount()
-			}),
-			IsCollected:  checkRes.GetIsCollected(),
-			IsSubscribed: subscribedRes.GetSubscribed(),
+			Id:             course.GetId(),
+			Name:           course.GetName(),
+			Teacher:        course.GetTeacher(),
+			School:         course.GetSchool(),
+			CompositeScore: score.Score,
+			RaterCount:     score.RaterCount,
+			Property:       course.GetProperty().String(),
+			Credit:         course.GetCredit(),
+			Assessments:    tags.Assessments,
+			Features:       tags.Features,
+			IsCollected:    checkRes.GetIsCollected(),
+			IsSubscribed:   subscribedRes.GetSubscribed(),
 		},
+		Degraded: degraded,
 	}, nil
 }
 
@@ -261,9 +237,7 @@ func (h *CourseHandler) SimpleDetail(ctx *gin.Context) (ginx.Result, error) {
 			Msg:  "输入参数有误",
 		}, err
 	}
-	detailRes, err := h.course.GetDetailById(ctx, &coursev1.GetDetailByIdRequest{
-		CourseId: cid,
-	})
+	course, err := h.courseCache.GetDetail(ctx, cid)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -273,12 +247,12 @@ func (h *CourseHandler) SimpleDetail(ctx *gin.Context) (ginx.Result, error) {
 	return ginx.Result{
 		Msg: "Success",
 		Data: SimplePublicCourseVo{
-			Id:       detailRes.GetCourse().GetId(),
-			Name:     detailRes.GetCourse().GetName(),
-			Teacher:  detailRes.GetCourse().GetTeacher(),
-			School:   detailRes.GetCourse().GetSchool(),
-			Property: detailRes.GetCourse().GetProperty().String(),
-			Credit:   detailRes.GetCourse().GetCredit(),
+			Id:       course.GetId(),
+			Name:     course.GetName(),
+			Teacher:  course.GetTeacher(),
+			School:   course.GetSchool(),
+			Property: course.GetProperty().String(),
+			Credit:   course.GetCredit(),
 		},
 	}, nil
 }
@@ -303,39 +277,8 @@ func (h *CourseHandler) Tags(ctx *gin.Context) (ginx.Result, error) {
 	// 1. 查出courseId所有的，然后剔除不可见的：courseId
 	// 查到所有的非public的evaluation的uid，然后查到他们的tag，在内存中一个个减掉...真麻烦...
 	// 2. 查出不可见的tagger，在数据库count的时候就剔除，这种比较简单
-	// TODO 因为这个接口的性能一般，所以要优化
-	// 现在evaluation 找出courseId可见的uid ，然后在tag courseId中根据这些uid来找
-	res, err := h.evaluation.VisiblePublishersCourse(ctx, &evaluationv1.VisiblePublishersCourseRequest{
-		CourseId: cid,
-	})
-	if err != nil {
-		return ginx.Result{
-			Code: errs.InternalServerError,
-			Msg:  "系统异常",
-		}, err
-	}
-	var (
-		eg    errgroup.Group
-		caRes *tagv1.CountAssessmentTagsByCourseTaggerResponse
-		cfRes *tagv1.CountFeatureTagsByCourseTaggerResponse
-	)
-	eg.Go(func() error {
-		var er error
-		caRes, er = h.tag.CountAssessmentTagsByCourseTagger(ctx, &tagv1.CountAssessmentTagsByCourseTaggerRequest{
-			CourseId:  cid,
-			TaggerIds: res.GetPublishers(),
-		})
-		return er
-	})
-	eg.Go(func() error {
-		var er error
-		cfRes, er = h.tag.CountFeatureTagsByCourseTagger(ctx, &tagv1.CountFeatureTagsByCourseTaggerRequest{
-			CourseId:  cid,
-			TaggerIds: res.GetPublishers(),
-		})
-		return er
-	})
-	err = eg.Wait()
+	// 因为这个接口的性能一般，所以加了缓存，课评保存时失效
+	tags, err := h.courseCache.GetTags(ctx, cid)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -345,12 +288,8 @@ func (h *CourseHandler) Tags(ctx *gin.Context) (ginx.Result, error) {
 	return ginx.Result{
 		Msg: "Success",
 		Data: CourseTagsVo{
-			Assessments: slice.ToMapV(caRes.GetItems(), func(element *tagv1.CountAssessmentItem) (string, int64) {
-				return element.GetTag().String(), element.GetCount()
-			}),
-			Features: slice.ToMapV(cfRes.GetItems(), func(element *tagv1.CountFeatureItem) (string, int64) {
-				return element.GetTag().String(), element.GetCount()
-			}),
+			Assessments: tags.Assessments,
+			Features:    tags.Features,
 		},
 	}, nil
 }
@@ -404,16 +343,24 @@ func (h *CourseHandler) Collect(ctx *gin.Context, req CourseCollectReq, uc ijwt.
 // @Tags 课程
 // @Accept json
 // @Produce json
-// @Param cur_collection_id query integer true "当前收藏项的ID，用于分页"
-// @Param limit query integer true "每页数量限制"
-// @Success 200 {object} ginx.Result{data=[]CollectedCourseVo} "成功返回收藏列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[CollectedCourseVo]} "成功返回收藏列表"
 // @Router /courses/collections/list/mine [get]
 func (h *CourseHandler) ListCollectionMine(ctx *gin.Context, req CourseListCollectionMineReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.CourseInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
+	}
+	// 多查一条，用来判断还有没有下一页
 	res, err := h.collect.ListCollections(ctx, &collectv1.ListCollectionsRequest{
 		Uid:             uc.Uid,
 		Biz:             collectv1.Biz_Course,
-		CurCollectionId: req.CurCollectionId,
-		Limit:           req.Limit,
+		CurCollectionId: cur,
+		Limit:           h.pager.Size(req.Limit) + 1,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -421,48 +368,51 @@ func (h *CourseHandler) ListCollectionMine(ctx *gin.Context, req CourseListColle
 			Msg:  "系统异常",
 		}, err
 	}
-	courseVos := slice.Map(res.GetCollections(),
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetCollections(),
 		func(idx int, src *collectv1.Collection) CollectedCourseVo {
 			return CollectedCourseVo{
 				Id:       src.GetId(),
 				CourseId: src.GetBizId(),
 			}
-		})
-	var eg errgroup.Group
-	for i, c := range courseVos {
-		eg.Go(func() error {
-			detailRes, er := h.course.GetDetailById(ctx, &coursev1.GetDetailByIdRequest{
-				CourseId: c.CourseId,
-			})
-			if er != nil {
-				return er
-			}
-			scoreRes, er := h.evaluation.CompositeScoreCourse(ctx, &evaluationv1.CompositeScoreCourseRequest{
-				CourseId: c.CourseId,
-			})
-			if er != nil {
-				return er
-			}
-			courseVos[i].Name = detailRes.GetCourse().GetName()
-			courseVos[i].Property = detailRes.GetCourse().GetProperty().String()
-			courseVos[i].Credit = detailRes.GetCourse().GetCredit()
-			courseVos[i].School = detailRes.GetCourse().GetSchool()
-			courseVos[i].Teacher = detailRes.GetCourse().GetTeacher()
-			courseVos[i].CompositeScore = scoreRes.GetScore()
-			courseVos[i].IsCollected = true
-			return nil
-		})
+		}), func(vo CollectedCourseVo) int64 {
+		return vo.Id
+	})
+	courseVos := page.Items
+	type collected struct {
+		course *coursev1.Course
+		score  cache.CompositeScore
 	}
-	err = eg.Wait()
+	// 走缓存，但缓存未命中时仍会打到下游，用 loader 限制并发
+	cids := slice.Map(courseVos, func(idx int, src CollectedCourseVo) int64 {
+		return src.CourseId
+	})
+	details, err := dataloader.NewLoader(func(ctx context.Context, cid int64) (collected, error) {
+		course, er := h.courseCache.GetDetail(ctx, cid)
+		if er != nil {
+			return collected{}, er
+		}
+		score, er := h.courseCache.GetCompositeScore(ctx, cid)
+		return collected{course: course, score: score}, er
+	}).LoadMany(ctx, cids)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
 			Msg:  "系统异常",
 		}, err
 	}
+	for i := range courseVos {
+		d := details[courseVos[i].CourseId]
+		courseVos[i].Name = d.course.GetName()
+		courseVos[i].Property = d.course.GetProperty().String()
+		courseVos[i].Credit = d.course.GetCredit()
+		courseVos[i].School = d.course.GetSchool()
+		courseVos[i].Teacher = d.course.GetTeacher()
+		courseVos[i].CompositeScore = d.score.Score
+		courseVos[i].IsCollected = true
+	}
 	return ginx.Result{
 		Msg:  "Success",
-		Data: courseVos,
+		Data: page,
 	}, nil
 }
 
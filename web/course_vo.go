@@ -1,5 +1,7 @@
 package web
 
+import "github.com/MuxiKeStack/bff/pkg/ginx"
+
 type CourseListReq struct {
 	Year string `json:"year"`
 	Term string `json:"term"`
@@ -52,8 +54,7 @@ type CourseTagsVo struct {
 }
 
 type CourseListCollectionMineReq struct {
-	CurCollectionId int64 `form:"cur_collection_id"`
-	Limit           int64 `form:"limit"`
+	ginx.PageReq
 }
 
 type CollectedCourseVo struct {
@@ -0,0 +1,194 @@
+package web
+
+import (
+	"bytes"
+	"crypto/rand"
+	_ "embed"
+	"errors"
+	"fmt"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"html/template"
+	"math/big"
+	"net/mail"
+	"time"
+)
+
+//go:embed templates/email_verify.html
+var emailVerifyTemplate string
+
+var emailVerifyTmpl = template.Must(template.New("email_verify").Parse(emailVerifyTemplate))
+
+// EmailHandler 绑定邮箱，绑定之后才能在 /users/settings 里打开邮件摘要
+type EmailHandler struct {
+	userSvc      userv1.UserServiceClient
+	settings     cache.UserSettingsStore
+	verification cache.EmailVerification
+	sender       email.Sender
+	codeTTL      time.Duration
+}
+
+func NewEmailHandler(userSvc userv1.UserServiceClient, settings cache.UserSettingsStore,
+	verification cache.EmailVerification, sender email.Sender, codeTTL time.Duration) *EmailHandler {
+	return &EmailHandler{
+		userSvc:      userSvc,
+		settings:     settings,
+		verification: verification,
+		sender:       sender,
+		codeTTL:      codeTTL,
+	}
+}
+
+func (h *EmailHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
+	eg := s.Group("/users/email")
+	eg.POST("/bind", authMiddleware, ginx.WrapClaimsAndReq(h.Bind))
+	eg.POST("/verify", authMiddleware, ginx.WrapClaimsAndReq(h.Verify))
+	eg.DELETE("", authMiddleware, ginx.WrapClaims(h.Unbind))
+}
+
+// Bind 给要绑定的邮箱发验证码
+// @Summary 绑定邮箱
+// @Description 给邮箱发一个 6 位验证码，再调用 /users/email/verify 完成绑定。一分钟内只能发一次
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Param request body EmailBindReq true "要绑定的邮箱"
+// @Success 200 {object} ginx.Result "Success"
+// @Router /users/email/bind [post]
+func (h *EmailHandler) Bind(ctx *gin.Context, req EmailBindReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Address != req.Email {
+		return ginx.Result{
+			Code: errs.EmailInvalidInput,
+			Msg:  "邮箱格式不对",
+		}, nil
+	}
+	code, err := h.newCode()
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	err = h.verification.Save(ctx, uc.Uid, req.Email, code)
+	switch {
+	case errors.Is(err, cache.ErrEmailTooFrequent):
+		return ginx.Result{
+			Code: errs.EmailTooFrequent,
+			Msg:  "验证码发送太频繁，请稍后再试",
+		}, nil
+	case err != nil:
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	// 昵称只是用来称呼，查不到也照样发
+	profile, _ := h.userSvc.Profile(ctx, &userv1.ProfileRequest{Uid: uc.Uid})
+	var body bytes.Buffer
+	err = emailVerifyTmpl.Execute(&body, map[string]any{
+		"Nickname": profile.GetUser().GetNickname(),
+		"Email":    req.Email,
+		"Code":     code,
+		"TTL":      h.codeTTL,
+	})
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	err = h.sender.Send(ctx, email.Message{
+		To:      []string{req.Email},
+		Subject: fmt.Sprintf("课栈邮箱验证码：%s", code),
+		HTML:    body.String(),
+	})
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "邮件发送失败",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+	}, nil
+}
+
+// Verify 用验证码完成绑定
+// @Summary 验证邮箱
+// @Description 验证码错 5 次之后作废，需要重新发送。绑定新邮箱会替换掉旧的
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Param request body EmailVerifyReq true "验证码"
+// @Success 200 {object} ginx.Result{data=EmailSettingsVo} "Success"
+// @Router /users/email/verify [post]
+func (h *EmailHandler) Verify(ctx *gin.Context, req EmailVerifyReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	addr, err := h.verification.Verify(ctx, uc.Uid, req.Code)
+	switch {
+	case errors.Is(err, cache.ErrEmailCodeInvalid):
+		return ginx.Result{
+			Code: errs.EmailCodeInvalid,
+			Msg:  "验证码不对或者已经过期",
+		}, nil
+	case err != nil:
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return h.updateEmail(ctx, uc.Uid, func(settings *cache.EmailSettings) {
+		settings.Address = addr
+	})
+}
+
+// Unbind 解绑邮箱
+// @Summary 解绑邮箱
+// @Description 解绑之后邮件摘要也会关掉
+// @Tags 用户
+// @Produce json
+// @Success 200 {object} ginx.Result{data=EmailSettingsVo} "Success"
+// @Router /users/email [delete]
+func (h *EmailHandler) Unbind(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	return h.updateEmail(ctx, uc.Uid, func(settings *cache.EmailSettings) {
+		*settings = cache.EmailSettings{}
+	})
+}
+
+func (h *EmailHandler) updateEmail(ctx *gin.Context, uid int64, update func(settings *cache.EmailSettings)) (ginx.Result, error) {
+	settings, err := h.settings.Get(ctx, uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	update(&settings.Email)
+	if err = h.settings.Set(ctx, uid, settings); err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+		Data: EmailSettingsVo{
+			Address: settings.Email.Address,
+			Digest:  settings.Email.Digest,
+		},
+	}, nil
+}
+
+// newCode 6 位数字验证码
+func (h *EmailHandler) newCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
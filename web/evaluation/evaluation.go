@@ -1,17 +1,21 @@
 package evaluation
 
 import (
+	"context"
 	"errors"
 	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
 	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
 	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
 	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/sync/errgroup"
 	"strconv"
 )
 
@@ -20,17 +24,26 @@ type EvaluationHandler struct {
 	tagClient        tagv1.TagServiceClient
 	stanceClient     stancev1.StanceServiceClient
 	commentClient    commentv1.CommentServiceClient
+	courseCache      cache.CourseCache
+	producer         events.Producer
 	anonymousUsers   []int64
+	pager            *ginx.Pager
+	l                logger.Logger
 }
 
 func NewEvaluationHandler(evaluationClient evaluationv1.EvaluationServiceClient, tagClient tagv1.TagServiceClient,
-	interactClient stancev1.StanceServiceClient, commentClient commentv1.CommentServiceClient) *EvaluationHandler {
+	interactClient stancev1.StanceServiceClient, commentClient commentv1.CommentServiceClient,
+	courseCache cache.CourseCache, producer events.Producer, pager *ginx.Pager, l logger.Logger) *EvaluationHandler {
 	return &EvaluationHandler{
 		evaluationClient: evaluationClient,
 		tagClient:        tagClient,
 		stanceClient:     interactClient,
 		commentClient:    commentClient,
+		courseCache:      courseCache,
+		producer:         producer,
 		anonymousUsers:   []int64{-1, -2, -3, -4, -5, -6, -7, -8, -9, -10, -11, -12},
+		pager:            pager,
+		l:                l,
 	}
 }
 
@@ -114,20 +127,21 @@ func (h *EvaluationHandler) Save(ctx *gin.Context, req SaveReq, uc ijwt.UserClai
 		res     *evaluationv1.SaveResponse
 		saveErr error
 	)
+	evaluation := &evaluationv1.Evaluation{
+		Id:          req.Id,
+		PublisherId: uc.Uid,
+		CourseId:    req.CourseId,
+		StarRating:  uint32(req.StarRating),
+		Content:     req.Content,
+		Status:      evaluationv1.EvaluationStatus(status),
+		IsAnonymous: req.IsAnonymous,
+	}
 	// 已放弃分布式事务[2024.8.25]
 	// 下面涉及两个服务的原子性调用，需要使用分布式事务，这里的bff其实起到了聚合服务的作用...，引入实际意义聚合服务，目前没必要
 	// go的seatago框架相当不成熟，比如这个事务内部不能用errgroup并发这两个attach tag
 	err := func() error {
 		res, saveErr = h.evaluationClient.Save(ctx, &evaluationv1.SaveRequest{
-			Evaluation: &evaluationv1.Evaluation{
-				Id:          req.Id,
-				PublisherId: uc.Uid,
-				CourseId:    req.CourseId,
-				StarRating:  uint32(req.StarRating),
-				Content:     req.Content,
-				Status:      evaluationv1.EvaluationStatus(status),
-				IsAnonymous: req.IsAnonymous,
-			},
+			Evaluation: evaluation,
 		})
 		if saveErr != nil {
 			return saveErr
@@ -153,6 +167,15 @@ func (h *EvaluationHandler) Save(ctx *gin.Context, req SaveReq, uc ijwt.UserClai
 
 	switch {
 	case err == nil:
+		// 课程的评分和标签变了，失效掉缓存，失败了也只是晚一点看到，不影响这次保存
+		er := h.courseCache.Invalidate(ctx, req.CourseId)
+		if er != nil {
+			h.l.Error("失效课程缓存失败", logger.Error(er), logger.Int64("courseId", req.CourseId))
+		}
+		if req.Id == 0 {
+			evaluation.Id = res.GetEvaluationId()
+			h.producePublished(ctx, evaluation)
+		}
 		return ginx.Result{
 			Msg:  "Success",
 			Data: res.GetEvaluationId(), // 这里给前端标明是evaluationId
@@ -195,6 +218,21 @@ func (h *EvaluationHandler) UpdateStatus(ctx *gin.Context, req UpdateStatusReq,
 			Msg:  "不合法的课评状态",
 		}, errors.New("不合法的课评状态")
 	}
+	// 要先查出原来的状态和内容：失效课程缓存要用课程 id，从不公开改成公开也算发布
+	detail, err := h.evaluationClient.Detail(ctx, &evaluationv1.DetailRequest{EvaluationId: eid})
+	switch {
+	case evaluationv1.IsEvaluationNotFound(err):
+		return ginx.Result{
+			Code: errs.EvaluationNotFound,
+			Msg:  "课评不存在",
+		}, err
+	case err != nil:
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	before := detail.GetEvaluation()
 	_, err = h.evaluationClient.UpdateStatus(ctx, &evaluationv1.UpdateStatusRequest{
 		EvaluationId: eid,
 		Status:       evaluationv1.EvaluationStatus(status),
@@ -206,6 +244,16 @@ func (h *EvaluationHandler) UpdateStatus(ctx *gin.Context, req UpdateStatusReq,
 			Msg:  "系统异常",
 		}, err
 	}
+	// 公开和不公开之间切换会改变参与统计的课评，课程的评分和标签跟着变
+	er := h.courseCache.Invalidate(ctx, before.GetCourseId())
+	if er != nil {
+		h.l.Error("失效课程缓存失败", logger.Error(er), logger.Int64("courseId", before.GetCourseId()))
+	}
+	if evaluationv1.EvaluationStatus(status) == evaluationv1.EvaluationStatus_Public &&
+		before.GetStatus() != evaluationv1.EvaluationStatus_Public {
+		before.Status = evaluationv1.EvaluationStatus_Public
+		h.producePublished(ctx, before)
+	}
 	return ginx.Result{
 		Msg: "Success",
 	}, nil
@@ -253,8 +301,8 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 		}, nil
 	}
 	// 哦不，这里还要去聚合tags，但是似乎不用开分布式事务，因为只存在查询，没什么好事务的
+	g := aggregate.NewGroup(ctx)
 	var (
-		eg           errgroup.Group
 		evaluationVo = EvaluationVo{
 			Id:          res.GetEvaluation().GetId(),
 			PublisherId: res.GetEvaluation().GetPublisherId(),
@@ -268,8 +316,8 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 		}
 	)
 
-	// 聚合考核方式
-	eg.Go(func() error {
+	// 聚合考核方式，标签、表态、评论数都是可选的，失败了降级
+	g.Optional("tag.GetAssessmentTagsByTaggerBiz", func(ctx context.Context) error {
 		atRes, er := h.tagClient.GetAssessmentTagsByTaggerBiz(ctx, &tagv1.GetAssessmentTagsByTaggerBizRequest{
 			TaggerId: res.GetEvaluation().GetPublisherId(),
 			Biz:      tagv1.Biz_Course,
@@ -282,9 +330,9 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 			return src.String()
 		})
 		return nil
-	})
+	}, "assessments")
 	// 聚合课程特点
-	eg.Go(func() error {
+	g.Optional("tag.GetFeatureTagsByTaggerBiz", func(ctx context.Context) error {
 		ftRes, er := h.tagClient.GetFeatureTagsByTaggerBiz(ctx, &tagv1.GetFeatureTagsByTaggerBizRequest{
 			TaggerId: res.GetEvaluation().GetPublisherId(),
 			Biz:      tagv1.Biz_Course,
@@ -297,13 +345,13 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 			return src.String()
 		})
 		return nil
-	})
+	}, "features")
 	// 还要聚合interact数据，voting -1、0、1
 	// 支持数，反对数，评论数
 	// 聚合表态信息
 	// 设置了可受限访问，所以要区分游客和登录用户
 	if uc.Uid != 0 {
-		eg.Go(func() error {
+		g.Optional("stance.GetUserStance", func(ctx context.Context) error {
 			stanceRes, er := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
 				Uid:   uc.Uid,
 				Biz:   stancev1.Biz_Evaluation,
@@ -316,9 +364,9 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 			evaluationVo.TotalSupportCount = stanceRes.GetTotalSupports()
 			evaluationVo.TotalOpposeCount = stanceRes.GetTotalOpposes()
 			return nil
-		})
+		}, "stance", "total_support_count", "total_oppose_count")
 	} else {
-		eg.Go(func() error {
+		g.Optional("stance.CountStance", func(ctx context.Context) error {
 			countStanceRes, er := h.stanceClient.CountStance(ctx, &stancev1.CountStanceRequest{
 				Biz:   stancev1.Biz_Evaluation,
 				BizId: eid,
@@ -329,10 +377,10 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 			evaluationVo.TotalSupportCount = countStanceRes.GetTotalSupports()
 			evaluationVo.TotalOpposeCount = countStanceRes.GetTotalOpposes()
 			return nil
-		})
+		}, "total_support_count", "total_oppose_count")
 	}
 	// 评论数
-	eg.Go(func() error {
+	g.Optional("comment.CountComment", func(ctx context.Context) error {
 		countCommentRes, er := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
 			Biz:   commentv1.Biz_Evaluation,
 			BizId: eid,
@@ -342,8 +390,8 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 		}
 		evaluationVo.TotalCommentCount = countCommentRes.GetCount()
 		return nil
-	})
-	err = eg.Wait()
+	}, "total_comment_count")
+	degraded, err := g.Wait()
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -354,12 +402,42 @@ func (h *EvaluationHandler) Detail(ctx *gin.Context, uc ijwt.UserClaims) (ginx.R
 		evaluationVo.PublisherId = h.selectsAnonymousUser(evaluationVo.Id)
 	}
 	return ginx.Result{
-		Msg:  "Success",
-		Data: evaluationVo,
+		Msg:      "Success",
+		Data:     evaluationVo,
+		Degraded: degraded,
 	}, nil
 }
 
+// producePublished 发送课评发布事件，失败了只打日志，不影响发布。
+// 事件会投递给外部的 webhook，只有公开的课评才发
+func (h *EvaluationHandler) producePublished(ctx context.Context, evaluation *evaluationv1.Evaluation) {
+	if evaluation.GetStatus() != evaluationv1.EvaluationStatus_Public {
+		return
+	}
+	data := events.EvaluationPublished{
+		Id:         evaluation.GetId(),
+		CourseId:   evaluation.GetCourseId(),
+		StarRating: int(evaluation.GetStarRating()),
+		Content:    evaluation.GetContent(),
+	}
+	if !evaluation.GetIsAnonymous() {
+		data.PublisherId = evaluation.GetPublisherId()
+	}
+	err := events.Produce(ctx, h.producer, evaluation.GetPublisherId(), data)
+	if err != nil {
+		h.l.Error("发送课评发布事件失败", logger.Error(err), logger.Int64("evaluationId", evaluation.GetId()))
+	}
+}
+
 func (h *EvaluationHandler) selectsAnonymousUser(bizId int64) int64 {
 	idx := bizId % 12
 	return h.anonymousUsers[idx]
 }
+
+func (h *EvaluationHandler) hideAnonymousPublishers(evaluationVos []EvaluationVo) {
+	for i := range evaluationVos {
+		if evaluationVos[i].IsAnonymous {
+			evaluationVos[i].PublisherId = h.selectsAnonymousUser(evaluationVos[i].Id)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package evaluation
 
-import "github.com/MuxiKeStack/bff/web"
+import (
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/web"
+)
 
 type SaveReq struct {
 	Id          int64    `json:"id"`
@@ -18,9 +21,8 @@ type UpdateStatusReq struct {
 }
 
 type ListRecentReq struct {
-	CurEvaluationId int64  `form:"cur_evaluation_id"`
-	Limit           int64  `form:"limit"`
-	Property        string `form:"property"`
+	ginx.PageReq
+	Property string `form:"property"`
 }
 
 type EvaluationVo struct {
@@ -42,14 +44,12 @@ type EvaluationVo struct {
 }
 
 type ListCourseReq struct {
-	CurEvaluationId int64 `form:"cur_evaluation_id"`
-	Limit           int64 `form:"limit"`
+	ginx.PageReq
 }
 
 type ListMineReq struct {
-	CurEvaluationId int64  `form:"cur_evaluation_id"`
-	Limit           int64  `form:"limit"`
-	Status          string `form:"status"`
+	ginx.PageReq
+	Status string `form:"status"`
 }
 
 type CountMineReq struct {
@@ -1,18 +1,16 @@
 package evaluation
 
 import (
+	"context"
 	"errors"
-	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
 	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
 	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
-	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
-	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/sync/errgroup"
 	"strconv"
 )
 
@@ -21,10 +19,10 @@ import (
 // @Tags 课评
 // @Accept json
 // @Produce json
-// @Param cur_evaluation_id query int64 true "当前ID"
-// @Param limit query int64 true "课评数量限制"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
 // @Param property query string false "用于过滤课评的课程性质（可选）"
-// @Success 200 {object} ginx.Result{data=[]EvaluationVo} "Success"
+// @Success 200 {object} ginx.Result{data=ginx.Page[EvaluationVo]} "Success"
 // @Router /evaluations/list/all [get]
 func (h *EvaluationHandler) ListRecent(ctx *gin.Context, req ListRecentReq, uc ijwt.UserClaims) (ginx.Result, error) {
 	var property coursev1.CourseProperty
@@ -40,13 +38,17 @@ func (h *EvaluationHandler) ListRecent(ctx *gin.Context, req ListRecentReq, uc i
 		}
 		property = coursev1.CourseProperty(propertyUint32)
 	}
-	// 单次最多查一百
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.EvaluationInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
+	// 多查一条，用来判断还有没有下一页
 	res, err := h.evaluationClient.ListRecent(ctx, &evaluationv1.ListRecentRequest{
-		CurEvaluationId: req.CurEvaluationId,
-		Limit:           req.Limit,
+		CurEvaluationId: cur,
+		Limit:           h.pager.Size(req.Limit) + 1,
 		Property:        property,
 	})
 	if err != nil {
@@ -55,7 +57,7 @@ func (h *EvaluationHandler) ListRecent(ctx *gin.Context, req ListRecentReq, uc i
 			Msg:  "系统异常",
 		}, err
 	}
-	evaluationVos := slice.Map(res.GetEvaluations(), func(idx int, src *evaluationv1.Evaluation) EvaluationVo {
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetEvaluations(), func(idx int, src *evaluationv1.Evaluation) EvaluationVo {
 		return EvaluationVo{
 			Id:          src.GetId(),
 			PublisherId: src.GetPublisherId(),
@@ -67,59 +69,23 @@ func (h *EvaluationHandler) ListRecent(ctx *gin.Context, req ListRecentReq, uc i
 			Utime:       src.GetUtime(),
 			Ctime:       src.GetCtime(),
 		}
+	}), func(vo EvaluationVo) int64 {
+		return vo.Id
 	})
-	//var eg errgroup.Group
-	for i := range evaluationVos {
-		err = func() error {
-			// 因为这个路径被设置为了可以受限访问，也就是游客访问，所以这里做了区分
-			if uc.Uid != 0 {
-				stanceRes, er := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
-					Uid:   uc.Uid,
-					Biz:   stancev1.Biz_Evaluation,
-					BizId: evaluationVos[i].Id,
-				})
-				if er != nil {
-					return er
-				}
-				evaluationVos[i].Stance = int32(stanceRes.GetStance())
-				evaluationVos[i].TotalSupportCount = stanceRes.GetTotalSupports()
-				evaluationVos[i].TotalOpposeCount = stanceRes.GetTotalOpposes()
-			} else {
-				countStanceRes, er := h.stanceClient.CountStance(ctx, &stancev1.CountStanceRequest{
-					Biz:   stancev1.Biz_Evaluation,
-					BizId: evaluationVos[i].Id,
-				})
-				if er != nil {
-					return er
-				}
-				evaluationVos[i].TotalSupportCount = countStanceRes.GetTotalSupports()
-				evaluationVos[i].TotalOpposeCount = countStanceRes.GetTotalOpposes()
-			}
-			countCommentRes, er := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
-				Biz:   commentv1.Biz_Evaluation,
-				BizId: evaluationVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			evaluationVos[i].TotalCommentCount = countCommentRes.GetCount()
-			return nil
-		}()
-		if evaluationVos[i].IsAnonymous {
-			evaluationVos[i].PublisherId = h.selectsAnonymousUser(evaluationVos[i].Id)
-		}
-	}
-	//err = eg.Wait()
+	evaluationVos := page.Items
+	// 因为这个路径被设置为了可以受限访问，也就是游客访问，所以 uid 可能为 0，里面做了区分
+	err = h.aggregateInteractions(ctx, uc.Uid, evaluationVos)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
 			Msg:  "系统异常",
 		}, err
 	}
+	h.hideAnonymousPublishers(evaluationVos)
 	// 要聚合评论数，支持反对数，是否支持了
 	return ginx.Result{
 		Msg:  "Success",
-		Data: evaluationVos,
+		Data: page,
 	}, nil
 }
 
@@ -130,9 +96,9 @@ func (h *EvaluationHandler) ListRecent(ctx *gin.Context, req ListRecentReq, uc i
 // @Accept json
 // @Produce json
 // @Param courseId path int64 true "课程ID"
-// @Param cur_evaluation_id query int64 true "当前课评ID"
-// @Param limit query int64 true "返回课评的最大数量，上限为100"
-// @Success 200 {object} ginx.Result{data=[]EvaluationVo} "Success"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[EvaluationVo]} "Success"
 // @Router /evaluations/list/courses/{courseId} [get]
 func (h *EvaluationHandler) ListCourse(ctx *gin.Context, req ListCourseReq, uc ijwt.UserClaims) (ginx.Result, error) {
 	cidStr := ctx.Param("courseId")
@@ -143,13 +109,16 @@ func (h *EvaluationHandler) ListCourse(ctx *gin.Context, req ListCourseReq, uc i
 			Msg:  "输入参数有误",
 		}, err
 	}
-	// 单次最多查一百
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.EvaluationInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.evaluationClient.ListCourse(ctx, &evaluationv1.ListCourseRequest{
-		CurEvaluationId: req.CurEvaluationId,
-		Limit:           req.Limit,
+		CurEvaluationId: cur,
+		Limit:           h.pager.Size(req.Limit) + 1,
 		CourseId:        cid,
 	})
 	if err != nil {
@@ -158,7 +127,7 @@ func (h *EvaluationHandler) ListCourse(ctx *gin.Context, req ListCourseReq, uc i
 			Msg:  "系统异常",
 		}, err
 	}
-	evaluationVos := slice.Map(res.GetEvaluations(), func(idx int, src *evaluationv1.Evaluation) EvaluationVo {
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetEvaluations(), func(idx int, src *evaluationv1.Evaluation) EvaluationVo {
 		return EvaluationVo{
 			Id:          src.GetId(),
 			PublisherId: src.GetPublisherId(),
@@ -170,69 +139,29 @@ func (h *EvaluationHandler) ListCourse(ctx *gin.Context, req ListCourseReq, uc i
 			Utime:       src.GetUtime(),
 			Ctime:       src.GetCtime(),
 		}
+	}), func(vo EvaluationVo) int64 {
+		return vo.Id
 	})
-	// 这里要为，每个课评，聚合标签
-	var eg errgroup.Group
-	for i := range evaluationVos {
-		eg.Go(func() error {
-			atRes, er := h.tagClient.GetAssessmentTagsByTaggerBiz(ctx, &tagv1.GetAssessmentTagsByTaggerBizRequest{
-				TaggerId: evaluationVos[i].PublisherId,
-				Biz:      tagv1.Biz_Course,
-				BizId:    evaluationVos[i].CourseId,
-			})
-			if er != nil {
-				return er
-			}
-			evaluationVos[i].Assessments = slice.Map(atRes.GetTags(), func(idx int, src tagv1.AssessmentTag) string {
-				return src.String()
-			})
-			ftRes, er := h.tagClient.GetFeatureTagsByTaggerBiz(ctx, &tagv1.GetFeatureTagsByTaggerBizRequest{
-				TaggerId: evaluationVos[i].PublisherId,
-				Biz:      tagv1.Biz_Course,
-				BizId:    evaluationVos[i].CourseId,
-			})
-			if er != nil {
-				return er
-			}
-			evaluationVos[i].Features = slice.Map(ftRes.GetTags(), func(idx int, src tagv1.FeatureTag) string {
-				return src.String()
-			})
-			stanceRes, er := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
-				Uid:   uc.Uid,
-				Biz:   stancev1.Biz_Evaluation,
-				BizId: evaluationVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			countCommentRes, er := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
-				Biz:   commentv1.Biz_Evaluation,
-				BizId: evaluationVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			evaluationVos[i].Stance = int32(stanceRes.GetStance())
-			evaluationVos[i].TotalSupportCount = stanceRes.GetTotalSupports()
-			evaluationVos[i].TotalOpposeCount = stanceRes.GetTotalOpposes()
-			evaluationVos[i].TotalCommentCount = countCommentRes.GetCount()
-			if evaluationVos[i].IsAnonymous {
-				evaluationVos[i].PublisherId = h.selectsAnonymousUser(evaluationVos[i].Id)
-			}
-			return nil
-		})
-	}
-	// 要聚合评论数，支持反对数，是否支持了
-	err = eg.Wait()
+	evaluationVos := page.Items
+	// 这里要为，每个课评，聚合标签，还要聚合评论数，支持反对数，是否支持了
+	g := aggregate.NewGroup(ctx)
+	g.Required("aggregateTags", func(ctx context.Context) error {
+		return h.aggregateTags(ctx, evaluationVos)
+	})
+	g.Required("aggregateInteractions", func(ctx context.Context) error {
+		return h.aggregateInteractions(ctx, uc.Uid, evaluationVos)
+	})
+	_, err = g.Wait()
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
 			Msg:  "系统异常",
 		}, err
 	}
+	h.hideAnonymousPublishers(evaluationVos)
 	return ginx.Result{
 		Msg:  "Success",
-		Data: evaluationVos,
+		Data: page,
 	}, nil
 }
 
@@ -243,10 +172,10 @@ func (h *EvaluationHandler) ListCourse(ctx *gin.Context, req ListCourseReq, uc i
 // @Accept json
 // @Produce json
 // @Param courseId path int64 true "课程ID"
-// @Param cur_evaluation_id query int64 true "当前评估ID，用于分页"
-// @Param limit query int64 true "上限为100"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
 // @Param status query string true "课评状态: Public/Private/Folded"
-// @Success 200 {object} ginx.Result{data=[]EvaluationVo} "Success"
+// @Success 200 {object} ginx.Result{data=ginx.Page[EvaluationVo]} "Success"
 // @Router /evaluations/list/mine [get]
 func (h *EvaluationHandler) ListMine(ctx *gin.Context, req ListMineReq, uc ijwt.UserClaims) (ginx.Result, error) {
 	status, ok := evaluationv1.EvaluationStatus_value[req.Status]
@@ -256,13 +185,16 @@ func (h *EvaluationHandler) ListMine(ctx *gin.Context, req ListMineReq, uc ijwt.
 			Msg:  "不合法的课评状态",
 		}, errors.New("不合法的课评状态")
 	}
-	// 单次最多查一百
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.EvaluationInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.evaluationClient.ListMine(ctx, &evaluationv1.ListMineRequest{
-		CurEvaluationId: req.CurEvaluationId,
-		Limit:           req.Limit,
+		CurEvaluationId: cur,
+		Limit:           h.pager.Size(req.Limit) + 1,
 		Uid:             uc.Uid,
 		Status:          evaluationv1.EvaluationStatus(status),
 	})
@@ -272,7 +204,7 @@ func (h *EvaluationHandler) ListMine(ctx *gin.Context, req ListMineReq, uc ijwt.
 			Msg:  "系统异常",
 		}, err
 	}
-	evaluationVos := slice.Map(res.GetEvaluations(), func(idx int, src *evaluationv1.Evaluation) EvaluationVo {
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetEvaluations(), func(idx int, src *evaluationv1.Evaluation) EvaluationVo {
 		return EvaluationVo{
 			Id:          src.GetId(),
 			PublisherId: src.GetPublisherId(),
@@ -284,45 +216,21 @@ func (h *EvaluationHandler) ListMine(ctx *gin.Context, req ListMineReq, uc ijwt.
 			Utime:       src.GetUtime(),
 			Ctime:       src.GetCtime(),
 		}
+	}), func(vo EvaluationVo) int64 {
+		return vo.Id
 	})
-	var eg errgroup.Group
-	for i := range evaluationVos {
-		eg.Go(func() error {
-			stanceRes, er := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
-				Uid:   uc.Uid,
-				Biz:   stancev1.Biz_Evaluation,
-				BizId: evaluationVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			countCommentRes, er := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
-				Biz:   commentv1.Biz_Evaluation,
-				BizId: evaluationVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			evaluationVos[i].Stance = int32(stanceRes.GetStance())
-			evaluationVos[i].TotalSupportCount = stanceRes.GetTotalSupports()
-			evaluationVos[i].TotalOpposeCount = stanceRes.GetTotalOpposes()
-			evaluationVos[i].TotalCommentCount = countCommentRes.GetCount()
-			if evaluationVos[i].IsAnonymous {
-				evaluationVos[i].PublisherId = h.selectsAnonymousUser(evaluationVos[i].Id)
-			}
-			return nil
-		})
-	}
-	err = eg.Wait()
+	evaluationVos := page.Items
+	err = h.aggregateInteractions(ctx, uc.Uid, evaluationVos)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
 			Msg:  "系统异常",
 		}, err
 	}
+	h.hideAnonymousPublishers(evaluationVos)
 	// 要聚合评论数，支持反对数，是否支持了
 	return ginx.Result{
 		Msg:  "Success",
-		Data: evaluationVos,
+		Data: page,
 	}, nil
 }
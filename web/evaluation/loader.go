@@ -0,0 +1,141 @@
+package evaluation
+
+import (
+	"context"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/dataloader"
+	"github.com/ecodeclub/ekit/slice"
+)
+
+type stance struct {
+	stance        int32
+	totalSupports int64
+	totalOpposes  int64
+}
+
+type taggerCourse struct {
+	taggerId int64
+	courseId int64
+}
+
+type tags struct {
+	assessments []string
+	features    []string
+}
+
+// aggregateInteractions 为列表里的课评聚合表态和评论数，uid 为 0 时是游客，只查总数
+func (h *EvaluationHandler) aggregateInteractions(ctx context.Context, uid int64, evaluationVos []EvaluationVo) error {
+	eids := slice.Map(evaluationVos, func(idx int, src EvaluationVo) int64 {
+		return src.Id
+	})
+	g := aggregate.NewGroup(ctx)
+	var (
+		stances  map[int64]stance
+		comments map[int64]int64
+	)
+	g.Required("stance.GetUserStance", func(ctx context.Context) error {
+		var er error
+		stances, er = dataloader.NewLoader(func(ctx context.Context, eid int64) (stance, error) {
+			if uid != 0 {
+				res, err := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
+					Uid:   uid,
+					Biz:   stancev1.Biz_Evaluation,
+					BizId: eid,
+				})
+				return stance{
+					stance:        int32(res.GetStance()),
+					totalSupports: res.GetTotalSupports(),
+					totalOpposes:  res.GetTotalOpposes(),
+				}, err
+			}
+			res, err := h.stanceClient.CountStance(ctx, &stancev1.CountStanceRequest{
+				Biz:   stancev1.Biz_Evaluation,
+				BizId: eid,
+			})
+			return stance{
+				totalSupports: res.GetTotalSupports(),
+				totalOpposes:  res.GetTotalOpposes(),
+			}, err
+		}).LoadMany(ctx, eids)
+		return er
+	})
+	g.Required("comment.CountComment", func(ctx context.Context) error {
+		var er error
+		comments, er = dataloader.NewLoader(func(ctx context.Context, eid int64) (int64, error) {
+			res, err := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
+				Biz:   commentv1.Biz_Evaluation,
+				BizId: eid,
+			})
+			return res.GetCount(), err
+		}).LoadMany(ctx, eids)
+		return er
+	})
+	_, err := g.Wait()
+	if err != nil {
+		return err
+	}
+	for i := range evaluationVos {
+		s := stances[evaluationVos[i].Id]
+		evaluationVos[i].Stance = s.stance
+		evaluationVos[i].TotalSupportCount = s.totalSupports
+		evaluationVos[i].TotalOpposeCount = s.totalOpposes
+		evaluationVos[i].TotalCommentCount = comments[evaluationVos[i].Id]
+	}
+	return nil
+}
+
+// aggregateTags 为列表里的课评聚合发布者打的标签，要在匿名替换 PublisherId 之前调用
+func (h *EvaluationHandler) aggregateTags(ctx context.Context, evaluationVos []EvaluationVo) error {
+	keys := slice.Map(evaluationVos, func(idx int, src EvaluationVo) taggerCourse {
+		return taggerCourse{taggerId: src.PublisherId, courseId: src.CourseId}
+	})
+	res, err := dataloader.NewLoader(func(ctx context.Context, key taggerCourse) (tags, error) {
+		g := aggregate.NewGroup(ctx)
+		var (
+			atRes *tagv1.GetAssessmentTagsByTaggerBizResponse
+			ftRes *tagv1.GetFeatureTagsByTaggerBizResponse
+		)
+		g.Required("tag.GetAssessmentTagsByTaggerBiz", func(ctx context.Context) error {
+			var er error
+			atRes, er = h.tagClient.GetAssessmentTagsByTaggerBiz(ctx, &tagv1.GetAssessmentTagsByTaggerBizRequest{
+				TaggerId: key.taggerId,
+				Biz:      tagv1.Biz_Course,
+				BizId:    key.courseId,
+			})
+			return er
+		})
+		g.Required("tag.GetFeatureTagsByTaggerBiz", func(ctx context.Context) error {
+			var er error
+			ftRes, er = h.tagClient.GetFeatureTagsByTaggerBiz(ctx, &tagv1.GetFeatureTagsByTaggerBizRequest{
+				TaggerId: key.taggerId,
+				Biz:      tagv1.Biz_Course,
+				BizId:    key.courseId,
+			})
+			return er
+		})
+		_, err := g.Wait()
+		if err != nil {
+			return tags{}, err
+		}
+		return tags{
+			assessments: slice.Map(atRes.GetTags(), func(idx int, src tagv1.AssessmentTag) string {
+				return src.String()
+			}),
+			features: slice.Map(ftRes.GetTags(), func(idx int, src tagv1.FeatureTag) string {
+				return src.String()
+			}),
+		}, nil
+	}).LoadMany(ctx, keys)
+	if err != nil {
+		return err
+	}
+	for i := range evaluationVos {
+		t := res[keys[i]]
+		evaluationVos[i].Assessments = t.assessments
+		evaluationVos[i].Features = t.features
+	}
+	return nil
+}
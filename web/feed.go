@@ -1,42 +1,76 @@
 package web
 
 import (
+	"cmp"
+	"context"
 	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/feature"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/gin-gonic/gin"
+	"slices"
+	"time"
+)
+
+const (
+	// 数未读时往前拉多少条，只拉一次，更早的不再计入未读。角标轮询得很频繁，不能一页页往前翻
+	feedMaxUnreadScan = 200
 )
 
 type FeedHandler struct {
 	feedClient feedv1.FeedServiceClient
+	readState  cache.FeedReadState
+	settings   cache.UserSettingsStore
+	presenter  *FeedPresenter
+	// 实时推送，topic 是 uid
+	hub       *pubsub.Hub
+	heartbeat time.Duration
+	pager     *ginx.Pager
+	flags     *feature.Flags
+	l         logger.Logger
 }
 
-func NewFeedHandler(feedClient feedv1.FeedServiceClient) *FeedHandler {
-	return &FeedHandler{feedClient: feedClient}
+func NewFeedHandler(feedClient feedv1.FeedServiceClient, readState cache.FeedReadState, settings cache.UserSettingsStore,
+	presenter *FeedPresenter, hub *pubsub.Hub, heartbeat time.Duration, pager *ginx.Pager, flags *feature.Flags, l logger.Logger) *FeedHandler {
+	return &FeedHandler{
+		feedClient: feedClient,
+		readState:  readState,
+		settings:   settings,
+		presenter:  presenter,
+		hub:        hub,
+		heartbeat:  heartbeat,
+		pager:      pager,
+		flags:      flags,
+		l:          l,
+	}
 }
 
 func (h *FeedHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
 	fg := s.Group("/feed")
 	fg.GET("/events_list", authMiddleware, ginx.WrapClaimsAndReq(h.GetFeedEventsList))
-
+	// SSE，带 Upgrade 头时是 WebSocket。长连接按 feed_stream 开关放量，没放到的用户拿到 404，客户端退回轮询未读数
+	fg.GET("/stream", tokenFromQuery, authMiddleware, h.flags.Guard("feed_stream"), h.Stream)
+	fg.GET("/unread_count", authMiddleware, ginx.WrapClaims(h.UnreadCount))
+	fg.POST("/mark_read", authMiddleware, ginx.WrapClaimsAndReq(h.MarkRead))
 }
 
 // GetFeedEventsList 拉取feed事件
 // @Summary 拉取feed事件
-// @Description 根据上一次事件ctime，进行增量拉取
+// @Description 根据上一页最后一条事件的ctime，进行增量拉取。同一个对象上的同类事件会按配置聚合成一条，
+// @Description 聚合只在一页之内进行，用户关掉的通知类型也会被过滤掉，所以每页的条数可能少于 limit
 // @Tags feed
 // @Accept json
 // @Produce json
-// @Param last_time query int64 true "上一条消息提醒的发生时间ctime"
-// @Param direction query string true "查询方向 Before 或 After last_time"
-// @Param limit query int64 true "返回消息数量限制"
-// @Success 200 {object} ginx.Result{data=[]feedv1.FeedEvent} "成功返回结果"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param direction query string true "查询方向 Before 或 After 游标"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[FeedEventVo]} "成功返回结果"
 // @Router /feed/events_list [get]
 func (h *FeedHandler) GetFeedEventsList(ctx *gin.Context, req GetFeedEventsListReq, uc ijwt.UserClaims) (ginx.Result, error) {
-	if req.Limit > 100 {
-		req.Limit = 100
-	}
 	direction, ok := feedv1.Direction_value[req.Direction]
 	if !ok {
 		return ginx.Result{
@@ -44,11 +78,81 @@ func (h *FeedHandler) GetFeedEventsList(ctx *gin.Context, req GetFeedEventsListR
 			Msg:  "不合法的查询方向",
 		}, nil
 	}
+	cur, err := h.decodeCursor(ctx, req, feedv1.Direction(direction))
+	if err != nil {
+		return ginx.Result{
+			Code: errs.FeedInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
+	}
+	items, more, err := cur.Find(ctx, h.feedClient, uc.Uid, h.pager.Size(req.Limit))
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	settings, err := h.settings.Get(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	// 先按原始事件分页，聚合和过滤都在这一页之内
+	page := ginx.Page[*feedv1.FeedEvent]{Items: items, HasMore: more}
+	if page.HasMore {
+		page.NextCursor = h.encodeCursor(ctx, cur.Next(page.Items))
+	}
+	events := slices.DeleteFunc(slices.Clone(page.Items), func(evt *feedv1.FeedEvent) bool {
+		return !h.presenter.Notify(settings, evt)
+	})
+	vos, degraded, err := h.presenter.Present(ctx, events)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+		Data: ginx.Page[FeedEventVo]{
+			Items:      vos,
+			NextCursor: page.NextCursor,
+			HasMore:    page.HasMore,
+		},
+		Degraded: degraded,
+	}, nil
+}
+
+// UnreadCount 未读数
+// @Summary 未读数
+// @Description 按事件类型分别统计，最多往前数 200 条，用户关掉的通知类型不计入
+// @Tags feed
+// @Produce json
+// @Success 200 {object} ginx.Result{data=FeedUnreadCountVo} "成功返回结果"
+// @Router /feed/unread_count [get]
+func (h *FeedHandler) UnreadCount(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	cursor, err := h.readState.Get(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	settings, err := h.settings.Get(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	vo := FeedUnreadCountVo{ByType: make(map[string]int64)}
+	// 从新往旧数，数到全部已读的游标为止
 	res, err := h.feedClient.FindFeedEvents(ctx, &feedv1.FindFeedEventsRequest{
 		Uid:       uc.Uid,
-		LastTime:  req.LastTime,
-		Direction: feedv1.Direction(direction),
-		Limit:     req.Limit,
+		Direction: feedv1.Direction_Before,
+		Limit:     feedMaxUnreadScan,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -56,8 +160,202 @@ func (h *FeedHandler) GetFeedEventsList(ctx *gin.Context, req GetFeedEventsListR
 			Msg:  "系统异常",
 		}, err
 	}
+	events := res.GetFeedEvents()
+	vo.Truncated = len(events) >= feedMaxUnreadScan
+	for _, evt := range events {
+		if evt.GetCtime() <= cursor.All {
+			vo.Truncated = false
+			break
+		}
+		if !cursor.IsRead(evt) && h.presenter.Notify(settings, evt) {
+			vo.Total++
+			vo.ByType[evt.GetType()]++
+		}
+	}
 	return ginx.Result{
 		Msg:  "Success",
-		Data: res.GetFeedEvents(),
+		Data: vo,
 	}, nil
 }
+
+// MarkRead 标记已读
+// @Summary 标记已读
+// @Description 不传 type 和 event_id 是全部已读，传 type 是这一类全部已读，传 event_id 是这一条已读。
+// @Description type 只能是 feed.types 里配置了的事件类型
+// @Tags feed
+// @Accept json
+// @Produce json
+// @Param request body FeedMarkReadReq true "标记已读请求体"
+// @Success 200 {object} ginx.Result "成功返回结果"
+// @Router /feed/mark_read [post]
+func (h *FeedHandler) MarkRead(ctx *gin.Context, req FeedMarkReadReq, uc ijwt.UserClaims) (ginx.Result, error) {
+	if req.Type != "" && req.EventId != 0 || req.EventId < 0 {
+		return ginx.Result{
+			Code: errs.FeedInvalidInput,
+			Msg:  "type 和 event_id 只能传一个",
+		}, nil
+	}
+	if req.Type != "" && !h.presenter.HasType(req.Type) {
+		return ginx.Result{
+			Code: errs.FeedInvalidInput,
+			Msg:  "不认识的事件类型",
+		}, nil
+	}
+	var err error
+	if req.EventId > 0 {
+		err = h.readState.MarkEvent(ctx, uc.Uid, req.EventId)
+	} else {
+		// 游标用最新一条事件的 ctime 而不是当前时间，和 feed 服务的时钟对不齐也不会漏掉新事件
+		var res *feedv1.FindFeedEventsResponse
+		res, err = h.feedClient.FindFeedEvents(ctx, &feedv1.FindFeedEventsRequest{
+			Uid:       uc.Uid,
+			Direction: feedv1.Direction_Before,
+			Limit:     1,
+		})
+		if err != nil || len(res.GetFeedEvents()) == 0 {
+			return h.markReadResult(err)
+		}
+		latest := res.GetFeedEvents()[0].GetCtime()
+		if req.Type != "" {
+			err = h.readState.MarkType(ctx, uc.Uid, req.Type, latest)
+		} else {
+			err = h.readState.MarkAll(ctx, uc.Uid, latest)
+		}
+	}
+	return h.markReadResult(err)
+}
+
+func (h *FeedHandler) markReadResult(err error) (ginx.Result, error) {
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg: "Success",
+	}, nil
+}
+
+// FeedCursor 同一个 ctime 上可能有多条事件，只用 ctime 翻页会在页的边界上漏掉或者重复，
+// 所以游标里是上一页最后一条事件的 (ctime, id)，页内按 (ctime, id) 排序。
+// 游标也带上查询方向，不能拿 Before 的游标去查 After。邮件摘要这样在后台翻 feed 的也用它
+type FeedCursor struct {
+	direction feedv1.Direction
+	// 第一页为 false
+	valid bool
+	ctime int64
+	id    int64
+	// 这个 ctime 上已经返回过的条数
+	seen int64
+}
+
+// NewFeedCursor 第一页的游标
+func NewFeedCursor(direction feedv1.Direction) FeedCursor {
+	return FeedCursor{direction: direction}
+}
+
+func (h *FeedHandler) decodeCursor(ctx *gin.Context, req GetFeedEventsListReq, direction feedv1.Direction) (FeedCursor, error) {
+	fields, err := h.pager.DecodeFields(ctx, req.PageReq, 4)
+	if err != nil {
+		return FeedCursor{}, err
+	}
+	if fields == nil {
+		return FeedCursor{direction: direction}, nil
+	}
+	if feedv1.Direction(fields[0]) != direction || fields[3] < 0 {
+		return FeedCursor{}, ginx.ErrInvalidCursor
+	}
+	return FeedCursor{direction: direction, valid: true, ctime: fields[1], id: fields[2], seen: fields[3]}, nil
+}
+
+func (h *FeedHandler) encodeCursor(ctx *gin.Context, cur FeedCursor) string {
+	return h.pager.EncodeFields(ctx, int64(cur.direction), cur.ctime, cur.id, cur.seen)
+}
+
+// LastTime 下游按 ctime 严格大于或者小于 LastTime 查，往外放一格，把游标所在的 ctime 也查出来
+func (c FeedCursor) LastTime() int64 {
+	switch {
+	case !c.valid:
+		return 0
+	case c.direction == feedv1.Direction_After:
+		return c.ctime - 1
+	default:
+		return c.ctime + 1
+	}
+}
+
+// Limit 和游标同一个 ctime 的事件会再查出来，按 id 去掉返回过的，所以要查 size 条新的事件就得多查 seen 条
+func (c FeedCursor) Limit(size int64) int64 {
+	return size + c.seen
+}
+
+// Find 按翻页的顺序查游标之后最多 size 条事件，more 表示后面还有，这时至少有一条。
+// 下游只按 ctime 排序，同一个 ctime 上的事件谁先谁后不固定，查满 limit 条时最后一个 ctime 上可能只查出来一部分，
+// 拿这一部分翻页会漏掉没查出来的，所以去掉留到下一页；去掉之后一条都不剩的，加大 limit 重查
+func (c FeedCursor) Find(ctx context.Context, client feedv1.FeedServiceClient, uid int64, size int64) ([]*feedv1.FeedEvent, bool, error) {
+	// 多查一条，用来判断还有没有下一页
+	limit := c.Limit(size + 1)
+	for {
+		resp, err := client.FindFeedEvents(ctx, &feedv1.FindFeedEventsRequest{
+			Uid:       uid,
+			LastTime:  c.LastTime(),
+			Direction: c.direction,
+			Limit:     limit,
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		events := c.Filter(resp.GetFeedEvents())
+		if int64(len(resp.GetFeedEvents())) < limit {
+			return events[:min(int64(len(events)), size)], int64(len(events)) > size, nil
+		}
+		if len(events) > 0 {
+			boundary := events[len(events)-1].GetCtime()
+			events = slices.DeleteFunc(events, func(evt *feedv1.FeedEvent) bool {
+				return evt.GetCtime() == boundary
+			})
+		}
+		if len(events) > 0 {
+			return events[:min(int64(len(events)), size)], true, nil
+		}
+		limit *= 2
+	}
+}
+
+// Filter 按 (ctime, id) 排好序，去掉游标和它之前的事件
+func (c FeedCursor) Filter(events []*feedv1.FeedEvent) []*feedv1.FeedEvent {
+	slices.SortFunc(events, func(a, b *feedv1.FeedEvent) int {
+		return c.compare(a.GetCtime(), a.GetId(), b.GetCtime(), b.GetId())
+	})
+	if !c.valid {
+		return events
+	}
+	return slices.DeleteFunc(events, func(evt *feedv1.FeedEvent) bool {
+		return c.compare(evt.GetCtime(), evt.GetId(), c.ctime, c.id) <= 0
+	})
+}
+
+// compare 按翻页的顺序比较，Before 新的在前，After 旧的在前
+func (c FeedCursor) compare(ctime1, id1, ctime2, id2 int64) int {
+	res := cmp.Or(cmp.Compare(ctime1, ctime2), cmp.Compare(id1, id2))
+	if c.direction == feedv1.Direction_After {
+		return res
+	}
+	return -res
+}
+
+// Next 下一页的游标，items 是这一页按顺序排好的事件
+func (c FeedCursor) Next(items []*feedv1.FeedEvent) FeedCursor {
+	last := items[len(items)-1]
+	next := FeedCursor{direction: c.direction, valid: true, ctime: last.GetCtime(), id: last.GetId()}
+	if c.valid && c.ctime == next.ctime {
+		next.seen = c.seen
+	}
+	for _, evt := range items {
+		if evt.GetCtime() == next.ctime {
+			next.seen++
+		}
+	}
+	return next
+}
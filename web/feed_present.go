@@ -0,0 +1,360 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/dataloader"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// FeedEvent.Content 里约定的 key，其余的 key 原样透传给前端
+const (
+	feedContentActor = "actor"  // 触发事件的用户 uid
+	feedContentBiz   = "biz"    // 事件作用的对象：evaluation、question、answer、comment、course
+	feedContentBizId = "biz_id" // 对象的 id
+)
+
+const (
+	// 聚合后最多带几个用户的头像昵称
+	feedMaxActors = 3
+	// 标题取内容的前多少个字
+	feedTitleLen = 30
+)
+
+var feedBizNames = map[string]string{
+	"evaluation": "课评",
+	"question":   "问题",
+	"answer":     "回答",
+	"comment":    "评论",
+	"course":     "课程",
+}
+
+type FeedPresentConfig struct {
+	// Links 对象的深链接模板，key 是 biz，{id} 会被换成对象的 id
+	Links map[string]string `yaml:"links"`
+	// Types 每类事件的展示方式，key 是事件类型，没配置的类型不聚合，也没有 summary
+	Types map[string]FeedTypeConfig `yaml:"types"`
+}
+
+type FeedTypeConfig struct {
+	// Action 拼在 summary 里，比如 "赞同了你的"，后面接对象的名称
+	Action string `yaml:"action"`
+	// GroupWindow 同一个对象上的同类事件，和这一组第一条相差不超过这个时间的合并成一条，0 表示不聚合
+	GroupWindow time.Duration `yaml:"groupWindow"`
+	// Setting 属于哪一类通知（comment、reply、stance、invitation），用户关掉这一类之后就看不到了，不配置的总是展示
+	Setting string `yaml:"setting"`
+}
+
+// FeedPresenter 把 feed 事件转成前端直接能展示的 FeedEventVo：
+// 补上触发者的昵称头像、对象的标题和深链接，并按配置聚合同一个对象上的同类事件。
+// 用户和对象的信息都是可选的，查不到就降级，不影响列表本身。隐藏了主页的用户不展示昵称和头像
+type FeedPresenter struct {
+	userClient       userv1.UserServiceClient
+	settings         cache.UserSettingsStore
+	evaluationClient evaluationv1.EvaluationServiceClient
+	questionClient   questionv1.QuestionServiceClient
+	answerClient     answerv1.AnswerServiceClient
+	commentClient    commentv1.CommentServiceClient
+	courseCache      cache.CourseCache
+	cfg              FeedPresentConfig
+}
+
+func NewFeedPresenter(userClient userv1.UserServiceClient, settings cache.UserSettingsStore,
+	evaluationClient evaluationv1.EvaluationServiceClient, questionClient questionv1.QuestionServiceClient,
+	answerClient answerv1.AnswerServiceClient, commentClient commentv1.CommentServiceClient,
+	courseCache cache.CourseCache, cfg FeedPresentConfig) *FeedPresenter {
+	return &FeedPresenter{
+		userClient:       userClient,
+		settings:         settings,
+		evaluationClient: evaluationClient,
+		questionClient:   questionClient,
+		answerClient:     answerClient,
+		commentClient:    commentClient,
+		courseCache:      courseCache,
+		cfg:              cfg,
+	}
+}
+
+type feedTarget struct {
+	biz   string
+	bizId int64
+}
+
+type feedGroup struct {
+	typ    string
+	target feedTarget
+	events []*feedv1.FeedEvent
+}
+
+// Setting 事件类型属于哪一类通知，没配置的返回空
+func (p *FeedPresenter) Setting(typ string) string {
+	return p.cfg.Types[strings.ToLower(typ)].Setting
+}
+
+// HasType 事件类型有没有在 feed.types 里配置
+func (p *FeedPresenter) HasType(typ string) bool {
+	_, ok := p.cfg.Types[strings.ToLower(typ)]
+	return ok
+}
+
+// Notify 用户是否要收到这条事件
+func (p *FeedPresenter) Notify(settings cache.UserSettings, evt *feedv1.FeedEvent) bool {
+	return settings.Notifications.Enabled(p.Setting(evt.GetType()))
+}
+
+// Present 返回的顺序和 events 一致，聚合出来的一组放在它第一条事件的位置上
+func (p *FeedPresenter) Present(ctx context.Context, events []*feedv1.FeedEvent) ([]FeedEventVo, []string, error) {
+	groups := p.group(events)
+	var (
+		uids    []int64
+		targets []feedTarget
+	)
+	for _, g := range groups {
+		for _, evt := range g.events {
+			if uid := feedActor(evt); uid > 0 {
+				uids = append(uids, uid)
+			}
+		}
+		if g.target.biz != "" {
+			targets = append(targets, g.target)
+		}
+	}
+
+	var (
+		users  map[int64]*userv1.User
+		titles map[feedTarget]string
+	)
+	g := aggregate.NewGroup(ctx)
+	g.Optional("user.Profile", func(ctx context.Context) error {
+		var er error
+		users, er = dataloader.NewLoader(p.fetchUser).LoadMany(ctx, uids)
+		return er
+	}, "actors", "summary")
+	g.Optional("feed.targets", func(ctx context.Context) error {
+		var er error
+		titles, er = dataloader.NewLoader(p.fetchTitle).LoadMany(ctx, targets)
+		return er
+	}, "target.title")
+	degraded, err := g.Wait()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	vos := make([]FeedEventVo, 0, len(groups))
+	for _, grp := range groups {
+		vos = append(vos, p.toVo(grp, users, titles))
+	}
+	return vos, degraded, nil
+}
+
+func (p *FeedPresenter) group(events []*feedv1.FeedEvent) []*feedGroup {
+	type groupKey struct {
+		typ    string
+		target feedTarget
+	}
+	groups := make([]*feedGroup, 0, len(events))
+	open := make(map[groupKey]*feedGroup)
+	for _, evt := range events {
+		typ := strings.ToLower(evt.GetType())
+		target := feedTargetOf(evt)
+		window := p.cfg.Types[typ].GroupWindow
+		key := groupKey{typ: typ, target: target}
+		if window > 0 && target.biz != "" {
+			if grp, ok := open[key]; ok && feedAbs(grp.events[0].GetCtime()-evt.GetCtime()) <= window.Milliseconds() {
+				grp.events = append(grp.events, evt)
+				continue
+			}
+		}
+		grp := &feedGroup{typ: typ, target: target, events: []*feedv1.FeedEvent{evt}}
+		groups = append(groups, grp)
+		if window > 0 && target.biz != "" {
+			// 超出窗口的另起一组，之后的事件都和新的这一组比
+			open[key] = grp
+		}
+	}
+	return groups
+}
+
+func (p *FeedPresenter) toVo(grp *feedGroup, users map[int64]*userv1.User, titles map[feedTarget]string) FeedEventVo {
+	first := grp.events[0]
+	vo := FeedEventVo{
+		Id:       first.GetId(),
+		Type:     first.GetType(),
+		Actors:   []FeedActorVo{},
+		EventIds: make([]int64, 0, len(grp.events)),
+		Content:  first.GetContent(),
+		Ctime:    first.GetCtime(),
+	}
+	seen := make(map[int64]struct{}, len(grp.events))
+	for _, evt := range grp.events {
+		vo.EventIds = append(vo.EventIds, evt.GetId())
+		uid := feedActor(evt)
+		if uid <= 0 {
+			continue
+		}
+		if _, ok := seen[uid]; ok {
+			continue
+		}
+		seen[uid] = struct{}{}
+		vo.ActorCount++
+		if len(vo.Actors) < feedMaxActors {
+			user := users[uid]
+			vo.Actors = append(vo.Actors, FeedActorVo{
+				Uid:      uid,
+				Nickname: user.GetNickname(),
+				Avatar:   user.GetAvatar(),
+			})
+		}
+	}
+	if grp.target.biz != "" {
+		vo.Target = &FeedTargetVo{
+			Biz:   grp.target.biz,
+			BizId: grp.target.bizId,
+			Title: titles[grp.target],
+			Link:  p.link(grp.target),
+		}
+	}
+	vo.Summary = p.summary(grp, vo)
+	return vo
+}
+
+// summary 比如 "张三 等 5 人赞同了你的课评"
+func (p *FeedPresenter) summary(grp *feedGroup, vo FeedEventVo) string {
+	tc, ok := p.cfg.Types[grp.typ]
+	if !ok || tc.Action == "" {
+		return ""
+	}
+	var sb strings.Builder
+	switch {
+	case len(vo.Actors) == 0:
+	case vo.Actors[0].Nickname == "":
+		sb.WriteString("有人")
+	default:
+		sb.WriteString(vo.Actors[0].Nickname)
+	}
+	if vo.ActorCount > 1 {
+		sb.WriteString(fmt.Sprintf(" 等 %d 人", vo.ActorCount))
+	}
+	sb.WriteString(tc.Action)
+	sb.WriteString(feedBizNames[grp.target.biz])
+	return sb.String()
+}
+
+func (p *FeedPresenter) link(target feedTarget) string {
+	tmpl, ok := p.cfg.Links[target.biz]
+	if !ok {
+		return ""
+	}
+	return strings.ReplaceAll(tmpl, "{id}", strconv.FormatInt(target.bizId, 10))
+}
+
+// 查不到的用户和对象都返回零值，不算错误
+
+// fetchUser 隐藏了主页的用户当作查不到
+func (p *FeedPresenter) fetchUser(ctx context.Context, uid int64) (*userv1.User, error) {
+	hidden, err := cache.ProfileHidden(ctx, p.settings, uid)
+	if err != nil || hidden {
+		return nil, err
+	}
+	res, err := p.userClient.Profile(ctx, &userv1.ProfileRequest{Uid: uid})
+	if err != nil {
+		if userv1.IsUserNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.GetUser(), nil
+}
+
+// fetchTitle 课评用课程名，其余的用内容的开头
+func (p *FeedPresenter) fetchTitle(ctx context.Context, target feedTarget) (string, error) {
+	switch target.biz {
+	case "evaluation":
+		res, err := p.evaluationClient.Detail(ctx, &evaluationv1.DetailRequest{EvaluationId: target.bizId})
+		if err != nil {
+			if evaluationv1.IsEvaluationNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return p.fetchTitle(ctx, feedTarget{biz: "course", bizId: res.GetEvaluation().GetCourseId()})
+	case "course":
+		course, err := p.courseCache.GetDetail(ctx, target.bizId)
+		if err != nil {
+			return "", err
+		}
+		return course.GetName(), nil
+	case "question":
+		res, err := p.questionClient.GetDetailById(ctx, &questionv1.GetDetailByIdRequest{QuestionId: target.bizId})
+		if err != nil {
+			if questionv1.IsQuestionNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return feedTitle(res.GetQuestion().GetContent()), nil
+	case "answer":
+		res, err := p.answerClient.Detail(ctx, &answerv1.DetailRequest{AnswerId: target.bizId})
+		if err != nil {
+			if answerv1.IsAnswerNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return feedTitle(res.GetAnswer().GetContent()), nil
+	case "comment":
+		res, err := p.commentClient.GetComment(ctx, &commentv1.GetCommentRequest{CommentId: target.bizId})
+		if err != nil {
+			if commentv1.IsCommentNotFound(err) {
+				return "", nil
+			}
+			return "", err
+		}
+		return feedTitle(res.GetComment().GetContent()), nil
+	default:
+		return "", nil
+	}
+}
+
+func feedActor(evt *feedv1.FeedEvent) int64 {
+	uid, _ := strconv.ParseInt(evt.GetContent()[feedContentActor], 10, 64)
+	return uid
+}
+
+// feedTargetOf 不认识的 biz 当作没有对象
+func feedTargetOf(evt *feedv1.FeedEvent) feedTarget {
+	biz := strings.ToLower(evt.GetContent()[feedContentBiz])
+	if _, ok := feedBizNames[biz]; !ok {
+		return feedTarget{}
+	}
+	bizId, err := strconv.ParseInt(evt.GetContent()[feedContentBizId], 10, 64)
+	if err != nil || bizId <= 0 {
+		return feedTarget{}
+	}
+	return feedTarget{biz: biz, bizId: bizId}
+}
+
+func feedTitle(content string) string {
+	if utf8.RuneCountInString(content) <= feedTitleLen {
+		return content
+	}
+	return string([]rune(content)[:feedTitleLen]) + "…"
+}
+
+func feedAbs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
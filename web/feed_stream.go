@@ -0,0 +1,300 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// 断线重连时一次补发多少条
+	feedReplayBatch = 50
+	// 最多补发多少条，离线太久的直接用 /feed/events_list 拉
+	feedMaxReplay = 200
+	// 建议 EventSource 断开后多久重连
+	feedRetry = 3 * time.Second
+)
+
+var errFeedSlowConsumer = errors.New("消费太慢，被断开")
+
+// Stream 实时推送 feed 事件
+// @Summary 实时推送feed事件
+// @Description 默认是 SSE，带 WebSocket 的 Upgrade 头时走 WebSocket。事件的 id 是 ctime，
+// @Description 断线重连时带上 Last-Event-ID 头（或者 last_event_id 参数）会先补发这之后的事件。
+// @Description 补发时和 Last-Event-ID 同一毫秒的事件不会再发，所以重连不会重复，但断线前没收到的同一毫秒的事件也会漏掉。
+// @Description 浏览器的 EventSource 和 WebSocket 不能带请求头，可以把 token 放在 access_token 参数里。
+// @Description 用户关掉的通知类型不推送，免打扰时段内的事件等时段结束后再补发
+// @Tags feed
+// @Produce text/event-stream
+// @Param last_event_id query int64 false "最后收到的事件的 id"
+// @Param access_token query string false "不能带 Authorization 头时用"
+// @Success 200 {object} FeedStreamMessage "WebSocket 的消息格式，SSE 的 data 是 feedv1.FeedEvent"
+// @Router /feed/stream [get]
+func (h *FeedHandler) Stream(ctx *gin.Context) {
+	uc, ok := ctx.MustGet("user").(ijwt.UserClaims)
+	if !ok {
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	lastEventId := ctx.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = ctx.Query("last_event_id")
+	}
+	var lastTime int64
+	if lastEventId != "" {
+		var err error
+		lastTime, err = strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusOK, ginx.Result{
+				Code: errs.FeedInvalidInput,
+				Msg:  "不合法的 Last-Event-ID",
+			})
+			return
+		}
+	}
+	if ctx.IsWebsocket() {
+		h.streamWebSocket(ctx, uc.Uid, lastTime)
+		return
+	}
+	h.streamSSE(ctx, uc.Uid, lastTime)
+}
+
+func (h *FeedHandler) streamSSE(ctx *gin.Context, uid int64, lastTime int64) {
+	w := ctx.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// 让 nginx 不要缓冲
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "retry: %d\n\n", feedRetry.Milliseconds())
+	w.Flush()
+	err := h.stream(ctx, uid, lastTime, func(evt *feedv1.FeedEvent) error {
+		data, err := json.Marshal(evt)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: feed\ndata: %s\n\n", evt.GetCtime(), data)
+		w.Flush()
+		return err
+	}, func() error {
+		_, err := io.WriteString(w, ": heartbeat\n\n")
+		w.Flush()
+		return err
+	})
+	if err != nil {
+		h.l.Warn("feed 推送中断", logger.Int64("uid", uid), logger.Error(err))
+	}
+}
+
+func (h *FeedHandler) streamWebSocket(ctx *gin.Context, uid int64, lastTime int64) {
+	websocket.Server{
+		// 鉴权用的是 token 而不是 cookie，不存在跨站劫持的问题，所以不校验 Origin
+		Handshake: func(*websocket.Config, *http.Request) error {
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			// 连接被接管之后客户端断开不会取消请求的 ctx，要靠读来发现
+			wsCtx, cancel := context.WithCancel(ctx.Request.Context())
+			defer cancel()
+			go func() {
+				defer cancel()
+				var msg string
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+			}()
+			err := h.stream(wsCtx, uid, lastTime, func(evt *feedv1.FeedEvent) error {
+				return websocket.JSON.Send(ws, FeedStreamMessage{
+					Type:  "feed",
+					Id:    evt.GetCtime(),
+					Event: evt,
+				})
+			}, func() error {
+				return websocket.JSON.Send(ws, FeedStreamMessage{Type: "heartbeat"})
+			})
+			if err != nil {
+				h.l.Warn("feed 推送中断", logger.Int64("uid", uid), logger.Error(err))
+			}
+		},
+	}.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+// stream 先订阅再补发，补发期间新来的事件不会丢；补发和推送重叠的部分按事件的 id 去重。
+// 用户关掉的通知类型直接跳过；免打扰时段内新事件先压着，结束后从上次推到的位置补发。
+// ctx 结束（客户端断开或者到了 http.timeout 里配置的连接时长）时正常返回，客户端重连即可
+func (h *FeedHandler) stream(ctx context.Context, uid int64, lastTime int64,
+	send func(evt *feedv1.FeedEvent) error, heartbeat func() error) error {
+	sub := h.hub.Subscribe(strconv.FormatInt(uid, 10))
+	defer sub.Close()
+
+	// 推到了哪里：lastTime 之前的都推过了，lastTime 这一毫秒上推过的是 sent 里的这些。
+	// 同一毫秒可能有多条事件，只比 ctime 会漏掉。客户端带的 Last-Event-ID 只有 ctime，
+	// 当作这一毫秒的都收到了，这时 sent 为 nil
+	var sent map[int64]struct{}
+	delivered := func(evt *feedv1.FeedEvent) bool {
+		switch {
+		case evt.GetCtime() != lastTime:
+			return evt.GetCtime() < lastTime
+		case sent == nil:
+			return true
+		default:
+			_, ok := sent[evt.GetId()]
+			return ok
+		}
+	}
+	deliver := func(settings cache.UserSettings, evt *feedv1.FeedEvent) error {
+		if delivered(evt) {
+			return nil
+		}
+		if h.presenter.Notify(settings, evt) {
+			if err := send(evt); err != nil {
+				return err
+			}
+		}
+		if evt.GetCtime() > lastTime {
+			lastTime = evt.GetCtime()
+			sent = make(map[int64]struct{})
+		}
+		sent[evt.GetId()] = struct{}{}
+		return nil
+	}
+	replay := func(settings cache.UserSettings) error {
+		for replayed := 0; replayed < feedMaxReplay; {
+			after := lastTime
+			if sent != nil {
+				// 下游按 ctime 严格大于查，lastTime 这一毫秒上可能还有没推过的
+				after--
+			}
+			res, err := h.feedClient.FindFeedEvents(ctx, &feedv1.FindFeedEventsRequest{
+				Uid:       uid,
+				LastTime:  after,
+				Direction: feedv1.Direction_After,
+				Limit:     feedReplayBatch,
+			})
+			if err != nil {
+				return err
+			}
+			for _, evt := range res.GetFeedEvents() {
+				if err = deliver(settings, evt); err != nil {
+					return err
+				}
+			}
+			replayed += len(res.GetFeedEvents())
+			if len(res.GetFeedEvents()) < feedReplayBatch {
+				return nil
+			}
+		}
+		return nil
+	}
+	// pending 表示 lastTime 之后可能有还没推的事件，要等到免打扰结束再补发
+	pending := lastTime > 0
+	flush := func() error {
+		if !pending {
+			return nil
+		}
+		settings, err := h.settings.Get(ctx, uid)
+		if err != nil {
+			return err
+		}
+		if settings.QuietHours.Contains(time.Now()) {
+			return nil
+		}
+		pending = false
+		return replay(settings)
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+		case payload, ok := <-sub.C():
+			if !ok {
+				return errFeedSlowConsumer
+			}
+			var evt feedv1.FeedEvent
+			if err := json.Unmarshal(payload, &evt); err != nil {
+				h.l.Error("解析 feed 推送失败", logger.Error(err))
+				continue
+			}
+			settings, err := h.settings.Get(ctx, uid)
+			if err != nil {
+				return err
+			}
+			if settings.QuietHours.Contains(time.Now()) {
+				if !pending && lastTime == 0 {
+					// 连上之后还没推过，补发要从这一条开始
+					lastTime = evt.GetCtime()
+					sent = make(map[int64]struct{})
+				}
+				pending = true
+				continue
+			}
+			if err = flush(); err != nil {
+				return err
+			}
+			if err = deliver(settings, &evt); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// FeedStreamHandler 消费 feed.created 事件，发布到 uid 对应的频道。
+// 消费组里只有一个实例会收到事件，靠 Hub 广播给所有实例，每个实例再推给连在自己身上的客户端
+func FeedStreamHandler(hub *pubsub.Hub) events.Handler {
+	return func(ctx context.Context, env events.Envelope) error {
+		evt, err := events.Decode[events.FeedCreated](env)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(&feedv1.FeedEvent{
+			Id:      evt.Id,
+			Type:    evt.Type,
+			Content: evt.Content,
+			Ctime:   evt.Ctime,
+		})
+		if err != nil {
+			return err
+		}
+		return hub.Publish(ctx, strconv.FormatInt(evt.Uid, 10), payload)
+	}
+}
+
+// tokenFromQuery 浏览器的 EventSource 和 WebSocket 都不能带请求头，允许把 token 放在 access_token 参数里，
+// 只挂在推送的路由上，其余接口仍然只认 Authorization 头
+func tokenFromQuery(ctx *gin.Context) {
+	if ctx.GetHeader("Authorization") != "" {
+		return
+	}
+	if token := ctx.Query("access_token"); token != "" {
+		ctx.Request.Header.Set("Authorization", "Bearer "+token)
+	}
+}
@@ -0,0 +1,95 @@
+package web
+
+import (
+	"context"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	"google.golang.org/grpc"
+	"slices"
+	"testing"
+)
+
+// testFeedClient 模拟下游：按 ctime 严格小于（Before）或者大于（After）LastTime 查，LastTime 为 0 不限制。
+// 只按 ctime 排序，同一个 ctime 上的顺序不固定，这里按 idOrder 排
+type testFeedClient struct {
+	feedv1.FeedServiceClient
+	events  []*feedv1.FeedEvent
+	idOrder int
+}
+
+func (c *testFeedClient) FindFeedEvents(ctx context.Context, in *feedv1.FindFeedEventsRequest,
+	opts ...grpc.CallOption) (*feedv1.FindFeedEventsResponse, error) {
+	var res []*feedv1.FeedEvent
+	for _, evt := range c.events {
+		switch {
+		case in.GetLastTime() == 0:
+		case in.GetDirection() == feedv1.Direction_Before && evt.GetCtime() >= in.GetLastTime():
+			continue
+		case in.GetDirection() == feedv1.Direction_After && evt.GetCtime() <= in.GetLastTime():
+			continue
+		}
+		res = append(res, evt)
+	}
+	slices.SortFunc(res, func(a, b *feedv1.FeedEvent) int {
+		if a.GetCtime() != b.GetCtime() {
+			if in.GetDirection() == feedv1.Direction_After {
+				return int(a.GetCtime() - b.GetCtime())
+			}
+			return int(b.GetCtime() - a.GetCtime())
+		}
+		return c.idOrder * int(a.GetId()-b.GetId())
+	})
+	return &feedv1.FindFeedEventsResponse{FeedEvents: res[:min(int64(len(res)), in.GetLimit())]}, nil
+}
+
+func TestFeedCursor(t *testing.T) {
+	// ctime 100 上有 5 条，跨过好几页
+	var events []*feedv1.FeedEvent
+	id := int64(0)
+	for _, ctime := range []int64{90, 100, 100, 100, 100, 100, 110, 120} {
+		id++
+		events = append(events, &feedv1.FeedEvent{Id: id, Ctime: ctime})
+	}
+	before := []int64{8, 7, 6, 5, 4, 3, 2, 1}
+	after := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	testCases := []struct {
+		name      string
+		direction feedv1.Direction
+		// 下游同一个 ctime 上按 id 正序（1）还是倒序（-1）
+		idOrder int
+		size    int64
+		want    []int64
+	}{
+		{name: "往前翻", direction: feedv1.Direction_Before, idOrder: -1, size: 2, want: before},
+		{name: "往前翻，下游顺序和翻页的相反", direction: feedv1.Direction_Before, idOrder: 1, size: 2, want: before},
+		{name: "往后翻", direction: feedv1.Direction_After, idOrder: 1, size: 2, want: after},
+		{name: "往后翻，下游顺序和翻页的相反", direction: feedv1.Direction_After, idOrder: -1, size: 2, want: after},
+		{name: "一页比同一个 ctime 的条数少", direction: feedv1.Direction_Before, idOrder: 1, size: 1, want: before},
+		{name: "一页装得下", direction: feedv1.Direction_After, idOrder: -1, size: 10, want: after},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &testFeedClient{events: events, idOrder: tc.idOrder}
+			cur := NewFeedCursor(tc.direction)
+			var got []int64
+			for page := 0; page < 20; page++ {
+				items, more, err := cur.Find(context.Background(), client, 1, tc.size)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if int64(len(items)) > tc.size {
+					t.Fatalf("一页 %d 条，超过了 %d 条", len(items), tc.size)
+				}
+				for _, evt := range items {
+					got = append(got, evt.GetId())
+				}
+				if !more {
+					break
+				}
+				cur = cur.Next(items)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("翻出来 %v，期望 %v", got, tc.want)
+			}
+		})
+	}
+}
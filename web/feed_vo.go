@@ -1,7 +1,59 @@
 package web
 
+import (
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+)
+
 type GetFeedEventsListReq struct {
-	LastTime  int64  `form:"last_time"` // 获取到的上一条消息的发生事件ctime
-	Direction string `form:"direction"` // 查询方向 before 或 after last_time
-	Limit     int64  `form:"limit"`
+	// 游标里是上一页最后一条事件的 ctime 和 id，还有查询方向
+	ginx.PageReq
+	Direction string `form:"direction"` // 查询方向 before 或 after 游标
+}
+
+// FeedEventVo 聚合之后的一条 feed，没有聚合时 event_ids 只有一个
+type FeedEventVo struct {
+	Id         int64         `json:"id"`   // 这一组里第一条事件的 id
+	Type       string        `json:"type"` // 事件类型
+	Actors     []FeedActorVo `json:"actors"`
+	ActorCount int64         `json:"actor_count"` // 去重后的总人数，actors 最多只带 3 个
+	Summary    string        `json:"summary"`     // 比如 "张三 等 5 人赞同了你的课评"，没配置的事件类型为空
+	Target     *FeedTargetVo `json:"target"`      // 事件作用的对象，没有时为 null
+	EventIds   []int64       `json:"event_ids"`   // 这一组里所有事件的 id，标记已读用
+	// 第一条事件的原始内容
+	Content map[string]string `json:"content"`
+	Ctime   int64             `json:"ctime"` // 第一条事件的 ctime
+}
+
+type FeedActorVo struct {
+	Uid      int64  `json:"uid"`
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+}
+
+type FeedTargetVo struct {
+	Biz   string `json:"biz"` // evaluation、question、answer、comment、course
+	BizId int64  `json:"biz_id"`
+	Title string `json:"title"` // 课评是课程名，其余是内容的开头，对象不存在时为空
+	Link  string `json:"link"`  // 深链接
+}
+
+type FeedUnreadCountVo struct {
+	Total  int64            `json:"total"`
+	ByType map[string]int64 `json:"by_type"`
+	// 未读太多时只数了最近的一部分，角标显示成 99+ 之类的即可
+	Truncated bool `json:"truncated"`
+}
+
+// FeedMarkReadReq type 和 event_id 都不传是全部已读，只能传一个
+type FeedMarkReadReq struct {
+	Type    string `json:"type"`
+	EventId int64  `json:"event_id"`
+}
+
+// FeedStreamMessage WebSocket 推送的消息
+type FeedStreamMessage struct {
+	Type  string            `json:"type"`            // feed 或者 heartbeat
+	Id    int64             `json:"id,omitempty"`    // 事件的 ctime，重连时作为 last_event_id
+	Event *feedv1.FeedEvent `json:"event,omitempty"` // type 为 feed 时才有
 }
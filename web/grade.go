@@ -124,7 +124,7 @@ func (h *GradeHandler) Share(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result,
 			Msg:  "登录失效，请重新登录",
 		}, err
 	}
-	err = h.producer.ProduceShareGradeEvent(ctx, events.ShareGradeEvent{
+	err = events.Produce(ctx, h.producer, uc.Uid, events.ShareGradeEvent{
 		Uid:       uc.Uid,
 		StudentId: uc.StudentId,
 		Password:  uc.Password,
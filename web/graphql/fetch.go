@@ -0,0 +1,225 @@
+package graphql
+
+import (
+	"context"
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	gql "github.com/MuxiKeStack/bff/pkg/graphql"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/ecodeclub/ekit/slice"
+	"sort"
+)
+
+// 不存在的对象返回 nil，字段为 null，不算错误
+
+// fetchUser 别人隐藏了主页时当作查不到，自己总能看到自己
+func (h *GraphQLHandler) fetchUser(ctx context.Context, uid int64) (*userv1.User, error) {
+	if uid != claims(ctx).Uid {
+		hidden, err := cache.ProfileHidden(ctx, h.settings, uid)
+		if err != nil || hidden {
+			return nil, err
+		}
+	}
+	res, err := h.userClient.Profile(ctx, &userv1.ProfileRequest{Uid: uid})
+	if err != nil {
+		if userv1.IsUserNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.GetUser(), nil
+}
+
+func (h *GraphQLHandler) fetchCourse(ctx context.Context, cid int64) (*coursev1.Course, error) {
+	return h.courseCache.GetDetail(ctx, cid)
+}
+
+// fetchEvaluation 不可见的课评只有发布者自己能看
+func (h *GraphQLHandler) fetchEvaluation(ctx context.Context, eid int64) (*evaluationv1.Evaluation, error) {
+	res, err := h.evaluationClient.Detail(ctx, &evaluationv1.DetailRequest{EvaluationId: eid})
+	if err != nil {
+		if evaluationv1.IsEvaluationNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if res.GetEvaluation().GetStatus() != evaluationv1.EvaluationStatus_Public &&
+		res.GetEvaluation().GetPublisherId() != claims(ctx).Uid {
+		return nil, gql.NewUserError("无法访问他人不可见的课评")
+	}
+	return res.GetEvaluation(), nil
+}
+
+func (h *GraphQLHandler) fetchQuestion(ctx context.Context, qid int64) (*questionv1.Question, error) {
+	res, err := h.questionClient.GetDetailById(ctx, &questionv1.GetDetailByIdRequest{QuestionId: qid})
+	if err != nil {
+		if questionv1.IsQuestionNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.GetQuestion(), nil
+}
+
+func (h *GraphQLHandler) fetchAnswer(ctx context.Context, aid int64) (*answerv1.Answer, error) {
+	res, err := h.answerClient.Detail(ctx, &answerv1.DetailRequest{AnswerId: aid})
+	if err != nil {
+		if answerv1.IsAnswerNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.GetAnswer(), nil
+}
+
+func (h *GraphQLHandler) fetchComment(ctx context.Context, cid int64) (*commentv1.Comment, error) {
+	res, err := h.commentClient.GetComment(ctx, &commentv1.GetCommentRequest{CommentId: cid})
+	if err != nil {
+		if commentv1.IsCommentNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.GetComment(), nil
+}
+
+type tagVo struct {
+	Kind  string // assessment 考核方式，feature 课程特点
+	Name  string
+	Count int64
+}
+
+const (
+	tagKindAssessment = "assessment"
+	tagKindFeature    = "feature"
+)
+
+// fetchCourseTags 课程上所有可见课评打的标签，数量多的在前
+func (h *GraphQLHandler) fetchCourseTags(ctx context.Context, cid int64) ([]tagVo, error) {
+	tags, err := h.courseCache.GetTags(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]tagVo, 0, len(tags.Assessments)+len(tags.Features))
+	for name, cnt := range tags.Assessments {
+		res = append(res, tagVo{Kind: tagKindAssessment, Name: name, Count: cnt})
+	}
+	for name, cnt := range tags.Features {
+		res = append(res, tagVo{Kind: tagKindFeature, Name: name, Count: cnt})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Count != res[j].Count {
+			return res[i].Count > res[j].Count
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+type taggerCourse struct {
+	taggerId int64
+	courseId int64
+}
+
+// fetchEvaluationTags 课评发布者给课程打的标签，每个标签的数量都是 1
+func (h *GraphQLHandler) fetchEvaluationTags(ctx context.Context, key taggerCourse) ([]tagVo, error) {
+	g := aggregate.NewGroup(ctx)
+	var (
+		atRes *tagv1.GetAssessmentTagsByTaggerBizResponse
+		ftRes *tagv1.GetFeatureTagsByTaggerBizResponse
+	)
+	g.Required("tag.GetAssessmentTagsByTaggerBiz", func(ctx context.Context) error {
+		var er error
+		atRes, er = h.tagClient.GetAssessmentTagsByTaggerBiz(ctx, &tagv1.GetAssessmentTagsByTaggerBizRequest{
+			TaggerId: key.taggerId,
+			Biz:      tagv1.Biz_Course,
+			BizId:    key.courseId,
+		})
+		return er
+	})
+	g.Required("tag.GetFeatureTagsByTaggerBiz", func(ctx context.Context) error {
+		var er error
+		ftRes, er = h.tagClient.GetFeatureTagsByTaggerBiz(ctx, &tagv1.GetFeatureTagsByTaggerBizRequest{
+			TaggerId: key.taggerId,
+			Biz:      tagv1.Biz_Course,
+			BizId:    key.courseId,
+		})
+		return er
+	})
+	_, err := g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	return append(slice.Map(atRes.GetTags(), func(idx int, src tagv1.AssessmentTag) tagVo {
+		return tagVo{Kind: tagKindAssessment, Name: src.String(), Count: 1}
+	}), slice.Map(ftRes.GetTags(), func(idx int, src tagv1.FeatureTag) tagVo {
+		return tagVo{Kind: tagKindFeature, Name: src.String(), Count: 1}
+	})...), nil
+}
+
+type stanceVo struct {
+	Mine          int32
+	TotalSupports int64
+	TotalOpposes  int64
+}
+
+// fetchStance 游客只查总数
+func (h *GraphQLHandler) fetchStance(biz stancev1.Biz) func(ctx context.Context, bizId int64, args gql.Args) (*stanceVo, error) {
+	return func(ctx context.Context, bizId int64, args gql.Args) (*stanceVo, error) {
+		if uid := claims(ctx).Uid; uid != 0 {
+			res, err := h.stanceClient.GetUserStance(ctx, &stancev1.GetUserStanceRequest{
+				Uid:   uid,
+				Biz:   biz,
+				BizId: bizId,
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &stanceVo{
+				Mine:          int32(res.GetStance()),
+				TotalSupports: res.GetTotalSupports(),
+				TotalOpposes:  res.GetTotalOpposes(),
+			}, nil
+		}
+		res, err := h.stanceClient.CountStance(ctx, &stancev1.CountStanceRequest{
+			Biz:   biz,
+			BizId: bizId,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &stanceVo{
+			TotalSupports: res.GetTotalSupports(),
+			TotalOpposes:  res.GetTotalOpposes(),
+		}, nil
+	}
+}
+
+func (h *GraphQLHandler) fetchCommentCount(biz commentv1.Biz) func(ctx context.Context, bizId int64, args gql.Args) (int64, error) {
+	return func(ctx context.Context, bizId int64, args gql.Args) (int64, error) {
+		res, err := h.commentClient.CountComment(ctx, &commentv1.CountCommentRequest{
+			Biz:   biz,
+			BizId: bizId,
+		})
+		return res.GetCount(), err
+	}
+}
+
+// fetchComments 只返回一级评论
+func (h *GraphQLHandler) fetchComments(biz commentv1.Biz) func(ctx context.Context, bizId int64, args gql.Args) ([]*commentv1.Comment, error) {
+	return func(ctx context.Context, bizId int64, args gql.Args) ([]*commentv1.Comment, error) {
+		res, err := h.commentClient.GetCommentList(ctx, &commentv1.CommentListRequest{
+			Biz:   biz,
+			BizId: bizId,
+			Limit: h.limit(args),
+		})
+		return res.GetComments(), err
+	}
+}
@@ -0,0 +1,95 @@
+package graphql
+
+import (
+	"context"
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+	gql "github.com/MuxiKeStack/bff/pkg/graphql"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/cache"
+	"github.com/MuxiKeStack/bff/web/ijwt"
+	"github.com/gin-gonic/gin"
+)
+
+// GraphQLHandler 只读的 GraphQL 网关，解析器复用和 REST 接口一样的下游客户端，
+// 前端按需选字段，不用再为了几个字段去调冗余接口
+type GraphQLHandler struct {
+	userClient       userv1.UserServiceClient
+	evaluationClient evaluationv1.EvaluationServiceClient
+	questionClient   questionv1.QuestionServiceClient
+	answerClient     answerv1.AnswerServiceClient
+	commentClient    commentv1.CommentServiceClient
+	stanceClient     stancev1.StanceServiceClient
+	tagClient        tagv1.TagServiceClient
+	courseCache      cache.CourseCache
+	settings         cache.UserSettingsStore
+	pager            *ginx.Pager
+	executor         *gql.Executor
+}
+
+func NewGraphQLHandler(userClient userv1.UserServiceClient, evaluationClient evaluationv1.EvaluationServiceClient,
+	questionClient questionv1.QuestionServiceClient, answerClient answerv1.AnswerServiceClient,
+	commentClient commentv1.CommentServiceClient, stanceClient stancev1.StanceServiceClient,
+	tagClient tagv1.TagServiceClient, courseCache cache.CourseCache, settings cache.UserSettingsStore,
+	pager *ginx.Pager, l logger.Logger, maxDepth, maxComplexity, maxQueryLength int) *GraphQLHandler {
+	h := &GraphQLHandler{
+		userClient:       userClient,
+		evaluationClient: evaluationClient,
+		questionClient:   questionClient,
+		answerClient:     answerClient,
+		commentClient:    commentClient,
+		stanceClient:     stanceClient,
+		tagClient:        tagClient,
+		courseCache:      courseCache,
+		settings:         settings,
+		pager:            pager,
+	}
+	h.executor = gql.NewExecutor(h.schema(), l).
+		MaxDepth(maxDepth).
+		MaxComplexity(maxComplexity).
+		DefaultListSize(int(pager.Size(0))).
+		MaxQueryLength(maxQueryLength)
+	return h
+}
+
+func (h *GraphQLHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
+	s.POST("/graphql", authMiddleware, ginx.WrapClaimsAndReq(h.Query))
+}
+
+// Query 执行 GraphQL 查询
+// @Summary GraphQL 查询
+// @Description 只支持 query 和 README 里列出的语法子集，字段解析失败时对应字段为 null，原因在 data.errors 里
+// @Tags GraphQL
+// @Accept json
+// @Produce json
+// @Param request body gql.Request true "查询"
+// @Success 200 {object} ginx.Result{data=gql.Response} "Success"
+// @Router /graphql [post]
+func (h *GraphQLHandler) Query(ctx *gin.Context, req gql.Request, uc ijwt.UserClaims) (ginx.Result, error) {
+	res, err := h.executor.Execute(context.WithValue(ctx, claimsKey{}, uc), req)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.GraphQLInvalidQuery,
+			Msg:  err.Error(),
+		}, err
+	}
+	return ginx.Result{
+		Msg:  "Success",
+		Data: res,
+	}, nil
+}
+
+type claimsKey struct{}
+
+// claims 游客的 Uid 是 0
+func claims(ctx context.Context) ijwt.UserClaims {
+	uc, _ := ctx.Value(claimsKey{}).(ijwt.UserClaims)
+	return uc
+}
@@ -0,0 +1,80 @@
+package graphql
+
+import (
+	"context"
+	"github.com/MuxiKeStack/bff/pkg/dataloader"
+	gql "github.com/MuxiKeStack/bff/pkg/graphql"
+	"github.com/ecodeclub/ekit/slice"
+)
+
+// 访问下游的字段按 2 计算复杂度，其余字段按 1 计算
+const downstreamCost = 2
+
+// scalar 直接从父对象上取值的字段
+func scalar[S any](fn func(src S) any) *gql.FieldDef {
+	return &gql.FieldDef{
+		Resolve: func(ctx context.Context, source any, args gql.Args) (any, error) {
+			return fn(source.(S)), nil
+		},
+	}
+}
+
+// batch 需要访问下游的字段。同一层所有父对象的 key 汇总之后交给 dataloader 去重、并发查询，
+// key 为零值表示没有关联的对象（比如匿名课评的发布者），直接返回 null 不去查。
+// typ 为 nil 表示标量
+func batch[S any, K comparable, V any](typ *gql.Object, list bool,
+	key func(ctx context.Context, src S) K,
+	fetch func(ctx context.Context, key K, args gql.Args) (V, error)) *gql.FieldDef {
+	return &gql.FieldDef{
+		Type: typ,
+		List: list,
+		Cost: downstreamCost,
+		Batch: func(ctx context.Context, sources []any, args gql.Args) ([]any, error) {
+			var zero K
+			keys := slice.Map(sources, func(idx int, src any) K {
+				return key(ctx, src.(S))
+			})
+			vals, err := dataloader.NewLoader(func(ctx context.Context, k K) (V, error) {
+				return fetch(ctx, k, args)
+			}).LoadMany(ctx, slice.FilterMap(keys, func(idx int, src K) (K, bool) {
+				return src, src != zero
+			}))
+			if err != nil {
+				return nil, err
+			}
+			return slice.Map(keys, func(idx int, k K) any {
+				if k == zero {
+					return nil
+				}
+				return vals[k]
+			}), nil
+		},
+	}
+}
+
+// root 根字段，id 参数必传
+func root[V any](typ *gql.Object, fetch func(ctx context.Context, id int64) (V, error)) *gql.FieldDef {
+	return &gql.FieldDef{
+		Type: typ,
+		Cost: downstreamCost,
+		Resolve: func(ctx context.Context, source any, args gql.Args) (any, error) {
+			id := args.Int("id", 0)
+			if id <= 0 {
+				return nil, gql.NewUserError("参数 id 不合法")
+			}
+			return fetch(ctx, id)
+		},
+	}
+}
+
+// limit 列表字段只返回前 limit 条，默认值和上限与 REST 接口的分页一致，翻页请使用 REST 接口
+func (h *GraphQLHandler) limit(args gql.Args) int64 {
+	return h.pager.Size(args.Int("limit", 0))
+}
+
+// ignoreArgs 适配不需要参数的 fetch
+func ignoreArgs[K, V any](fetch func(ctx context.Context, key K) (V, error)) func(ctx context.Context, key K, args gql.Args) (V, error) {
+	return func(ctx context.Context, key K, args gql.Args) (V, error) {
+		return fetch(ctx, key)
+	}
+}
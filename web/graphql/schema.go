@@ -0,0 +1,269 @@
+package graphql
+
+import (
+	"context"
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	gql "github.com/MuxiKeStack/bff/pkg/graphql"
+)
+
+// schema 字段名和 REST 接口的 VO 保持一致的含义，但按 GraphQL 的习惯用驼峰
+//
+//	type Query {
+//	  me: User
+//	  user(id: Int!): User
+//	  course(id: Int!): Course
+//	  evaluation(id: Int!): Evaluation
+//	  recentEvaluations(limit: Int, property: String): [Evaluation]
+//	  question(id: Int!): Question
+//	  answer(id: Int!): Answer
+//	  comment(id: Int!): Comment
+//	}
+func (h *GraphQLHandler) schema() *gql.Schema {
+	var (
+		query      = gql.NewObject("Query")
+		user       = gql.NewObject("User")
+		course     = gql.NewObject("Course")
+		evaluation = gql.NewObject("Evaluation")
+		question   = gql.NewObject("Question")
+		answer     = gql.NewObject("Answer")
+		comment    = gql.NewObject("Comment")
+		tag        = gql.NewObject("Tag")
+		stance     = gql.NewObject("Stance")
+	)
+
+	query.Fields = map[string]*gql.FieldDef{
+		"me": {
+			Type: user,
+			Cost: downstreamCost,
+			Resolve: func(ctx context.Context, source any, args gql.Args) (any, error) {
+				uid := claims(ctx).Uid
+				if uid == 0 {
+					return nil, nil
+				}
+				return h.fetchUser(ctx, uid)
+			},
+		},
+		"user":       root(user, h.fetchUser),
+		"course":     root(course, h.fetchCourse),
+		"evaluation": root(evaluation, h.fetchEvaluation),
+		"question":   root(question, h.fetchQuestion),
+		"answer":     root(answer, h.fetchAnswer),
+		"comment":    root(comment, h.fetchComment),
+		"recentEvaluations": {
+			Type: evaluation,
+			List: true,
+			Cost: downstreamCost,
+			Resolve: func(ctx context.Context, source any, args gql.Args) (any, error) {
+				property := coursev1.CourseProperty_CoursePropertyAny
+				if p := args.String("property", ""); p != "" {
+					val, ok := coursev1.CourseProperty_value[p]
+					if !ok {
+						return nil, gql.NewUserError("不合法的课程性质")
+					}
+					property = coursev1.CourseProperty(val)
+				}
+				res, err := h.evaluationClient.ListRecent(ctx, &evaluationv1.ListRecentRequest{
+					Limit:    h.limit(args),
+					Property: property,
+				})
+				return res.GetEvaluations(), err
+			},
+		},
+	}
+
+	// 只暴露公开信息，学号等敏感信息请走 /users/profile
+	user.Fields = map[string]*gql.FieldDef{
+		"id":       scalar(func(src *userv1.User) any { return src.GetId() }),
+		"nickname": scalar(func(src *userv1.User) any { return src.GetNickname() }),
+		"avatar":   scalar(func(src *userv1.User) any { return src.GetAvatar() }),
+	}
+
+	course.Fields = map[string]*gql.FieldDef{
+		"id":      scalar(func(src *coursev1.Course) any { return src.GetId() }),
+		"name":    scalar(func(src *coursev1.Course) any { return src.GetName() }),
+		"teacher": scalar(func(src *coursev1.Course) any { return src.GetTeacher() }),
+		"school":  scalar(func(src *coursev1.Course) any { return src.GetSchool() }),
+		"type":    scalar(func(src *coursev1.Course) any { return src.GetProperty().String() }),
+		"credit":  scalar(func(src *coursev1.Course) any { return src.GetCredit() }),
+		"compositeScore": batch(nil, false, courseId,
+			func(ctx context.Context, cid int64, args gql.Args) (float64, error) {
+				score, err := h.courseCache.GetCompositeScore(ctx, cid)
+				return score.Score, err
+			}),
+		"raterCount": batch(nil, false, courseId,
+			func(ctx context.Context, cid int64, args gql.Args) (int64, error) {
+				score, err := h.courseCache.GetCompositeScore(ctx, cid)
+				return score.RaterCount, err
+			}),
+		"tags": batch(tag, true, courseId,
+			func(ctx context.Context, cid int64, args gql.Args) ([]tagVo, error) {
+				return h.fetchCourseTags(ctx, cid)
+			}),
+		"evaluations": batch(evaluation, true, courseId,
+			func(ctx context.Context, cid int64, args gql.Args) ([]*evaluationv1.Evaluation, error) {
+				res, err := h.evaluationClient.ListCourse(ctx, &evaluationv1.ListCourseRequest{
+					CourseId: cid,
+					Limit:    h.limit(args),
+				})
+				return res.GetEvaluations(), err
+			}),
+		"questions": batch(question, true, courseId,
+			func(ctx context.Context, cid int64, args gql.Args) ([]*questionv1.Question, error) {
+				res, err := h.questionClient.ListBizQuestions(ctx, &questionv1.ListBizQuestionsRequest{
+					Biz:   questionv1.Biz_Course,
+					BizId: cid,
+					Limit: h.limit(args),
+				})
+				return res.GetQuestions(), err
+			}),
+	}
+
+	evaluation.Fields = map[string]*gql.FieldDef{
+		"id":          scalar(func(src *evaluationv1.Evaluation) any { return src.GetId() }),
+		"starRating":  scalar(func(src *evaluationv1.Evaluation) any { return src.GetStarRating() }),
+		"content":     scalar(func(src *evaluationv1.Evaluation) any { return src.GetContent() }),
+		"status":      scalar(func(src *evaluationv1.Evaluation) any { return src.GetStatus().String() }),
+		"isAnonymous": scalar(func(src *evaluationv1.Evaluation) any { return src.GetIsAnonymous() }),
+		"utime":       scalar(func(src *evaluationv1.Evaluation) any { return src.GetUtime() }),
+		"ctime":       scalar(func(src *evaluationv1.Evaluation) any { return src.GetCtime() }),
+		// 匿名课评只有发布者自己能看到是谁发的，其他人拿到的是 null
+		"publisher": batch(user, false,
+			func(ctx context.Context, src *evaluationv1.Evaluation) int64 {
+				if src.GetIsAnonymous() && src.GetPublisherId() != claims(ctx).Uid {
+					return 0
+				}
+				return src.GetPublisherId()
+			}, ignoreArgs(h.fetchUser)),
+		"course": batch(course, false,
+			func(ctx context.Context, src *evaluationv1.Evaluation) int64 {
+				return src.GetCourseId()
+			}, ignoreArgs(h.fetchCourse)),
+		"tags": batch(tag, true,
+			func(ctx context.Context, src *evaluationv1.Evaluation) taggerCourse {
+				return taggerCourse{taggerId: src.GetPublisherId(), courseId: src.GetCourseId()}
+			}, ignoreArgs(h.fetchEvaluationTags)),
+		"stance":       batch(stance, false, evaluationId, h.fetchStance(stancev1.Biz_Evaluation)),
+		"commentCount": batch(nil, false, evaluationId, h.fetchCommentCount(commentv1.Biz_Evaluation)),
+		"comments":     batch(comment, true, evaluationId, h.fetchComments(commentv1.Biz_Evaluation)),
+	}
+
+	question.Fields = map[string]*gql.FieldDef{
+		"id":      scalar(func(src *questionv1.Question) any { return src.GetId() }),
+		"biz":     scalar(func(src *questionv1.Question) any { return src.GetBiz().String() }),
+		"bizId":   scalar(func(src *questionv1.Question) any { return src.GetBizId() }),
+		"content": scalar(func(src *questionv1.Question) any { return src.GetContent() }),
+		"utime":   scalar(func(src *questionv1.Question) any { return src.GetUtime() }),
+		"ctime":   scalar(func(src *questionv1.Question) any { return src.GetCtime() }),
+		"questioner": batch(user, false,
+			func(ctx context.Context, src *questionv1.Question) int64 {
+				return src.GetQuestionerId()
+			}, ignoreArgs(h.fetchUser)),
+		// 针对课程的提问才有 course
+		"course": batch(course, false,
+			func(ctx context.Context, src *questionv1.Question) int64 {
+				if src.GetBiz() != questionv1.Biz_Course {
+					return 0
+				}
+				return src.GetBizId()
+			}, ignoreArgs(h.fetchCourse)),
+		"answerCount": batch(nil, false, questionId,
+			func(ctx context.Context, qid int64, args gql.Args) (int64, error) {
+				res, err := h.answerClient.CountForQuestion(ctx, &answerv1.CountForQuestionRequest{QuestionId: qid})
+				return res.GetCnt(), err
+			}),
+		"answers": batch(answer, true, questionId,
+			func(ctx context.Context, qid int64, args gql.Args) ([]*answerv1.Answer, error) {
+				res, err := h.answerClient.ListForQuestion(ctx, &answerv1.ListForQuestionRequest{
+					QuestionId: qid,
+					Limit:      h.limit(args),
+				})
+				return res.GetAnswers(), err
+			}),
+	}
+
+	answer.Fields = map[string]*gql.FieldDef{
+		"id":      scalar(func(src *answerv1.Answer) any { return src.GetId() }),
+		"content": scalar(func(src *answerv1.Answer) any { return src.GetContent() }),
+		"utime":   scalar(func(src *answerv1.Answer) any { return src.GetUtime() }),
+		"ctime":   scalar(func(src *answerv1.Answer) any { return src.GetCtime() }),
+		"publisher": batch(user, false,
+			func(ctx context.Context, src *answerv1.Answer) int64 {
+				return src.GetPublisherId()
+			}, ignoreArgs(h.fetchUser)),
+		"question": batch(question, false,
+			func(ctx context.Context, src *answerv1.Answer) int64 {
+				return src.GetQuestionId()
+			}, ignoreArgs(h.fetchQuestion)),
+		"stance":       batch(stance, false, answerId, h.fetchStance(stancev1.Biz_Answer)),
+		"commentCount": batch(nil, false, answerId, h.fetchCommentCount(commentv1.Biz_Answer)),
+		"comments":     batch(comment, true, answerId, h.fetchComments(commentv1.Biz_Answer)),
+	}
+
+	comment.Fields = map[string]*gql.FieldDef{
+		"id":              scalar(func(src *commentv1.Comment) any { return src.GetId() }),
+		"biz":             scalar(func(src *commentv1.Comment) any { return src.GetBiz().String() }),
+		"bizId":           scalar(func(src *commentv1.Comment) any { return src.GetBizId() }),
+		"content":         scalar(func(src *commentv1.Comment) any { return src.GetContent() }),
+		"rootCommentId":   scalar(func(src *commentv1.Comment) any { return src.GetRootComment().GetId() }),
+		"parentCommentId": scalar(func(src *commentv1.Comment) any { return src.GetParentComment().GetId() }),
+		"utime":           scalar(func(src *commentv1.Comment) any { return src.GetUtime() }),
+		"ctime":           scalar(func(src *commentv1.Comment) any { return src.GetCtime() }),
+		"commentator": batch(user, false,
+			func(ctx context.Context, src *commentv1.Comment) int64 {
+				return src.GetCommentatorId()
+			}, ignoreArgs(h.fetchUser)),
+		"replyTo": batch(user, false,
+			func(ctx context.Context, src *commentv1.Comment) int64 {
+				return src.GetReplyToUid()
+			}, ignoreArgs(h.fetchUser)),
+		// 和 /comments/replies/list 一样，二级及以下的回复都拍平在根评论下面
+		"replies": batch(comment, true,
+			func(ctx context.Context, src *commentv1.Comment) int64 {
+				return src.GetId()
+			},
+			func(ctx context.Context, rid int64, args gql.Args) ([]*commentv1.Comment, error) {
+				res, err := h.commentClient.GetMoreReplies(ctx, &commentv1.GetMoreRepliesRequest{
+					Rid:   rid,
+					Limit: h.limit(args),
+				})
+				return res.GetReplies(), err
+			}),
+	}
+
+	// kind 是 assessment（考核方式）或者 feature（课程特点）
+	tag.Fields = map[string]*gql.FieldDef{
+		"kind":  scalar(func(src tagVo) any { return src.Kind }),
+		"name":  scalar(func(src tagVo) any { return src.Name }),
+		"count": scalar(func(src tagVo) any { return src.Count }),
+	}
+
+	// mine 是自己的表态，取值和 REST 接口的 stance 一致，游客永远是 0
+	stance.Fields = map[string]*gql.FieldDef{
+		"mine":          scalar(func(src *stanceVo) any { return src.Mine }),
+		"totalSupports": scalar(func(src *stanceVo) any { return src.TotalSupports }),
+		"totalOpposes":  scalar(func(src *stanceVo) any { return src.TotalOpposes }),
+	}
+	return &gql.Schema{Query: query}
+}
+
+func courseId(ctx context.Context, src *coursev1.Course) int64 {
+	return src.GetId()
+}
+
+func evaluationId(ctx context.Context, src *evaluationv1.Evaluation) int64 {
+	return src.GetId()
+}
+
+func questionId(ctx context.Context, src *questionv1.Question) int64 {
+	return src.GetId()
+}
+
+func answerId(ctx context.Context, src *answerv1.Answer) int64 {
+	return src.GetId()
+}
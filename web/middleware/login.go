@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"errors"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/set"
 	"github.com/gin-gonic/gin"
@@ -11,29 +12,21 @@ import (
 )
 
 type LoginMiddlewareBuilder struct {
-	allowRestrictedAccessPaths set.Set[string]
+	// 游客也可以访问的路由，用注册路由时的 pattern，例如 /evaluations/:evaluationId/detail，可以动态修改
+	allowRestrictedAccessPaths *dynconf.Value[set.Set[string]]
 	ijwt.Handler
 }
 
-func NewLoginMiddleWareBuilder(hdl ijwt.Handler) *LoginMiddlewareBuilder {
-	s := set.NewMapSet[string](3)
-	s.Add("/evaluations/list/all")
+func NewLoginMiddleWareBuilder(hdl ijwt.Handler, allowRestrictedAccessPaths *dynconf.Value[set.Set[string]]) *LoginMiddlewareBuilder {
 	l := &LoginMiddlewareBuilder{
-		allowRestrictedAccessPaths: s,
+		allowRestrictedAccessPaths: allowRestrictedAccessPaths,
 		Handler:                    hdl,
 	}
 	return l
 }
 
-func (m *LoginMiddlewareBuilder) allowRestrictedAccess(path string) bool {
-	if m.allowRestrictedAccessPaths.Exist(path) {
-		return true
-	}
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-	if len(parts) == 3 && parts[0] == "evaluations" && parts[2] == "detail" {
-		return true
-	}
-	return false
+func (m *LoginMiddlewareBuilder) allowRestrictedAccess(pattern string) bool {
+	return m.allowRestrictedAccessPaths.Load().Exist(pattern)
 }
 
 func (m *LoginMiddlewareBuilder) Build() gin.HandlerFunc {
@@ -42,7 +35,7 @@ func (m *LoginMiddlewareBuilder) Build() gin.HandlerFunc {
 		if err == nil {
 			ctx.Set("user", uc)
 		} else {
-			if m.allowRestrictedAccess(ctx.Request.URL.Path) {
+			if m.allowRestrictedAccess(ctx.FullPath()) {
 				// 放行游客可访问的路由，
 				ctx.Set("user", uc)
 			} else {
@@ -1,33 +1,43 @@
 package web
 
 import (
+	"context"
 	"fmt"
 	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
 	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
 	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
+	"github.com/MuxiKeStack/bff/pkg/dataloader"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
 	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/ecodeclub/ekit/slice"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/sync/errgroup"
 	"strconv"
 )
 
 type QuestionHandler struct {
 	question questionv1.QuestionServiceClient
 	user     userv1.UserServiceClient
+	settings cache.UserSettingsStore
 	answer   answerv1.AnswerServiceClient
+	producer events.Producer
+	pager    *ginx.Pager
 	l        logger.Logger
 }
 
 func NewQuestionHandler(question questionv1.QuestionServiceClient, user userv1.UserServiceClient,
-	answer answerv1.AnswerServiceClient, l logger.Logger) *QuestionHandler {
+	settings cache.UserSettingsStore, answer answerv1.AnswerServiceClient, producer events.Producer, pager *ginx.Pager, l logger.Logger) *QuestionHandler {
 	return &QuestionHandler{
 		question: question,
 		user:     user,
+		settings: settings,
 		answer:   answer,
+		producer: producer,
+		pager:    pager,
 		l:        l,
 	}
 }
@@ -74,6 +84,17 @@ func (h *QuestionHandler) Publish(ctx *gin.Context, req QuestionPublishReq, uc i
 			Msg:  "系统异常",
 		}, err
 	}
+	// 失败了只打日志，不影响发布
+	err = events.Produce(ctx, h.producer, uc.Uid, events.QuestionPublished{
+		Id:           res.GetQuestionId(),
+		Biz:          req.Biz,
+		BizId:        req.BizId,
+		QuestionerId: uc.Uid,
+		Content:      req.Content,
+	})
+	if err != nil {
+		h.l.Error("发送问题发布事件失败", logger.Error(err), logger.Int64("questionId", res.GetQuestionId()))
+	}
 	return ginx.Result{
 		Msg:  "Success",
 		Data: res.GetQuestionId(), // 这里给前端标明是questionId
@@ -87,9 +108,9 @@ func (h *QuestionHandler) Publish(ctx *gin.Context, req QuestionPublishReq, uc i
 // @Accept json
 // @Produce json
 // @Param questionId path int true "问题ID"
-// @Param limit query int true "邀请人数限制" default(10)
-// @Param cur_uid query int true "当前id，游标的感觉" default(0)
-// @Success 200 {object} ginx.Result{data=[]InviteesVo} "Success"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[InviteesVo]} "Success"
 // @Router /questions/{questionId}/recommendation_invitees [get]
 func (h *QuestionHandler) RecommendationInvitees(ctx *gin.Context, req RecommendationInviteesReq, uc ijwt.UserClaims) (ginx.Result, error) {
 	qidStr := ctx.Param("questionId")
@@ -100,11 +121,19 @@ func (h *QuestionHandler) RecommendationInvitees(ctx *gin.Context, req Recommend
 			Msg:  "输入参数有误",
 		}, err
 	}
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.QuestionInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
+	}
 	// 用cid拿到，上过该课的用户uids
 	res, err := h.question.GetRecommendationInviteeUids(ctx, &questionv1.GetRecommendationInviteeUidsRequest{
 		QuestionId: qid,
-		CurUid:     req.CurUid,
-		Limit:      req.Limit + 1, // 多拿一个，为了保证存在我自身的时候，也能返回给前端十个
+		CurUid:     cur,
+		// 多拿两个，一个是为了保证存在我自身的时候，也能返回给前端 limit 个，一个用来判断还有没有下一页
+		Limit: h.pager.Size(req.Limit) + 2,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -112,18 +141,26 @@ func (h *QuestionHandler) RecommendationInvitees(ctx *gin.Context, req Recommend
 			Msg:  "系统异常",
 		}, err
 	}
-	invitees := make([]int64, 0, req.Limit)
+	invitees := make([]int64, 0, len(res.GetInviteeUids()))
 	for _, invitee := range res.GetInviteeUids() {
 		if invitee != uc.Uid {
 			invitees = append(invitees, invitee)
 		}
 	}
-	// 超过limit 只保留 limit
-	if len(invitees) > int(req.Limit) {
-		invitees = invitees[:req.Limit]
-	}
+	// 超过 limit 的截掉，顺便判断还有没有下一页
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, invitees, func(uid int64) int64 {
+		return uid
+	})
 	// 在这里聚合用户信息
-	inviteesVos := slice.Map(invitees, func(idx int, src int64) InviteesVo {
+	inviteesVos := slice.Map(page.Items, func(idx int, src int64) InviteesVo {
+		// 隐藏了主页的只给 uid，查不到设置时也按隐藏处理
+		hidden, err := cache.ProfileHidden(ctx, h.settings, src)
+		if err != nil {
+			h.l.Error("查询用户设置失败", logger.Error(err), logger.Int64("uid", src))
+		}
+		if hidden || err != nil {
+			return InviteesVo{Uid: src, Hidden: true}
+		}
 		// 降级了的话可以直接不聚合
 		res, err := h.user.Profile(ctx, &userv1.ProfileRequest{
 			Uid: src,
@@ -134,13 +171,17 @@ func (h *QuestionHandler) RecommendationInvitees(ctx *gin.Context, req Recommend
 		}
 		return InviteesVo{
 			Uid:      src,
-			Nickname: res.User.Nickname,
-			Avatar:   res.User.Avatar,
+			Nickname: res.GetUser().GetNickname(),
+			Avatar:   res.GetUser().GetAvatar(),
 		}
 	})
 	return ginx.Result{
-		Msg:  "Success",
-		Data: inviteesVos,
+		Msg: "Success",
+		Data: ginx.Page[InviteesVo]{
+			Items:      inviteesVos,
+			NextCursor: page.NextCursor,
+			HasMore:    page.HasMore,
+		},
 	}, nil
 }
 
@@ -283,9 +324,9 @@ func (h *QuestionHandler) CountBiz(ctx *gin.Context, req QuestionCountBizReq) (g
 // @Produce json
 // @Param biz query string true "业务类型"
 // @Param biz_id query int64 true "业务ID"
-// @Param cur_question_id query int64 true "当前问题ID，用于分页"
-// @Param limit query int64 true "返回问题的数量限制"
-// @Success 200 {object} ginx.Result{data=[]QuestionVo} "成功返回问题列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[QuestionVo]} "成功返回问题列表"
 // @Router /questions/list [get]
 func (h *QuestionHandler) ListBiz(ctx *gin.Context, req QuestionListBizReq) (ginx.Result, error) {
 	biz, ok := questionv1.Biz_value[req.Biz]
@@ -295,14 +336,18 @@ func (h *QuestionHandler) ListBiz(ctx *gin.Context, req QuestionListBizReq) (gin
 			Msg:  "未找到业务",
 		}, fmt.Errorf("未找到业务: %s", req.Biz)
 	}
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.QuestionInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.question.ListBizQuestions(ctx, &questionv1.ListBizQuestionsRequest{
 		Biz:           questionv1.Biz(biz),
 		BizId:         req.BizId,
-		CurQuestionId: req.CurQuestionId,
-		Limit:         req.Limit,
+		CurQuestionId: cur,
+		Limit:         h.pager.Size(req.Limit) + 1,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -310,7 +355,7 @@ func (h *QuestionHandler) ListBiz(ctx *gin.Context, req QuestionListBizReq) (gin
 			Msg:  "系统异常",
 		}, err
 	}
-	questionVos := slice.Map(res.GetQuestions(), func(idx int, src *questionv1.Question) QuestionVo {
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetQuestions(), func(idx int, src *questionv1.Question) QuestionVo {
 		return QuestionVo{
 			Id:           src.GetId(),
 			QuestionerId: src.GetQuestionerId(),
@@ -320,29 +365,11 @@ func (h *QuestionHandler) ListBiz(ctx *gin.Context, req QuestionListBizReq) (gin
 			Utime:        src.GetUtime(),
 			Ctime:        src.GetCtime(),
 		}
+	}), func(vo QuestionVo) int64 {
+		return vo.Id
 	})
-	var eg errgroup.Group
-	for i := range questionVos {
-		eg.Go(func() error {
-			// 聚合 cnt 和 第一条
-			cntRes, er := h.answer.CountForQuestion(ctx, &answerv1.CountForQuestionRequest{QuestionId: questionVos[i].QuestionerId})
-			if er != nil {
-				return er
-			}
-			questionVos[i].AnswerCnt = cntRes.GetCnt()
-			listRes, er := h.answer.ListForQuestion(ctx, &answerv1.ListForQuestionRequest{
-				QuestionId:  questionVos[i].Id,
-				CurAnswerId: 0,
-				Limit:       1,
-			})
-			if er != nil {
-				return er
-			}
-			questionVos[i].PreviewAnswers = listRes.GetAnswers()
-			return nil
-		})
-	}
-	err = eg.Wait()
+	questionVos := page.Items
+	err = h.aggregateAnswers(ctx, questionVos)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -351,7 +378,7 @@ func (h *QuestionHandler) ListBiz(ctx *gin.Context, req QuestionListBizReq) (gin
 	}
 	return ginx.Result{
 		Msg:  "Success",
-		Data: questionVos,
+		Data: page,
 	}, nil
 }
 
@@ -360,18 +387,22 @@ func (h *QuestionHandler) ListBiz(ctx *gin.Context, req QuestionListBizReq) (gin
 // @Tags 问题
 // @Accept json
 // @Produce json
-// @Param cur_question_id query int64 true "当前问题ID，用于分页"
-// @Param limit query int64 true "返回问题的数量限制"
-// @Success 200 {object} ginx.Result{data=[]QuestionVo} "成功返回问题列表"
+// @Param cursor query string false "上一页返回的 next_cursor，第一页不传"
+// @Param limit query int64 false "每页数量，默认 20，最多 100"
+// @Success 200 {object} ginx.Result{data=ginx.Page[QuestionVo]} "成功返回问题列表"
 // @Router /questions/list/mine [get]
 func (h *QuestionHandler) ListMine(ctx *gin.Context, req QuestionListMineReq, uc ijwt.UserClaims) (ginx.Result, error) {
-	if req.Limit > 100 {
-		req.Limit = 100
+	cur, err := h.pager.Decode(ctx, req.PageReq)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.QuestionInvalidInput,
+			Msg:  "不合法的分页游标",
+		}, err
 	}
 	res, err := h.question.ListUserQuestions(ctx, &questionv1.ListUserQuestionsRequest{
 		Uid:           uc.Uid,
-		CurQuestionId: req.CurQuestionId,
-		Limit:         req.Limit,
+		CurQuestionId: cur,
+		Limit:         h.pager.Size(req.Limit) + 1,
 	})
 	if err != nil {
 		return ginx.Result{
@@ -379,7 +410,7 @@ func (h *QuestionHandler) ListMine(ctx *gin.Context, req QuestionListMineReq, uc
 			Msg:  "系统异常",
 		}, err
 	}
-	questionVos := slice.Map(res.GetQuestions(), func(idx int, src *questionv1.Question) QuestionVo {
+	page := ginx.NewPage(ctx, h.pager, req.PageReq, slice.Map(res.GetQuestions(), func(idx int, src *questionv1.Question) QuestionVo {
 		return QuestionVo{
 			Id:           src.GetId(),
 			QuestionerId: src.GetQuestionerId(),
@@ -389,29 +420,11 @@ func (h *QuestionHandler) ListMine(ctx *gin.Context, req QuestionListMineReq, uc
 			Utime:        src.GetUtime(),
 			Ctime:        src.GetCtime(),
 		}
+	}), func(vo QuestionVo) int64 {
+		return vo.Id
 	})
-	var eg errgroup.Group
-	for i := range questionVos {
-		eg.Go(func() error {
-			// 聚合 cnt 和 第一条
-			cntRes, er := h.answer.CountForQuestion(ctx, &answerv1.CountForQuestionRequest{QuestionId: questionVos[i].QuestionerId})
-			if er != nil {
-				return er
-			}
-			questionVos[i].AnswerCnt = cntRes.GetCnt()
-			listRes, er := h.answer.ListForQuestion(ctx, &answerv1.ListForQuestionRequest{
-				QuestionId:  questionVos[i].Id,
-				CurAnswerId: 0,
-				Limit:       1,
-			})
-			if er != nil {
-				return er
-			}
-			questionVos[i].PreviewAnswers = listRes.GetAnswers()
-			return nil
-		})
-	}
-	err = eg.Wait()
+	questionVos := page.Items
+	err = h.aggregateAnswers(ctx, questionVos)
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -420,6 +433,47 @@ func (h *QuestionHandler) ListMine(ctx *gin.Context, req QuestionListMineReq, uc
 	}
 	return ginx.Result{
 		Msg:  "Success",
-		Data: questionVos,
+		Data: page,
 	}, nil
 }
+
+// aggregateAnswers 为列表里的问题聚合回答数和第一条回答
+func (h *QuestionHandler) aggregateAnswers(ctx context.Context, questionVos []QuestionVo) error {
+	qids := slice.Map(questionVos, func(idx int, src QuestionVo) int64 {
+		return src.Id
+	})
+	g := aggregate.NewGroup(ctx)
+	var (
+		cnts     map[int64]int64
+		previews map[int64][]*answerv1.Answer
+	)
+	g.Required("answer.CountForQuestion", func(ctx context.Context) error {
+		var er error
+		cnts, er = dataloader.NewLoader(func(ctx context.Context, qid int64) (int64, error) {
+			res, err := h.answer.CountForQuestion(ctx, &answerv1.CountForQuestionRequest{QuestionId: qid})
+			return res.GetCnt(), err
+		}).LoadMany(ctx, qids)
+		return er
+	})
+	g.Required("answer.ListForQuestion", func(ctx context.Context) error {
+		var er error
+		previews, er = dataloader.NewLoader(func(ctx context.Context, qid int64) ([]*answerv1.Answer, error) {
+			res, err := h.answer.ListForQuestion(ctx, &answerv1.ListForQuestionRequest{
+				QuestionId:  qid,
+				CurAnswerId: 0,
+				Limit:       1,
+			})
+			return res.GetAnswers(), err
+		}).LoadMany(ctx, qids)
+		return er
+	})
+	_, err := g.Wait()
+	if err != nil {
+		return err
+	}
+	for i := range questionVos {
+		questionVos[i].AnswerCnt = cnts[questionVos[i].Id]
+		questionVos[i].PreviewAnswers = previews[questionVos[i].Id]
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package web
 
-import answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+import (
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	"github.com/MuxiKeStack/bff/pkg/ginx"
+)
 
 type QuestionPublishReq struct {
 	Content string `json:"content"`
@@ -9,14 +12,14 @@ type QuestionPublishReq struct {
 }
 
 type RecommendationInviteesReq struct {
-	CurUid int64 `form:"cur_uid"` // 第一页用 0 ，之后每次携带上一页的最后一个uid
-	Limit  int64 `form:"limit"`
+	ginx.PageReq
 }
 
 type InviteesVo struct {
 	Uid      int64  `json:"uid"`
 	Nickname string `json:"nickname"`
 	Avatar   string `json:"avatar"`
+	Hidden   bool   `json:"hidden"` // 对方隐藏了主页，昵称和头像为空
 }
 
 type QuestionVo struct {
@@ -37,13 +40,11 @@ type QuestionCountBizReq struct {
 }
 
 type QuestionListBizReq struct {
-	Biz           string `form:"biz"`
-	BizId         int64  `form:"biz_id"`
-	CurQuestionId int64  `form:"cur_question_id"` // 第一页用 0 ，之后每次携带上一页的最后一个uid
-	Limit         int64  `form:"limit"`
+	Biz   string `form:"biz"`
+	BizId int64  `form:"biz_id"`
+	ginx.PageReq
 }
 
 type QuestionListMineReq struct {
-	CurQuestionId int64 `form:"cur_question_id"` // 第一页用 0 ，之后每次携带上一页的最后一个uid
-	Limit         int64 `form:"limit"`
+	ginx.PageReq
 }
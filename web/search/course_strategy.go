@@ -3,19 +3,17 @@ package search
 import (
 	"context"
 	"fmt"
-	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
 	searchv1 "github.com/MuxiKeStack/be-api/gen/proto/search/v1"
-	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/ecodeclub/ekit/slice"
-	"golang.org/x/sync/errgroup"
 )
 
 type CourseSearchStrategy struct {
-	searchClient     searchv1.SearchServiceClient
-	tagClient        tagv1.TagServiceClient
-	evaluationClient evaluationv1.EvaluationServiceClient
+	searchClient searchv1.SearchServiceClient
+	courseCache  cache.CourseCache
 }
 
 // Search 可用于普通搜索和收藏搜索
@@ -47,39 +45,21 @@ func (c *CourseSearchStrategy) Search(ctx context.Context, keyword string, uid i
 		}
 	})
 	// 要去聚合一下标签信息，因为es里面没这个
-	var eg errgroup.Group
-	for i, _ := range courseVos {
-		eg.Go(func() error {
-			publishersRes, er := c.evaluationClient.VisiblePublishersCourse(ctx, &evaluationv1.VisiblePublishersCourseRequest{
-				CourseId: courseVos[i].Id,
-			})
-			if er != nil {
-				return er
-			}
-			caRes, er := c.tagClient.CountAssessmentTagsByCourseTagger(ctx, &tagv1.CountAssessmentTagsByCourseTaggerRequest{
-				CourseId:  courseVos[i].Id,
-				TaggerIds: publishersRes.GetPublishers(),
-			})
-			if er != nil {
-				return er
-			}
-			cfRes, er := c.tagClient.CountFeatureTagsByCourseTagger(ctx, &tagv1.CountFeatureTagsByCourseTaggerRequest{
-				CourseId:  courseVos[i].Id,
-				TaggerIds: publishersRes.GetPublishers(),
-			})
-			if er != nil {
-				return er
-			}
-			courseVos[i].Assessments = slice.ToMapV(caRes.GetItems(), func(element *tagv1.CountAssessmentItem) (string, int64) {
-				return element.GetTag().String(), element.GetCount()
-			})
-			courseVos[i].Features = slice.ToMapV(cfRes.GetItems(), func(element *tagv1.CountFeatureItem) (string, int64) {
-				return element.GetTag().String(), element.GetCount()
-			})
-			return nil
-		})
+	err = aggregate.ForEach(ctx, "courseCache.GetTags", courseVos, func(ctx context.Context, i int, vo CourseVo) error {
+		tags, er := c.courseCache.GetTags(ctx, vo.Id)
+		if er != nil {
+			return er
+		}
+		courseVos[i].Assessments = tags.Assessments
+		courseVos[i].Features = tags.Features
+		return nil
+	})
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
 	}
-	err = eg.Wait()
 	return ginx.Result{
 		Msg:  "Success",
 		Data: courseVos,
@@ -3,11 +3,10 @@ package search
 import (
 	"errors"
 	"fmt"
-	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
 	searchv1 "github.com/MuxiKeStack/be-api/gen/proto/search/v1"
-	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
 	"github.com/MuxiKeStack/bff/errs"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/gin-gonic/gin"
 )
@@ -25,13 +24,11 @@ func (h *SearchHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.Handler
 	sg.PUT("/history", authMiddleware, ginx.WrapClaimsAndReq(h.DeleteHistory)) // 删除历史记录
 }
 
-func NewSearchHandler(client searchv1.SearchServiceClient, tagClient tagv1.TagServiceClient,
-	evaluationClient evaluationv1.EvaluationServiceClient) *SearchHandler {
+func NewSearchHandler(client searchv1.SearchServiceClient, courseCache cache.CourseCache) *SearchHandler {
 	strategies := map[string]SearchStrategy{
 		"Course": &CourseSearchStrategy{
-			searchClient:     client,
-			tagClient:        tagClient,
-			evaluationClient: evaluationClient,
+			searchClient: client,
+			courseCache:  courseCache,
 		},
 	}
 	return &SearchHandler{
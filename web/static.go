@@ -5,6 +5,7 @@ import (
 	"fmt"
 	staticv1 "github.com/MuxiKeStack/be-api/gen/proto/static/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/pkg/dynconf"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
 	"github.com/MuxiKeStack/bff/pkg/htmlx"
 	"github.com/MuxiKeStack/bff/web/ijwt"
@@ -16,12 +17,13 @@ import (
 type StaticHandler struct {
 	staticClient           staticv1.StaticServiceClient
 	fileToHTMLConverterMap map[string]htmlx.FileToHTMLConverter
-	Administrators         map[string]struct{}
+	// 管理员的学号，可以动态修改
+	administrators *dynconf.Value[map[string]struct{}]
 }
 
 func NewStaticHandler(staticClient staticv1.StaticServiceClient, fileToHTMLConverterMap map[string]htmlx.FileToHTMLConverter,
-	administrators map[string]struct{}) *StaticHandler {
-	return &StaticHandler{staticClient: staticClient, fileToHTMLConverterMap: fileToHTMLConverterMap, Administrators: administrators}
+	administrators *dynconf.Value[map[string]struct{}]) *StaticHandler {
+	return &StaticHandler{staticClient: staticClient, fileToHTMLConverterMap: fileToHTMLConverterMap, administrators: administrators}
 }
 
 func (h *StaticHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFunc) {
@@ -191,7 +193,7 @@ func (h *StaticHandler) SaveStaticByFile(ctx *gin.Context, req SaveStaticByFileR
 }
 
 func (h *StaticHandler) isAdmin(studentId string) bool {
-	_, exists := h.Administrators[studentId]
+	_, exists := h.administrators.Load()[studentId]
 	return exists
 }
 
@@ -1,20 +1,25 @@
 package web
 
 import (
+	"context"
 	"errors"
 	ccnuv1 "github.com/MuxiKeStack/be-api/gen/proto/ccnu/v1"
 	gradev1 "github.com/MuxiKeStack/be-api/gen/proto/grade/v1"
 	pointv1 "github.com/MuxiKeStack/be-api/gen/proto/point/v1"
 	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
 	"github.com/MuxiKeStack/bff/errs"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/aggregate"
 	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/ijwt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/sync/errgroup"
 	"maps"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 type UserHandler struct {
@@ -23,11 +28,15 @@ type UserHandler struct {
 	ccnuSvc       ccnuv1.CCNUServiceClient
 	gradeSvc      gradev1.GradeServiceClient
 	pointSvc      pointv1.PointServiceClient
+	settings      cache.UserSettingsStore
+	producer      events.Producer
 	allPointTitle map[string]bool
+	l             logger.Logger
 }
 
 func NewUserHandler(hdl ijwt.Handler, userSvc userv1.UserServiceClient, ccnuSvc ccnuv1.CCNUServiceClient,
-	gradeSvc gradev1.GradeServiceClient, pointSvc pointv1.PointServiceClient) *UserHandler {
+	gradeSvc gradev1.GradeServiceClient, pointSvc pointv1.PointServiceClient, settings cache.UserSettingsStore,
+	producer events.Producer, l logger.Logger) *UserHandler {
 	allPointTitle := make(map[string]bool, len(pointv1.Title_value))
 	for title := range pointv1.Title_value {
 		allPointTitle[title] = false
@@ -38,7 +47,10 @@ func NewUserHandler(hdl ijwt.Handler, userSvc userv1.UserServiceClient, ccnuSvc
 		ccnuSvc:       ccnuSvc,
 		gradeSvc:      gradeSvc,
 		pointSvc:      pointSvc,
+		settings:      settings,
+		producer:      producer,
 		allPointTitle: allPointTitle,
+		l:             l,
 	}
 }
 
@@ -50,6 +62,8 @@ func (h *UserHandler) RegisterRoutes(s *gin.Engine, authMiddleware gin.HandlerFu
 	ug.POST("/edit", authMiddleware, ginx.WrapClaimsAndReq(h.Edit))
 	ug.GET("/profile", authMiddleware, ginx.WrapClaims(h.Profile))
 	ug.GET("/:userId/profile", ginx.Wrap(h.ProfileById))
+	ug.GET("/settings", authMiddleware, ginx.WrapClaims(h.GetSettings))
+	ug.PUT("/settings", authMiddleware, ginx.WrapClaims(h.UpdateSettings))
 }
 
 // @Summary ccnu登录
@@ -94,6 +108,14 @@ func (h *UserHandler) LoginByCCNU(ctx *gin.Context, req LoginByCCNUReq) (ginx.Re
 			Msg:  "系统异常",
 		}, err
 	}
+	// 失败了只打日志，不影响登录
+	err = events.Produce(ctx, h.producer, fcRes.GetUser().GetId(), events.UserLogin{
+		Uid: fcRes.GetUser().GetId(),
+		New: fcRes.GetUser().GetNew(),
+	})
+	if err != nil {
+		h.l.Error("发送登录事件失败", logger.Error(err), logger.Int64("uid", fcRes.GetUser().GetId()))
+	}
 	return ginx.Result{
 		Msg: "Success",
 	}, nil
@@ -181,15 +203,15 @@ func (h *UserHandler) Edit(ctx *gin.Context, req UserEditReq, uc ijwt.UserClaims
 			Msg:  "无效的title",
 		}, errors.New("无效的title")
 	}
-	var eg errgroup.Group
-	eg.Go(func() error {
+	g := aggregate.NewGroup(ctx)
+	g.Required("point.SaveUsingTitleOfUser", func(ctx context.Context) error {
 		_, err := h.pointSvc.SaveUsingTitleOfUser(ctx, &pointv1.SaveUsingTitleOfUserRequest{
 			Uid:   uc.Uid,
 			Title: pointv1.Title(usingTitle),
 		})
 		return err
 	})
-	eg.Go(func() error {
+	g.Required("user.UpdateNonSensitiveInfo", func(ctx context.Context) error {
 		_, err := h.userSvc.UpdateNonSensitiveInfo(ctx, &userv1.UpdateNonSensitiveInfoRequest{
 			User: &userv1.User{
 				Id:       uc.Uid,
@@ -199,7 +221,7 @@ func (h *UserHandler) Edit(ctx *gin.Context, req UserEditReq, uc ijwt.UserClaims
 		})
 		return err
 	})
-	err := eg.Wait()
+	_, err := g.Wait()
 	switch {
 	case err == nil:
 		return ginx.Result{
@@ -226,25 +248,25 @@ func (h *UserHandler) Edit(ctx *gin.Context, req UserEditReq, uc ijwt.UserClaims
 // @Success 200 {object} ginx.Result{data=UserProfileVo} "Success"
 // @Router /users/profile [get]
 func (h *UserHandler) Profile(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	g := aggregate.NewGroup(ctx)
 	var (
-		eg             errgroup.Group
 		userRes        *userv1.ProfileResponse
 		statusRes      *gradev1.GetSignStatusResponse
 		titleOwnership map[string]bool
 		usingTitle     string
 	)
-	eg.Go(func() error {
+	g.Required("user.Profile", func(ctx context.Context) error {
 		var er error
 		userRes, er = h.userSvc.Profile(ctx, &userv1.ProfileRequest{Uid: uc.Uid})
 		return er
 	})
-	eg.Go(func() error {
+	g.Required("grade.GetSignStatus", func(ctx context.Context) error {
 		var er error
 		statusRes, er = h.gradeSvc.GetSignStatus(ctx, &gradev1.GetSignStatusRequest{Uid: uc.Uid})
 		return er
 	})
 	// 聚合title信息
-	eg.Go(func() error {
+	g.Required("point.GetTitleOfUser", func(ctx context.Context) error {
 		titleRes, er := h.pointSvc.GetTitleOfUser(ctx, &pointv1.GetTitleOfUserRequest{Uid: uc.Uid})
 		if er != nil {
 			return er
@@ -257,7 +279,7 @@ func (h *UserHandler) Profile(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result
 		usingTitle = titleRes.GetUsingTitle().String()
 		return nil
 	})
-	err := eg.Wait()
+	_, err := g.Wait()
 	if err != nil {
 		return ginx.Result{
 			Code: errs.InternalServerError,
@@ -300,6 +322,22 @@ func (h *UserHandler) ProfileById(ctx *gin.Context) (ginx.Result, error) {
 	res, err := h.userSvc.Profile(ctx, &userv1.ProfileRequest{Uid: uid})
 	switch {
 	case err == nil:
+		hidden, er := cache.ProfileHidden(ctx, h.settings, uid)
+		if er != nil {
+			return ginx.Result{
+				Code: errs.InternalServerError,
+				Msg:  "系统异常",
+			}, er
+		}
+		if hidden {
+			return ginx.Result{
+				Msg: "Success",
+				Data: UserPublicProfileVo{
+					Id:     res.GetUser().GetId(),
+					Hidden: true,
+				},
+			}, nil
+		}
 		return ginx.Result{
 			Msg: "Success",
 			Data: UserPublicProfileVo{
@@ -320,3 +358,126 @@ func (h *UserHandler) ProfileById(ctx *gin.Context) (ginx.Result, error) {
 		}, err
 	}
 }
+
+// @Summary 获取个人设置
+// @Description 通知开关、免打扰时段和隐私设置，没设置过的是默认值
+// @Tags 用户
+// @Produce json
+// @Success 200 {object} ginx.Result{data=UserSettingsVo} "Success"
+// @Router /users/settings [get]
+func (h *UserHandler) GetSettings(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	settings, err := h.settings.Get(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg:  "Success",
+		Data: h.toSettingsVo(settings),
+	}, nil
+}
+
+// @Summary 修改个人设置
+// @Description 只需要传要改的字段，没传的保持不变，返回修改后的完整设置
+// @Tags 用户
+// @Accept json
+// @Produce json
+// @Param request body UserSettingsVo true "要修改的设置"
+// @Success 200 {object} ginx.Result{data=UserSettingsVo} "Success"
+// @Router /users/settings [put]
+func (h *UserHandler) UpdateSettings(ctx *gin.Context, uc ijwt.UserClaims) (ginx.Result, error) {
+	settings, err := h.settings.Get(ctx, uc.Uid)
+	if err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	// 在现有设置上解析请求体，没传的字段保持原样
+	vo := h.toSettingsVo(settings)
+	if err = ctx.ShouldBindJSON(&vo); err != nil {
+		return ginx.Result{
+			Code: errs.UserInvalidInput,
+			Msg:  "无效的输入参数",
+		}, err
+	}
+	switch vo.Email.Digest {
+	case cache.DigestOff, cache.DigestDaily, cache.DigestWeekly:
+	default:
+		return ginx.Result{
+			Code: errs.UserInvalidInput,
+			Msg:  "邮件摘要只能是 daily 或者 weekly",
+		}, nil
+	}
+	if vo.Email.Digest != cache.DigestOff && settings.Email.Address == "" {
+		return ginx.Result{
+			Code: errs.EmailNotBound,
+			Msg:  "请先绑定邮箱",
+		}, nil
+	}
+	for _, clock := range []string{vo.QuietHours.Start, vo.QuietHours.End} {
+		if _, err = time.Parse(cache.QuietHoursLayout, clock); err != nil {
+			return ginx.Result{
+				Code: errs.UserInvalidInput,
+				Msg:  "免打扰时段的格式是 23:00",
+			}, nil
+		}
+	}
+	settings = cache.UserSettings{
+		Notifications: cache.NotificationSettings{
+			Comment:    vo.Notifications.Comment,
+			Reply:      vo.Notifications.Reply,
+			Stance:     vo.Notifications.Stance,
+			Invitation: vo.Notifications.Invitation,
+		},
+		QuietHours: cache.QuietHours{
+			Enabled: vo.QuietHours.Enabled,
+			Start:   vo.QuietHours.Start,
+			End:     vo.QuietHours.End,
+		},
+		Privacy: cache.PrivacySettings{
+			HideProfile: vo.Privacy.HideProfile,
+		},
+		Email: cache.EmailSettings{
+			// 邮箱只能通过验证来改
+			Address: settings.Email.Address,
+			Digest:  vo.Email.Digest,
+		},
+	}
+	vo.Email.Address = settings.Email.Address
+	if err = h.settings.Set(ctx, uc.Uid, settings); err != nil {
+		return ginx.Result{
+			Code: errs.InternalServerError,
+			Msg:  "系统异常",
+		}, err
+	}
+	return ginx.Result{
+		Msg:  "Success",
+		Data: vo,
+	}, nil
+}
+
+func (h *UserHandler) toSettingsVo(settings cache.UserSettings) UserSettingsVo {
+	return UserSettingsVo{
+		Notifications: NotificationSettingsVo{
+			Comment:    settings.Notifications.Comment,
+			Reply:      settings.Notifications.Reply,
+			Stance:     settings.Notifications.Stance,
+			Invitation: settings.Notifications.Invitation,
+		},
+		QuietHours: QuietHoursVo{
+			Enabled: settings.QuietHours.Enabled,
+			Start:   settings.QuietHours.Start,
+			End:     settings.QuietHours.End,
+		},
+		Privacy: PrivacySettingsVo{
+			HideProfile: settings.Privacy.HideProfile,
+		},
+		Email: EmailSettingsVo{
+			Address: settings.Email.Address,
+			Digest:  settings.Email.Digest,
+		},
+	}
+}
@@ -30,4 +30,45 @@ type UserPublicProfileVo struct {
 	Id       int64  `json:"id"`
 	Avatar   string `json:"avatar"`
 	Nickname string `json:"nickname"`
+	Hidden   bool   `json:"hidden"` // 对方隐藏了主页，昵称和头像为空
+}
+
+// UserSettingsVo 修改时只需要传要改的字段，没传的保持不变
+type UserSettingsVo struct {
+	Notifications NotificationSettingsVo `json:"notifications"`
+	QuietHours    QuietHoursVo           `json:"quiet_hours"`
+	Privacy       PrivacySettingsVo      `json:"privacy"`
+	Email         EmailSettingsVo        `json:"email"`
+}
+
+// NotificationSettingsVo 关掉的类型不会出现在 feed 列表、未读数和实时推送里
+type NotificationSettingsVo struct {
+	Comment    bool `json:"comment"`    // 评论了我的课评、回答
+	Reply      bool `json:"reply"`      // 回复了我的评论
+	Stance     bool `json:"stance"`     // 赞同、反对
+	Invitation bool `json:"invitation"` // 邀请我回答问题
+}
+
+// QuietHoursVo 免打扰时段内不实时推送，结束后补发
+type QuietHoursVo struct {
+	Enabled bool   `json:"enabled"`
+	Start   string `json:"start"` // 北京时间，格式 23:00，晚于 end 表示跨天
+	End     string `json:"end"`
+}
+
+type PrivacySettingsVo struct {
+	HideProfile bool `json:"hide_profile"` // 别人看不到我的昵称和头像
+}
+
+type EmailSettingsVo struct {
+	Address string `json:"address"` // 绑定的邮箱，只读，绑定走 /users/email/bind
+	Digest  string `json:"digest"`  // 邮件摘要：空是不发，daily 每天，weekly 每周，要先绑定邮箱
+}
+
+type EmailBindReq struct {
+	Email string `json:"email"`
+}
+
+type EmailVerifyReq struct {
+	Code string `json:"code"`
 }
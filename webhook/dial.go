@@ -0,0 +1,68 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var ErrForbiddenAddr = errors.New("webhook 不能指向回环、内网或者链路本地地址")
+
+// 除了 netip 能判断的，再加上运营商级 NAT 的地址段，有的云厂商的元数据服务在这里
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// forbidden BFF 自己的诊断端口只对回环开放，云上的元数据服务在链路本地地址，都不能让 webhook 打过去
+func forbidden(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForbiddenHost 保存 webhook 时先拦一下明显不行的地址，真正的检查在建立连接的时候
+func ForbiddenHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(strings.Trim(host, "[]"))
+	return err == nil && forbidden(ip)
+}
+
+// dialControl 检查的是 DNS 解析之后真正要连的 IP，域名解析到内网、解析结果中途变了都绕不过去
+func dialControl(network, address string, c syscall.RawConn) error {
+	addr, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if forbidden(addr.Addr()) {
+		return fmt.Errorf("%w：%s", ErrForbiddenAddr, addr.Addr())
+	}
+	return nil
+}
+
+// newTransport 不走环境变量里的代理，不然连的是代理，检查不到真正的目标
+func newTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}).DialContext
+	return t
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestForbiddenHost(t *testing.T) {
+	testCases := []struct {
+		host string
+		want bool
+	}{
+		{host: "localhost", want: true},
+		{host: "api.LOCALHOST.", want: true},
+		{host: "127.0.0.1", want: true},
+		{host: "[::1]", want: true},
+		{host: "10.0.0.8", want: true},
+		{host: "192.168.1.1", want: true},
+		{host: "169.254.169.254", want: true},
+		{host: "100.100.100.200", want: true},
+		{host: "0.0.0.0", want: true},
+		{host: "::ffff:127.0.0.1", want: true},
+		{host: "1.1.1.1", want: false},
+		{host: "hooks.example.com", want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			if got := ForbiddenHost(tc.host); got != tc.want {
+				t.Fatalf("ForbiddenHost(%s) = %v，期望 %v", tc.host, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDialControl(t *testing.T) {
+	if err := dialControl("tcp", "127.0.0.1:6060", nil); !errors.Is(err, ErrForbiddenAddr) {
+		t.Fatalf("连回环地址应该返回 ErrForbiddenAddr，实际是 %v", err)
+	}
+	if err := dialControl("tcp", "[fe80::1]:80", nil); !errors.Is(err, ErrForbiddenAddr) {
+		t.Fatalf("连链路本地地址应该返回 ErrForbiddenAddr，实际是 %v", err)
+	}
+	if err := dialControl("tcp", "1.1.1.1:443", nil); err != nil {
+		t.Fatalf("公网地址应该放行，实际是 %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 请求头，签名是 sha256= 加上 HMAC-SHA256(secret, "{timestamp}.{body}") 的十六进制
+const (
+	HeaderEvent     = "X-KStack-Event"
+	HeaderDelivery  = "X-KStack-Delivery"
+	HeaderTimestamp = "X-KStack-Timestamp"
+	HeaderSignature = "X-KStack-Signature"
+)
+
+const (
+	// 投递记录里最多保留多少字节的响应体
+	maxResponseLen = 512
+	// 每次最多扫出多少条该投递的记录
+	sweepBatch = 100
+)
+
+// Dispatcher 把事件投递给订阅了它的 webhook，失败了按指数退避重试。
+// 重试排在进程内，实例重启或者队列满了没排上的，由每隔 cfg.SweepInterval 扫一次的 sweep 从 store 里捞回来。
+// 多个实例可能拿到同一条投递记录，每次请求前先在 store 里占住，同一次请求只会发一遍
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    Config
+	queue  chan int64
+	l      logger.Logger
+}
+
+func NewDispatcher(store Store, cfg Config, l logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		store: store,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: newTransport(),
+			// 不跟随重定向，3xx 算失败
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg:   cfg,
+		queue: make(chan int64, 1024),
+		l:     l,
+	}
+}
+
+// Run 启动 cfg.Workers 个协程投递，定时 sweep，一直运行到 ctx 取消
+func (d *Dispatcher) Run(ctx context.Context) {
+	for i := 0; i < d.cfg.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-d.queue:
+					d.deliver(ctx, id)
+				}
+			}
+		}()
+	}
+	ticker := time.NewTicker(d.cfg.SweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.sweep(ctx, time.Now())
+		}
+	}
+}
+
+// sweep 把到了投递时间又过了 cfg.SweepInterval 还停在 pending 或者 retrying 的投递重新排队
+func (d *Dispatcher) sweep(ctx context.Context, now time.Time) {
+	ids, err := d.store.DueDeliveries(ctx, now.Add(-d.cfg.SweepInterval).UnixMilli(), sweepBatch)
+	if err != nil {
+		d.l.Error("查询待投递的记录失败", logger.Error(err))
+		return
+	}
+	for _, id := range ids {
+		if !d.enqueue(id) {
+			// 剩下的等下次
+			return
+		}
+	}
+}
+
+// Handle 给每个订阅了 env.Type 的 webhook 建一条投递记录，然后排队投递
+func (d *Dispatcher) Handle(ctx context.Context, env events.Envelope) error {
+	hooks, err := d.store.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	var payload []byte
+	for _, hook := range hooks {
+		if !hook.Subscribes(env.Type) {
+			continue
+		}
+		if payload == nil {
+			// 不带 actor，匿名发布的人只在内部可见
+			payload, err = json.Marshal(Event{
+				Id:         env.Id,
+				Type:       env.Type,
+				Version:    env.Version,
+				OccurredAt: env.OccurredAt,
+				Data:       env.Payload,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		delivery, er := d.store.SaveDelivery(ctx, Delivery{
+			WebhookId: hook.Id,
+			EventId:   env.Id,
+			EventType: env.Type,
+			Payload:   string(payload),
+			Status:    StatusPending,
+		})
+		if errors.Is(er, ErrDeliveryExists) {
+			// 消费者在重试这个事件，前面的 webhook 上次已经建好了投递记录
+			continue
+		}
+		if er != nil {
+			return er
+		}
+		// 队列满了也不能卡住消费者，这条投递留在 pending，等 sweep
+		d.enqueue(delivery.Id)
+	}
+	return nil
+}
+
+// Redeliver 把一条投递记录的请求体原样再投递一次，记成一条新的投递记录
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryId int64) (Delivery, error) {
+	src, err := d.store.GetDelivery(ctx, deliveryId)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if _, err = d.store.GetWebhook(ctx, src.WebhookId); err != nil {
+		return Delivery{}, err
+	}
+	delivery, err := d.store.SaveDelivery(ctx, Delivery{
+		WebhookId:    src.WebhookId,
+		EventId:      src.EventId,
+		EventType:    src.EventType,
+		Payload:      src.Payload,
+		RedeliveryOf: src.Id,
+		Status:       StatusPending,
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+	if !d.enqueue(delivery.Id) {
+		return delivery, ErrQueueFull
+	}
+	return delivery, nil
+}
+
+// enqueue 不阻塞，队列满了返回 false
+func (d *Dispatcher) enqueue(id int64) bool {
+	select {
+	case d.queue <- id:
+		return true
+	default:
+		d.l.Warn("webhook 投递队列满了", logger.Int64("delivery", id))
+		return false
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, id int64) {
+	delivery, err := d.store.GetDelivery(ctx, id)
+	if err != nil {
+		d.l.Error("查询投递记录失败", logger.Int64("delivery", id), logger.Error(err))
+		return
+	}
+	// sweep 和进程内的重试可能同时排了这一条，别的实例也可能已经投递过了
+	switch {
+	case delivery.Status == StatusRetrying && delivery.NextRetryAt > time.Now().UnixMilli():
+		return
+	case delivery.Status != StatusPending && delivery.Status != StatusRetrying:
+		return
+	}
+	// 占住这一次请求，占住的时间够发完请求并保存结果；实例中途挂了，过期之后 sweep 会再捞回来
+	ok, err := d.store.ClaimDelivery(ctx, id, len(delivery.Attempts), 2*d.cfg.Timeout)
+	if err != nil || !ok {
+		if err != nil {
+			d.l.Error("占住投递记录失败", logger.Int64("delivery", id), logger.Error(err))
+		}
+		return
+	}
+	attempt := Attempt{At: time.Now().UnixMilli()}
+	hook, err := d.store.GetWebhook(ctx, delivery.WebhookId)
+	switch {
+	case err != nil:
+		attempt.Error = err.Error()
+	case !hook.Active:
+		attempt.Error = "webhook 已停用"
+	default:
+		attempt = d.post(ctx, hook, delivery)
+	}
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.NextRetryAt = 0
+	switch {
+	case attempt.Error == "":
+		delivery.Status = StatusSucceeded
+	case err == nil && hook.Active && len(delivery.Attempts) < d.cfg.MaxAttempts:
+		backoff := d.backoff(len(delivery.Attempts))
+		delivery.Status = StatusRetrying
+		delivery.NextRetryAt = time.Now().Add(backoff).UnixMilli()
+		// 排不上队就停在 retrying，等 sweep
+		time.AfterFunc(backoff, func() {
+			d.enqueue(id)
+		})
+	default:
+		delivery.Status = StatusFailed
+	}
+	if _, err = d.store.SaveDelivery(ctx, delivery); err != nil {
+		d.l.Error("保存投递记录失败", logger.Int64("delivery", id), logger.Error(err))
+	}
+}
+
+// post 发一次请求，非 2xx 的响应也算失败
+func (d *Dispatcher) post(ctx context.Context, hook Webhook, delivery Delivery) (attempt Attempt) {
+	start := time.Now()
+	attempt.At = start.UnixMilli()
+	defer func() {
+		attempt.Duration = time.Since(start).Milliseconds()
+	}()
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	ts := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "KStack-Webhook")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, ts, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLen))
+	attempt.Response = string(data)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("响应状态码 %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// backoff 第 n 次失败之后等多久再重试
+func (d *Dispatcher) backoff(n int) time.Duration {
+	backoff := d.cfg.Backoff
+	for i := 1; i < n && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.cfg.MaxBackoff)
+}
+
+// Sign 接收方用同样的方法算一遍，和 X-KStack-Signature 比较，再检查时间戳不要太旧，防止重放
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/fakes"
+	"github.com/MuxiKeStack/bff/pkg/logger"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, Store) {
+	cfg := Config{
+		Workers:        1,
+		Timeout:        time.Second,
+		MaxAttempts:    3,
+		Backoff:        time.Hour,
+		MaxBackoff:     time.Hour,
+		KeepDeliveries: 10,
+		DeliveryTTL:    time.Hour,
+		SweepInterval:  time.Minute,
+	}
+	store := NewRedisStore(fakes.NewRedis(), cfg)
+	for _, url := range []string{"https://a.example.com/hook", "https://b.example.com/hook"} {
+		_, err := store.SaveWebhook(context.Background(), Webhook{
+			URL:    url,
+			Secret: "secret",
+			Events: []string{events.TypeQuestionPublished},
+			Active: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewDispatcher(store, cfg, logger.NewNopLogger()), store
+}
+
+func TestDispatcherHandleIdempotent(t *testing.T) {
+	d, store := newTestDispatcher(t)
+	ctx := context.Background()
+	env := events.Envelope{
+		Type:    events.TypeQuestionPublished,
+		Version: 1,
+		Id:      "e1",
+		Payload: json.RawMessage(`{}`),
+	}
+	// 消费者重试同一个事件，第二次不应该再建投递记录
+	for i := 0; i < 2; i++ {
+		if err := d.Handle(ctx, env); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(d.queue) != 2 {
+		t.Fatalf("两个 webhook 应该各排一次，拿到 %d 次", len(d.queue))
+	}
+	for _, hookId := range []int64{1, 2} {
+		list, err := store.ListDeliveries(ctx, hookId, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 {
+			t.Fatalf("webhook %d 应该只有 1 条投递记录，拿到 %d 条", hookId, len(list))
+		}
+	}
+}
+
+func TestDispatcherSweep(t *testing.T) {
+	d, store := newTestDispatcher(t)
+	ctx := context.Background()
+	now := time.Now()
+	stale, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "stale", Status: StatusRetrying,
+		NextRetryAt: now.Add(-2 * time.Minute).UnixMilli()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 刚到投递时间的可能还在进程内的队列里，不捞
+	_, err = store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "fresh", Status: StatusRetrying,
+		NextRetryAt: now.Add(-time.Second).UnixMilli()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.sweep(ctx, now)
+	if len(d.queue) != 1 {
+		t.Fatalf("应该只捞回 1 条，拿到 %d 条", len(d.queue))
+	}
+	if id := <-d.queue; id != stale.Id {
+		t.Fatalf("应该捞回 %d，拿到 %d", stale.Id, id)
+	}
+}
+
+func TestDispatcherDeliverSkip(t *testing.T) {
+	testCases := []struct {
+		name     string
+		delivery Delivery
+		claimed  bool
+		attempts int
+	}{
+		{
+			name:     "pending 的投递一次",
+			delivery: Delivery{Status: StatusPending},
+			attempts: 1,
+		},
+		{
+			name:     "别的实例占住了",
+			delivery: Delivery{Status: StatusPending},
+			claimed:  true,
+		},
+		{
+			name:     "已经成功了",
+			delivery: Delivery{Status: StatusSucceeded},
+		},
+		{
+			name:     "还没到重试时间",
+			delivery: Delivery{Status: StatusRetrying, NextRetryAt: time.Now().Add(time.Hour).UnixMilli()},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, store := newTestDispatcher(t)
+			ctx := context.Background()
+			tc.delivery.WebhookId = 1
+			tc.delivery.EventId = "e1"
+			tc.delivery.Payload = `{}`
+			delivery, err := store.SaveDelivery(ctx, tc.delivery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.claimed {
+				if _, err = store.ClaimDelivery(ctx, delivery.Id, 0, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 投递到 example.com 会失败，这里只看有没有发请求
+			d.client.Transport = failTransport{}
+			d.deliver(ctx, delivery.Id)
+			got, err := store.GetDelivery(ctx, delivery.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Attempts) != tc.attempts {
+				t.Fatalf("应该请求 %d 次，拿到 %d 次", tc.attempts, len(got.Attempts))
+			}
+		})
+	}
+}
+
+type failTransport struct{}
+
+func (failTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("不发请求")
+}
@@ -0,0 +1,267 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Store interface {
+	// SaveWebhook Id 为 0 时新建并分配 id
+	SaveWebhook(ctx context.Context, hook Webhook) (Webhook, error)
+	GetWebhook(ctx context.Context, id int64) (Webhook, error)
+	// ListWebhooks 按 id 排序
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	// DeleteWebhook 投递记录一起删掉
+	DeleteWebhook(ctx context.Context, id int64) error
+	// SaveDelivery Id 为 0 时新建并分配 id。同一个事件到同一个 webhook 只会建一条（手动重新投递除外），
+	// 已经有了就返回已有的那条和 ErrDeliveryExists，消费者重试同一个事件时不会重复投递
+	SaveDelivery(ctx context.Context, d Delivery) (Delivery, error)
+	GetDelivery(ctx context.Context, id int64) (Delivery, error)
+	// ClaimDelivery 占住一条投递记录的第 attempt 次请求 ttl 这么久，多个实例不会同时发同一次请求
+	ClaimDelivery(ctx context.Context, id int64, attempt int, ttl time.Duration) (bool, error)
+	// DueDeliveries 状态是 pending 或者 retrying，并且投递时间不晚于 before（毫秒）的投递记录 id，最早的在前
+	DueDeliveries(ctx context.Context, before int64, limit int64) ([]int64, error)
+	// ListDeliveries 从新到旧，before 不为 0 时只返回 id 比它小的
+	ListDeliveries(ctx context.Context, webhookId int64, before int64, limit int64) ([]Delivery, error)
+}
+
+const (
+	webhooksKey       = "kstack:webhooks"
+	webhookIdKey      = "kstack:webhook_id"
+	webhookDeliveryId = "kstack:webhook_delivery_id"
+	webhookDueKey     = "kstack:webhook_due"
+)
+
+// RedisStore webhook 存在 kstack:webhooks 这个 hash 里，量很小，每次都整个读出来。
+// 投递记录一条一个 key，带过期时间，kstack:webhook_deliveries:{webhookId} 这个 list 里按从新到旧放着 id，只保留最近的几条。
+// kstack:webhook_delivery_event:{webhookId}:{eventId} 指向这个事件的投递记录，用来去重；
+// 还没投递完的记录放在 kstack:webhook_due 这个 sorted set 里，score 是该投递的时间
+type RedisStore struct {
+	cmd  redis.Cmdable
+	keep int64
+	ttl  time.Duration
+}
+
+func NewRedisStore(cmd redis.Cmdable, cfg Config) Store {
+	return &RedisStore{cmd: cmd, keep: cfg.KeepDeliveries, ttl: cfg.DeliveryTTL}
+}
+
+func (r *RedisStore) SaveWebhook(ctx context.Context, hook Webhook) (Webhook, error) {
+	now := time.Now().UnixMilli()
+	if hook.Id == 0 {
+		id, err := r.cmd.Incr(ctx, webhookIdKey).Result()
+		if err != nil {
+			return Webhook{}, err
+		}
+		hook.Id = id
+		hook.Ctime = now
+	}
+	hook.Utime = now
+	data, err := json.Marshal(hook)
+	if err != nil {
+		return Webhook{}, err
+	}
+	err = r.cmd.HSet(ctx, webhooksKey, strconv.FormatInt(hook.Id, 10), data).Err()
+	return hook, err
+}
+
+func (r *RedisStore) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	hooks, err := r.ListWebhooks(ctx)
+	if err != nil {
+		return Webhook{}, err
+	}
+	for _, hook := range hooks {
+		if hook.Id == id {
+			return hook, nil
+		}
+	}
+	return Webhook{}, ErrWebhookNotFound
+}
+
+func (r *RedisStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	fields, err := r.cmd.HGetAll(ctx, webhooksKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]Webhook, 0, len(fields))
+	for _, data := range fields {
+		var hook Webhook
+		if er := json.Unmarshal([]byte(data), &hook); er != nil {
+			return nil, er
+		}
+		hooks = append(hooks, hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Id < hooks[j].Id
+	})
+	return hooks, nil
+}
+
+func (r *RedisStore) DeleteWebhook(ctx context.Context, id int64) error {
+	n, err := r.cmd.HDel(ctx, webhooksKey, strconv.FormatInt(id, 10)).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	// 投递记录本身会过期，删掉索引就查不到了
+	return r.cmd.Del(ctx, r.deliveriesKey(id)).Err()
+}
+
+func (r *RedisStore) SaveDelivery(ctx context.Context, d Delivery) (Delivery, error) {
+	now := time.Now().UnixMilli()
+	created := d.Id == 0
+	if created {
+		id, err := r.cmd.Incr(ctx, webhookDeliveryId).Result()
+		if err != nil {
+			return Delivery{}, err
+		}
+		d.Id = id
+		d.Ctime = now
+		if d.RedeliveryOf == 0 {
+			existing, er := r.reserve(ctx, &d)
+			if er != nil {
+				return existing, er
+			}
+		}
+	}
+	d.Utime = now
+	data, err := json.Marshal(d)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if err = r.cmd.Set(ctx, r.deliveryKey(d.Id), data, r.ttl).Err(); err != nil {
+		return Delivery{}, err
+	}
+	switch d.Status {
+	case StatusPending:
+		err = r.cmd.ZAdd(ctx, webhookDueKey, redis.Z{Score: float64(d.Utime), Member: d.Id}).Err()
+	case StatusRetrying:
+		err = r.cmd.ZAdd(ctx, webhookDueKey, redis.Z{Score: float64(d.NextRetryAt), Member: d.Id}).Err()
+	default:
+		err = r.cmd.ZRem(ctx, webhookDueKey, d.Id).Err()
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+	if !created {
+		return d, nil
+	}
+	key := r.deliveriesKey(d.WebhookId)
+	if err = r.cmd.LPush(ctx, key, d.Id).Err(); err != nil {
+		return Delivery{}, err
+	}
+	return d, r.cmd.LTrim(ctx, key, 0, r.keep-1).Err()
+}
+
+// reserve 让 (webhookId, eventId) 指向 d.Id。已经指向了别的投递记录时返回那条记录和 ErrDeliveryExists；
+// 那条记录不在说明上次占住之后没写成功，沿用它的 id 重新写
+func (r *RedisStore) reserve(ctx context.Context, d *Delivery) (Delivery, error) {
+	key := r.eventKey(d.WebhookId, d.EventId)
+	ok, err := r.cmd.SetNX(ctx, key, d.Id, r.ttl).Result()
+	if err != nil || ok {
+		return Delivery{}, err
+	}
+	id, err := r.cmd.Get(ctx, key).Int64()
+	if err != nil {
+		return Delivery{}, err
+	}
+	existing, err := r.GetDelivery(ctx, id)
+	switch {
+	case err == nil:
+		return existing, ErrDeliveryExists
+	case errors.Is(err, ErrDeliveryNotFound):
+		d.Id = id
+		return Delivery{}, nil
+	default:
+		return Delivery{}, err
+	}
+}
+
+func (r *RedisStore) GetDelivery(ctx context.Context, id int64) (Delivery, error) {
+	data, err := r.cmd.Get(ctx, r.deliveryKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+	var d Delivery
+	err = json.Unmarshal(data, &d)
+	return d, err
+}
+
+func (r *RedisStore) ListDeliveries(ctx context.Context, webhookId int64, before int64, limit int64) ([]Delivery, error) {
+	ids, err := r.cmd.LRange(ctx, r.deliveriesKey(webhookId), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Delivery, 0, limit)
+	for _, field := range ids {
+		if int64(len(res)) >= limit {
+			break
+		}
+		id, er := strconv.ParseInt(field, 10, 64)
+		if er != nil || (before > 0 && id >= before) {
+			continue
+		}
+		d, er := r.GetDelivery(ctx, id)
+		if errors.Is(er, ErrDeliveryNotFound) {
+			// 已经过期了
+			continue
+		}
+		if er != nil {
+			return nil, er
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func (r *RedisStore) ClaimDelivery(ctx context.Context, id int64, attempt int, ttl time.Duration) (bool, error) {
+	return r.cmd.SetNX(ctx, fmt.Sprintf("kstack:webhook_delivery_claim:%d:%d", id, attempt), 1, ttl).Result()
+}
+
+func (r *RedisStore) DueDeliveries(ctx context.Context, before int64, limit int64) ([]int64, error) {
+	// 投递记录过期了就不用再投递了
+	expired := strconv.FormatInt(time.Now().Add(-r.ttl).UnixMilli(), 10)
+	if err := r.cmd.ZRemRangeByScore(ctx, webhookDueKey, "-inf", expired).Err(); err != nil {
+		return nil, err
+	}
+	members, err := r.cmd.ZRangeByScore(ctx, webhookDueKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(before, 10),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(members))
+	for _, member := range members {
+		id, er := strconv.ParseInt(member, 10, 64)
+		if er != nil {
+			return nil, er
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *RedisStore) deliveryKey(id int64) string {
+	return fmt.Sprintf("kstack:webhook_delivery:%d", id)
+}
+
+func (r *RedisStore) eventKey(webhookId int64, eventId string) string {
+	return fmt.Sprintf("kstack:webhook_delivery_event:%d:%s", webhookId, eventId)
+}
+
+func (r *RedisStore) deliveriesKey(webhookId int64) string {
+	return fmt.Sprintf("kstack:webhook_deliveries:%d", webhookId)
+}
@@ -0,0 +1,109 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"github.com/MuxiKeStack/bff/fakes"
+	"testing"
+	"time"
+)
+
+func TestRedisStoreSaveDeliveryIdempotent(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(fakes.NewRedis(), Config{KeepDeliveries: 10, DeliveryTTL: time.Hour})
+	first, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "e1", Status: StatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "e1", Status: StatusPending})
+	if !errors.Is(err, ErrDeliveryExists) {
+		t.Fatalf("同一个事件再建一次应该返回 ErrDeliveryExists，拿到 %v", err)
+	}
+	if again.Id != first.Id {
+		t.Fatalf("应该返回已有的投递记录 %d，拿到 %d", first.Id, again.Id)
+	}
+	other, err := store.SaveDelivery(ctx, Delivery{WebhookId: 2, EventId: "e1", Status: StatusPending})
+	if err != nil || other.Id == first.Id {
+		t.Fatalf("另一个 webhook 应该新建投递记录，拿到 %d, %v", other.Id, err)
+	}
+	redelivery, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "e1", RedeliveryOf: first.Id, Status: StatusPending})
+	if err != nil || redelivery.Id == first.Id {
+		t.Fatalf("手动重新投递应该新建投递记录，拿到 %d, %v", redelivery.Id, err)
+	}
+	list, err := store.ListDeliveries(ctx, 1, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("webhook 1 应该有 2 条投递记录，拿到 %d 条", len(list))
+	}
+}
+
+func TestRedisStoreDueDeliveries(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(fakes.NewRedis(), Config{KeepDeliveries: 10, DeliveryTTL: time.Hour})
+	now := time.Now()
+	pending, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "pending", Status: StatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "due", Status: StatusRetrying,
+		NextRetryAt: now.Add(-time.Minute).UnixMilli()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "later", Status: StatusRetrying,
+		NextRetryAt: now.Add(time.Minute).UnixMilli()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := store.SaveDelivery(ctx, Delivery{WebhookId: 1, EventId: "done", Status: StatusPending})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done.Status = StatusSucceeded
+	if _, err = store.SaveDelivery(ctx, done); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := store.DueDeliveries(ctx, now.Add(time.Second).UnixMilli(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{due.Id, pending.Id}
+	if len(ids) != len(want) || ids[0] != want[0] || ids[1] != want[1] {
+		t.Fatalf("该投递的应该是 %v，拿到 %v", want, ids)
+	}
+	ids, err = store.DueDeliveries(ctx, now.Add(time.Second).UnixMilli(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != due.Id {
+		t.Fatalf("limit 1 应该只拿到最早的 %d，拿到 %v", due.Id, ids)
+	}
+}
+
+func TestRedisStoreClaimDelivery(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(fakes.NewRedis(), Config{KeepDeliveries: 10, DeliveryTTL: time.Hour})
+	testCases := []struct {
+		name    string
+		attempt int
+		want    bool
+	}{
+		{name: "第一次占住", attempt: 0, want: true},
+		{name: "同一次请求再占", attempt: 0, want: false},
+		{name: "下一次请求", attempt: 1, want: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := store.ClaimDelivery(ctx, 1, tc.attempt, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tc.want {
+				t.Fatalf("期望 %v，拿到 %v", tc.want, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook 不存在")
+	ErrDeliveryNotFound = errors.New("投递记录不存在或者已经过期")
+	ErrQueueFull        = errors.New("投递队列满了")
+	// ErrDeliveryExists 同一个事件到同一个 webhook 已经有投递记录了
+	ErrDeliveryExists = errors.New("投递记录已经存在")
+)
+
+// 投递状态
+const (
+	StatusPending   = "pending"
+	StatusRetrying  = "retrying"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+type Config struct {
+	// Workers 同时投递的协程数
+	Workers int `yaml:"workers"`
+	// Timeout 单次请求的超时
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxAttempts 算上第一次一共最多请求几次
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Backoff 第一次重试前等多久，之后每次翻倍，最多 MaxBackoff
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// KeepDeliveries 每个 webhook 保留最近多少条投递记录
+	KeepDeliveries int64 `yaml:"keepDeliveries"`
+	// DeliveryTTL 投递记录保留多久
+	DeliveryTTL time.Duration `yaml:"deliveryTTL"`
+	// SweepInterval 多久扫一次该投递却没在投递的记录，比如实例重启丢了的重试、队列满了没排上的投递。
+	// 到了投递时间又过了这么久还没投递的才会被扫到
+	SweepInterval time.Duration `yaml:"sweepInterval"`
+}
+
+// Event 推给 webhook 的请求体，data 是事件的 payload，结构由 type 和 version 决定
+type Event struct {
+	Id      string `json:"id"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+	// OccurredAt 毫秒时间戳
+	OccurredAt int64           `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Webhook 管理员注册的回调地址，Events 是订阅的事件类型，见 events.WebhookTypes
+type Webhook struct {
+	Id          int64    `json:"id"`
+	URL         string   `json:"url"`
+	Secret      string   `json:"secret"`
+	Events      []string `json:"events"`
+	Description string   `json:"description"`
+	Active      bool     `json:"active"`
+	Ctime       int64    `json:"ctime"`
+	Utime       int64    `json:"utime"`
+}
+
+func (w Webhook) Subscribes(typ string) bool {
+	return w.Active && slices.Contains(w.Events, typ)
+}
+
+// Delivery 一个事件到一个 webhook 的投递，重试都记在 Attempts 里
+type Delivery struct {
+	Id        int64  `json:"id"`
+	WebhookId int64  `json:"webhook_id"`
+	EventId   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Payload 请求体，重新投递时原样再发一次
+	Payload string `json:"payload"`
+	// RedeliveryOf 手动重新投递时是哪条投递记录
+	RedeliveryOf int64     `json:"redelivery_of,omitempty"`
+	Status       string    `json:"status"`
+	Attempts     []Attempt `json:"attempts"`
+	// NextRetryAt 状态是 retrying 时下次重试的时间，毫秒
+	NextRetryAt int64 `json:"next_retry_at,omitempty"`
+	Ctime       int64 `json:"ctime"`
+	Utime       int64 `json:"utime"`
+}
+
+type Attempt struct {
+	At         int64  `json:"at"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// Response 响应体的开头一段，方便排查
+	Response string `json:"response,omitempty"`
+	// Duration 耗时，毫秒
+	Duration int64 `json:"duration"`
+}
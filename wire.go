@@ -3,47 +3,151 @@
 package main
 
 import (
+	answerv1 "github.com/MuxiKeStack/be-api/gen/proto/answer/v1"
+	ccnuv1 "github.com/MuxiKeStack/be-api/gen/proto/ccnu/v1"
+	collectv1 "github.com/MuxiKeStack/be-api/gen/proto/collect/v1"
+	commentv1 "github.com/MuxiKeStack/be-api/gen/proto/comment/v1"
+	coursev1 "github.com/MuxiKeStack/be-api/gen/proto/course/v1"
+	evaluationv1 "github.com/MuxiKeStack/be-api/gen/proto/evaluation/v1"
+	feedv1 "github.com/MuxiKeStack/be-api/gen/proto/feed/v1"
+	gradev1 "github.com/MuxiKeStack/be-api/gen/proto/grade/v1"
+	pointv1 "github.com/MuxiKeStack/be-api/gen/proto/point/v1"
+	questionv1 "github.com/MuxiKeStack/be-api/gen/proto/question/v1"
+	searchv1 "github.com/MuxiKeStack/be-api/gen/proto/search/v1"
+	stancev1 "github.com/MuxiKeStack/be-api/gen/proto/stance/v1"
+	staticv1 "github.com/MuxiKeStack/be-api/gen/proto/static/v1"
+	tagv1 "github.com/MuxiKeStack/be-api/gen/proto/tag/v1"
+	userv1 "github.com/MuxiKeStack/be-api/gen/proto/user/v1"
+	"github.com/MuxiKeStack/bff/events"
+	"github.com/MuxiKeStack/bff/fakes"
 	"github.com/MuxiKeStack/bff/ioc"
-	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/email"
+	"github.com/MuxiKeStack/bff/pkg/feature"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/maintenance"
+	"github.com/MuxiKeStack/bff/pkg/pubsub"
 	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/evaluation"
 	"github.com/MuxiKeStack/bff/web/search"
+	"github.com/MuxiKeStack/bff/webhook"
 	"github.com/google/wire"
+	"github.com/redis/go-redis/v9"
 )
 
-func InitWebServer() *ginx.Server {
-	wire.Build(
-		ioc.InitGinServer,
-		web.NewUserHandler, web.NewCourseHandler, ioc.InitJwtHandler, web.NewQuestionHandler,
-		evaluation.NewEvaluationHandler, web.NewCommentHandler, search.NewSearchHandler,
-		web.NewGradeHandler, ioc.InitStaticHandler, web.NewAnswerHandler, web.NewPointHandler,
-		web.NewFeedHandler, ioc.InitTubeHandler,
-		// oss
-		ioc.InitPutPolicy,
-		ioc.InitMac,
-		// producer
-		ioc.InitProducer,
-		ioc.InitKafka,
-		// rpc client
-		ioc.InitFeedClient,
-		ioc.InitPointClient,
-		ioc.InitAnswerClient,
-		ioc.InitStaticClient,
-		ioc.InitGradeClient,
-		ioc.InitSearchClient,
-		ioc.InitCommentClient,
-		ioc.InitStanceClient,
-		ioc.InitCollectClient,
-		ioc.InitTagClient,
-		ioc.InitCCNUClient,
-		ioc.InitCourseClient,
-		ioc.InitEvaluationClient,
-		ioc.InitUserClient,
-		ioc.InitQuestionClient,
-		// 组件
-		ioc.InitEtcdClient,
-		ioc.InitLogger,
-		ioc.InitRedis,
-	)
-	return &ginx.Server{}
+var webSet = wire.NewSet(
+	wire.Struct(new(App), "*"),
+	wire.FieldsOf(new(*ioc.Config), "HTTP", "Admin", "DynConf", "Redis", "Etcd", "Kafka", "Grpc",
+		"Jwt", "Oss", "Cache", "Aggregation", "Feed", "Email", "Webhook"),
+	ioc.InitGinServer,
+	ioc.InitAdminServer,
+	ioc.InitRecovery,
+	web.NewUserHandler, web.NewCourseHandler, ioc.InitJwtHandler, web.NewQuestionHandler,
+	evaluation.NewEvaluationHandler, web.NewCommentHandler, search.NewSearchHandler,
+	web.NewGradeHandler, ioc.InitStaticHandler, web.NewAnswerHandler, web.NewPointHandler,
+	ioc.InitFeedHandler, ioc.InitTubeHandler, web.NewAdminHandler, ioc.InitBatchHandler,
+	ioc.InitGraphQLHandler, ioc.InitEmailHandler,
+	ioc.InitPager,
+	ioc.InitFeedHub, ioc.InitFeedPresenter,
+	webhook.NewRedisStore, ioc.InitWebhookDispatcher,
+	ioc.InitSubscriptions,
+	ioc.InitAdministrators,
+	feature.NewFlags,
+	maintenance.NewBuilder,
+	// cache
+	ioc.InitCourseCache,
+	cache.NewRedisFeedReadState,
+	cache.NewRedisUserSettings,
+	ioc.InitEmailVerification,
+	// job
+	ioc.InitDigestJob,
+	// oss
+	ioc.InitPutPolicy,
+	ioc.InitMac,
+	ioc.InitLogger,
+)
+
+// thirdPartySet 依赖 etcd、kafka、redis 和下游服务
+var thirdPartySet = wire.NewSet(
+	// producer
+	ioc.InitProducer,
+	ioc.InitKafka,
+	// consumer
+	ioc.InitConsumers,
+	// rpc client
+	ioc.InitFeedClient,
+	ioc.InitPointClient,
+	ioc.InitAnswerClient,
+	ioc.InitStaticClient,
+	ioc.InitGradeClient,
+	ioc.InitSearchClient,
+	ioc.InitCommentClient,
+	ioc.InitStanceClient,
+	ioc.InitCollectClient,
+	ioc.InitTagClient,
+	ioc.InitCCNUClient,
+	ioc.InitCourseClient,
+	ioc.InitEvaluationClient,
+	ioc.InitUserClient,
+	ioc.InitQuestionClient,
+	// 组件
+	ioc.InitDynConf,
+	ioc.InitEtcdClient,
+	ioc.InitRedis,
+	wire.Bind(new(redis.Cmdable), new(*redis.Client)),
+	ioc.InitBroker,
+	ioc.InitEmailSender,
+)
+
+// fakeSet 用内存实现替换掉 thirdPartySet，standalone 模式用
+var fakeSet = wire.NewSet(
+	ioc.InitStandaloneDynConf,
+	ioc.InitStandaloneConsumers,
+	fakes.NewProducer,
+	wire.Bind(new(events.Producer), new(*fakes.Producer)),
+	fakes.NewRedis,
+	wire.Bind(new(redis.Cmdable), new(*fakes.Redis)),
+	fakes.NewBroker,
+	wire.Bind(new(pubsub.Broker), new(*fakes.Broker)),
+	fakes.NewEmailSender,
+	wire.Bind(new(email.Sender), new(*fakes.EmailSender)),
+	fakes.NewFeedService,
+	wire.Bind(new(feedv1.FeedServiceClient), new(*fakes.FeedService)),
+	fakes.NewPointService,
+	wire.Bind(new(pointv1.PointServiceClient), new(*fakes.PointService)),
+	fakes.NewAnswerService,
+	wire.Bind(new(answerv1.AnswerServiceClient), new(*fakes.AnswerService)),
+	fakes.NewStaticService,
+	wire.Bind(new(staticv1.StaticServiceClient), new(*fakes.StaticService)),
+	fakes.NewGradeService,
+	wire.Bind(new(gradev1.GradeServiceClient), new(*fakes.GradeService)),
+	fakes.NewSearchService,
+	wire.Bind(new(searchv1.SearchServiceClient), new(*fakes.SearchService)),
+	fakes.NewCommentService,
+	wire.Bind(new(commentv1.CommentServiceClient), new(*fakes.CommentService)),
+	fakes.NewStanceService,
+	wire.Bind(new(stancev1.StanceServiceClient), new(*fakes.StanceService)),
+	fakes.NewCollectService,
+	wire.Bind(new(collectv1.CollectServiceClient), new(*fakes.CollectService)),
+	fakes.NewTagService,
+	wire.Bind(new(tagv1.TagServiceClient), new(*fakes.TagService)),
+	fakes.NewCCNUService,
+	wire.Bind(new(ccnuv1.CCNUServiceClient), new(*fakes.CCNUService)),
+	fakes.NewCourseService,
+	wire.Bind(new(coursev1.CourseServiceClient), new(*fakes.CourseService)),
+	fakes.NewEvaluationService,
+	wire.Bind(new(evaluationv1.EvaluationServiceClient), new(*fakes.EvaluationService)),
+	fakes.NewUserService,
+	wire.Bind(new(userv1.UserServiceClient), new(*fakes.UserService)),
+	fakes.NewQuestionService,
+	wire.Bind(new(questionv1.QuestionServiceClient), new(*fakes.QuestionService)),
+)
+
+func InitApp(cfg *ioc.Config) *App {
+	wire.Build(webSet, thirdPartySet)
+	return new(App)
+}
+
+func InitStandaloneApp(cfg *ioc.Config) *App {
+	wire.Build(webSet, fakeSet)
+	return new(App)
 }
@@ -7,51 +7,180 @@
 package main
 
 import (
+	"github.com/MuxiKeStack/bff/fakes"
 	"github.com/MuxiKeStack/bff/ioc"
-	"github.com/MuxiKeStack/bff/pkg/ginx"
+	"github.com/MuxiKeStack/bff/pkg/feature"
+	"github.com/MuxiKeStack/bff/pkg/ginx/middleware/maintenance"
 	"github.com/MuxiKeStack/bff/web"
+	"github.com/MuxiKeStack/bff/web/cache"
 	"github.com/MuxiKeStack/bff/web/evaluation"
 	"github.com/MuxiKeStack/bff/web/search"
+	"github.com/MuxiKeStack/bff/webhook"
 )
 
 // Injectors from wire.go:
 
-func InitWebServer() *ginx.Server {
+func InitApp(cfg *ioc.Config) *App {
 	logger := ioc.InitLogger()
-	cmdable := ioc.InitRedis()
-	handler := ioc.InitJwtHandler(cmdable)
-	client := ioc.InitEtcdClient()
-	userServiceClient := ioc.InitUserClient(client)
-	ccnuServiceClient := ioc.InitCCNUClient(client)
-	gradeServiceClient := ioc.InitGradeClient(client)
-	pointServiceClient := ioc.InitPointClient(client)
-	userHandler := web.NewUserHandler(handler, userServiceClient, ccnuServiceClient, gradeServiceClient, pointServiceClient)
-	courseServiceClient := ioc.InitCourseClient(client)
-	evaluationServiceClient := ioc.InitEvaluationClient(client)
-	tagServiceClient := ioc.InitTagClient(client)
-	collectServiceClient := ioc.InitCollectClient(client)
-	courseHandler := web.NewCourseHandler(handler, courseServiceClient, evaluationServiceClient, userServiceClient, tagServiceClient, logger, collectServiceClient)
-	questionServiceClient := ioc.InitQuestionClient(client)
-	answerServiceClient := ioc.InitAnswerClient(client)
-	questionHandler := web.NewQuestionHandler(questionServiceClient, userServiceClient, answerServiceClient, logger)
-	stanceServiceClient := ioc.InitStanceClient(client)
-	commentServiceClient := ioc.InitCommentClient(client)
-	evaluationHandler := evaluation.NewEvaluationHandler(evaluationServiceClient, tagServiceClient, stanceServiceClient, commentServiceClient)
-	commentHandler := web.NewCommentHandler(commentServiceClient)
-	searchServiceClient := ioc.InitSearchClient(client)
-	searchHandler := search.NewSearchHandler(searchServiceClient, tagServiceClient, evaluationServiceClient)
-	saramaClient := ioc.InitKafka()
-	producer := ioc.InitProducer(saramaClient)
+	config := cfg.Etcd
+	client := ioc.InitEtcdClient(config)
+	dynConfConfig := cfg.DynConf
+	manager := ioc.InitDynConf(logger, client, dynConfConfig)
+	redisConfig := cfg.Redis
+	redisClient := ioc.InitRedis(redisConfig)
+	jwtConfig := cfg.Jwt
+	handler := ioc.InitJwtHandler(redisClient, jwtConfig)
+	grpcConfig := cfg.Grpc
+	userServiceClient := ioc.InitUserClient(client, grpcConfig)
+	ccnuServiceClient := ioc.InitCCNUClient(client, manager, grpcConfig)
+	gradeServiceClient := ioc.InitGradeClient(client, grpcConfig)
+	pointServiceClient := ioc.InitPointClient(client, grpcConfig)
+	userSettingsStore := cache.NewRedisUserSettings(redisClient)
+	kafkaConfig := cfg.Kafka
+	saramaClient := ioc.InitKafka(kafkaConfig)
+	producer := ioc.InitProducer(saramaClient, logger)
+	userHandler := web.NewUserHandler(handler, userServiceClient, ccnuServiceClient, gradeServiceClient, pointServiceClient, userSettingsStore, producer, logger)
+	courseServiceClient := ioc.InitCourseClient(client, grpcConfig)
+	evaluationServiceClient := ioc.InitEvaluationClient(client, grpcConfig)
+	tagServiceClient := ioc.InitTagClient(client, grpcConfig)
+	collectServiceClient := ioc.InitCollectClient(client, grpcConfig)
+	cacheConfig := cfg.Cache
+	courseCache := ioc.InitCourseCache(redisClient, courseServiceClient, evaluationServiceClient, tagServiceClient, cacheConfig)
+	httpConfig := cfg.HTTP
+	pager := ioc.InitPager(httpConfig)
+	courseHandler := web.NewCourseHandler(handler, courseServiceClient, evaluationServiceClient, userServiceClient, tagServiceClient, logger, collectServiceClient, courseCache, pager)
+	questionServiceClient := ioc.InitQuestionClient(client, grpcConfig)
+	answerServiceClient := ioc.InitAnswerClient(client, grpcConfig)
+	questionHandler := web.NewQuestionHandler(questionServiceClient, userServiceClient, userSettingsStore, answerServiceClient, producer, pager, logger)
+	stanceServiceClient := ioc.InitStanceClient(client, grpcConfig)
+	commentServiceClient := ioc.InitCommentClient(client, grpcConfig)
+	evaluationHandler := evaluation.NewEvaluationHandler(evaluationServiceClient, tagServiceClient, stanceServiceClient, commentServiceClient, courseCache, producer, pager, logger)
+	commentHandler := web.NewCommentHandler(commentServiceClient, producer, pager, logger)
+	searchServiceClient := ioc.InitSearchClient(client, grpcConfig)
+	searchHandler := search.NewSearchHandler(searchServiceClient, courseCache)
 	gradeHandler := web.NewGradeHandler(gradeServiceClient, ccnuServiceClient, producer, handler)
-	staticServiceClient := ioc.InitStaticClient(client)
-	staticHandler := ioc.InitStaticHandler(staticServiceClient)
-	answerHandler := web.NewAnswerHandler(answerServiceClient, courseServiceClient, questionServiceClient, commentServiceClient, stanceServiceClient)
+	staticServiceClient := ioc.InitStaticClient(client, grpcConfig)
+	value := ioc.InitAdministrators(manager)
+	staticHandler := ioc.InitStaticHandler(staticServiceClient, value)
+	answerHandler := web.NewAnswerHandler(answerServiceClient, courseServiceClient, questionServiceClient, commentServiceClient, stanceServiceClient, producer, pager, logger)
 	pointHandler := web.NewPointHandler(pointServiceClient)
-	feedServiceClient := ioc.InitFeedClient(client)
-	feedHandler := web.NewFeedHandler(feedServiceClient)
-	putPolicy := ioc.InitPutPolicy()
-	credentials := ioc.InitMac()
-	tubeHandler := ioc.InitTubeHandler(putPolicy, credentials)
-	server := ioc.InitGinServer(logger, handler, userHandler, courseHandler, questionHandler, evaluationHandler, commentHandler, searchHandler, gradeHandler, staticHandler, answerHandler, pointHandler, feedHandler, tubeHandler)
-	return server
+	feedServiceClient := ioc.InitFeedClient(client, grpcConfig)
+	broker := ioc.InitBroker(redisClient)
+	hub := ioc.InitFeedHub(broker, logger)
+	feedReadState := cache.NewRedisFeedReadState(redisClient)
+	feedPresentConfig := cfg.Feed
+	feedPresenter := ioc.InitFeedPresenter(userServiceClient, userSettingsStore, evaluationServiceClient, questionServiceClient, answerServiceClient, commentServiceClient, courseCache, feedPresentConfig)
+	flags := feature.NewFlags(manager)
+	feedHandler := ioc.InitFeedHandler(feedServiceClient, feedReadState, userSettingsStore, feedPresenter, hub, pager, flags, logger, httpConfig)
+	ossConfig := cfg.Oss
+	putPolicy := ioc.InitPutPolicy(ossConfig)
+	credentials := ioc.InitMac(ossConfig)
+	tubeHandler := ioc.InitTubeHandler(putPolicy, credentials, ossConfig)
+	builder := maintenance.NewBuilder(manager)
+	config2 := cfg.Webhook
+	store := webhook.NewRedisStore(redisClient, config2)
+	dispatcher := ioc.InitWebhookDispatcher(store, config2, logger)
+	adminHandler := web.NewAdminHandler(flags, builder, store, dispatcher, value, pager)
+	batchHandler := ioc.InitBatchHandler(httpConfig)
+	graphQLHandler := ioc.InitGraphQLHandler(userServiceClient, evaluationServiceClient, questionServiceClient, answerServiceClient, commentServiceClient, stanceServiceClient, tagServiceClient, courseCache, userSettingsStore, pager, logger, httpConfig)
+	emailConfig := cfg.Email
+	emailVerification := ioc.InitEmailVerification(redisClient, emailConfig)
+	sender := ioc.InitEmailSender(emailConfig)
+	emailHandler := ioc.InitEmailHandler(userServiceClient, userSettingsStore, emailVerification, sender, emailConfig)
+	recoveryBuilder := ioc.InitRecovery(logger)
+	aggregationConfig := cfg.Aggregation
+	server := ioc.InitGinServer(logger, manager, redisClient, builder, recoveryBuilder, handler, userHandler, courseHandler, questionHandler, evaluationHandler, commentHandler, searchHandler, gradeHandler, staticHandler, answerHandler, pointHandler, feedHandler, tubeHandler, adminHandler, batchHandler, graphQLHandler, emailHandler, httpConfig, aggregationConfig)
+	adminConfig := cfg.Admin
+	diagServer := ioc.InitAdminServer(handler, value, manager, recoveryBuilder, server, adminConfig)
+	digest := ioc.InitDigestJob(feedServiceClient, userServiceClient, userSettingsStore, feedPresenter, sender, redisClient, logger, emailConfig)
+	v := ioc.InitSubscriptions(dispatcher, hub)
+	v2 := ioc.InitConsumers(saramaClient, kafkaConfig, v, logger)
+	app := &App{
+		server:    server,
+		admin:     diagServer,
+		digest:    digest,
+		webhooks:  dispatcher,
+		feedHub:   hub,
+		consumers: v2,
+	}
+	return app
+}
+
+func InitStandaloneApp(cfg *ioc.Config) *App {
+	logger := ioc.InitLogger()
+	manager := ioc.InitStandaloneDynConf(logger)
+	fakesRedis := fakes.NewRedis()
+	jwtConfig := cfg.Jwt
+	handler := ioc.InitJwtHandler(fakesRedis, jwtConfig)
+	userService := fakes.NewUserService()
+	ccnuService := fakes.NewCCNUService()
+	gradeService := fakes.NewGradeService()
+	pointService := fakes.NewPointService()
+	userSettingsStore := cache.NewRedisUserSettings(fakesRedis)
+	config := cfg.Webhook
+	store := webhook.NewRedisStore(fakesRedis, config)
+	dispatcher := ioc.InitWebhookDispatcher(store, config, logger)
+	broker := fakes.NewBroker()
+	hub := ioc.InitFeedHub(broker, logger)
+	v := ioc.InitSubscriptions(dispatcher, hub)
+	producer := fakes.NewProducer(logger, v)
+	userHandler := web.NewUserHandler(handler, userService, ccnuService, gradeService, pointService, userSettingsStore, producer, logger)
+	courseService := fakes.NewCourseService()
+	evaluationService := fakes.NewEvaluationService(courseService)
+	tagService := fakes.NewTagService()
+	collectService := fakes.NewCollectService()
+	cacheConfig := cfg.Cache
+	courseCache := ioc.InitCourseCache(fakesRedis, courseService, evaluationService, tagService, cacheConfig)
+	httpConfig := cfg.HTTP
+	pager := ioc.InitPager(httpConfig)
+	courseHandler := web.NewCourseHandler(handler, courseService, evaluationService, userService, tagService, logger, collectService, courseCache, pager)
+	questionService := fakes.NewQuestionService(userService)
+	answerService := fakes.NewAnswerService()
+	questionHandler := web.NewQuestionHandler(questionService, userService, userSettingsStore, answerService, producer, pager, logger)
+	stanceService := fakes.NewStanceService()
+	commentService := fakes.NewCommentService()
+	evaluationHandler := evaluation.NewEvaluationHandler(evaluationService, tagService, stanceService, commentService, courseCache, producer, pager, logger)
+	commentHandler := web.NewCommentHandler(commentService, producer, pager, logger)
+	searchService := fakes.NewSearchService(courseService, evaluationService, collectService)
+	searchHandler := search.NewSearchHandler(searchService, courseCache)
+	gradeHandler := web.NewGradeHandler(gradeService, ccnuService, producer, handler)
+	staticService := fakes.NewStaticService()
+	value := ioc.InitAdministrators(manager)
+	staticHandler := ioc.InitStaticHandler(staticService, value)
+	answerHandler := web.NewAnswerHandler(answerService, courseService, questionService, commentService, stanceService, producer, pager, logger)
+	pointHandler := web.NewPointHandler(pointService)
+	feedService := fakes.NewFeedService(producer)
+	feedReadState := cache.NewRedisFeedReadState(fakesRedis)
+	feedPresentConfig := cfg.Feed
+	feedPresenter := ioc.InitFeedPresenter(userService, userSettingsStore, evaluationService, questionService, answerService, commentService, courseCache, feedPresentConfig)
+	flags := feature.NewFlags(manager)
+	feedHandler := ioc.InitFeedHandler(feedService, feedReadState, userSettingsStore, feedPresenter, hub, pager, flags, logger, httpConfig)
+	ossConfig := cfg.Oss
+	putPolicy := ioc.InitPutPolicy(ossConfig)
+	credentials := ioc.InitMac(ossConfig)
+	tubeHandler := ioc.InitTubeHandler(putPolicy, credentials, ossConfig)
+	builder := maintenance.NewBuilder(manager)
+	adminHandler := web.NewAdminHandler(flags, builder, store, dispatcher, value, pager)
+	batchHandler := ioc.InitBatchHandler(httpConfig)
+	graphQLHandler := ioc.InitGraphQLHandler(userService, evaluationService, questionService, answerService, commentService, stanceService, tagService, courseCache, userSettingsStore, pager, logger, httpConfig)
+	emailConfig := cfg.Email
+	emailVerification := ioc.InitEmailVerification(fakesRedis, emailConfig)
+	emailSender := fakes.NewEmailSender(logger)
+	emailHandler := ioc.InitEmailHandler(userService, userSettingsStore, emailVerification, emailSender, emailConfig)
+	recoveryBuilder := ioc.InitRecovery(logger)
+	aggregationConfig := cfg.Aggregation
+	server := ioc.InitGinServer(logger, manager, fakesRedis, builder, recoveryBuilder, handler, userHandler, courseHandler, questionHandler, evaluationHandler, commentHandler, searchHandler, gradeHandler, staticHandler, answerHandler, pointHandler, feedHandler, tubeHandler, adminHandler, batchHandler, graphQLHandler, emailHandler, httpConfig, aggregationConfig)
+	adminConfig := cfg.Admin
+	diagServer := ioc.InitAdminServer(handler, value, manager, recoveryBuilder, server, adminConfig)
+	digest := ioc.InitDigestJob(feedService, userService, userSettingsStore, feedPresenter, emailSender, fakesRedis, logger, emailConfig)
+	v2 := ioc.InitStandaloneConsumers()
+	app := &App{
+		server:    server,
+		admin:     diagServer,
+		digest:    digest,
+		webhooks:  dispatcher,
+		feedHub:   hub,
+		consumers: v2,
+	}
+	return app
 }